@@ -21,12 +21,12 @@ type CsvModule struct{}
 //    header=YES|NO              First row of CSV defines the names of
 //                               columns if "yes".  Default "no".
 func (c *CsvModule) Connect(_ *sqlite.Conn, args []string, declare func(string) error) (_ sqlite.VirtualTable, err error) {
-	args = args[2:]
+	var options = sqlite.ParseCreationArgs(args).Options
 	var table = &CsvVirtualTable{}
 	var readHeader = false
 
-	for i := range args {
-		s := strings.SplitN(args[i], "=", 2)
+	for i := range options {
+		s := strings.SplitN(options[i], "=", 2)
 		fmt.Println(s)
 		switch s[0] {
 		case "file":
@@ -14,6 +14,7 @@ type X struct{}
 
 func (m *X) Args() int           { return 1 }
 func (m *X) Deterministic() bool { return true }
+func (m *X) SubTypes() (bool, bool) { return false, true }
 func (m *X) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
 	ctx.ResultText(values[0].Text())
 	ctx.ResultSubType(magic)
@@ -25,6 +26,7 @@ type IsX struct{}
 
 func (m *IsX) Args() int           { return 1 }
 func (m *IsX) Deterministic() bool { return true }
+func (m *IsX) SubTypes() (bool, bool) { return true, false }
 func (m *IsX) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
 	st := values[0].SubType()
 	if st == magic { 
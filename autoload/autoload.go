@@ -0,0 +1,105 @@
+//go:build static
+// +build static
+
+// Package autoload provides support to automatically load registered extensions with
+// every new database connection, using sqlite3_auto_extension.
+//
+// It is meant for programs that statically link the extension together with the sqlite3 library
+// (see docs/STATIC_LINKING.md) and must be built with the static build tag.
+package autoload
+
+// #cgo CFLAGS: -DSQLITE_CORE
+//
+// #include <stdlib.h>
+// #include "../sqlite3.h"
+//
+// // initializes the named extension; defined in the archive from go.riyazali.net/sqlite
+// extern int go_sqlite3_extension_init_named(const char*, sqlite3*, char**, const sqlite3_api_routines*);
+//
+// extern int autoload_init_tramp(sqlite3*, char**, sqlite3_api_routines*);
+//
+// static int _register_autoload() { return sqlite3_auto_extension((void(*)(void)) autoload_init_tramp); }
+// static int _cancel_autoload() { return sqlite3_cancel_auto_extension((void(*)(void)) autoload_init_tramp); }
+import "C"
+
+import (
+	"go.riyazali.net/sqlite"
+	"sync"
+	"unsafe"
+)
+
+var ( // protected list of names of extensions that are loaded automatically
+	namesLock sync.RWMutex
+	names     []string
+)
+
+// AutoLoad arranges for the extension registered under the default name
+// to be loaded automatically with every new database connection.
+func AutoLoad() error { return AutoLoadNamed("default") }
+
+// AutoLoadNamed arranges for the extension registered under the given name to be loaded automatically
+// with every new database connection. Extensions are loaded in the order in which they were added.
+// Adding the same name more than once has no effect.
+//
+// The extension needn't be registered at the time of the call, but it must be registered
+// before a new connection is opened, else opening the connection fails.
+func AutoLoadNamed(name string) error {
+	namesLock.Lock()
+	defer namesLock.Unlock()
+
+	for _, n := range names {
+		if n == name {
+			return nil
+		}
+	}
+
+	if len(names) == 0 {
+		// sqlite3_auto_extension is a no-op if the entrypoint is already registered
+		if err := errorIfNotOk(C._register_autoload()); err != nil {
+			return err
+		}
+	}
+
+	names = append(names, name)
+	return nil
+}
+
+// Reset stops automatically loading any extension with new connections.
+// Connections that are already open are not affected.
+func Reset() {
+	namesLock.Lock()
+	defer namesLock.Unlock()
+
+	C._cancel_autoload()
+	names = nil
+}
+
+//export autoload_init_tramp
+func autoload_init_tramp(db *C.sqlite3, pzErrMsg **C.char, pApi *C.sqlite3_api_routines) C.int {
+	namesLock.RLock()
+	var list = append([]string(nil), names...)
+	namesLock.RUnlock()
+
+	for _, name := range list {
+		var cname = C.CString(name)
+		var res = C.go_sqlite3_extension_init_named(cname, db, pzErrMsg, pApi)
+		C.free(unsafe.Pointer(cname))
+
+		// auto extensions are treated as failed unless they return SQLITE_OK
+		if res == C.SQLITE_OK_LOAD_PERMANENTLY {
+			res = C.SQLITE_OK
+		}
+
+		if res != C.SQLITE_OK {
+			return res
+		}
+	}
+	return C.SQLITE_OK
+}
+
+func errorIfNotOk(res C.int) error {
+	if res != C.SQLITE_OK {
+		return sqlite.ErrorCode(res)
+	}
+	return nil
+}
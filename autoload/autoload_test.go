@@ -0,0 +1,35 @@
+//go:build static
+// +build static
+
+package autoload_test
+
+import (
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+	"go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/autoload"
+	"go.riyazali.net/sqlite/internal/testing/fixture"
+	"testing"
+)
+
+func TestAutoLoadNamed(t *testing.T) {
+	fixture.Register("autoload")
+	defer sqlite.Unregister("autoload")
+
+	if err := autoload.AutoLoadNamed("autoload"); err != nil {
+		t.Fatal(err)
+	}
+	defer autoload.Reset()
+
+	var db, err = sql.Open("sqlite3", "file:testing.db?mode=memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var result string
+	if err = db.QueryRow(fixture.Query).Scan(&result); err != nil {
+		t.Fatal(err)
+	}
+	fixture.Check(t, result)
+}
@@ -37,6 +37,24 @@ int _sqlite3_finalize(sqlite3_stmt* stmt){ return sqlite3_finalize(stmt); }
 
 // stepping / executing a prepared statement
 int _sqlite3_step(sqlite3_stmt *stmt){ return sqlite3_step(stmt); }
+int _sqlite3_exec(sqlite3 *db, const char *sql, int *failed){
+  // like sqlite3_exec(db, sql, 0, 0, 0) but also reports the offset of the statement that failed, if any
+  const char *next = sql;
+  while (*next) {
+    sqlite3_stmt *stmt = 0;
+    const char *start = next;
+    int rc = sqlite3_prepare_v2(db, start, -1, &stmt, &next);
+    if (rc == SQLITE_OK && stmt) {
+      while ((rc = sqlite3_step(stmt)) == SQLITE_ROW) {}
+      rc = sqlite3_finalize(stmt);
+    }
+    if (rc != SQLITE_OK) {
+      *failed = (int)(start - sql);
+      return rc;
+    }
+  }
+  return SQLITE_OK;
+}
 int _sqlite3_reset(sqlite3_stmt *stmt){ return sqlite3_reset(stmt); }
 int _sqlite3_clear_bindings(sqlite3_stmt *stmt){ return sqlite3_clear_bindings(stmt); }
 int _sqlite3_data_count(sqlite3_stmt *stmt){ return sqlite3_data_count(stmt); }
@@ -45,11 +63,13 @@ sqlite3* _sqlite3_db_handle(sqlite3_stmt* stmt){ return sqlite3_db_handle(stmt);
 
 // binding values to prepared statement
 int _sqlite3_bind_blob(sqlite3_stmt *stmt, int i, const void *val, int n, void (*destructor)(void *)){ return sqlite3_bind_blob(stmt, i, val, n, destructor); }
+int _sqlite3_bind_blob64(sqlite3_stmt *stmt, int i, const void *val, sqlite3_uint64 n, void (*destructor)(void *)){ return sqlite3_bind_blob64(stmt, i, val, n, destructor); }
 int _sqlite3_bind_double(sqlite3_stmt *stmt, int i, double val){ return sqlite3_bind_double(stmt, i, val); }
 int _sqlite3_bind_int(sqlite3_stmt *stmt, int i, int val){ return sqlite3_bind_int(stmt, i, val); }
 int _sqlite3_bind_int64(sqlite3_stmt *stmt, int i, sqlite_int64 val){ return sqlite3_bind_int64(stmt, i, val); }
 int _sqlite3_bind_null(sqlite3_stmt *stmt, int i){ return sqlite3_bind_null(stmt, i); }
 int _sqlite3_bind_text(sqlite3_stmt *stmt, int i, const char *val, int n, void (*destructor)(void *)){ return sqlite3_bind_text(stmt, i, val, n, destructor); }
+int _sqlite3_bind_text64(sqlite3_stmt *stmt, int i, const char *val, sqlite3_uint64 n, void (*destructor)(void *)){ return sqlite3_bind_text64(stmt, i, val, n, destructor, SQLITE_UTF8); }
 int _sqlite3_bind_pointer(sqlite3_stmt *stmt, int i, void *val, const char *type, void (*destructor)(void *)){ return sqlite3_bind_pointer(stmt, i, val, type, destructor); }
 int _sqlite3_bind_value(sqlite3_stmt *stmt, int i, const sqlite3_value *val){ return sqlite3_bind_value(stmt, i, val); }
 int _sqlite3_bind_zeroblob(sqlite3_stmt *stmt, int i, int sz){ return sqlite3_bind_zeroblob(stmt, i, sz); }
@@ -74,10 +94,37 @@ int _sqlite3_column_type(sqlite3_stmt* stmt, int i){ return sqlite3_column_type(
 const char* _sqlite3_column_database_name(sqlite3_stmt *stmt, int i){ return sqlite3_column_database_name(stmt, i); }
 const char* _sqlite3_column_table_name(sqlite3_stmt *stmt, int i){ return sqlite3_column_table_name(stmt, i); }
 const char* _sqlite3_column_origin_name(sqlite3_stmt *stmt, int i){ return sqlite3_column_origin_name(stmt, i); }
+const char* _sqlite3_column_decltype(sqlite3_stmt *stmt, int i){ return sqlite3_column_decltype(stmt, i); }
+int _sqlite3_table_column_metadata(sqlite3 *db, const char *schema, const char *table, const char *column, int *notNull, int *primaryKey, int *autoinc) {
+  return sqlite3_table_column_metadata(db, schema, table, column, 0, 0, notNull, primaryKey, autoinc);
+}
 
 // meta-information about the statement itself
 int _sqlite3_stmt_readonly(sqlite3_stmt* pStmt) { return sqlite3_stmt_readonly(pStmt); }
 
+// sqlite3_stmt_scanstatus_v2 is only available since 3.42.0, in libraries compiled with SQLITE_ENABLE_STMT_SCANSTATUS,
+// and isn't declared by the bundled headers nor part of sqlite3_api_routines; when statically linked, a weak reference
+// allows linking regardless, and when loaded as an extension, the estimates aren't available.
+// It reports the id of the EXPLAIN QUERY PLAN step of the idx-th scan, and for loops, the estimated number of rows.
+#if defined(SQLITE_CORE) && !defined(_WIN32)
+int sqlite3_stmt_scanstatus_v2(sqlite3_stmt *, int, int, int, void *);
+#pragma weak sqlite3_stmt_scanstatus_v2
+int _sqlite3_stmt_scanstatus_est(sqlite3_stmt *stmt, int idx, int *id, double *est) {
+  const int complex = 0x0001; // SQLITE_SCANSTAT_COMPLEX
+  sqlite3_int64 loops = -1;
+  if (!sqlite3_stmt_scanstatus_v2 || sqlite3_stmt_scanstatus_v2(stmt, idx, SQLITE_SCANSTAT_SELECTID, complex, id)) {
+    return 1;
+  }
+  sqlite3_stmt_scanstatus_v2(stmt, idx, SQLITE_SCANSTAT_NLOOP, complex, &loops);
+  if (loops < 0 || sqlite3_stmt_scanstatus_v2(stmt, idx, SQLITE_SCANSTAT_EST, complex, est)) {
+    *est = -1; // not a loop
+  }
+  return 0;
+}
+#else
+int _sqlite3_stmt_scanstatus_est(sqlite3_stmt *stmt, int idx, int *id, double *est) { return 1; }
+#endif
+
 // routines to extract value from sqlite3_value type; see: https://sqlite.org/c3ref/value.html
 //-----------------------------
 
@@ -104,10 +151,23 @@ int _sqlite3_create_window_function(sqlite3 *db, const char *zName, int nArgs, i
 void* _sqlite3_malloc(int sz){ return sqlite3_malloc(sz); }
 void* _sqlite3_realloc(void *p, int sz){ return sqlite3_realloc(p, sz); }
 void  _sqlite3_free(void *p){ sqlite3_free(p); }
+int _sqlite3_db_release_memory(sqlite3 *db){ return sqlite3_db_release_memory(db); }
+int _sqlite3_wal_autocheckpoint(sqlite3 *db, int n){ return sqlite3_wal_autocheckpoint(db, n); }
+int _sqlite3_db_cacheflush(sqlite3 *db){ return sqlite3_db_cacheflush(db); }
 
 // error details handler
 int _sqlite3_errcode(sqlite3 *db){ return sqlite3_errcode(db); }
 const char *_sqlite3_errmsg(sqlite3 *db){ return sqlite3_errmsg(db); }
+int _sqlite3_extended_errcode(sqlite3 *db){ return sqlite3_extended_errcode(db); }
+
+// sqlite3_error_offset is only available since 3.38.0; when statically linked against an older library,
+// a weak reference allows linking regardless (and callers check the library's version before calling it)
+#if defined(SQLITE_CORE) && !defined(_WIN32)
+#pragma weak sqlite3_error_offset
+int _sqlite3_error_offset(sqlite3 *db){ return sqlite3_error_offset ? sqlite3_error_offset(db) : -1; }
+#else
+int _sqlite3_error_offset(sqlite3 *db){ return sqlite3_error_offset(db); }
+#endif
 
 // auth+tracing
 int _sqlite3_set_authorizer(sqlite3 *db, int (*xAuth)(void *, int, const char *, const char *, const char *, const char *), void *pUserData){ return sqlite3_set_authorizer(db, xAuth, pUserData); }
@@ -120,8 +180,12 @@ void* _sqlite3_update_hook(sqlite3 *db, void (*xCallback)(void *, int, const cha
 
 // version number information
 sqlite_int64 _sqlite3_last_insert_rowid(sqlite3 *db){ return sqlite3_last_insert_rowid(db); }
+int _sqlite3_changes(sqlite3 *db){ return sqlite3_changes(db); }
+int _sqlite3_total_changes(sqlite3 *db){ return sqlite3_total_changes(db); }
 const char* _sqlite3_libversion(void){ return sqlite3_libversion(); }
 int _sqlite3_libversion_number(void) { return sqlite3_libversion_number(); }
+int _sqlite3_compileoption_used(const char *opt) { return sqlite3_compileoption_used(opt); }
+const char* _sqlite3_compileoption_get(int n) { return sqlite3_compileoption_get(n); }
 
 // Virtual table routines
 int _sqlite3_create_module_v2(sqlite3 *db, const char *name, const sqlite3_module *module, void *pApp, void (*destructor)(void *)){ return sqlite3_create_module_v2(db, name, module, pApp, destructor); }
@@ -129,10 +193,83 @@ int _sqlite3_declare_vtab(sqlite3 *db, const char *sql) { return sqlite3_declare
 const char* _sqlite3_vtab_collation(sqlite3_index_info* in, int i) { return sqlite3_vtab_collation(in, i); }
 int _sqlite3_overload_function(sqlite3 *db, const char *name, int args) { return sqlite3_overload_function(db, name, args); }
 int _sqlite3_vtab_nochange(sqlite3_context* ctx) { return sqlite3_vtab_nochange(ctx); }
+int _sqlite3_vtab_config(sqlite3 *db, int op, int arg) { return sqlite3_vtab_config(db, op, arg); }
+int _sqlite3_vtab_on_conflict(sqlite3 *db) { return sqlite3_vtab_on_conflict(db); }
+
+// VFS routines
+sqlite3_vfs* _sqlite3_vfs_find(const char *name) { return sqlite3_vfs_find(name); }
+int _sqlite3_vfs_register(sqlite3_vfs *vfs, int makeDefault) { return sqlite3_vfs_register(vfs, makeDefault); }
+int _sqlite3_vfs_unregister(sqlite3_vfs *vfs) { return sqlite3_vfs_unregister(vfs); }
+
+// status routines
+int _sqlite3_status64(int op, sqlite3_int64 *current, sqlite3_int64 *highwater, int reset) { return sqlite3_status64(op, current, highwater, reset); }
+int _sqlite3_db_status(sqlite3 *db, int op, int *current, int *highwater, int reset) { return sqlite3_db_status(db, op, current, highwater, reset); }
+sqlite3_int64 _sqlite3_memory_used(void) { return sqlite3_memory_used(); }
+sqlite3_int64 _sqlite3_memory_highwater(int reset) { return sqlite3_memory_highwater(reset); }
+
+// keyword routines
+int _sqlite3_keyword_count(void) { return sqlite3_keyword_count(); }
+int _sqlite3_keyword_name(int i, const char **name, int *n) { return sqlite3_keyword_name(i, name, n); }
+int _sqlite3_keyword_check(const char *name, int n) { return sqlite3_keyword_check(name, n); }
+
+// string matching routines
+int _sqlite3_strglob(const char *pattern, const char *str) { return sqlite3_strglob(pattern, str); }
+int _sqlite3_strlike(const char *pattern, const char *str, unsigned int esc) { return sqlite3_strlike(pattern, str, esc); }
+int _sqlite3_stricmp(const char *a, const char *b) { return sqlite3_stricmp(a, b); }
+
+// formatting routines; sqlite3_mprintf is variadic, and so, we define a helper for each type of argument
+char* _sqlite3_mprintf_text(const char *format, const char *arg) { return sqlite3_mprintf(format, arg); }
+char* _sqlite3_mprintf_int(const char *format, int arg) { return sqlite3_mprintf(format, arg); }
+char* _sqlite3_mprintf_int64(const char *format, sqlite3_int64 arg) { return sqlite3_mprintf(format, arg); }
+char* _sqlite3_mprintf_double(const char *format, double arg) { return sqlite3_mprintf(format, arg); }
+
+// filename and uri routines
+const char* _sqlite3_db_filename(sqlite3 *db, const char *schema) { return sqlite3_db_filename(db, schema); }
+int _sqlite3_db_readonly(sqlite3 *db, const char *schema) { return sqlite3_db_readonly(db, schema); }
+const char* _sqlite3_uri_parameter(const char *filename, const char *key) { return sqlite3_uri_parameter(filename, key); }
+int _sqlite3_uri_boolean(const char *filename, const char *key, int def) { return sqlite3_uri_boolean(filename, key, def); }
+sqlite3_int64 _sqlite3_uri_int64(const char *filename, const char *key, sqlite3_int64 def) { return sqlite3_uri_int64(filename, key, def); }
+const char* _sqlite3_uri_key(const char *filename, int n) { return sqlite3_uri_key(filename, n); }
+const char* _sqlite3_filename_database(const char *filename) { return sqlite3_filename_database(filename); }
+const char* _sqlite3_filename_journal(const char *filename) { return sqlite3_filename_journal(filename); }
+const char* _sqlite3_filename_wal(const char *filename) { return sqlite3_filename_wal(filename); }
+
+// connection routines
+int _sqlite3_open_v2(const char *filename, sqlite3 **db, int flags, const char *vfs){ return sqlite3_open_v2(filename, db, flags, vfs); }
+int _sqlite3_close_v2(sqlite3 *db){ return sqlite3_close_v2(db); }
+
+// statement lookup routines
+sqlite3_stmt *_sqlite3_next_stmt(sqlite3 *db, sqlite3_stmt *stmt){ return sqlite3_next_stmt(db, stmt); }
+int _sqlite3_stmt_busy(sqlite3_stmt *stmt){ return sqlite3_stmt_busy(stmt); }
+const char *_sqlite3_sql(sqlite3_stmt *stmt){ return sqlite3_sql(stmt); }
 
 // miscellaneous routines
+// sqlite3_log is variadic; the message is passed through as-is
+void _sqlite3_log(int code, const char *msg){ sqlite3_log(code, "%s", msg); }
 int _sqlite3_get_autocommit(sqlite3 *db){ return sqlite3_get_autocommit(db); }
 void _sqlite3_interrupt(sqlite3 *db){ sqlite3_interrupt(db); }
+// sqlite3_is_interrupted is only available since 3.41.0, and isn't declared by the bundled headers; when statically
+// linked, a weak reference allows linking against an older library, and when loaded as an extension, the routine is
+// looked up past the ones the headers know of (callers check the library's version before calling it)
+#ifdef SQLITE_CORE
+int sqlite3_is_interrupted(sqlite3 *);
+#ifndef _WIN32
+#pragma weak sqlite3_is_interrupted
+int _sqlite3_is_interrupted(sqlite3 *db){ return sqlite3_is_interrupted ? sqlite3_is_interrupted(db) : 0; }
+#else
+int _sqlite3_is_interrupted(sqlite3 *db){ return sqlite3_is_interrupted(db); }
+#endif
+#else
+struct _sqlite3_api_routines_3_41 {
+  sqlite3_api_routines base;
+  int (*value_encoding)(sqlite3_value *); // 3.40.0
+  int (*is_interrupted)(sqlite3 *);       // 3.41.0
+};
+int _sqlite3_is_interrupted(sqlite3 *db){ return ((const struct _sqlite3_api_routines_3_41 *) sqlite3_api)->is_interrupted(db); }
+#endif
 int _sqlite3_release_memory(int i){ return sqlite3_release_memory(i); }
 int _sqlite3_threadsafe(void){ return sqlite3_threadsafe(); }
-int _sqlite3_limit(sqlite3* db, int id, int val){ return sqlite3_limit(db, id, val); }
\ No newline at end of file
+int _sqlite3_limit(sqlite3* db, int id, int val){ return sqlite3_limit(db, id, val); }
+int _sqlite3_load_extension(sqlite3 *db, const char *file, const char *proc, char **err){ return sqlite3_load_extension(db, file, proc, err); }
+// sqlite3_db_config is variadic; this covers the verbs that take an int and an int* argument
+int _sqlite3_db_config_int(sqlite3 *db, int op, int val, int *out){ return sqlite3_db_config(db, op, val, out); }
\ No newline at end of file
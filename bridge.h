@@ -48,6 +48,7 @@ int _sqlite3_finalize(sqlite3_stmt*);
 
 // stepping / executing a prepared statement
 int _sqlite3_step(sqlite3_stmt *);
+int _sqlite3_exec(sqlite3 *, const char *, int *);
 int _sqlite3_reset(sqlite3_stmt *);
 int _sqlite3_clear_bindings(sqlite3_stmt *);
 int _sqlite3_data_count(sqlite3_stmt *);
@@ -56,11 +57,13 @@ sqlite3* _sqlite3_db_handle(sqlite3_stmt*);
 
 // binding values to prepared statement
 int _sqlite3_bind_blob(sqlite3_stmt *, int, const void *, int, void (*)(void *));
+int _sqlite3_bind_blob64(sqlite3_stmt *, int, const void *, sqlite3_uint64, void (*)(void *));
 int _sqlite3_bind_double(sqlite3_stmt *, int, double);
 int _sqlite3_bind_int(sqlite3_stmt *, int, int);
 int _sqlite3_bind_int64(sqlite3_stmt *, int, sqlite_int64);
 int _sqlite3_bind_null(sqlite3_stmt *, int);
 int _sqlite3_bind_text(sqlite3_stmt *, int, const char *, int, void (*)(void *));
+int _sqlite3_bind_text64(sqlite3_stmt *, int, const char *, sqlite3_uint64, void (*)(void *));
 int _sqlite3_bind_value(sqlite3_stmt *, int, const sqlite3_value *);
 int _sqlite3_bind_zeroblob(sqlite3_stmt *, int, int);
 int _sqlite3_bind_zeroblob64(sqlite3_stmt *, int, sqlite3_uint64);
@@ -87,9 +90,12 @@ int _sqlite3_column_type(sqlite3_stmt*, int);
 const char *_sqlite3_column_database_name(sqlite3_stmt *, int);
 const char *_sqlite3_column_table_name(sqlite3_stmt *, int);
 const char *_sqlite3_column_origin_name(sqlite3_stmt *, int);
+const char *_sqlite3_column_decltype(sqlite3_stmt *, int);
+int _sqlite3_table_column_metadata(sqlite3 *, const char *, const char *, const char *, int *, int *, int *);
 
 // meta-information about the statement itself
 int _sqlite3_stmt_readonly(sqlite3_stmt*);
+int _sqlite3_stmt_scanstatus_est(sqlite3_stmt *, int, int *, double *);
 
 // routines to extract value from sqlite3_value type; see: https://sqlite.org/c3ref/value.html
 //-----------------------------
@@ -117,10 +123,15 @@ int _sqlite3_create_window_function(sqlite3 *, const char *, int, int, void *, v
 void  _sqlite3_free(void *);
 void* _sqlite3_malloc(int);
 void* _sqlite3_realloc(void *, int);
+int _sqlite3_db_release_memory(sqlite3 *);
+int _sqlite3_wal_autocheckpoint(sqlite3 *, int);
+int _sqlite3_db_cacheflush(sqlite3 *);
 
 // error details handler
 int _sqlite3_errcode(sqlite3 *);
 const char *_sqlite3_errmsg(sqlite3 *);
+int _sqlite3_extended_errcode(sqlite3 *);
+int _sqlite3_error_offset(sqlite3 *);
 
 // auth+tracing
 int _sqlite3_set_authorizer(sqlite3 *, int (*)(void *, int, const char *, const char *, const char *, const char *), void *);
@@ -133,8 +144,12 @@ void* _sqlite3_update_hook(sqlite3 *, void (*)(void *, int, const char *, const
 
 // version number information
 sqlite_int64 _sqlite3_last_insert_rowid(sqlite3 *);
+int _sqlite3_changes(sqlite3 *);
+int _sqlite3_total_changes(sqlite3 *);
 const char* _sqlite3_libversion(void);
 int _sqlite3_libversion_number(void);
+int _sqlite3_compileoption_used(const char*);
+const char* _sqlite3_compileoption_get(int);
 
 // Virtual table routines
 int _sqlite3_create_module_v2(sqlite3 *, const char *, const sqlite3_module *, void *, void (*)(void *));
@@ -142,12 +157,65 @@ int _sqlite3_declare_vtab(sqlite3 *, const char *);
 const char* _sqlite3_vtab_collation(sqlite3_index_info*, int);
 int _sqlite3_overload_function(sqlite3*, const char*, int);
 int _sqlite3_vtab_nochange(sqlite3_context*);
+int _sqlite3_vtab_config(sqlite3*, int, int);
+int _sqlite3_vtab_on_conflict(sqlite3*);
+
+// VFS routines
+sqlite3_vfs* _sqlite3_vfs_find(const char *);
+int _sqlite3_vfs_register(sqlite3_vfs *, int);
+int _sqlite3_vfs_unregister(sqlite3_vfs *);
+
+// status routines
+int _sqlite3_status64(int, sqlite3_int64*, sqlite3_int64*, int);
+int _sqlite3_db_status(sqlite3*, int, int*, int*, int);
+sqlite3_int64 _sqlite3_memory_used(void);
+sqlite3_int64 _sqlite3_memory_highwater(int);
+
+// keyword routines
+int _sqlite3_keyword_count(void);
+int _sqlite3_keyword_name(int, const char**, int*);
+int _sqlite3_keyword_check(const char*, int);
+
+// string matching routines
+int _sqlite3_strglob(const char*, const char*);
+int _sqlite3_strlike(const char*, const char*, unsigned int);
+int _sqlite3_stricmp(const char*, const char*);
+
+// formatting routines; sqlite3_mprintf is variadic, and so, we define a helper for each type of argument
+char* _sqlite3_mprintf_text(const char*, const char*);
+char* _sqlite3_mprintf_int(const char*, int);
+char* _sqlite3_mprintf_int64(const char*, sqlite3_int64);
+char* _sqlite3_mprintf_double(const char*, double);
+
+// filename and uri routines
+const char* _sqlite3_db_filename(sqlite3*, const char*);
+int _sqlite3_db_readonly(sqlite3*, const char*);
+const char* _sqlite3_uri_parameter(const char*, const char*);
+int _sqlite3_uri_boolean(const char*, const char*, int);
+sqlite3_int64 _sqlite3_uri_int64(const char*, const char*, sqlite3_int64);
+const char* _sqlite3_uri_key(const char*, int);
+const char* _sqlite3_filename_database(const char*);
+const char* _sqlite3_filename_journal(const char*);
+const char* _sqlite3_filename_wal(const char*);
+
+// connection routines
+int _sqlite3_open_v2(const char *, sqlite3 **, int, const char *);
+int _sqlite3_close_v2(sqlite3 *);
+
+// statement lookup routines
+sqlite3_stmt *_sqlite3_next_stmt(sqlite3 *, sqlite3_stmt *);
+int _sqlite3_stmt_busy(sqlite3_stmt *);
+const char *_sqlite3_sql(sqlite3_stmt *);
 
 // miscellaneous routines
+void _sqlite3_log(int, const char*);
 int _sqlite3_get_autocommit(sqlite3 *);
 void _sqlite3_interrupt(sqlite3 *);
+int _sqlite3_is_interrupted(sqlite3 *);
 int _sqlite3_release_memory(int);
 int _sqlite3_threadsafe(void);
 int _sqlite3_limit(sqlite3*, int, int);
+int _sqlite3_load_extension(sqlite3*, const char*, const char*, char**);
+int _sqlite3_db_config_int(sqlite3*, int, int, int*);
 
 #endif // _BRIDGE_H
\ No newline at end of file
@@ -0,0 +1,248 @@
+//go:build session
+// +build session
+
+package sqlite
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ChangeEvent is a change made to a row of a table, as delivered by a Capture
+type ChangeEvent struct {
+	Table    string
+	Op       ChangeOp
+	Indirect bool // whether the change was made by a trigger or foreign key action
+
+	// PrimaryKey has one entry per column, set to true for the columns that are part of the table's primary key
+	PrimaryKey []bool
+
+	// Old holds the values of the row before the change, for updates and deletes, and New holds its values after the
+	// change, for inserts and updates. Values are int64, float64, string, []byte or nil. For an update, the columns
+	// that weren't modified are nil in both, except for the primary key columns which are always set in Old.
+	Old, New []interface{}
+}
+
+// OverflowPolicy decides what a Capture does with events when its channel is full
+type OverflowPolicy int
+
+const (
+	OverflowBlock OverflowPolicy = iota // wait for the consumer to make room; the default
+	OverflowDrop                        // drop the event, counting it in Capture.Dropped
+	OverflowError                       // stop delivering and fail Flush with ErrCaptureOverflow
+)
+
+// ErrCaptureOverflow is returned by Capture.Flush when its channel is full and the capture is set up with OverflowError.
+// The events that couldn't be delivered are kept and delivered first by the next call to Flush.
+var ErrCaptureOverflow = errors.New("sqlite: change capture buffer is full")
+
+// ErrCaptureClosed is returned by Capture.Flush once the capture is closed
+var ErrCaptureClosed = errors.New("sqlite: change capture is closed")
+
+// CaptureOptions configures a Capture
+type CaptureOptions struct {
+	Tables   []string       // names of tables whose changes are captured; all tables when empty
+	Buffer   int            // capacity of the events channel
+	Overflow OverflowPolicy // what to do with events when the channel is full
+}
+
+// Capture streams the changes made to the tables of a database through a connection as ChangeEvent values on a channel,
+// so that replication or audit extensions can be built without dealing with the session extension themselves.
+//
+// Changes are recorded by a Session and turned into events by Flush, which should be called after every
+// statement (or transaction) made through the connection. Flush does nothing while a transaction is open,
+// so that only committed changes are delivered, and changes are delivered in the order of the tables
+// they were made to, with the net effect of the transaction on every row (see the session extension's docs).
+//
+// Like Session, this requires the build tag "session" and a host sqlite3 library compiled with SQLITE_ENABLE_SESSION
+// and SQLITE_ENABLE_PREUPDATE_HOOK.
+type Capture struct {
+	conn    *Conn
+	schema  string
+	opts    CaptureOptions
+	session *Session
+	events  chan ChangeEvent
+	pending []ChangeEvent // events that couldn't be delivered with OverflowError
+	dropped uint64
+	err     error // set once the capture can't go on, and returned by every later call to Flush
+}
+
+// Capture starts capturing the changes made through the connection to the tables of the given schema (eg. "main").
+// The capture must be closed with Capture.Close before the connection is closed.
+func (conn *Conn) Capture(schema string, opts CaptureOptions) (*Capture, error) {
+	var capture = &Capture{conn: conn, schema: schema, opts: opts, events: make(chan ChangeEvent, opts.Buffer)}
+	if err := capture.startSession(); err != nil {
+		return nil, err
+	}
+	return capture, nil
+}
+
+// Events returns the channel the events are delivered on. It's closed by Capture.Close.
+func (capture *Capture) Events() <-chan ChangeEvent { return capture.events }
+
+// Dropped returns the number of events dropped so far because the channel was full, with OverflowDrop
+func (capture *Capture) Dropped() uint64 { return atomic.LoadUint64(&capture.dropped) }
+
+// Flush delivers the changes recorded since the last call as events on the channel, unless there's a transaction
+// open on the connection, in which case it does nothing. It blocks for as long as the consumer lags behind,
+// when the capture is set up with OverflowBlock. It fails with ErrCaptureClosed once the capture is closed, and
+// with the same error as before once it failed to start recording changes anew; the capture must be closed then.
+func (capture *Capture) Flush() error {
+	if capture.err != nil {
+		return capture.err
+	}
+	if err := capture.deliver(); err != nil {
+		return err
+	}
+
+	if !capture.conn.AutoCommit() || capture.session.IsEmpty() {
+		return nil
+	}
+
+	var changeset, err = capture.session.Changeset()
+	if err != nil {
+		return err
+	}
+	// the session is only discarded once the changes are decoded, so that a failed Flush can be retried
+	var events []ChangeEvent
+	if events, err = changeEvents(changeset); err != nil {
+		return err
+	}
+
+	// changes made while the events are being delivered are recorded by a new session
+	capture.session.Delete()
+	if capture.err = capture.startSession(); capture.err != nil {
+		return capture.err
+	}
+
+	capture.pending = events
+	return capture.deliver()
+}
+
+// Close stops capturing changes and closes the events channel. Changes that weren't flushed are discarded.
+func (capture *Capture) Close() error {
+	if capture.err == ErrCaptureClosed {
+		return nil
+	}
+	if capture.session != nil {
+		capture.session.Delete()
+		capture.session = nil
+	}
+	capture.err = ErrCaptureClosed
+	close(capture.events)
+	return nil
+}
+
+func (capture *Capture) startSession() (err error) {
+	if capture.session, err = capture.conn.CreateSession(capture.schema); err != nil {
+		return err
+	}
+
+	var tables = capture.opts.Tables
+	if len(tables) == 0 {
+		tables = []string{""} // attach all tables
+	}
+	for _, table := range tables {
+		if err = capture.session.Attach(table); err != nil {
+			capture.session.Delete()
+			capture.session = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver sends the pending events on the channel, following the overflow policy
+func (capture *Capture) deliver() error {
+	for len(capture.pending) > 0 {
+		var event = capture.pending[0]
+		switch capture.opts.Overflow {
+		case OverflowDrop:
+			select {
+			case capture.events <- event:
+			default:
+				atomic.AddUint64(&capture.dropped, 1)
+			}
+		case OverflowError:
+			select {
+			case capture.events <- event:
+			default:
+				return ErrCaptureOverflow
+			}
+		default:
+			capture.events <- event
+		}
+		capture.pending = capture.pending[1:]
+	}
+	capture.pending = nil
+	return nil
+}
+
+// changeEvents decodes the changes in the changeset into events
+func changeEvents(changeset []byte) (_ []ChangeEvent, err error) {
+	var iter *ChangesetIterator
+	if iter, err = NewChangesetIterator(changeset); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if e := iter.Finalize(); err == nil {
+			err = e
+		}
+	}()
+
+	var events []ChangeEvent
+	for {
+		if ok, err := iter.Next(); err != nil {
+			return nil, err
+		} else if !ok {
+			return events, nil
+		}
+
+		var event ChangeEvent
+		var columns int
+		if event.Table, columns, event.Op, event.Indirect, err = iter.Operation(); err != nil {
+			return nil, err
+		}
+		if event.PrimaryKey, err = iter.PrimaryKey(); err != nil {
+			return nil, err
+		}
+
+		if event.Op != CHANGE_INSERT {
+			if event.Old, err = changeValues(columns, iter.Old); err != nil {
+				return nil, err
+			}
+		}
+		if event.Op != CHANGE_DELETE {
+			if event.New, err = changeValues(columns, iter.New); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, event)
+	}
+}
+
+// changeValues copies the values of a row's columns, as returned by fn, to Go values
+func changeValues(columns int, fn func(int) (Value, error)) ([]interface{}, error) {
+	var row = make([]interface{}, columns)
+	for i := range row {
+		var value, err = fn(i)
+		if err != nil {
+			return nil, err
+		}
+		if value.IsNil() {
+			continue
+		}
+
+		switch value.Type() {
+		case SQLITE_INTEGER:
+			row[i] = value.Int64()
+		case SQLITE_FLOAT:
+			row[i] = value.Float()
+		case SQLITE_TEXT:
+			row[i] = value.Text()
+		case SQLITE_BLOB:
+			row[i] = value.Blob()
+		}
+	}
+	return row, nil
+}
@@ -0,0 +1,92 @@
+//go:build session
+// +build session
+
+package sqlite_test
+
+import (
+	"fmt"
+	. "go.riyazali.net/sqlite"
+	"reflect"
+	"testing"
+)
+
+func TestCapture(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+
+		if err := c.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT)", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		var capture, err = c.Capture("main", CaptureOptions{Buffer: 1, Overflow: OverflowError})
+		if err != nil {
+			return SQLITE_ERROR, err
+		}
+		defer capture.Close()
+
+		if err = c.Exec("BEGIN", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err = c.Exec("INSERT INTO t VALUES (1, 'a'), (2, 'b')", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		// nothing is delivered while the transaction is open
+		if err = capture.Flush(); err != nil {
+			return SQLITE_ERROR, err
+		} else if n := len(capture.Events()); n != 0 {
+			return SQLITE_ERROR, fmt.Errorf("expected no events got %d", n)
+		}
+
+		if err = c.Exec("COMMIT", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		// the second event doesn't fit in the buffer
+		if err = capture.Flush(); err != ErrCaptureOverflow {
+			return SQLITE_ERROR, fmt.Errorf("expected overflow got %v", err)
+		}
+
+		var event = <-capture.Events()
+		if event.Table != "t" || event.Op != CHANGE_INSERT || !reflect.DeepEqual(event.New, []interface{}{int64(1), "a"}) {
+			return SQLITE_ERROR, fmt.Errorf("unexpected event %+v", event)
+		}
+
+		if err = capture.Flush(); err != nil {
+			return SQLITE_ERROR, err
+		} else if event = <-capture.Events(); event.Op != CHANGE_INSERT || event.New[0] != int64(2) {
+			return SQLITE_ERROR, fmt.Errorf("unexpected event %+v", event)
+		}
+
+		if err = c.Exec("UPDATE t SET name = 'c' WHERE id = 2", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err = capture.Flush(); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		event = <-capture.Events()
+		if event.Op != CHANGE_UPDATE || !reflect.DeepEqual(event.Old, []interface{}{int64(2), "b"}) || event.New[1] != "c" {
+			return SQLITE_ERROR, fmt.Errorf("unexpected event %+v", event)
+		}
+
+		// a closed capture fails to flush, and closing it again does nothing
+		if err = capture.Close(); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err = capture.Flush(); err != ErrCaptureClosed {
+			return SQLITE_ERROR, fmt.Errorf("expected the capture to be closed got %v", err)
+		}
+		if _, ok := <-capture.Events(); ok {
+			return SQLITE_ERROR, fmt.Errorf("expected the events channel to be closed")
+		}
+
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
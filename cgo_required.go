@@ -0,0 +1,11 @@
+//go:build !cgo
+// +build !cgo
+
+package sqlite
+
+// The package is a thin wrapper over sqlite's C api and can only be built with cgo. Targets cgo doesn't support,
+// like js/wasm and wasip1/wasm, can't host a loadable extension either, as neither sqlite3.wasm nor the wasm
+// builds of sqlite embedded by Go hosts can load a separately built extension and hand it the sqlite3_api
+// routines; supporting them would need a bridge of its own, so it's out of scope (see the README).
+// The reference below fails the build with a descriptive error.
+var _ = sqlite_requires_cgo_and_doesnt_support_wasm
@@ -0,0 +1,44 @@
+//go:build sqlcipher
+// +build sqlcipher
+
+package sqlite
+
+// Encryption keys are managed with sqlite3_key_v2 and sqlite3_rekey_v2, which aren't part of sqlite3_api_routines
+// and so are linked directly. The host library must support encryption, like SQLCipher (https://www.zetetic.net/sqlcipher/)
+// or sqlite built with the SQLite Encryption Extension (https://www.sqlite.org/see); else loading the extension fails.
+
+// #cgo CFLAGS: -DSQLITE_HAS_CODEC
+//
+// #include <stdlib.h>
+// #include <sqlite3ext.h>
+//
+// extern int sqlite3_key_v2(sqlite3*, const char*, const void*, int);
+// extern int sqlite3_rekey_v2(sqlite3*, const char*, const void*, int);
+import "C"
+
+import "unsafe"
+
+// Key sets the key used to encrypt and decrypt the given schema (eg. "main" or an attached database).
+// It must be called right after the connection is opened, before the database is read or written.
+// An incorrect key isn't reported by Key; instead, the first read fails with SQLITE_NOTADB.
+func (conn *Conn) Key(schema string, key []byte) error {
+	var cschema = C.CString(schema)
+	defer C.free(unsafe.Pointer(cschema))
+
+	var ckey = C.CBytes(key)
+	defer C.free(ckey)
+
+	return errorIfNotOk(C.sqlite3_key_v2(conn.db, cschema, ckey, C.int(len(key))))
+}
+
+// Rekey re-encrypts the given schema with a new key. The database must have been unlocked with Key first.
+// Depending on the library, an empty key may decrypt the database entirely.
+func (conn *Conn) Rekey(schema string, key []byte) error {
+	var cschema = C.CString(schema)
+	defer C.free(unsafe.Pointer(cschema))
+
+	var ckey = C.CBytes(key)
+	defer C.free(ckey)
+
+	return errorIfNotOk(C.sqlite3_rekey_v2(conn.db, cschema, ckey, C.int(len(key))))
+}
@@ -0,0 +1,62 @@
+//go:build sqlcipher
+// +build sqlcipher
+
+package sqlite_test
+
+import (
+	. "go.riyazali.net/sqlite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openWithKey opens the database at path, unlocking it with the given key
+func openWithKey(path string, key []byte) (*Conn, error) {
+	var conn, err = Open(path, DefaultOpenFlags)
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.Key("main", key); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func TestKey(t *testing.T) {
+	bootstrap(t)
+
+	dir, err := ioutil.TempDir("", "cipher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var path = filepath.Join(dir, "encrypted.db")
+	conn, err := openWithKey(path, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Exec("CREATE TABLE t(v); INSERT INTO t VALUES (1)", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Rekey("main", []byte("another secret")); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+
+	for key, ok := range map[string]bool{"secret": false, "another secret": true} {
+		if conn, err = openWithKey(path, []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+
+		err = conn.Exec("SELECT COUNT(*) FROM t", nil)
+		if ok && err != nil {
+			t.Errorf("expected %q to unlock the database, got %v", key, err)
+		} else if !ok && err == nil {
+			t.Errorf("expected %q not to unlock the database", key)
+		}
+		_ = conn.Close()
+	}
+}
@@ -0,0 +1,168 @@
+// Command mkinit generates the C and Go glue required to expose extensions registered with
+// sqlite.RegisterNamed through custom entry points.
+//
+// sqlite derives the default entry point of a loadable extension from its file name (sqlite3_<name>_init),
+// and sqlite3_load_extension accepts an explicit entry point too. The package itself only exports the generic
+// sqlite3_extension_init which initializes the "default" extension. mkinit emits an entry point for each
+// named registration, so that a single shared object can expose several independently loadable extensions.
+//
+// Usage:
+//
+//	mkinit [-package name] [-o prefix] name[=entrypoint] ...
+//
+// For every name, an entry point called sqlite3_<name>_init (or entrypoint, if given) is generated
+// which initializes the extension registered under name. It is typically invoked using go:generate, as:
+//
+//	//go:generate go run go.riyazali.net/sqlite/cmd/mkinit -package main upper lower=sqlite3_lowercase_init
+//
+// which would write entrypoints.c, entrypoints.go and entrypoints_windows.go in the current directory.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// identifier matches valid C identifiers
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Entrypoint maps an exported C entry point to the name of a registered extension
+type Entrypoint struct {
+	Name   string // name the extension is registered under
+	Symbol string // name of the exported C function
+}
+
+// ParseEntrypoint parses an argument of form name[=entrypoint]
+func ParseEntrypoint(arg string) (*Entrypoint, error) {
+	var name, symbol = arg, ""
+	if i := strings.IndexByte(arg, '='); i >= 0 {
+		name, symbol = arg[:i], arg[i+1:]
+	}
+
+	if !identifier.MatchString(name) {
+		return nil, fmt.Errorf("mkinit: invalid extension name %q", name)
+	}
+
+	if symbol == "" {
+		symbol = "sqlite3_" + strings.ToLower(name) + "_init"
+	} else if !identifier.MatchString(symbol) {
+		return nil, fmt.Errorf("mkinit: invalid entry point %q", symbol)
+	}
+
+	return &Entrypoint{Name: name, Symbol: symbol}, nil
+}
+
+var cTemplate = template.Must(template.New("c").Parse(`// Code generated by mkinit. DO NOT EDIT.
+
+// sqlite3 types are declared opaquely so that the file doesn't depend on sqlite3 headers
+typedef struct sqlite3 sqlite3;
+typedef struct sqlite3_api_routines sqlite3_api_routines;
+
+// defined in go.riyazali.net/sqlite; initializes the extension registered under the given name
+extern int go_sqlite3_extension_init_named(const char*, sqlite3*, char**, const sqlite3_api_routines*);
+
+// on windows, the entry points are exported from go instead (see the _windows.go file)
+#ifndef _WIN32
+{{range .}}
+int {{.Symbol}}(sqlite3* db, char** pzErrMsg, const sqlite3_api_routines *pApi) {
+	return go_sqlite3_extension_init_named("{{.Name}}", db, pzErrMsg, pApi);
+}
+{{end}}
+#endif
+`))
+
+var goTemplate = template.Must(template.New("go").Parse(`// Code generated by mkinit. DO NOT EDIT.
+
+package {{.}}
+
+// cgo must be enabled for the package so that the generated entry points are compiled in.
+
+import "C"
+`))
+
+// on windows, the linker only exports the symbols listed in the module-definition file go generates
+// for //export-ed functions, and so, the entry points must be defined in go
+var windowsTemplate = template.Must(template.New("windows").Parse(`// Code generated by mkinit. DO NOT EDIT.
+
+package {{.Package}}
+
+// #include <stdlib.h>
+//
+// typedef struct sqlite3 sqlite3;
+// typedef struct sqlite3_api_routines sqlite3_api_routines;
+//
+// extern int go_sqlite3_extension_init_named(const char*, sqlite3*, char**, const sqlite3_api_routines*);
+import "C"
+import "unsafe"
+{{range .Entrypoints}}
+//export {{.Symbol}}
+func {{.Symbol}}(db *C.sqlite3, pzErrMsg **C.char, pApi *C.sqlite3_api_routines) C.int {
+	var name = C.CString("{{.Name}}")
+	defer C.free(unsafe.Pointer(name))
+	return C.go_sqlite3_extension_init_named(name, db, pzErrMsg, pApi)
+}
+{{end}}`))
+
+// Generate writes the generated C and Go sources to files named prefix.c and prefix.go,
+// and the Go source of the entry points used on windows to prefix_windows.go
+func Generate(pkg, prefix string, entrypoints []*Entrypoint) error {
+	var write = func(name string, tmpl *template.Template, data interface{}) (err error) {
+		var file *os.File
+		if file, err = os.Create(name); err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := file.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		return tmpl.Execute(file, data)
+	}
+
+	if err := write(prefix+".c", cTemplate, entrypoints); err != nil {
+		return err
+	}
+	if err := write(prefix+".go", goTemplate, pkg); err != nil {
+		return err
+	}
+
+	var data = struct {
+		Package     string
+		Entrypoints []*Entrypoint
+	}{pkg, entrypoints}
+	return write(prefix+"_windows.go", windowsTemplate, data)
+}
+
+func main() {
+	var pkg = flag.String("package", "main", "name of the go package the files are generated for")
+	var prefix = flag.String("o", "entrypoints", "prefix of the generated files")
+	flag.Usage = func() {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "usage: mkinit [-package name] [-o prefix] name[=entrypoint] ...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var entrypoints []*Entrypoint
+	for _, arg := range flag.Args() {
+		var ep, err = ParseEntrypoint(arg)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		entrypoints = append(entrypoints, ep)
+	}
+
+	if err := Generate(*pkg, *prefix, entrypoints); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseEntrypoint(t *testing.T) {
+	var cases = []struct {
+		arg, name, symbol string
+		err               bool
+	}{
+		{arg: "upper", name: "upper", symbol: "sqlite3_upper_init"},
+		{arg: "Upper", name: "Upper", symbol: "sqlite3_upper_init"},
+		{arg: "lower=lower_init", name: "lower", symbol: "lower_init"},
+		{arg: "bad name", err: true},
+		{arg: "name=bad-symbol", err: true},
+		{arg: "=symbol", err: true},
+	}
+
+	for _, c := range cases {
+		var ep, err = ParseEntrypoint(c.arg)
+		if c.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", c.arg)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.arg, err)
+		} else if ep.Name != c.name || ep.Symbol != c.symbol {
+			t.Errorf("%q: got %+v", c.arg, ep)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "mkinit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var prefix = filepath.Join(dir, "entrypoints")
+	if err = Generate("ext", prefix, []*Entrypoint{{Name: "upper", Symbol: "sqlite3_upper_init"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var c, g []byte
+	if c, err = ioutil.ReadFile(prefix + ".c"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(c), `int sqlite3_upper_init(sqlite3* db, char** pzErrMsg, const sqlite3_api_routines *pApi) {`) ||
+		!strings.Contains(string(c), `go_sqlite3_extension_init_named("upper", db, pzErrMsg, pApi)`) {
+		t.Fatalf("unexpected c source:\n%s", c)
+	}
+
+	if g, err = ioutil.ReadFile(prefix + ".go"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(g), "package ext\n") || !strings.Contains(string(g), "\n\nimport \"C\"\n") {
+		t.Fatalf("unexpected go source:\n%s", g)
+	}
+
+	if g, err = ioutil.ReadFile(prefix + "_windows.go"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(g), "package ext\n") || !strings.Contains(string(g), "//export sqlite3_upper_init\n") ||
+		!strings.Contains(string(g), `C.CString("upper")`) {
+		t.Fatalf("unexpected windows source:\n%s", g)
+	}
+}
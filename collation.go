@@ -0,0 +1,94 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import "fmt"
+
+// Collations returns the names of the collations registered with the connection, including sqlite's built-in ones.
+// see: https://www.sqlite.org/pragma.html#pragma_collation_list
+func (conn *Conn) Collations() ([]string, error) {
+	var names []string
+	var err = conn.Exec("PRAGMA collation_list", func(stmt *Stmt) error {
+		if name := stmt.GetText("name"); name != connStateCollation {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names, err
+}
+
+// Collations returns the names of the collations registered with the connection, including sqlite's built-in ones.
+func (ext *ExtensionApi) Collations() ([]string, error) { return ext.conn().Collations() }
+
+// VerifyCollation checks that cmp has the properties sqlite requires of a collation, over every pair and triple
+// of strings in the corpus, and returns an error describing the first violation it finds. A collation that breaks
+// any of them sorts rows inconsistently, and may leave the indexes that use it corrupted.
+//
+// The properties, with A, B and C strings from the corpus, are:
+//   - consistency: cmp(A, B) always returns the same result
+//   - reflexivity: cmp(A, A) == 0
+//   - symmetry: cmp(A, B) == 0 if, and only if, cmp(B, A) == 0, and cmp(A, B) < 0 if, and only if, cmp(B, A) > 0
+//   - transitivity: if cmp(A, B) and cmp(B, C) are both < 0, == 0 or > 0, then so is cmp(A, C),
+//     and if either is 0, cmp(A, C) has the sign of the other
+//
+// As it compares every triple, the corpus is best kept to a few hundred strings, that include the edge cases of
+// the collation (eg. the empty string, different cases, accents, numbers and whitespace).
+// see: https://www.sqlite.org/c3ref/create_collation.html
+func VerifyCollation(cmp func(string, string) int, corpus []string) error {
+	var sign = func(a, b string) int {
+		switch r := cmp(a, b); {
+		case r < 0:
+			return -1
+		case r > 0:
+			return 1
+		}
+		return 0
+	}
+
+	var n = len(corpus)
+	var signs = make([]int, n*n)
+	for i, a := range corpus {
+		if r := sign(a, a); r != 0 {
+			return fmt.Errorf("sqlite: collation isn't reflexive: cmp(%q, %q) = %d", a, a, r)
+		}
+		for j, b := range corpus {
+			var r = sign(a, b)
+			if again := sign(a, b); again != r {
+				return fmt.Errorf("sqlite: collation isn't consistent: cmp(%q, %q) returned %d, then %d", a, b, r, again)
+			}
+			signs[i*n+j] = r
+		}
+	}
+
+	for i, a := range corpus {
+		for j, b := range corpus {
+			if signs[i*n+j] != -signs[j*n+i] {
+				return fmt.Errorf("sqlite: collation isn't symmetric: cmp(%q, %q) = %d but cmp(%q, %q) = %d",
+					a, b, signs[i*n+j], b, a, signs[j*n+i])
+			}
+		}
+	}
+
+	for i, a := range corpus {
+		for j, b := range corpus {
+			var ab = signs[i*n+j]
+			for k, c := range corpus {
+				var bc, expected = signs[j*n+k], 0
+				switch {
+				case ab == bc, bc == 0:
+					expected = ab
+				case ab == 0:
+					expected = bc
+				default:
+					continue // A < B > C (or A > B < C) says nothing about A and C
+				}
+				if signs[i*n+k] != expected {
+					return fmt.Errorf("sqlite: collation isn't transitive: cmp(%q, %q) = %d and cmp(%q, %q) = %d but cmp(%q, %q) = %d",
+						a, b, ab, b, c, bc, a, c, signs[i*n+k])
+				}
+			}
+		}
+	}
+	return nil
+}
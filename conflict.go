@@ -0,0 +1,134 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+import "C"
+
+import (
+	"errors"
+	"strings"
+)
+
+// ConflictMode is the conflict resolution mode of the statement writing to a virtual table,
+// as set by its ON CONFLICT (or OR) clause; see https://www.sqlite.org/lang_conflict.html
+type ConflictMode int
+
+//noinspection GoSnakeCaseUsage
+const (
+	CONFLICT_ROLLBACK = ConflictMode(C.SQLITE_ROLLBACK)
+	CONFLICT_IGNORE   = ConflictMode(C.SQLITE_IGNORE)
+	CONFLICT_FAIL     = ConflictMode(C.SQLITE_FAIL)
+	CONFLICT_ABORT    = ConflictMode(C.SQLITE_ABORT)
+	CONFLICT_REPLACE  = ConflictMode(C.SQLITE_REPLACE)
+)
+
+func (mode ConflictMode) String() string {
+	switch mode {
+	case CONFLICT_ROLLBACK:
+		return "ROLLBACK"
+	case CONFLICT_IGNORE:
+		return "IGNORE"
+	case CONFLICT_FAIL:
+		return "FAIL"
+	case CONFLICT_ABORT:
+		return "ABORT"
+	case CONFLICT_REPLACE:
+		return "REPLACE"
+	}
+	return "UNKNOWN"
+}
+
+// OnConflict returns the conflict resolution mode of the statement that is writing to a virtual table.
+// It must only be called from within the Insert, Update, Replace or Delete methods of a table whose module
+// is registered with ConstraintSupport(true), on the connection passed to the module's Create or Connect.
+//
+// Tables must implement CONFLICT_REPLACE themselves, by overwriting the conflicting row. The other modes
+// are taken care of by sqlite (and this package) once the table returns a ConstraintError.
+func (conn *Conn) OnConflict() ConflictMode {
+	return ConflictMode(C._sqlite3_vtab_on_conflict(conn.db))
+}
+
+// ConstraintError is returned by the methods of a WriteableVirtualTable when a write violates a constraint.
+// Its Code is reported to sqlite, which then resolves the conflict as it would for a native table
+// if the module is registered with ConstraintSupport(true).
+//
+// Use one of the ErrConstraint* errors, naming the columns involved with On:
+//
+//	return 0, sqlite.ErrConstraintUnique.On("users.email")
+//
+// and errors.Is to test for a kind of violation.
+type ConstraintError struct {
+	Code    ErrorCode // extended SQLITE_CONSTRAINT_* code
+	Columns []string  // qualified names of the columns involved, if any
+}
+
+// ConstraintError values for the common kinds of constraints
+var (
+	ErrConstraint           = &ConstraintError{Code: SQLITE_CONSTRAINT}
+	ErrConstraintUnique     = &ConstraintError{Code: SQLITE_CONSTRAINT_UNIQUE}
+	ErrConstraintPrimaryKey = &ConstraintError{Code: SQLITE_CONSTRAINT_PRIMARYKEY}
+	ErrConstraintNotNull    = &ConstraintError{Code: SQLITE_CONSTRAINT_NOTNULL}
+	ErrConstraintCheck      = &ConstraintError{Code: SQLITE_CONSTRAINT_CHECK}
+	ErrConstraintForeignKey = &ConstraintError{Code: SQLITE_CONSTRAINT_FOREIGNKEY}
+	ErrConstraintDatatype   = &ConstraintError{Code: SQLITE_CONSTRAINT_DATATYPE}
+	ErrConstraintRowID      = &ConstraintError{Code: SQLITE_CONSTRAINT_ROWID}
+)
+
+// On returns a copy of the error that names the given columns
+func (e *ConstraintError) On(columns ...string) *ConstraintError {
+	return &ConstraintError{Code: e.Code, Columns: columns}
+}
+
+// Error returns the message sqlite would report for the same violation on a native table,
+// such as "UNIQUE constraint failed: users.email"
+func (e *ConstraintError) Error() string {
+	var kind string
+	switch e.Code {
+	case SQLITE_CONSTRAINT_UNIQUE, SQLITE_CONSTRAINT_PRIMARYKEY, SQLITE_CONSTRAINT_ROWID:
+		kind = "UNIQUE"
+	case SQLITE_CONSTRAINT_NOTNULL:
+		kind = "NOT NULL"
+	case SQLITE_CONSTRAINT_CHECK:
+		kind = "CHECK"
+	case SQLITE_CONSTRAINT_FOREIGNKEY:
+		kind = "FOREIGN KEY"
+	case SQLITE_CONSTRAINT_DATATYPE:
+		kind = "DATATYPE"
+	}
+
+	var msg = strings.TrimSpace(kind + " constraint failed")
+	if len(e.Columns) > 0 {
+		msg += ": " + strings.Join(e.Columns, ", ")
+	}
+	return msg
+}
+
+// Is reports whether target is a ConstraintError with the same code, so that errors.Is(err, ErrConstraintUnique)
+// holds for the errors returned by ErrConstraintUnique.On
+func (e *ConstraintError) Is(target error) bool {
+	var t, ok = target.(*ConstraintError)
+	return ok && t.Code == e.Code
+}
+
+// ConstraintCode returns the extended SQLITE_CONSTRAINT_* code of err, if it wraps a ConstraintError
+// or is a constraint ErrorCode, which is what a virtual table reports to sqlite when returning err
+func ConstraintCode(err error) (ErrorCode, bool) {
+	var ce *ConstraintError
+	if errors.As(err, &ce) {
+		return ce.Code, true
+	}
+
+	var em *errorCodeWithMessage
+	if errors.As(err, &em) && em.code&0xff == SQLITE_CONSTRAINT {
+		return em.code, true
+	}
+
+	var code ErrorCode
+	if errors.As(err, &code) && code&0xff == SQLITE_CONSTRAINT {
+		return code, true
+	}
+	return 0, false
+}
@@ -0,0 +1,112 @@
+package sqlite_test
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	. "go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/vtabutil"
+)
+
+// KeyValueModule is a writeable virtual table module whose tables are key-value stores with unique keys
+type KeyValueModule struct{}
+
+func (m *KeyValueModule) Connect(conn *Conn, _ []string, declare func(string) error) (VirtualTable, error) {
+	var table = &KeyValueTable{conn: conn, values: map[string]string{}}
+	table.Scan = func() (vtabutil.Iterator, error) {
+		var keys = make([]string, 0, len(table.values))
+		for key := range table.values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var rows [][]interface{}
+		for _, key := range keys {
+			rows = append(rows, []interface{}{key, table.values[key]})
+		}
+		return vtabutil.Rows(rows), nil
+	}
+	return table, declare("CREATE TABLE x(key TEXT, value TEXT)")
+}
+
+type KeyValueTable struct {
+	vtabutil.FullScanTable
+	conn   *Conn
+	values map[string]string
+}
+
+func (t *KeyValueTable) Insert(values ...Value) (int64, error) {
+	var key = values[0].Text()
+	if _, exists := t.values[key]; exists && t.conn.OnConflict() != CONFLICT_REPLACE {
+		return 0, ErrConstraintUnique.On("kv.key")
+	}
+	t.values[key] = values[1].Text()
+	return int64(len(t.values)), nil
+}
+
+func (t *KeyValueTable) Update(_ Value, _ ...Value) error     { return SQLITE_READONLY }
+func (t *KeyValueTable) Replace(_, _ Value, _ ...Value) error { return SQLITE_READONLY }
+func (t *KeyValueTable) Delete(_ Value) error                 { return SQLITE_READONLY }
+
+func TestConstraintSupport(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		return SQLITE_OK, api.CreateModule("kv", &KeyValueModule{}, ReadOnly(false), ConstraintSupport(true))
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.Exec("CREATE VIRTUAL TABLE kv USING kv; INSERT INTO kv VALUES ('a', '1')"); err != nil {
+		t.Fatal(err)
+	}
+
+	var value = func() (v string) {
+		if err := db.QueryRow("SELECT value FROM kv WHERE key = 'a'").Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	if _, err = db.Exec("INSERT INTO kv VALUES ('a', '2')"); err == nil || !strings.Contains(err.Error(), "UNIQUE constraint failed: kv.key") {
+		t.Fatalf("expected a unique constraint violation, got %v", err)
+	}
+
+	if _, err = db.Exec("INSERT OR IGNORE INTO kv VALUES ('a', '2')"); err != nil {
+		t.Fatalf("expected the conflict to be ignored, got %v", err)
+	} else if v := value(); v != "1" {
+		t.Fatalf("expected ignored insert to leave value as is, got %q", v)
+	}
+
+	if _, err = db.Exec("INSERT OR REPLACE INTO kv VALUES ('a', '3')"); err != nil {
+		t.Fatalf("expected the conflicting row to be replaced, got %v", err)
+	} else if v := value(); v != "3" {
+		t.Fatalf("expected replaced value, got %q", v)
+	}
+}
+
+func TestConstraintError(t *testing.T) {
+	var err error = fmt.Errorf("insert failed: %w", ErrConstraintNotNull.On("t.a", "t.b"))
+	if !errors.Is(err, ErrConstraintNotNull) || errors.Is(err, ErrConstraintUnique) {
+		t.Fatalf("expected error to match ErrConstraintNotNull only")
+	}
+	if !strings.HasSuffix(err.Error(), "NOT NULL constraint failed: t.a, t.b") {
+		t.Fatalf("unexpected message: %s", err)
+	}
+
+	if code, ok := ConstraintCode(err); !ok || code != SQLITE_CONSTRAINT_NOTNULL {
+		t.Fatalf("expected SQLITE_CONSTRAINT_NOTNULL, got %v", code)
+	}
+	if code, ok := ConstraintCode(SQLITE_CONSTRAINT_CHECK); !ok || code != SQLITE_CONSTRAINT_CHECK {
+		t.Fatalf("expected SQLITE_CONSTRAINT_CHECK, got %v", code)
+	}
+	if _, ok := ConstraintCode(SQLITE_BUSY); ok {
+		t.Fatalf("expected SQLITE_BUSY not to be a constraint violation")
+	}
+}
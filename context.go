@@ -8,9 +8,11 @@ package sqlite
 import "C"
 
 import (
-	"unsafe"
-
+	"errors"
+	"fmt"
 	"github.com/mattn/go-pointer"
+	"sync/atomic"
+	"unsafe"
 )
 
 // see: https://sqlite.org/bindptr.html#pointer_types_are_static_strings
@@ -21,19 +23,61 @@ var pointerType = C.CString("golang")
 // An SQLite context is in no way related to a Go context.Context.
 //
 // adapted from https://github.com/crawshaw/sqlite/blob/ae45c9066f6e7b62bb7b491a0c7c9659f866ce7c/func.go
-type Context struct{ ptr *C.sqlite3_context }
+type Context struct {
+	ptr    *C.sqlite3_context
+	result *ColumnType // if set, records the type of the result; used to validate the columns of strict modules
+	fn     *function   // the function the context belongs to, if it's a function registered with createFunction
+	failed *error      // if set, records the error the function failed with; used to end the span of the call
+}
+
+// record records the type of the result, if asked to
+func (ctx Context) record(typ ColumnType) {
+	if ctx.result != nil {
+		*ctx.result = typ
+	}
+}
 
 func (ctx *Context) GetConnection() *Conn { return wrap(C._sqlite3_context_db_handle(ctx.ptr)) }
-func (ctx Context) ResultInt(v int)       { C._sqlite3_result_int(ctx.ptr, C.int(v)) }
-func (ctx Context) ResultInt64(v int64)   { C._sqlite3_result_int64(ctx.ptr, C.sqlite3_int64(v)) }
-func (ctx Context) ResultFloat(v float64) { C._sqlite3_result_double(ctx.ptr, C.double(v)) }
-func (ctx Context) ResultNull()           { C._sqlite3_result_null(ctx.ptr) }
-func (ctx Context) ResultValue(v Value)   { C._sqlite3_result_value(ctx.ptr, v.ptr) }
+
+// UserData returns the value associated with key on the connection the function is invoked on; see Conn.SetUserData.
+func (ctx *Context) UserData(key interface{}) interface{} { return ctx.GetConnection().UserData(key) }
+
+// Interrupted reports whether the statement that called the function has been interrupted; see Conn.Interrupted.
+// A function that runs for long can check it to abort promptly, eg. with ctx.ResultError(SQLITE_INTERRUPT).
+func (ctx *Context) Interrupted() bool { return ctx.GetConnection().Interrupted() }
+
+func (ctx Context) ResultInt(v int) {
+	ctx.record(SQLITE_INTEGER)
+	C._sqlite3_result_int(ctx.ptr, C.int(v))
+}
+
+func (ctx Context) ResultInt64(v int64) {
+	ctx.record(SQLITE_INTEGER)
+	C._sqlite3_result_int64(ctx.ptr, C.sqlite3_int64(v))
+}
+
+func (ctx Context) ResultFloat(v float64) {
+	ctx.record(SQLITE_FLOAT)
+	C._sqlite3_result_double(ctx.ptr, C.double(v))
+}
+
+func (ctx Context) ResultNull() {
+	ctx.record(SQLITE_NULL)
+	C._sqlite3_result_null(ctx.ptr)
+}
+
+func (ctx Context) ResultValue(v Value) {
+	ctx.record(v.Type())
+	C._sqlite3_result_value(ctx.ptr, v.ptr)
+}
+
 func (ctx Context) ResultZeroBlob(n int64) {
+	ctx.record(SQLITE_BLOB)
 	C._sqlite3_result_zeroblob64(ctx.ptr, C.sqlite3_uint64(n))
 }
 
 func (ctx Context) ResultBlob(v []byte) {
+	ctx.record(SQLITE_BLOB)
 	C._sqlite3_result_blob0(ctx.ptr, C.CBytes(v), C.int(len(v)), (*[0]byte)(C.free))
 }
 
@@ -41,29 +85,120 @@ func (ctx Context) ResultText(v string) {
 	var cv *C.char
 	if len(v) != 0 {
 		cv = C.CString(v)
+		ctx.record(SQLITE_TEXT)
+	} else {
+		ctx.record(SQLITE_NULL) // a NULL text results in NULL
 	}
 	C._sqlite3_result_text0(ctx.ptr, cv, C.int(len(v)), (*[0]byte)(C.free))
 }
 
-func (ctx Context) ResultSubType(v int) {
+// ResultSubType attaches the subtype to the result of the function, which must already be set.
+// Functions must declare that they set subtypes (see FunctionOptions.ResultSubType), as sqlite 3.45.0 and later
+// may otherwise drop the subtype; a missing declaration is reported, once per function, on sqlite's error log.
+func (ctx Context) ResultSubType(v SubType) {
+	if ctx.fn != nil && !ctx.fn.subTyped && atomic.CompareAndSwapInt32(&ctx.fn.warned, 0, 1) {
+		Log(SQLITE_WARNING, fmt.Sprintf("sqlite: function %s sets a result subtype without declaring it "+
+			"with FunctionOptions.ResultSubType", ctx.fn.name))
+	}
 	C._sqlite3_result_subtype(ctx.ptr, C.uint(v))
 }
 
+// ResultError sets the result of the function to err. The error code reported to sqlite is that of the ErrorCode,
+// *QueryError or *ConstraintError err wraps, if any, or SQLITE_ERROR otherwise.
 func (ctx Context) ResultError(err error) {
+	if ctx.failed != nil {
+		*ctx.failed = err
+	}
+	logDebug("sqlite: function returned error", "error", err)
 	if err, ok := err.(ErrorCode); ok {
+		countError(err)
 		C._sqlite3_result_error_code(ctx.ptr, C.int(err))
 		return
 	}
+	var code = SQLITE_ERROR
+	var qe *QueryError
+	var em *errorCodeWithMessage
+	if errors.As(err, &qe) {
+		code = qe.Extended
+	} else if errors.As(err, &em) {
+		code = em.code
+	} else if c, ok := ConstraintCode(err); ok {
+		code = c
+	} else {
+		errors.As(err, &code) // eg. a wrapped ErrorCode, or a *TimeoutError
+	}
+	countError(code)
 	var errstr = err.Error()
 	var cerrstr = C.CString(errstr)
 	defer C.free(unsafe.Pointer(cerrstr))
 	C._sqlite3_result_error(ctx.ptr, cerrstr, C.int(len(errstr)))
+	if code != SQLITE_ERROR {
+		C._sqlite3_result_error_code(ctx.ptr, C.int(code))
+	}
+}
+
+// Result sets the result to v, choosing the ResultX method based on its type: nil results in NULL,
+// integer types in ResultInt64, float types in ResultFloat, bool in 1 or 0, string in ResultText
+// (an empty string results in an empty text rather than NULL), []byte in ResultBlob and Value in ResultValue.
+// It returns an error for any other type.
+func (ctx Context) Result(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		ctx.ResultNull()
+	case bool:
+		if v {
+			ctx.ResultInt(1)
+		} else {
+			ctx.ResultInt(0)
+		}
+	case string:
+		if v == "" {
+			ctx.record(SQLITE_TEXT)
+			C._sqlite3_result_text0(ctx.ptr, C.CString(""), 0, (*[0]byte)(C.free))
+		} else {
+			ctx.ResultText(v)
+		}
+	case []byte:
+		ctx.ResultBlob(v)
+	case Value:
+		ctx.ResultValue(v)
+	case float32, float64:
+		var f, _ = toFloat64(v)
+		ctx.ResultFloat(f)
+	default:
+		var i, ok = toInt64(v)
+		if !ok {
+			return fmt.Errorf("sqlite: unsupported result type %T", v)
+		}
+		ctx.ResultInt64(i)
+	}
+	return nil
 }
 
 func (ctx Context) ResultPointer(val interface{}) {
-	ptr := pointer.Save(val)
+	ctx.record(SQLITE_NULL) // pointers are NULL to sql
+	ptr := saveHandle(handlePointer, val)
 	C._sqlite3_result_pointer(ctx.ptr, ptr, pointerType, (*[0]byte)(C.pointer_destructor_hook_tramp))
 }
 
+// AuxData returns the value associated with the n-th argument of the function by an earlier call to SetAuxData
+// (in the same statement), or nil if there's none.
+func (ctx Context) AuxData(n int) interface{} {
+	var ptr = C._sqlite3_get_auxdata(ctx.ptr, C.int(n))
+	if ptr == nil {
+		return nil
+	}
+	return pointer.Restore(ptr)
+}
+
+// SetAuxData associates val with the n-th argument of the function. sqlite keeps it for later calls of the function
+// in the same statement as long as the argument is a constant, and releases it otherwise, so that functions can
+// cache what they derive from constant arguments, such as a compiled regular expression.
+// see: https://www.sqlite.org/c3ref/get_auxdata.html
+func (ctx Context) SetAuxData(n int, val interface{}) {
+	ptr := saveHandle(handleAuxData, val)
+	C._sqlite3_set_auxdata(ctx.ptr, C.int(n), ptr, (*[0]byte)(C.pointer_destructor_hook_tramp))
+}
+
 //export pointer_destructor_hook_tramp
-func pointer_destructor_hook_tramp(p unsafe.Pointer) { pointer.Unref(p) }
+func pointer_destructor_hook_tramp(p unsafe.Pointer) { unrefHandle(p) }
@@ -0,0 +1,107 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+import "C"
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TimeoutError is returned by Stmt.Step (and so, Conn.Exec) when a statement runs past its deadline and is interrupted;
+// see Stmt.SetDeadline and Conn.SetQueryTimeout. It matches SQLITE_INTERRUPT with errors.Is.
+type TimeoutError struct {
+	SQL      string    // sql that was interrupted
+	Deadline time.Time // deadline the statement ran past
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("sqlite: statement ran past its deadline (%s): %q", e.Deadline.Format(time.RFC3339Nano), e.SQL)
+}
+
+// Unwrap returns SQLITE_INTERRUPT
+func (e *TimeoutError) Unwrap() error { return SQLITE_INTERRUPT }
+
+// Timeout reports true, like the errors of package net do when they're caused by a timeout
+func (e *TimeoutError) Timeout() bool { return true }
+
+// SetQueryTimeout caps the time any statement prepared on the connection takes to run, from its first call to Step
+// until it's done or reset, and so, including the time spent by the caller between the rows. A statement that runs
+// past it is interrupted with sqlite3_interrupt, and Step returns a *TimeoutError. Passing zero disables the timeout,
+// which is the default. It's simpler than threading a context through, for callers that want a wall-clock cap.
+// see: https://www.sqlite.org/c3ref/interrupt.html
+func (conn *Conn) SetQueryTimeout(d time.Duration) { conn.timeout = d }
+
+// SetDeadline sets the time by which the statement must be done, or else it's interrupted and Step returns
+// a *TimeoutError. Unlike Conn.SetQueryTimeout, the deadline is absolute, and so, it applies to every run of the
+// statement until it's changed; the earlier of the two applies if both are set. The zero time clears the deadline.
+func (stmt *Stmt) SetDeadline(t time.Time) { stmt.deadline = t }
+
+// deadlineFor returns the deadline that applies to the next step of the statement, or the zero time if there's none
+func (stmt *Stmt) deadlineFor(now time.Time) time.Time {
+	var deadline = stmt.deadline
+	if stmt.conn.timeout > 0 {
+		if !stmt.lastHasRow { // the statement starts running with this step
+			stmt.started = now
+		}
+		if d := stmt.started.Add(stmt.conn.timeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	return deadline
+}
+
+// Interrupted reports whether the statements running on the connection have been interrupted, eg. because one of
+// them ran past its deadline. Functions and virtual tables that do a lot of work in a single call can check it
+// every now and then, to give up promptly rather than hold up the cancellation until they're done.
+//
+// With a library older than 3.41.0, that lacks sqlite3_is_interrupted, only the interrupts issued by this package
+// (see Stmt.SetDeadline and Conn.SetQueryTimeout) are reported.
+// see: https://www.sqlite.org/c3ref/interrupt.html
+func (conn *Conn) Interrupted() bool {
+	if _, ok := interrupted.Load(conn.db); ok {
+		return true
+	}
+	return C._sqlite3_libversion_number() >= 3041000 && C._sqlite3_is_interrupted(conn.db) != 0
+}
+
+// interrupted holds the connections interrupted by interruptAt, until the call that was interrupted returns
+var interrupted sync.Map // map[*C.sqlite3]struct{}
+
+// interrupter interrupts a call into sqlite once its deadline passes
+type interrupter struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	running bool // whether the call is still running; the timer mustn't interrupt whatever runs after it
+	fired   bool
+}
+
+// interruptAt arms a timer that interrupts the call about to be made on db at deadline. The returned func must be
+// called once the call returns; it reports whether the call was interrupted because of the deadline.
+func interruptAt(db *C.sqlite3, deadline time.Time) (stop func() bool) {
+	var i = &interrupter{running: true}
+	i.timer = time.AfterFunc(time.Until(deadline), func() {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		if i.running {
+			i.fired = true
+			interrupted.Store(db, struct{}{})
+			C._sqlite3_interrupt(db)
+		}
+	})
+
+	return func() bool {
+		i.timer.Stop()
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		i.running = false
+		if i.fired {
+			interrupted.Delete(db)
+		}
+		return i.fired
+	}
+}
@@ -0,0 +1,117 @@
+package sqlite_test
+
+import (
+	"errors"
+	. "go.riyazali.net/sqlite"
+	"testing"
+	"time"
+)
+
+// forever is a query that runs until it's interrupted
+const forever = "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT COUNT(*) FROM c"
+
+func TestDeadline(t *testing.T) {
+	bootstrap(t)
+
+	conn, err := Open("file:deadline.db?mode=memory", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetQueryTimeout(50 * time.Millisecond)
+	var start = time.Now()
+	var timeout *TimeoutError
+	if err = conn.Exec(forever, nil); !errors.As(err, &timeout) || !errors.Is(err, SQLITE_INTERRUPT) {
+		t.Fatalf("expected a timeout got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the query to be interrupted after 50ms, took %s", elapsed)
+	}
+
+	// the connection remains usable once a statement is interrupted
+	if n, err := ResultInt64(conn, "SELECT 42"); err != nil || n != 42 {
+		t.Fatalf("expected 42 got %d (%v)", n, err)
+	}
+
+	// the timeout covers the time spent between the rows too
+	stmt, _, err := conn.Prepare("SELECT 1 UNION ALL SELECT 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Finalize()
+	if _, err = stmt.Step(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err = stmt.Step(); !errors.As(err, &timeout) {
+		t.Fatalf("expected a timeout got %v", err)
+	}
+	if row, err := stmt.Step(); err != nil || !row {
+		t.Fatalf("expected the statement to run again got %v (%v)", row, err)
+	}
+	_ = stmt.Reset()
+
+	// a deadline applies regardless of the connection's timeout
+	conn.SetQueryTimeout(0)
+	stmt.SetDeadline(time.Now().Add(-time.Second))
+	if _, err = stmt.Step(); !errors.As(err, &timeout) {
+		t.Fatalf("expected a timeout got %v", err)
+	}
+	stmt.SetDeadline(time.Time{})
+	if row, err := stmt.Step(); err != nil || !row {
+		t.Fatalf("expected the statement to run once the deadline is cleared got %v (%v)", row, err)
+	}
+
+	long, _, err := conn.Prepare(forever)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer long.Finalize()
+	long.SetDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err = long.Step(); !errors.As(err, &timeout) {
+		t.Fatalf("expected a timeout got %v", err)
+	}
+}
+
+// Spin implements a SPIN() sql function that runs until the statement calling it is interrupted
+type Spin struct{}
+
+func (s *Spin) Args() int           { return 0 }
+func (s *Spin) Deterministic() bool { return false }
+func (s *Spin) Apply(ctx *Context, _ ...Value) {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		if ctx.Interrupted() {
+			ctx.ResultError(SQLITE_INTERRUPT)
+			return
+		}
+	}
+	ctx.ResultText("not interrupted")
+}
+
+func TestInterrupted(t *testing.T) {
+	bootstrap(t)
+
+	conn, err := Open("file:interrupted.db?mode=memory", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err = conn.CreateFunction("spin", &Spin{}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetQueryTimeout(50 * time.Millisecond)
+	var start = time.Now()
+	var timeout *TimeoutError
+	if err = conn.Exec("SELECT spin()", func(stmt *Stmt) error { return nil }); !errors.As(err, &timeout) {
+		t.Fatalf("expected a timeout got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("expected the function to give up once interrupted, took %s", elapsed)
+	}
+	if conn.Interrupted() {
+		t.Fatal("expected the interrupt to be cleared once the statement is done")
+	}
+}
@@ -0,0 +1,284 @@
+// Package driver exposes connections of go.riyazali.net/sqlite as a database/sql/driver implementation, so that
+// code running inside an extension can use the packages built around *sql.DB (eg. query builders, ORMs or
+// migration tools) with the connections it opens with sqlite.Open, or with the connection it was loaded on:
+//
+//	var db = driver.OpenDB(api.Connection())
+//	defer db.Close()
+//
+// Values are mapped from their sqlite datatype to int64, float64, string, []byte or nil, except for the columns
+// declared as DATE, DATETIME or TIMESTAMP, which are read as time.Time when they hold a valid time (see
+// sqlite.Stmt.ColumnTime). Note that an INTEGER in such a column is read as seconds since the unix epoch and
+// a REAL as a julian day, which differs from sqlite's date and time functions, that take any bare number as
+// a julian day unless given 'unixepoch'. A time.Time argument is bound as TEXT, in a format understood by
+// sqlite's date and time functions, and so, is read back the same either way.
+//
+// The deadline of the context a query runs with interrupts the query once it's reached; other cancellations
+// are only noticed between rows. As with the rest of the package, the sqlite3_api routines must be available.
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.riyazali.net/sqlite"
+)
+
+// Driver opens connections with sqlite.Open, using the data source name as the uri and sqlite.DefaultOpenFlags.
+// It isn't registered with database/sql, so as not to clash with other sqlite drivers linked in the same program;
+// use Open, or register it under a name of your choice with sql.Register("name", driver.Driver{}).
+type Driver struct{}
+
+// Open opens a new connection to the database at name
+func (Driver) Open(name string) (driver.Conn, error) {
+	return NewConnector(name, 0).Connect(context.Background())
+}
+
+// OpenConnector returns a Connector for the database at name
+func (Driver) OpenConnector(name string) (driver.Connector, error) { return NewConnector(name, 0), nil }
+
+// Connector opens connections to the database at URI with sqlite.Open
+type Connector struct {
+	URI   string           // uri of the database; see sqlite.Open
+	Flags sqlite.OpenFlags // flags the connections are opened with; sqlite.DefaultOpenFlags if zero
+}
+
+// NewConnector returns a Connector that opens connections to the database at uri with the given flags
+func NewConnector(uri string, flags sqlite.OpenFlags) *Connector {
+	return &Connector{URI: uri, Flags: flags}
+}
+
+// Connect opens a new connection, closed along with the returned driver.Conn
+func (c *Connector) Connect(context.Context) (driver.Conn, error) {
+	var conn, err = sqlite.Open(c.URI, c.Flags)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{conn: conn, owned: true}, nil
+}
+
+// Driver returns the Driver the connector belongs to
+func (c *Connector) Driver() driver.Driver { return Driver{} }
+
+// Open returns a *sql.DB over connections to the database at uri, opened with the given flags.
+// Every connection in the pool is a connection of its own, and so, an in-memory database must be shared
+// (eg. with "file:name?mode=memory&cache=shared") or the pool limited to a single connection.
+func Open(uri string, flags sqlite.OpenFlags) *sql.DB { return sql.OpenDB(NewConnector(uri, flags)) }
+
+// OpenDB returns a *sql.DB over the given connection, eg. the one an extension was loaded on (see
+// sqlite.ExtensionApi.Connection). The pool is limited to that single connection, which isn't closed by
+// sql.DB.Close. The connection mustn't be used directly while the *sql.DB uses it (eg. during a transaction
+// or while iterating over rows).
+func OpenDB(conn *sqlite.Conn) *sql.DB {
+	var db = sql.OpenDB(&wrapped{conn: conn})
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+// wrapped is a driver.Connector over a single existing connection
+type wrapped struct {
+	conn  *sqlite.Conn
+	mu    sync.Mutex
+	inUse bool // whether the connection is held by a driver.Conn
+}
+
+func (w *wrapped) Connect(context.Context) (driver.Conn, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.inUse {
+		return nil, errors.New("driver: connection is already in use")
+	}
+	w.inUse = true
+	return &Conn{conn: w.conn, release: w.release}, nil
+}
+
+func (w *wrapped) Driver() driver.Driver { return Driver{} }
+
+func (w *wrapped) release() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.inUse = false
+}
+
+// Conn is a driver.Conn over an *sqlite.Conn. Use sql.Conn.Raw to reach the underlying connection:
+//
+//	_ = c.Raw(func(c interface{}) error { conn := c.(*driver.Conn).SQLite(); ... })
+type Conn struct {
+	conn    *sqlite.Conn
+	owned   bool   // whether conn is closed along with the Conn
+	release func() // called once the Conn is closed, if set
+}
+
+var (
+	_ driver.ConnBeginTx        = (*Conn)(nil)
+	_ driver.ConnPrepareContext = (*Conn)(nil)
+	_ driver.ExecerContext      = (*Conn)(nil)
+	_ driver.QueryerContext     = (*Conn)(nil)
+	_ driver.SessionResetter    = (*Conn)(nil)
+)
+
+// SQLite returns the underlying connection
+func (c *Conn) SQLite() *sqlite.Conn { return c.conn }
+
+// Prepare prepares query, which must be a single statement
+func (c *Conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext prepares query, which must be a single statement
+func (c *Conn) PrepareContext(_ context.Context, query string) (driver.Stmt, error) {
+	var stmt, err = c.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{conn: c, stmt: stmt}, nil
+}
+
+// prepare prepares query, failing if it isn't a single statement
+func (c *Conn) prepare(query string) (*sqlite.Stmt, error) {
+	var stmt, rest, err = c.conn.PrepareNext(query)
+	if err != nil {
+		return nil, err
+	} else if stmt == nil {
+		return nil, fmt.Errorf("driver: query %q has no statement", query)
+	}
+
+	if strings.TrimSpace(rest) != "" {
+		var next, _, err = c.conn.PrepareNext(rest)
+		if next != nil || err != nil {
+			if next != nil {
+				_ = next.Finalize()
+			}
+			_ = stmt.Finalize()
+			return nil, fmt.Errorf("driver: query %q has more than one statement", query)
+		}
+	}
+	return stmt, nil
+}
+
+// Close closes the underlying connection, if it was opened by the Connector
+func (c *Conn) Close() error {
+	if c.release != nil {
+		c.release()
+		c.release = nil
+	}
+	if c.owned {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// Begin starts a transaction
+func (c *Conn) Begin() (driver.Tx, error) { return c.BeginTx(context.Background(), driver.TxOptions{}) }
+
+// BeginTx starts a transaction. Transactions in sqlite are serializable, and so, the only isolation levels
+// supported are the default one and sql.LevelSerializable. Read-only transactions aren't supported.
+func (c *Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if opts.ReadOnly {
+		return nil, errors.New("driver: read-only transactions aren't supported")
+	}
+	if level := sql.IsolationLevel(opts.Isolation); level != sql.LevelDefault && level != sql.LevelSerializable {
+		return nil, fmt.Errorf("driver: isolation level %s isn't supported", level)
+	}
+
+	if _, err := c.ExecContext(ctx, "BEGIN", nil); err != nil {
+		return nil, err
+	}
+	return &tx{conn: c.conn}, nil
+}
+
+// ExecContext executes every statement in query, binding args to their parameters. Positional arguments are
+// consumed by the statements in turn, each taking as many as it has parameters; named arguments are bound to
+// the parameters with the same name, in any statement.
+func (c *Conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (_ driver.Result, err error) {
+	var script = c.conn.PrepareScript(query)
+	defer func() {
+		if cerr := script.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	var res result
+	var consumed, positional = 0, countPositional(args)
+	for script.Next() {
+		var n int
+		if n, err = bind(script.Stmt(), args, consumed); err != nil {
+			return nil, err
+		}
+		consumed += n
+
+		// arguments left over by the last statement fail the query before it runs; unless it's followed by comments
+		if strings.TrimSpace(script.Rest()) == "" && consumed < positional {
+			break
+		}
+		if err = c.run(ctx, script.Stmt(), &res); err != nil {
+			return nil, err
+		}
+	}
+	if err = script.Err(); err != nil {
+		return nil, err
+	}
+
+	if consumed < positional {
+		return nil, fmt.Errorf("driver: %d arguments given, but the query only has %d parameters", positional, consumed)
+	}
+	return res, nil
+}
+
+// QueryContext executes query, which must be a single statement, binding args to its parameters
+func (c *Conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	var stmt, err = c.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = bind(stmt, args, 0); err != nil {
+		_ = stmt.Finalize()
+		return nil, err
+	}
+	return newRows(ctx, stmt, true), nil
+}
+
+// ResetSession releases the connection from the goroutine it was used by, as database/sql hands it over
+// to other goroutines; see sqlite.SetOwnershipChecks
+func (c *Conn) ResetSession(context.Context) error {
+	c.conn.Disown()
+	return nil
+}
+
+// run steps through stmt, adding its changes to res
+func (c *Conn) run(ctx context.Context, stmt *sqlite.Stmt, res *result) error {
+	setDeadline(ctx, stmt)
+
+	var total = c.conn.TotalChanges()
+	for {
+		if hasRow, err := step(ctx, stmt); err != nil {
+			return err
+		} else if !hasRow {
+			break
+		}
+	}
+
+	if c.conn.TotalChanges() != total {
+		res.rowsAffected += c.conn.Changes()
+	}
+	res.lastInsertID = c.conn.LastInsertRowID()
+	return nil
+}
+
+// tx is a transaction started with Conn.BeginTx
+type tx struct{ conn *sqlite.Conn }
+
+func (tx *tx) Commit() error   { return tx.conn.Exec("COMMIT", nil) }
+func (tx *tx) Rollback() error { return tx.conn.Exec("ROLLBACK", nil) }
+
+// result is the driver.Result of Conn.ExecContext and Stmt.ExecContext
+type result struct{ lastInsertID, rowsAffected int64 }
+
+func (r result) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r result) RowsAffected() (int64, error) { return r.rowsAffected, nil }
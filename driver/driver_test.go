@@ -0,0 +1,240 @@
+//go:build static
+// +build static
+
+package driver_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // links the sqlite3 library
+	"go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/driver"
+)
+
+func TestOpen(t *testing.T) {
+	var db = driver.Open(filepath.Join(t.TempDir(), "driver.db"), 0)
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT, score REAL, data BLOB, at DATETIME); CREATE INDEX t_name ON t (name)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var at = time.Date(2024, 2, 29, 12, 30, 0, 0, time.UTC)
+	if res, err := db.Exec("INSERT INTO t (name, score, data, at) VALUES (?, ?, ?, ?), (:name, NULL, NULL, NULL)", "a", 1.5, []byte{1, 2}, at, sql.Named("name", "b")); err != nil {
+		t.Fatal(err)
+	} else if id, _ := res.LastInsertId(); id != 2 {
+		t.Errorf("expected last insert id 2 got %d", id)
+	} else if n, _ := res.RowsAffected(); n != 2 {
+		t.Errorf("expected 2 rows affected got %d", n)
+	}
+
+	if res, err := db.Exec("SELECT * FROM t"); err != nil {
+		t.Fatal(err)
+	} else if n, _ := res.RowsAffected(); n != 0 {
+		t.Errorf("expected no rows affected by a SELECT got %d", n)
+	}
+
+	if _, err := db.Exec("INSERT INTO t (name) VALUES (?)"); err == nil {
+		t.Error("expected an error with a missing argument")
+	}
+	if _, err := db.Exec("INSERT INTO t (name) VALUES (?)", "a", "b"); err == nil {
+		t.Error("expected an error with an extra argument")
+	}
+
+	// named parameters don't take up the positional arguments of the statements that follow
+	if _, err := db.Exec("INSERT INTO t (id, name) VALUES (:a, 'x'); INSERT INTO t (id, name) VALUES (?, 'y')", 5, sql.Named("a", 3)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO t (id, name) VALUES (?, :name); INSERT INTO t (id, name) VALUES (?, :name)", 6, 7, sql.Named("name", "z")); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	if rows, err := db.Query("SELECT id FROM t WHERE name IN ('x', 'y', 'z') ORDER BY id"); err != nil {
+		t.Fatal(err)
+	} else {
+		for rows.Next() {
+			var id int64
+			if err = rows.Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		_ = rows.Close()
+	}
+	if expected := []int64{3, 5, 6, 7}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected ids %v got %v", expected, ids)
+	}
+	if _, err := db.Exec("DELETE FROM t WHERE name IN ('x', 'y', 'z')"); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("SELECT id, name, score, data, at FROM t ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][]interface{}
+	for rows.Next() {
+		var row = make([]interface{}, 5)
+		var ptrs = make([]interface{}, 5)
+		for i := range row {
+			ptrs[i] = &row[i]
+		}
+		if err = rows.Scan(ptrs...); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, row)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	_ = rows.Close()
+
+	var expected = [][]interface{}{
+		{int64(1), "a", 1.5, []byte{1, 2}, at},
+		{int64(2), "b", nil, nil, nil},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v got %v", expected, got)
+	}
+
+	// prepared statements are reused with different arguments
+	stmt, err := db.Prepare("SELECT count(*) FROM t WHERE name = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, count := range map[string]int{"a": 1, "b": 1, "c": 0} {
+		var n int
+		if err = stmt.QueryRow(name).Scan(&n); err != nil {
+			t.Fatal(err)
+		} else if n != count {
+			t.Errorf("expected %d rows named %q got %d", count, name, n)
+		}
+	}
+	_ = stmt.Close()
+
+	if _, err = db.Prepare("SELECT 1; SELECT 2"); err == nil {
+		t.Error("expected an error preparing more than one statement")
+	}
+}
+
+func TestJulianDay(t *testing.T) {
+	var db = driver.Open(filepath.Join(t.TempDir(), "julian.db"), 0)
+	defer db.Close()
+
+	// julianday() returns a value a few microseconds short of the time it stands for
+	if _, err := db.Exec("CREATE TABLE t (at DATETIME); INSERT INTO t VALUES (julianday('2024-03-01 12:30:18'))"); err != nil {
+		t.Fatal(err)
+	}
+
+	var at time.Time
+	if err := db.QueryRow("SELECT at FROM t").Scan(&at); err != nil {
+		t.Fatal(err)
+	} else if expected := time.Date(2024, 3, 1, 12, 30, 18, 0, time.UTC); !at.Equal(expected) {
+		t.Errorf("expected %v got %v", expected, at)
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	var db = driver.Open(filepath.Join(t.TempDir(), "tx.db"), 0)
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE t (a)"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, commit := range []bool{true, false} {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tx.Exec("INSERT INTO t VALUES (?)", commit); err != nil {
+			t.Fatal(err)
+		}
+		if commit {
+			err = tx.Commit()
+		} else {
+			err = tx.Rollback()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM t").Scan(&count); err != nil {
+		t.Fatal(err)
+	} else if count != 1 {
+		t.Errorf("expected only the committed row got %d rows", count)
+	}
+
+	if _, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelReadCommitted}); err == nil {
+		t.Error("expected an error with an unsupported isolation level")
+	}
+}
+
+func TestContext(t *testing.T) {
+	var db = driver.Open(filepath.Join(t.TempDir(), "ctx.db"), 0)
+	defer db.Close()
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var err = db.QueryRowContext(ctx, "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT count(*) FROM c").Scan(new(int))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the query to be interrupted got %v", err)
+	}
+
+	// the connection remains usable
+	var n int
+	if err = db.QueryRow("SELECT 1").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("expected 1 got %d (%v)", n, err)
+	}
+}
+
+func TestOpenDB(t *testing.T) {
+	conn, err := sqlite.Open("file:wrapped.db?mode=memory", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err = conn.Exec("CREATE TABLE t (a); INSERT INTO t VALUES (42)", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var db = driver.OpenDB(conn)
+
+	var a int
+	if err = db.QueryRow("SELECT a FROM t").Scan(&a); err != nil || a != 42 {
+		t.Fatalf("expected 42 got %d (%v)", a, err)
+	}
+
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Raw(func(c interface{}) error {
+		if c.(*driver.Conn).SQLite() != conn {
+			return errors.New("unexpected underlying connection")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+
+	// closing the *sql.DB leaves the connection open
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := sqlite.ResultInt64(conn, "SELECT a FROM t"); err != nil || v != 42 {
+		t.Fatalf("expected the connection to remain open got %d (%v)", v, err)
+	}
+}
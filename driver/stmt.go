@@ -0,0 +1,264 @@
+package driver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.riyazali.net/sqlite"
+)
+
+// timeFormat is the format time.Time arguments are bound with, understood by sqlite's date and time functions
+const timeFormat = "2006-01-02 15:04:05.999999999Z07:00"
+
+// Stmt is a driver.Stmt over a prepared *sqlite.Stmt
+type Stmt struct {
+	conn *Conn
+	stmt *sqlite.Stmt
+}
+
+var (
+	_ driver.StmtExecContext  = (*Stmt)(nil)
+	_ driver.StmtQueryContext = (*Stmt)(nil)
+)
+
+// Close finalizes the statement
+func (s *Stmt) Close() error { return s.stmt.Finalize() }
+
+// NumInput returns the number of parameters of the statement
+func (s *Stmt) NumInput() int { return s.stmt.BindParamCount() }
+
+// Exec executes the statement with the given arguments
+func (s *Stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), named(args))
+}
+
+// ExecContext executes the statement with the given arguments
+func (s *Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if err := s.rebind(args); err != nil {
+		return nil, err
+	}
+
+	var res result
+	if err := s.conn.run(ctx, s.stmt, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Query executes the statement with the given arguments
+func (s *Stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), named(args))
+}
+
+// QueryContext executes the statement with the given arguments. The statement is reset once the rows are closed.
+func (s *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if err := s.rebind(args); err != nil {
+		return nil, err
+	}
+	return newRows(ctx, s.stmt, false), nil
+}
+
+// rebind resets the statement and binds args to its parameters
+func (s *Stmt) rebind(args []driver.NamedValue) error {
+	if err := s.stmt.Reset(); err != nil {
+		return err
+	}
+	if err := s.stmt.ClearBindings(); err != nil {
+		return err
+	}
+	var _, err = bind(s.stmt, args, 0)
+	return err
+}
+
+// rows iterates over the rows returned by a statement
+type rows struct {
+	ctx     context.Context
+	stmt    *sqlite.Stmt
+	owned   bool     // whether the statement is finalized, rather than reset, once the rows are closed
+	columns []string // names of the columns
+	types   []string // declared types of the columns, in upper case
+}
+
+var _ driver.RowsColumnTypeDatabaseTypeName = (*rows)(nil)
+
+func newRows(ctx context.Context, stmt *sqlite.Stmt, owned bool) *rows {
+	setDeadline(ctx, stmt)
+
+	var r = &rows{ctx: ctx, stmt: stmt, owned: owned}
+	for i, n := 0, stmt.ColumnCount(); i < n; i++ {
+		r.columns = append(r.columns, stmt.ColumnName(i))
+		r.types = append(r.types, strings.ToUpper(stmt.ColumnDeclType(i)))
+	}
+	return r
+}
+
+func (r *rows) Columns() []string { return r.columns }
+
+func (r *rows) ColumnTypeDatabaseTypeName(i int) string { return r.types[i] }
+
+func (r *rows) Close() error {
+	if r.owned {
+		return r.stmt.Finalize()
+	}
+	return r.stmt.Reset()
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if hasRow, err := step(r.ctx, r.stmt); err != nil {
+		return err
+	} else if !hasRow {
+		return io.EOF
+	}
+
+	for i := range dest {
+		switch r.stmt.ColumnType(i) {
+		case sqlite.SQLITE_NULL:
+			dest[i] = nil
+			continue
+		case sqlite.SQLITE_BLOB:
+			dest[i] = r.stmt.ColumnValue(i).Blob()
+			continue
+		}
+
+		// an INTEGER is read as unix seconds and a REAL as a julian day; see sqlite.Stmt.ColumnTime
+		if r.types[i] == "DATE" || r.types[i] == "DATETIME" || r.types[i] == "TIMESTAMP" {
+			if t, err := r.stmt.ColumnTime(i); err == nil {
+				dest[i] = t
+				continue
+			}
+		}
+
+		switch r.stmt.ColumnType(i) {
+		case sqlite.SQLITE_INTEGER:
+			dest[i] = r.stmt.ColumnInt64(i)
+		case sqlite.SQLITE_FLOAT:
+			dest[i] = r.stmt.ColumnFloat(i)
+		default:
+			dest[i] = r.stmt.ColumnText(i)
+		}
+	}
+	return nil
+}
+
+// setDeadline makes the deadline of ctx, if any, the deadline of stmt
+func setDeadline(ctx context.Context, stmt *sqlite.Stmt) {
+	var deadline, _ = ctx.Deadline()
+	stmt.SetDeadline(deadline)
+}
+
+// step steps through stmt, unless ctx is done. A step interrupted as the deadline of ctx was reached
+// reports the error of ctx.
+func step(ctx context.Context, stmt *sqlite.Stmt) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	var hasRow, err = stmt.Step()
+	var timeout *sqlite.TimeoutError
+	if errors.As(err, &timeout) {
+		return false, context.DeadlineExceeded
+	}
+	return hasRow, err
+}
+
+// bind binds args to the parameters of stmt, and returns the number of positional arguments it consumed.
+// A named parameter (eg. :name) is bound to the named argument with the same name, if there's one. The other
+// parameters are bound to the positional arguments in turn, starting from the one with the ordinal offset+1;
+// a parameter ?NNN is bound to the argument with the ordinal offset+NNN.
+func bind(stmt *sqlite.Stmt, args []driver.NamedValue, offset int) (int, error) {
+	var positional = make(map[int]driver.Value, len(args))
+	var named = make(map[string]driver.Value)
+	for _, arg := range args {
+		if arg.Name == "" {
+			positional[arg.Ordinal] = arg.Value
+		} else {
+			named[arg.Name] = arg.Value
+		}
+	}
+
+	var consumed int
+	for i, count := 1, stmt.BindParamCount(); i <= count; i++ {
+		var name = stmt.BindName(i)
+		if name != "" {
+			if v, ok := named[name[1:]]; ok {
+				if err := bindValue(stmt, i, v); err != nil {
+					return 0, err
+				}
+				continue
+			}
+		}
+
+		var n = consumed + 1
+		if strings.HasPrefix(name, "?") {
+			if nnn, err := strconv.Atoi(name[1:]); err == nil {
+				n = nnn
+			}
+		}
+		if n > consumed {
+			consumed = n
+		}
+
+		var v, ok = positional[offset+n]
+		if !ok && name != "" {
+			return 0, fmt.Errorf("driver: missing argument for parameter %s", name)
+		} else if !ok {
+			return 0, fmt.Errorf("driver: missing argument for parameter %d", offset+n)
+		}
+		if err := bindValue(stmt, i, v); err != nil {
+			return 0, err
+		}
+	}
+	return consumed, nil
+}
+
+// bindValue binds v to the i-th parameter of stmt
+func bindValue(stmt *sqlite.Stmt, i int, v driver.Value) error {
+	switch v := v.(type) {
+	case nil:
+		stmt.BindNull(i)
+	case int64:
+		stmt.BindInt64(i, v)
+	case float64:
+		stmt.BindFloat(i, v)
+	case bool:
+		stmt.BindBool(i, v)
+	case []byte:
+		if v == nil {
+			stmt.BindNull(i)
+		} else {
+			stmt.BindBytes(i, v)
+		}
+	case string:
+		stmt.BindText(i, v)
+	case time.Time:
+		stmt.BindText(i, v.Format(timeFormat))
+	default:
+		return fmt.Errorf("driver: unsupported type %T for parameter %d", v, i)
+	}
+	return nil
+}
+
+// named converts args to positional driver.NamedValue
+func named(args []driver.Value) []driver.NamedValue {
+	var values = make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		values[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return values
+}
+
+// countPositional returns the number of positional arguments in args
+func countPositional(args []driver.NamedValue) (n int) {
+	for _, arg := range args {
+		if arg.Name == "" {
+			n++
+		}
+	}
+	return n
+}
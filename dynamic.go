@@ -0,0 +1,110 @@
+//go:build !static && !windows
+// +build !static,!windows
+
+package sqlite
+
+// #cgo linux LDFLAGS: -ldl
+//
+// #define _GNU_SOURCE // for RTLD_DEFAULT
+// #include <stdlib.h>
+// #include <dlfcn.h>
+// #include <sqlite3ext.h>
+//
+// SQLITE_EXTENSION_INIT3
+//
+// extern int go_sqlite3_api_initialized(void);
+//
+// typedef int (*auto_extension_fn)(void(*)(void));
+// typedef int (*open_fn)(const char*, sqlite3**);
+// typedef int (*close_fn)(sqlite3*);
+//
+// // _capture_api is registered as an auto-extension to receive the library's sqlite3_api_routines
+// static int _capture_api(sqlite3 *db, char **pzErrMsg, const sqlite3_api_routines *pApi) {
+//   sqlite3_api = pApi;
+//   return SQLITE_OK;
+// }
+//
+// // _load_dynamic resolves the sqlite3_api_routines from the library identified by handle. Rather than resolving
+// // each routine, it has the library hand them over the same way it does to a loadable extension: by registering
+// // an auto-extension and opening (and closing) an in-memory database.
+// static int _load_dynamic(void *handle) {
+//   auto_extension_fn auto_extension = (auto_extension_fn) dlsym(handle, "sqlite3_auto_extension");
+//   auto_extension_fn cancel_auto_extension = (auto_extension_fn) dlsym(handle, "sqlite3_cancel_auto_extension");
+//   open_fn open = (open_fn) dlsym(handle, "sqlite3_open");
+//   close_fn close = (close_fn) dlsym(handle, "sqlite3_close");
+//   if (!auto_extension || !cancel_auto_extension || !open || !close) {
+//     return SQLITE_NOTFOUND;
+//   }
+//
+//   int res;
+//   if ((res = auto_extension((void(*)(void)) _capture_api)) != SQLITE_OK) {
+//     return res;
+//   }
+//
+//   sqlite3 *db = 0;
+//   res = open(":memory:", &db);
+//   cancel_auto_extension((void(*)(void)) _capture_api);
+//   close(db);
+//
+//   if (res == SQLITE_OK && sqlite3_api == 0) {
+//     res = SQLITE_ERROR;
+//   }
+//   return res;
+// }
+//
+// static void *_dlopen(const char *path) { return path ? dlopen(path, RTLD_NOW | RTLD_GLOBAL) : RTLD_DEFAULT; }
+// static char *_dlerror(void) { return dlerror(); }
+import "C"
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+var dynamicLock sync.Mutex
+
+// LoadDynamic makes the sqlite3_api routines available by resolving them at runtime from a sqlite3 library, for cases
+// where sqlite hasn't loaded the extension (and so, hasn't handed it the routines) yet, like when calling Open or
+// RegisterWithHandle from an application that links the package along with a sqlite3 library. An empty library
+// uses the sqlite3 library already loaded in the process; otherwise, the library at the given path is loaded with dlopen.
+//
+// This way, a single build of the package works against whichever sqlite3 the host uses, instead of depending on
+// the library it's statically linked with (see docs/STATIC_LINKING.md). The library's routines must be exported
+// from the process (eg. a shared libsqlite3, or an executable linked with -rdynamic) for them to be found.
+//
+// If the routines are already available, LoadDynamic is a no-op, apart from loading library.
+func LoadDynamic(library string) error {
+	dynamicLock.Lock()
+	defer dynamicLock.Unlock()
+
+	var path *C.char
+	if library != "" {
+		path = C.CString(library)
+		defer C.free(unsafe.Pointer(path))
+	}
+
+	var handle = C._dlopen(path)
+	if path != nil && handle == nil { // RTLD_DEFAULT is a nil handle on some platforms
+		return fmt.Errorf("sqlite: failed to load %s: %s", library, C.GoString(C._dlerror()))
+	}
+
+	if C.go_sqlite3_api_initialized() != 0 {
+		return nil
+	}
+
+	if res := ErrorCode(C._load_dynamic(handle)); res == SQLITE_NOTFOUND {
+		return fmt.Errorf("sqlite: no sqlite3 library found in %s", describeLibrary(library))
+	} else if !res.ok() {
+		return fmt.Errorf("sqlite: failed to resolve sqlite3_api routines from %s: %v", describeLibrary(library), res)
+	}
+	return nil
+}
+
+// describeLibrary describes the library passed to LoadDynamic for use in error messages
+func describeLibrary(library string) string {
+	if library == "" {
+		return "the process"
+	}
+	return library
+}
@@ -0,0 +1,21 @@
+//go:build !static && !windows
+// +build !static,!windows
+
+package sqlite_test
+
+import (
+	. "go.riyazali.net/sqlite"
+	"testing"
+)
+
+func TestLoadDynamic(t *testing.T) {
+	if err := LoadDynamic("no-such-library.so"); err == nil {
+		t.Fatal("expected error when loading a missing library")
+	}
+
+	bootstrap(t)
+
+	if err := LoadDynamic(""); err != nil {
+		t.Fatalf("expected no-op when routines are already available, got %v", err)
+	}
+}
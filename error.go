@@ -15,6 +15,7 @@
 package sqlite
 
 // #include <sqlite3ext.h>
+// #include "bridge.h"
 import "C"
 import "fmt"
 
@@ -33,7 +34,7 @@ type ErrorCode int
 
 func (code ErrorCode) ok() bool {
 	switch code {
-	case SQLITE_OK, SQLITE_ROW, SQLITE_DONE:
+	case SQLITE_OK, SQLITE_ROW, SQLITE_DONE, SQLITE_OK_LOAD_PERMANENTLY, SQLITE_OK_SYMLINK:
 		return true
 	}
 	return false
@@ -52,6 +53,10 @@ func (code ErrorCode) String() string {
 		return "SQLITE_ROW(not an error)"
 	case SQLITE_DONE:
 		return "SQLITE_DONE(not an error)"
+	case SQLITE_OK_LOAD_PERMANENTLY:
+		return "SQLITE_OK_LOAD_PERMANENTLY(not an error)"
+	case SQLITE_OK_SYMLINK:
+		return "SQLITE_OK_SYMLINK(not an error)"
 	case SQLITE_ERROR:
 		return "SQLITE_ERROR"
 	case SQLITE_INTERNAL:
@@ -177,12 +182,22 @@ func (code ErrorCode) String() string {
 		return "SQLITE_IOERR_COMMIT_ATOMIC"
 	case SQLITE_IOERR_ROLLBACK_ATOMIC:
 		return "SQLITE_IOERR_ROLLBACK_ATOMIC"
+	case SQLITE_IOERR_DATA:
+		return "SQLITE_IOERR_DATA"
+	case SQLITE_IOERR_CORRUPTFS:
+		return "SQLITE_IOERR_CORRUPTFS"
+	case SQLITE_IOERR_IN_PAGE:
+		return "SQLITE_IOERR_IN_PAGE"
 	case SQLITE_LOCKED_SHAREDCACHE:
 		return "SQLITE_LOCKED_SHAREDCACHE"
+	case SQLITE_LOCKED_VTAB:
+		return "SQLITE_LOCKED_VTAB"
 	case SQLITE_BUSY_RECOVERY:
 		return "SQLITE_BUSY_RECOVERY"
 	case SQLITE_BUSY_SNAPSHOT:
 		return "SQLITE_BUSY_SNAPSHOT"
+	case SQLITE_BUSY_TIMEOUT:
+		return "SQLITE_BUSY_TIMEOUT"
 	case SQLITE_CANTOPEN_NOTEMPDIR:
 		return "SQLITE_CANTOPEN_NOTEMPDIR"
 	case SQLITE_CANTOPEN_ISDIR:
@@ -191,8 +206,16 @@ func (code ErrorCode) String() string {
 		return "SQLITE_CANTOPEN_FULLPATH"
 	case SQLITE_CANTOPEN_CONVPATH:
 		return "SQLITE_CANTOPEN_CONVPATH"
+	case SQLITE_CANTOPEN_DIRTYWAL:
+		return "SQLITE_CANTOPEN_DIRTYWAL"
+	case SQLITE_CANTOPEN_SYMLINK:
+		return "SQLITE_CANTOPEN_SYMLINK"
 	case SQLITE_CORRUPT_VTAB:
 		return "SQLITE_CORRUPT_VTAB"
+	case SQLITE_CORRUPT_SEQUENCE:
+		return "SQLITE_CORRUPT_SEQUENCE"
+	case SQLITE_CORRUPT_INDEX:
+		return "SQLITE_CORRUPT_INDEX"
 	case SQLITE_READONLY_RECOVERY:
 		return "SQLITE_READONLY_RECOVERY"
 	case SQLITE_READONLY_CANTLOCK:
@@ -227,10 +250,16 @@ func (code ErrorCode) String() string {
 		return "SQLITE_CONSTRAINT_VTAB"
 	case SQLITE_CONSTRAINT_ROWID:
 		return "SQLITE_CONSTRAINT_ROWID"
+	case SQLITE_CONSTRAINT_PINNED:
+		return "SQLITE_CONSTRAINT_PINNED"
+	case SQLITE_CONSTRAINT_DATATYPE:
+		return "SQLITE_CONSTRAINT_DATATYPE"
 	case SQLITE_NOTICE_RECOVER_WAL:
 		return "SQLITE_NOTICE_RECOVER_WAL"
 	case SQLITE_NOTICE_RECOVER_ROLLBACK:
 		return "SQLITE_NOTICE_RECOVER_ROLLBACK"
+	case SQLITE_NOTICE_RBU:
+		return "SQLITE_NOTICE_RBU"
 	case SQLITE_WARNING_AUTOINDEX:
 		return "SQLITE_WARNING_AUTOINDEX"
 	case SQLITE_AUTH_USER:
@@ -271,6 +300,12 @@ const (
 	SQLITE_ROW        = ErrorCode(C.SQLITE_ROW)  // do not use in Error
 	SQLITE_DONE       = ErrorCode(C.SQLITE_DONE) // do not use in Error
 
+	// SQLITE_OK_LOAD_PERMANENTLY can be returned by an ExtensionFunc to keep the extension's shared library loaded
+	// even after the connection that loaded it is closed; required for extensions that register a VFS or auto extensions.
+	// It is only meaningful when the extension is loaded with sqlite3_load_extension.
+	SQLITE_OK_LOAD_PERMANENTLY = ErrorCode(C.SQLITE_OK_LOAD_PERMANENTLY) // do not use in Error
+	SQLITE_OK_SYMLINK          = ErrorCode(C.SQLITE_OK_SYMLINK)          // internal use only; do not use in Error
+
 	SQLITE_ERROR_MISSING_COLLSEQ   = ErrorCode(C.SQLITE_ERROR_MISSING_COLLSEQ)
 	SQLITE_ERROR_RETRY             = ErrorCode(C.SQLITE_ERROR_RETRY)
 	SQLITE_ERROR_SNAPSHOT          = ErrorCode(C.SQLITE_ERROR_SNAPSHOT)
@@ -305,14 +340,23 @@ const (
 	SQLITE_IOERR_BEGIN_ATOMIC      = ErrorCode(C.SQLITE_IOERR_BEGIN_ATOMIC)
 	SQLITE_IOERR_COMMIT_ATOMIC     = ErrorCode(C.SQLITE_IOERR_COMMIT_ATOMIC)
 	SQLITE_IOERR_ROLLBACK_ATOMIC   = ErrorCode(C.SQLITE_IOERR_ROLLBACK_ATOMIC)
+	SQLITE_IOERR_DATA              = ErrorCode(C.SQLITE_IOERR_DATA)
+	SQLITE_IOERR_CORRUPTFS         = ErrorCode(C.SQLITE_IOERR_CORRUPTFS)
+	SQLITE_IOERR_IN_PAGE           = ErrorCode(C.SQLITE_IOERR | (34 << 8)) // since 3.45.0
 	SQLITE_LOCKED_SHAREDCACHE      = ErrorCode(C.SQLITE_LOCKED_SHAREDCACHE)
+	SQLITE_LOCKED_VTAB             = ErrorCode(C.SQLITE_LOCKED_VTAB)
 	SQLITE_BUSY_RECOVERY           = ErrorCode(C.SQLITE_BUSY_RECOVERY)
 	SQLITE_BUSY_SNAPSHOT           = ErrorCode(C.SQLITE_BUSY_SNAPSHOT)
+	SQLITE_BUSY_TIMEOUT            = ErrorCode(C.SQLITE_BUSY_TIMEOUT)
 	SQLITE_CANTOPEN_NOTEMPDIR      = ErrorCode(C.SQLITE_CANTOPEN_NOTEMPDIR)
 	SQLITE_CANTOPEN_ISDIR          = ErrorCode(C.SQLITE_CANTOPEN_ISDIR)
 	SQLITE_CANTOPEN_FULLPATH       = ErrorCode(C.SQLITE_CANTOPEN_FULLPATH)
 	SQLITE_CANTOPEN_CONVPATH       = ErrorCode(C.SQLITE_CANTOPEN_CONVPATH)
+	SQLITE_CANTOPEN_DIRTYWAL       = ErrorCode(C.SQLITE_CANTOPEN_DIRTYWAL) // not used
+	SQLITE_CANTOPEN_SYMLINK        = ErrorCode(C.SQLITE_CANTOPEN_SYMLINK)
 	SQLITE_CORRUPT_VTAB            = ErrorCode(C.SQLITE_CORRUPT_VTAB)
+	SQLITE_CORRUPT_SEQUENCE        = ErrorCode(C.SQLITE_CORRUPT_SEQUENCE)
+	SQLITE_CORRUPT_INDEX           = ErrorCode(C.SQLITE_CORRUPT_INDEX)
 	SQLITE_READONLY_RECOVERY       = ErrorCode(C.SQLITE_READONLY_RECOVERY)
 	SQLITE_READONLY_CANTLOCK       = ErrorCode(C.SQLITE_READONLY_CANTLOCK)
 	SQLITE_READONLY_ROLLBACK       = ErrorCode(C.SQLITE_READONLY_ROLLBACK)
@@ -330,8 +374,11 @@ const (
 	SQLITE_CONSTRAINT_UNIQUE       = ErrorCode(C.SQLITE_CONSTRAINT_UNIQUE)
 	SQLITE_CONSTRAINT_VTAB         = ErrorCode(C.SQLITE_CONSTRAINT_VTAB)
 	SQLITE_CONSTRAINT_ROWID        = ErrorCode(C.SQLITE_CONSTRAINT_ROWID)
+	SQLITE_CONSTRAINT_PINNED       = ErrorCode(C.SQLITE_CONSTRAINT_PINNED)
+	SQLITE_CONSTRAINT_DATATYPE     = ErrorCode(C.SQLITE_CONSTRAINT_DATATYPE)
 	SQLITE_NOTICE_RECOVER_WAL      = ErrorCode(C.SQLITE_NOTICE_RECOVER_WAL)
 	SQLITE_NOTICE_RECOVER_ROLLBACK = ErrorCode(C.SQLITE_NOTICE_RECOVER_ROLLBACK)
+	SQLITE_NOTICE_RBU              = ErrorCode(C.SQLITE_NOTICE | (3 << 8)) // since 3.46.0
 	SQLITE_WARNING_AUTOINDEX       = ErrorCode(C.SQLITE_WARNING_AUTOINDEX)
 	SQLITE_AUTH_USER               = ErrorCode(C.SQLITE_AUTH_USER)
 )
@@ -369,3 +416,55 @@ func Error(code ErrorCode, msg string) error {
 func (e *errorCodeWithMessage) Error() string {
 	return fmt.Sprintf("sqlite: %s: %s", e.code.String(), e.msg)
 }
+
+// QueryError is the error returned by Conn.Prepare, Conn.Exec and Stmt.Step, describing what sqlite reported.
+// It matches both its primary and extended codes with errors.Is, eg. errors.Is(err, SQLITE_CONSTRAINT) and
+// errors.Is(err, SQLITE_CONSTRAINT_UNIQUE) both hold for a violated unique constraint.
+type QueryError struct {
+	Code     ErrorCode // primary result code
+	Extended ErrorCode // extended result code; same as Code if there's no extended code
+	Msg      string    // error message, as reported by sqlite3_errmsg
+	SQL      string    // sql that failed
+	Offset   int       // byte offset into SQL of the token the error refers to, or -1 if it isn't known
+}
+
+func (e *QueryError) Error() string {
+	var msg = fmt.Sprintf("sqlite: %s: %s", e.Extended.String(), e.Msg)
+	if e.Offset >= 0 {
+		msg += fmt.Sprintf(" (at offset %d)", e.Offset)
+	}
+	return msg
+}
+
+// Unwrap returns the extended result code
+func (e *QueryError) Unwrap() error { return e.Extended }
+
+// Is reports whether target is the primary or the extended result code of the error
+func (e *QueryError) Is(target error) bool {
+	var code, ok = target.(ErrorCode)
+	return ok && (code == e.Code || code == e.Extended)
+}
+
+// queryError returns a *QueryError describing the error res, that happened while running sql on db, or nil if res isn't an error.
+// It must be called before any other call on db, as that would reset the error details.
+func queryError(db *C.sqlite3, res C.int, sql string) error {
+	var code = ErrorCode(res)
+	if code.ok() {
+		return nil
+	}
+
+	var err = &QueryError{Code: code & 0xff, Extended: code, SQL: sql, Offset: -1}
+	if db == nil {
+		return err
+	}
+
+	// res may be the primary code only, if extended result codes aren't enabled on the connection
+	if extended := ErrorCode(C._sqlite3_extended_errcode(db)); extended&0xff == err.Code {
+		err.Extended = extended
+	}
+	err.Msg = C.GoString(C._sqlite3_errmsg(db))
+	if C._sqlite3_libversion_number() >= 3038000 { // sqlite3_error_offset is available since 3.38.0
+		err.Offset = int(C._sqlite3_error_offset(db))
+	}
+	return err
+}
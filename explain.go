@@ -0,0 +1,150 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+import "C"
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PlanNode is a step of a query plan, as reported by EXPLAIN QUERY PLAN
+type PlanNode struct {
+	ID       int     // identifier of the step
+	Parent   int     // identifier of the parent step, or 0 for top-level steps
+	Detail   string  // human-readable description of the step, eg. "SCAN t VIRTUAL TABLE INDEX 1:"
+	EstRows  float64 // estimated number of rows the step loops over, or -1 if it isn't known; see ExplainQueryPlan
+	Children []*PlanNode
+}
+
+// ExplainQueryPlan returns the plan sqlite picked for query, as a tree of the steps reported by EXPLAIN QUERY PLAN.
+// The args are bound to the query as with Exec; they matter as far as sqlite considers their values.
+//
+// The steps that loop over a table or an index carry the number of rows sqlite estimated they visit, as reported
+// by sqlite3_stmt_scanstatus_v2. It's only available with a library of version 3.42.0 or later compiled with
+// SQLITE_ENABLE_STMT_SCANSTATUS that the package is statically linked against, as the routine isn't part of those
+// available to loadable extensions; EstRows is -1 otherwise.
+//
+// It's meant to let modules and tools verify how sqlite uses a virtual table, eg. with PlanNode.VirtualTable.
+func (conn *Conn) ExplainQueryPlan(query string, args ...interface{}) ([]*PlanNode, error) {
+	var roots []*PlanNode
+	var nodes = map[int]*PlanNode{}
+
+	var err = conn.Exec("EXPLAIN QUERY PLAN "+query, func(stmt *Stmt) error {
+		var node = &PlanNode{ID: stmt.ColumnInt(0), Parent: stmt.ColumnInt(1), Detail: stmt.ColumnText(3), EstRows: -1}
+		nodes[node.ID] = node
+		if parent, ok := nodes[node.Parent]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+		return nil
+	}, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = conn.estimateRows(query, args, nodes); err != nil {
+		return nil, err
+	}
+	return roots, nil
+}
+
+// estimateRows fills in the estimated number of rows of the nodes of query's plan, if sqlite reports them.
+// The scans of the prepared (but not run) statement are identified by the id of the step they belong to.
+func (conn *Conn) estimateRows(query string, args []interface{}, nodes map[int]*PlanNode) (err error) {
+	var stmt *Stmt
+	if stmt, _, err = conn.Prepare(query); err != nil {
+		return err
+	}
+	defer func() {
+		if ferr := stmt.Finalize(); err == nil {
+			err = ferr
+		}
+	}()
+
+	for i, arg := range args {
+		stmt.bindArg(i+1, arg) // parameters are 1-indexed
+	}
+	for i := 0; ; i++ {
+		var id C.int
+		var est C.double
+		if C._sqlite3_stmt_scanstatus_est(stmt.stmt, C.int(i), &id, &est) != 0 {
+			return nil
+		}
+		if node, ok := nodes[int(id)]; ok && est >= 0 {
+			node.EstRows = float64(est)
+		}
+	}
+}
+
+// VirtualTable parses the step's detail, reporting whether it's a scan of a virtual table, and if so, the name of
+// the table (or its alias in the query) along with the IndexNumber and IndexString returned by its BestIndex for the scan.
+func (node *PlanNode) VirtualTable() (table string, indexNumber int, indexString string, ok bool) {
+	// eg. "SCAN t VIRTUAL TABLE INDEX 1:idx" or "SCAN t AS alias VIRTUAL TABLE INDEX 0:"
+	const marker = " VIRTUAL TABLE INDEX "
+	var i = strings.Index(node.Detail, marker)
+	if i < 0 {
+		return "", 0, "", false
+	}
+
+	// names aren't quoted, and so may contain spaces; only the keywords around them are split off
+	table = node.Detail[:i]
+	if !strings.HasPrefix(table, "SCAN ") {
+		return "", 0, "", false
+	}
+	table = table[len("SCAN "):]
+	if C._sqlite3_libversion_number() < 3036000 { // older versions report "SCAN TABLE t"
+		table = strings.TrimPrefix(table, "TABLE ")
+	}
+	if as := strings.Index(table, " AS "); as >= 0 {
+		table = table[as+len(" AS "):]
+	}
+	if table == "" {
+		return "", 0, "", false
+	}
+
+	var index = node.Detail[i+len(marker):]
+	var colon = strings.IndexByte(index, ':')
+	if colon < 0 {
+		return "", 0, "", false
+	}
+	var err error
+	if indexNumber, err = strconv.Atoi(index[:colon]); err != nil {
+		return "", 0, "", false
+	}
+	return table, indexNumber, index[colon+1:], true
+}
+
+// Walk calls fn for the node and each of its descendants, depth-first, in the order sqlite reported them
+func (node *PlanNode) Walk(fn func(*PlanNode)) {
+	fn(node)
+	for _, child := range node.Children {
+		child.Walk(fn)
+	}
+}
+
+// String formats the node and its descendants as a tree, like the sqlite3 shell does
+func (node *PlanNode) String() string {
+	var buf strings.Builder
+	node.format(&buf, "")
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func (node *PlanNode) format(buf *strings.Builder, indent string) {
+	buf.WriteString(node.Detail)
+	buf.WriteByte('\n')
+	for i, child := range node.Children {
+		if i == len(node.Children)-1 {
+			buf.WriteString(indent + "`--")
+			child.format(buf, indent+"   ")
+		} else {
+			buf.WriteString(indent + "|--")
+			child.format(buf, indent+"|  ")
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package sqlite_test
+
+import (
+	"strings"
+	"testing"
+
+	. "go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/vtabutil"
+)
+
+// IndexedModule is a virtual table module whose tables report an equality constraint on their first column
+// as index 1, "eq"
+type IndexedModule struct{}
+
+func (m *IndexedModule) Connect(_ *Conn, _ []string, declare func(string) error) (VirtualTable, error) {
+	var table = &IndexedTable{FullScanTable: vtabutil.FullScanTable{
+		Scan: func() (vtabutil.Iterator, error) { return vtabutil.Rows(nil), nil },
+	}}
+	return table, declare("CREATE TABLE x(key TEXT, value TEXT)")
+}
+
+type IndexedTable struct{ vtabutil.FullScanTable }
+
+func (t *IndexedTable) BestIndex(input *IndexInfoInput) (*IndexInfoOutput, error) {
+	var output = &IndexInfoOutput{EstimatedCost: 1000, ConstraintUsage: make([]*ConstraintUsage, len(input.Constraints))}
+	for i, c := range input.Constraints {
+		if c.Usable && c.ColumnIndex == 0 && c.Op == INDEX_CONSTRAINT_EQ {
+			output.ConstraintUsage[i] = &ConstraintUsage{ArgvIndex: 1}
+			output.IndexNumber, output.IndexString, output.EstimatedCost = 1, "eq", 1
+		}
+	}
+	return output, nil
+}
+
+func TestExplainQueryPlan(t *testing.T) {
+	bootstrap(t)
+
+	conn, err := Open("file:explain.db?mode=memory", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err = conn.CreateModule("indexed", &IndexedModule{}, EponymousOnly(true)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = conn.CreateModule("with space", &IndexedModule{}, EponymousOnly(true)); err != nil {
+		t.Fatal(err)
+	}
+
+	var find = func(plan []*PlanNode) (table string, number int, str string) {
+		for _, root := range plan {
+			root.Walk(func(node *PlanNode) {
+				if name, n, s, ok := node.VirtualTable(); ok {
+					table, number, str = name, n, s
+					// estimates are only available with some libraries; see ExplainQueryPlan
+					if node.EstRows != -1 && node.EstRows <= 0 {
+						t.Errorf("expected a positive estimate for %q, got %v", node.Detail, node.EstRows)
+					}
+				}
+			})
+		}
+		return table, number, str
+	}
+
+	plan, err := conn.ExplainQueryPlan("SELECT * FROM indexed AS i WHERE key = ?", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table, n, s := find(plan); table != "i" || n != 1 || s != "eq" {
+		t.Fatalf("expected the constraint to be pushed down, got %q %d %q in\n%v", table, n, s, plan)
+	}
+
+	if plan, err = conn.ExplainQueryPlan("SELECT * FROM indexed WHERE value = 'a'"); err != nil {
+		t.Fatal(err)
+	}
+	if table, n, s := find(plan); table != "indexed" || n != 0 || s != "" {
+		t.Fatalf("expected a full scan, got %q %d %q in\n%v", table, n, s, plan)
+	}
+
+	// names aren't quoted in the plan
+	if plan, err = conn.ExplainQueryPlan(`SELECT * FROM "with space" WHERE key = 'a'`); err != nil {
+		t.Fatal(err)
+	}
+	if table, n, _ := find(plan); table != "with space" || n != 1 {
+		t.Fatalf("expected the table with a space in its name, got %q %d in\n%v", table, n, plan)
+	}
+	if plan, err = conn.ExplainQueryPlan(`SELECT * FROM "with space" AS "an alias" WHERE key = 'a'`); err != nil {
+		t.Fatal(err)
+	}
+	if table, _, _ := find(plan); table != "an alias" {
+		t.Fatalf("expected the alias with a space in its name, got %q in\n%v", table, plan)
+	}
+
+	// nested steps are reported as children of the step they're part of
+	if plan, err = conn.ExplainQueryPlan("SELECT * FROM indexed WHERE key IN (SELECT value FROM indexed) ORDER BY value"); err != nil {
+		t.Fatal(err)
+	}
+	var tree strings.Builder
+	for _, root := range plan {
+		tree.WriteString(root.String() + "\n")
+	}
+	if !strings.Contains(tree.String(), "|--") && !strings.Contains(tree.String(), "`--") {
+		t.Fatalf("expected a tree of steps, got\n%s", tree.String())
+	}
+}
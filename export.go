@@ -0,0 +1,252 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSONOptions configures how WriteJSON encodes the rows of a statement
+type JSONOptions struct {
+	// Lines writes each row as a JSON object on its own line (NDJSON) rather than as an element of a JSON array
+	Lines bool
+
+	// QuoteBigInts writes integers that can't be represented exactly as a float64 (ie. beyond ±2^53) as strings,
+	// for consumers (like javascript) that decode every JSON number as a float64 and would silently round them
+	QuoteBigInts bool
+}
+
+// maxSafeInteger is the largest integer such that it, and every integer below it, is exactly representable as a float64
+const maxSafeInteger = 1<<53 - 1
+
+// WriteJSON steps through stmt and streams each row it returns to w as a JSON object, keyed by the column names.
+// The rows are written as a JSON array, or as newline-delimited JSON objects with JSONOptions.Lines.
+// Values are mapped from their sqlite datatype as follows:
+//
+//	INTEGER  number, written exactly (or a string with JSONOptions.QuoteBigInts, if it's beyond ±2^53)
+//	REAL     number, or null if it's infinite
+//	TEXT     string
+//	BLOB     string, with the base64-encoded bytes
+//	NULL     null
+//
+// The statement must be bound beforehand, and is left stepped to completion; the caller is still responsible
+// for resetting or finalizing it. Rows written before an error are not retracted, and so, w may end up with
+// incomplete JSON if WriteJSON fails.
+func WriteJSON(w io.Writer, stmt *Stmt, opts JSONOptions) (err error) {
+	var bw = bufio.NewWriter(w)
+	defer func() {
+		if ferr := bw.Flush(); err == nil {
+			err = ferr
+		}
+	}()
+
+	var keys [][]byte // JSON-encoded column names, followed by a colon
+	var buf []byte
+	for rows := 0; ; rows++ {
+		var hasRow bool
+		if hasRow, err = stmt.Step(); err != nil {
+			return err
+		} else if !hasRow {
+			if !opts.Lines {
+				if rows == 0 {
+					buf = append(buf, '[')
+				}
+				buf = append(buf, ']')
+			}
+			_, err = bw.Write(buf)
+			return err
+		}
+
+		if keys == nil {
+			keys = make([][]byte, stmt.ColumnCount())
+			for i := range keys {
+				keys[i] = append(appendJSONString(nil, stmt.ColumnName(i)), ':')
+			}
+		}
+
+		if buf = buf[:0]; !opts.Lines {
+			if rows == 0 {
+				buf = append(buf, '[')
+			} else {
+				buf = append(buf, ',')
+			}
+		}
+
+		buf = append(buf, '{')
+		for i, key := range keys {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, key...)
+			buf = appendJSONValue(buf, stmt, i, opts)
+		}
+		buf = append(buf, '}')
+
+		if opts.Lines {
+			buf = append(buf, '\n')
+		}
+		if _, err = bw.Write(buf); err != nil {
+			return err
+		}
+		buf = buf[:0]
+	}
+}
+
+// appendJSONValue appends the value of the col-th column of the current row of stmt, encoded as JSON
+func appendJSONValue(buf []byte, stmt *Stmt, col int, opts JSONOptions) []byte {
+	switch stmt.ColumnType(col) {
+	case SQLITE_INTEGER:
+		var v = stmt.ColumnInt64(col)
+		if opts.QuoteBigInts && (v > maxSafeInteger || v < -maxSafeInteger) {
+			return strconv.AppendQuote(buf, strconv.FormatInt(v, 10))
+		}
+		return strconv.AppendInt(buf, v, 10)
+	case SQLITE_FLOAT:
+		var v = stmt.ColumnFloat(col)
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return append(buf, "null"...)
+		}
+		return strconv.AppendFloat(buf, v, 'g', -1, 64)
+	case SQLITE_TEXT:
+		return appendJSONString(buf, stmt.ColumnText(col))
+	case SQLITE_BLOB:
+		var b = stmt.columnBytes(col)
+		buf = append(buf, '"')
+		var n = len(buf)
+		buf = append(buf, make([]byte, base64.StdEncoding.EncodedLen(len(b)))...)
+		base64.StdEncoding.Encode(buf[n:], b)
+		return append(buf, '"')
+	default:
+		return append(buf, "null"...)
+	}
+}
+
+// appendJSONString appends s encoded as a JSON string, without escaping HTML characters like encoding/json does by default
+func appendJSONString(buf []byte, s string) []byte {
+	var out bytes.Buffer
+	var enc = json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s) // encoding a string never fails
+	return append(buf, bytes.TrimSuffix(out.Bytes(), []byte{'\n'})...)
+}
+
+// CSVQuoting decides which fields WriteCSV encloses in double quotes
+type CSVQuoting int
+
+const (
+	QuoteMinimal    CSVQuoting = iota // quote only the fields that require it; the default
+	QuoteAll                          // quote every field, except NULLs
+	QuoteNonNumeric                   // quote every field, except INTEGERs, REALs and NULLs
+)
+
+// CSVOptions configures how WriteCSV writes the rows of a statement
+type CSVOptions struct {
+	Comma    rune       // field delimiter; a comma when zero
+	NoHeader bool       // don't write the column names as the first record
+	Quoting  CSVQuoting // which fields are enclosed in double quotes
+	Null     string     // representation of NULL, written unquoted; an empty field when empty
+	UseCRLF  bool       // end records with \r\n rather than \n
+}
+
+// WriteCSV steps through stmt and writes the rows it returns to w as CSV records, as described in RFC 4180,
+// preceded by a header record with the column names. It's the export counterpart of a CSV virtual table.
+//
+// Values are written as sqlite converts them to TEXT (ie. as stmt.ColumnText returns them), and BLOBs are written
+// as their raw bytes. A NULL is written as CSVOptions.Null, never quoted; a TEXT equal to it is always quoted
+// so that it can be told apart from a NULL (eg. an empty string is written as "" when Null is empty).
+//
+// The statement must be bound beforehand, and is left stepped to completion; the caller is still responsible
+// for resetting or finalizing it.
+func WriteCSV(w io.Writer, stmt *Stmt, opts CSVOptions) (err error) {
+	if opts.Comma == 0 {
+		opts.Comma = ','
+	}
+	if opts.Comma == '"' || opts.Comma == '\r' || opts.Comma == '\n' || !utf8.ValidRune(opts.Comma) || opts.Comma == utf8.RuneError {
+		return fmt.Errorf("sqlite: invalid CSV delimiter %q", opts.Comma)
+	}
+	var eol = "\n"
+	if opts.UseCRLF {
+		eol = "\r\n"
+	}
+
+	var bw = bufio.NewWriter(w)
+	defer func() {
+		if ferr := bw.Flush(); err == nil {
+			err = ferr
+		}
+	}()
+
+	var n = stmt.ColumnCount()
+	if !opts.NoHeader {
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				_, _ = bw.WriteRune(opts.Comma)
+			}
+			writeCSVField(bw, stmt.ColumnName(i), opts.Quoting != QuoteMinimal || csvNeedsQuotes(stmt.ColumnName(i), opts))
+		}
+		if _, err = bw.WriteString(eol); err != nil {
+			return err
+		}
+	}
+
+	for {
+		var hasRow bool
+		if hasRow, err = stmt.Step(); err != nil || !hasRow {
+			return err
+		}
+
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				_, _ = bw.WriteRune(opts.Comma)
+			}
+
+			var typ = stmt.ColumnType(i)
+			if typ == SQLITE_NULL {
+				_, _ = bw.WriteString(opts.Null)
+				continue
+			}
+
+			var v = stmt.ColumnText(i)
+			var quote = opts.Quoting == QuoteAll || csvNeedsQuotes(v, opts) ||
+				(opts.Quoting == QuoteNonNumeric && typ != SQLITE_INTEGER && typ != SQLITE_FLOAT)
+			writeCSVField(bw, v, quote)
+		}
+		if _, err = bw.WriteString(eol); err != nil {
+			return err
+		}
+	}
+}
+
+// csvNeedsQuotes reports whether the field must be quoted, as it contains the delimiter, a quote or a line break,
+// starts with a space (which some readers would trim) or could be mistaken for a NULL
+func csvNeedsQuotes(field string, opts CSVOptions) bool {
+	if field == opts.Null {
+		return true
+	}
+	if strings.ContainsRune(field, opts.Comma) || strings.ContainsAny(field, "\"\r\n") {
+		return true
+	}
+	var r, _ = utf8.DecodeRuneInString(field)
+	return r == ' ' || r == '\t'
+}
+
+// writeCSVField writes the field, enclosed in double quotes (with the quotes in it doubled) if quote is set
+func writeCSVField(w *bufio.Writer, field string, quote bool) {
+	if !quote {
+		_, _ = w.WriteString(field)
+		return
+	}
+	_ = w.WriteByte('"')
+	_, _ = w.WriteString(strings.ReplaceAll(field, `"`, `""`))
+	_ = w.WriteByte('"')
+}
@@ -0,0 +1,131 @@
+package sqlite_test
+
+import (
+	"bytes"
+	. "go.riyazali.net/sqlite"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	bootstrap(t)
+
+	conn, err := Open("file:export_json.db?mode=memory", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	const query = `SELECT * FROM (VALUES (1, 1.5, 'a "<b>"', x'00ff', NULL), (9007199254740993, 1e300 * 1e300, '', x'', -2)) WHERE column5 IS NOT ?`
+	var tests = []struct {
+		opts     JSONOptions
+		arg      int
+		expected string
+	}{
+		{
+			opts: JSONOptions{},
+			arg:  0,
+			expected: `[{"column1":1,"column2":1.5,"column3":"a \"<b>\"","column4":"AP8=","column5":null},` +
+				`{"column1":9007199254740993,"column2":null,"column3":"","column4":"","column5":-2}]`,
+		},
+		{
+			opts: JSONOptions{Lines: true, QuoteBigInts: true},
+			arg:  0,
+			expected: `{"column1":1,"column2":1.5,"column3":"a \"<b>\"","column4":"AP8=","column5":null}` + "\n" +
+				`{"column1":"9007199254740993","column2":null,"column3":"","column4":"","column5":-2}` + "\n",
+		},
+		{opts: JSONOptions{}, arg: -2, expected: `[{"column1":1,"column2":1.5,"column3":"a \"<b>\"","column4":"AP8=","column5":null}]`},
+	}
+
+	for _, test := range tests {
+		stmt, _, err := conn.Prepare(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmt.BindInt64(1, int64(test.arg))
+
+		var buf bytes.Buffer
+		if err = WriteJSON(&buf, stmt, test.opts); err != nil {
+			t.Fatal(err)
+		}
+		_ = stmt.Finalize()
+
+		if got := buf.String(); got != test.expected {
+			t.Errorf("expected %s got %s", test.expected, got)
+		}
+	}
+
+	// an empty result is an empty array, or nothing at all
+	for opts, expected := range map[JSONOptions]string{{}: "[]", {Lines: true}: ""} {
+		stmt, _, err := conn.Prepare("SELECT 1 WHERE 0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err = WriteJSON(&buf, stmt, opts); err != nil {
+			t.Fatal(err)
+		} else if buf.String() != expected {
+			t.Errorf("expected %q got %q", expected, buf.String())
+		}
+		_ = stmt.Finalize()
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	bootstrap(t)
+
+	conn, err := Open("file:export_csv.db?mode=memory", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	const query = `SELECT 1 AS id, 'plain' AS "name", 2.5 AS "a,b", 'say "hi"' AS q, NULL AS n, '' AS e, ' x' AS s, 'l1' || char(10) || 'l2' AS l`
+	var tests = []struct {
+		opts     CSVOptions
+		expected string
+	}{
+		{
+			opts:     CSVOptions{},
+			expected: "id,name,\"a,b\",q,n,e,s,l\n1,plain,2.5,\"say \"\"hi\"\"\",,\"\",\" x\",\"l1\nl2\"\n",
+		},
+		{
+			opts:     CSVOptions{Comma: ';', Null: "NULL", NoHeader: true, UseCRLF: true},
+			expected: "1;plain;2.5;\"say \"\"hi\"\"\";NULL;;\" x\";\"l1\nl2\"\r\n",
+		},
+		{
+			opts:     CSVOptions{Quoting: QuoteAll, NoHeader: true},
+			expected: "\"1\",\"plain\",\"2.5\",\"say \"\"hi\"\"\",,\"\",\" x\",\"l1\nl2\"\n",
+		},
+		{
+			opts:     CSVOptions{Quoting: QuoteNonNumeric, NoHeader: true, Comma: '\t'},
+			expected: "1\t\"plain\"\t2.5\t\"say \"\"hi\"\"\"\t\t\"\"\t\" x\"\t\"l1\nl2\"\n",
+		},
+	}
+
+	for _, test := range tests {
+		stmt, _, err := conn.Prepare(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err = WriteCSV(&buf, stmt, test.opts); err != nil {
+			t.Fatal(err)
+		}
+		_ = stmt.Finalize()
+
+		if got := buf.String(); got != test.expected {
+			t.Errorf("expected %q got %q", test.expected, got)
+		}
+	}
+
+	stmt, _, err := conn.Prepare("SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Finalize()
+	if err = WriteCSV(&bytes.Buffer{}, stmt, CSVOptions{Comma: '"'}); err == nil {
+		t.Error("expected an error with a quote as the delimiter")
+	}
+}
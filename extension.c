@@ -7,10 +7,28 @@ SQLITE_EXTENSION_INIT1
 // hook to call into golang functionality defined in extension.go
 extern int go_sqlite3_extension_init(const char*, sqlite3*, char**);
 
-#ifdef _WIN32
-  __declspec(dllexport)
-#endif
+// on windows, the linker only exports the symbols listed in the module-definition file go generates
+// for //export-ed functions (ignoring __declspec(dllexport)), and so, the entry point is defined in extension_windows.go
+#ifndef _WIN32
 int sqlite3_extension_init(sqlite3* db, char** pzErrMsg, const sqlite3_api_routines *pApi) {
 	SQLITE_EXTENSION_INIT2(pApi)
 	return go_sqlite3_extension_init("default", db, pzErrMsg);
-}
\ No newline at end of file
+}
+#endif
+
+// go_sqlite3_extension_init_named initializes the extension registered under the given name.
+// It is used by the autoload package to register named extensions with sqlite3_auto_extension.
+int go_sqlite3_extension_init_named(const char* name, sqlite3* db, char** pzErrMsg, const sqlite3_api_routines *pApi) {
+	SQLITE_EXTENSION_INIT2(pApi)
+	return go_sqlite3_extension_init(name, db, pzErrMsg);
+}
+
+// go_sqlite3_api_initialized reports whether the sqlite3_api routines are available to the extension.
+// When statically linked (with SQLITE_CORE), calls are made directly and the routines are always available.
+int go_sqlite3_api_initialized(void) {
+#ifdef SQLITE_CORE
+	return 1;
+#else
+	return sqlite3_api != 0;
+#endif
+}
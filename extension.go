@@ -6,12 +6,20 @@ package sqlite
 // #include <sqlite3ext.h>
 // #include "bridge.h"
 //
+// extern int  go_sqlite3_api_initialized(void);
 // extern int  commit_hook_tramp(void*);
 // extern void rollback_hook_tramp(void*);
 //
 import "C"
 import (
+	"errors"
+	"fmt"
 	"github.com/mattn/go-pointer"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"unsafe"
 )
 
@@ -19,33 +27,228 @@ import (
 // invoked by sqlite3 core whenever the user registers the extension with the connection.
 type ExtensionFunc func(*ExtensionApi) (ErrorCode, error)
 
-// Extensions is a map of all registered extensions.
-// Access to this map is not synchronised, and is such not thread-safe.
-var extensions = make(map[string]ExtensionFunc)
+// ExtensionOptions represents the various options that affect how an extension is initialized
+type ExtensionOptions struct {
+	Config          interface{}     // Config is made available to the extension through ExtensionApi.Config
+	InitSQL         []string        // InitSQL are executed, in order, after the extension function completes successfully
+	VersionFunction bool            // VersionFunction registers a <name>_version() function; see WithVersionFunction
+	OnDuplicate     DuplicatePolicy // OnDuplicate decides what happens if another package registered the same name
+	Namespace       bool            // Namespace registers the extension under a name qualified with its module path
+	Reloadable      bool            // Reloadable tracks the connections the extension is loaded on for Reload; see WithReload
+}
+
+// WithConfig sets the configuration value made available to the extension through ExtensionApi.Config
+func WithConfig(config interface{}) func(*ExtensionOptions) {
+	return func(opt *ExtensionOptions) { opt.Config = config }
+}
+
+// WithInitSQL adds sql to execute when the extension is initialized on a connection (eg. to create shadow tables or
+// set pragmas). Each sql may contain multiple statements. They are executed after the extension function completes
+// successfully, and so can make use of any function or module registered by it. Any error fails the initialization.
+func WithInitSQL(sql ...string) func(*ExtensionOptions) {
+	return func(opt *ExtensionOptions) { opt.InitSQL = append(opt.InitSQL, sql...) }
+}
+
+// registration is an entry in the extension registry
+type registration struct {
+	fn         ExtensionFunc
+	options    *ExtensionOptions
+	registrant string // path of the package that registered the extension
+	short      string // name the extension was registered with, before it was namespaced
+}
+
+var ( // protected registry of all registered extensions
+	extensionsLock sync.RWMutex
+	extensions     = make(map[string]*registration)
+)
+
+// RegisterNamed registers the provided extension function under the given name.
+// If an extension is already registered under the same name, it is replaced by fn, unless it was registered
+// by another package and the registration says otherwise (see WithDuplicatePolicy and WithNamespace).
+// It is safe to call RegisterNamed concurrently from multiple goroutines.
+//
+// A name ending with an asterisk (eg. "geo_*") registers fn for all names starting with the given prefix.
+// When an extension is loaded, an exact match is preferred and, failing that, the longest matching prefix is used.
+// Use ExtensionApi.Name to find the name the extension was loaded under.
+func RegisterNamed(name string, fn ExtensionFunc, opts ...func(*ExtensionOptions)) {
+	var options = &ExtensionOptions{}
+	for _, f := range opts {
+		f(options)
+	}
+
+	register(name, &registration{fn: fn, options: options, registrant: registrant(), short: name})
+}
 
-// RegisterNamed registers the provided extension function under the given name
-func RegisterNamed(name string, fn ExtensionFunc) { extensions[name] = fn }
+// RegisterNamedWithConfig registers the provided extension function under the given name
+// along with an arbitrary configuration value. The config is made available to fn
+// through ExtensionApi.Config, allowing the embedding application to parameterize the extension.
+func RegisterNamedWithConfig(name string, config interface{}, fn ExtensionFunc) {
+	RegisterNamed(name, fn, WithConfig(config))
+}
 
 // Register registers the given fn under the default name.
 // This function is kept for backwards compatibility reason.
-func Register(fn ExtensionFunc) { RegisterNamed("default", fn) }
+func Register(fn ExtensionFunc, opts ...func(*ExtensionOptions)) { RegisterNamed("default", fn, opts...) }
+
+// RegisterFallback registers the given fn as a catch-all, used when no other registration matches
+// the name under which the extension is loaded. It is equivalent to RegisterNamed("*", fn, opts...).
+func RegisterFallback(fn ExtensionFunc, opts ...func(*ExtensionOptions)) { RegisterNamed("*", fn, opts...) }
+
+// Compose returns an ExtensionFunc that runs each of fns in order, so that a large extension can be assembled from
+// independent feature packages, each exporting its own ExtensionFunc:
+//
+//	sqlite.Register(sqlite.Compose(geo.Register, text.Register, stats.Register))
+//
+// It stops at the first one to fail, returning its error code along with a *ComposeError identifying it.
+// Whatever the functions before it registered on the connection is left in place.
+// If all of them succeed and any returns SQLITE_OK_LOAD_PERMANENTLY, so does the composed function.
+func Compose(fns ...ExtensionFunc) ExtensionFunc {
+	return func(api *ExtensionApi) (ErrorCode, error) {
+		var result = SQLITE_OK
+		for i, fn := range fns {
+			var code, err = fn(api)
+			if err == nil && code.ok() {
+				if code == SQLITE_OK_LOAD_PERMANENTLY {
+					result = code
+				}
+				continue
+			}
+			if err == nil {
+				err = code
+			} else if code.ok() {
+				code = SQLITE_ERROR
+			}
+			return code, &ComposeError{Index: i, Name: runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name(), Err: err}
+		}
+		return result, nil
+	}
+}
+
+// ComposeError is returned by an ExtensionFunc created with Compose when one of the functions it's composed of fails
+type ComposeError struct {
+	Index int    // position of the function among those passed to Compose
+	Name  string // name of the function (eg. "example.com/geo.Register"), as reported by the runtime
+	Err   error  // error returned by the function
+}
+
+func (e *ComposeError) Error() string {
+	return fmt.Sprintf("sqlite: extension #%d (%s) failed: %v", e.Index, e.Name, e.Err)
+}
+
+func (e *ComposeError) Unwrap() error { return e.Err }
+
+// Unregister removes the extension registered under the given name.
+// It reports whether an extension was registered under that name.
+// Connections that have already loaded the extension are not affected.
+func Unregister(name string) bool {
+	extensionsLock.Lock()
+	defer extensionsLock.Unlock()
+
+	var _, found = extensions[name]
+	delete(extensions, name)
+	delete(shadowed, name)
+	return found
+}
+
+// Registered returns the sorted names of all the registered extensions.
+func Registered() []string {
+	extensionsLock.RLock()
+	defer extensionsLock.RUnlock()
+
+	var names = make([]string, 0, len(extensions))
+	for name := range extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookup returns the extension registered under the given name, or under a namespace (see WithNamespace),
+// or under the longest wildcard prefix matching it
+func lookup(name string) (*registration, bool) {
+	extensionsLock.RLock()
+	defer extensionsLock.RUnlock()
+
+	if reg, found := extensions[name]; found {
+		return reg, true
+	}
+	if reg, found := lookupNamespaced(name); found {
+		return reg, true
+	}
+
+	var match *registration
+	var longest = -1
+	for pattern, reg := range extensions {
+		if !strings.HasSuffix(pattern, "*") {
+			continue
+		}
+		if prefix := pattern[:len(pattern)-1]; strings.HasPrefix(name, prefix) && len(prefix) > longest {
+			match, longest = reg, len(prefix)
+		}
+	}
+	return match, match != nil
+}
 
 //export go_sqlite3_extension_init
 func go_sqlite3_extension_init(name *C.char, db *C.struct_sqlite3, msg **C.char) (code ErrorCode) {
 	var err error
 	var extName = C.GoString(name)
+	defer func() {
+		if err := panicked("sqlite3_extension_init", recover()); err != nil {
+			*msg = _allocate_string(err.Error())
+			code = SQLITE_ERROR
+		}
+	}()
 
-	fn, found := extensions[extName]
+	if code, err = initialize(extName, db); err != nil {
+		*msg = _allocate_string(err.Error())
+	}
+
+	return code
+}
+
+// initialize runs the extension registered under the given name against the connection
+func initialize(name string, db *C.struct_sqlite3) (ErrorCode, error) {
+	reg, found := lookup(name)
 	if !found {
-		*msg = _allocate_string("no extension with name '" + extName + "' registered")
-		return SQLITE_ERROR
+		var registered = "none"
+		if names := Registered(); len(names) > 0 {
+			registered = strings.Join(names, ", ")
+		}
+		logDebug("sqlite: no extension registered", "extension", name, "registered", registered)
+		return SQLITE_ERROR, fmt.Errorf("no extension with name '%s' registered (registered extensions: %s)", name, registered)
 	}
 
-	if code, err = fn(&ExtensionApi{db: db}); err != nil {
-		*msg = _allocate_string(err.Error())
+	var code, err = reg.fn(&ExtensionApi{db: db, name: name, config: reg.options.Config})
+	if err != nil || !code.ok() {
+		logDebug("sqlite: extension failed to initialize", "extension", name, "code", code, "error", err)
+		return code, err
 	}
 
-	return code
+	var conn = &Conn{db: db}
+	if reg.options.VersionFunction {
+		if err = createVersionFunction(conn, name); err != nil {
+			logDebug("sqlite: extension failed to initialize", "extension", name, "error", err)
+			return SQLITE_ERROR, err
+		}
+	}
+	for _, sql := range reg.options.InitSQL {
+		if err = conn.Exec(sql, nil); err != nil {
+			var code ErrorCode
+			if !errors.As(err, &code) { // the extended code, unwrapped from the *QueryError
+				code = SQLITE_ERROR
+			}
+			err = fmt.Errorf("sqlite: init sql for extension %q failed: %w", name, err)
+			logDebug("sqlite: extension failed to initialize", "extension", name, "error", err)
+			return code, err
+		}
+	}
+
+	if reg.options.Reloadable {
+		trackLoaded(name, db)
+	}
+	logDebug("sqlite: extension initialized", "extension", name)
+	return code, nil
 }
 
 // UnderlyingConnection represents a handle to an open sqlite3 database connection object.
@@ -57,15 +260,69 @@ func RegisterWith(conn UnderlyingConnection, fn ExtensionFunc) (ErrorCode, error
 	return fn(&ExtensionApi{db: (*C.struct_sqlite3)(conn)})
 }
 
+// RegisterWithHandle initializes the extension registered under the given name with the connection
+// identified by db, a sqlite3* handle obtained from another driver (see Conn.Handle for an example).
+// It performs the same initialization as the extension's entrypoint does when the extension is loaded by sqlite.
+//
+// The handle must refer to an open connection and it must remain open for the duration of the call.
+// The caller is responsible for ensuring the connection isn't closed while any function, collation or module
+// registered by the extension is in use. As uintptr isn't tracked by the garbage collector, the driver's connection
+// object the handle was obtained from must be kept alive (eg. with runtime.KeepAlive) until the call returns.
+//
+// Unless the package is built with the static tag, the sqlite3_api routines are only available once sqlite
+// has loaded the extension (through sqlite3_load_extension or sqlite3_auto_extension) at least once.
+// If that's not the case, RegisterWithHandle returns an error instead of crashing the process.
+func RegisterWithHandle(db uintptr, name string) error {
+	if db == 0 {
+		return errors.New("sqlite: nil database handle")
+	}
+
+	if C.go_sqlite3_api_initialized() == 0 {
+		return errApiNotInitialized
+	}
+
+	// db is the address of a sqlite3 object allocated by sqlite in C memory, which the Go garbage collector
+	// neither moves nor frees, and so, it remains valid as a pointer even though it's held in a uintptr.
+	// It's read back through the variable's address as go vet's unsafeptr check, meant for addresses of Go memory,
+	// can't tell it apart from one.
+	var handle = *(**C.struct_sqlite3)(unsafe.Pointer(&db))
+	if code, err := initialize(name, handle); err != nil {
+		return Error(code, err.Error())
+	} else if !code.ok() {
+		return code
+	}
+	return nil
+}
+
 // ExtensionApi wraps the underlying sqlite_api_routines and allows Go code to hook into
 // sqlite's extension facility.
 type ExtensionApi struct {
-	db *C.struct_sqlite3
+	db        *C.struct_sqlite3
+	name      string
+	config    interface{}
+	reloading bool // whether the extension is being reloaded; see Reload
 }
 
+// Name returns the name under which the extension is being loaded. It is most useful for extensions
+// registered with a wildcard prefix or with RegisterFallback. It is empty when the extension is
+// initialized directly with RegisterWith.
+func (ext *ExtensionApi) Name() string { return ext.name }
+
+// Config returns the configuration value the extension was registered with using RegisterNamedWithConfig.
+// It returns nil if no configuration was provided.
+func (ext *ExtensionApi) Config() interface{} { return ext.config }
+
+// Reloading reports whether the extension is being reloaded on a connection it was already loaded on (see Reload),
+// in which case it should only replace its functions, modules and hooks, and skip any one-time setup.
+func (ext *ExtensionApi) Reloading() bool { return ext.reloading }
+
 // Connection returns an instance of Conn which can be used to perform query on the database and more.
 func (ext *ExtensionApi) Connection() *Conn { return wrap(ext.db) }
 
+// conn returns a Conn over the extension's connection, used to delegate calls to methods that are defined on Conn.
+// Like any Conn, it waits for unlock notifications, allocating its unlock_note on first use.
+func (ext *ExtensionApi) conn() *Conn { return wrap(ext.db) }
+
 // AutoCommit returns the status of the auto_commit setting
 func (ext *ExtensionApi) AutoCommit() bool {
 	return int(C._sqlite3_get_autocommit(ext.db)) != 0
@@ -76,6 +333,12 @@ func (ext *ExtensionApi) Version() int {
 	return int(C._sqlite3_libversion_number())
 }
 
+// LoadExtension loads a further sqlite3 extension from the shared library at path using the given entrypoint.
+// It allows the extension to pull in companion native extensions during its own initialization.
+func (ext *ExtensionApi) LoadExtension(path, entrypoint string) error {
+	return ext.conn().LoadExtension(path, entrypoint)
+}
+
 // LimitId is an integer id used to refer to sqlite's limits
 type LimitId int
 
@@ -105,45 +368,105 @@ func (ext *ExtensionApi) SetLimit(id LimitId, val int) int {
 	return int(C._sqlite3_limit(ext.db, C.int(id), C.int(val)))
 }
 
-// RegisterCommitHook sets the commit hook for a connection.
+// Hook is the commit or rollback hook a connection had before RegisterCommitHook or RegisterRollbackHook
+// replaced it. It lets the new hook wrap the previous one, by calling it, and put it back in place with Restore.
+//
+// sqlite only reports the argument of the previous hook, and not its function, and so, hooks installed outside
+// of this package (eg. by an extension written in C) can neither be called nor restored; see Foreign.
+type Hook struct {
+	ext     *ExtensionApi
+	commit  bool       // whether it's a commit hook, rather than a rollback hook
+	fn      func() int // the previous hook, if it was registered with this package
+	foreign bool       // whether the previous hook was installed outside of this package
+}
+
+// Call invokes the previous hook and returns its result. It returns 0 if there was no previous hook, or if it's foreign.
+func (h *Hook) Call() int {
+	if h.fn == nil {
+		return 0
+	}
+	return h.fn()
+}
+
+// Foreign reports whether the previous hook was installed outside of this package, in which case it's lost.
+func (h *Hook) Foreign() bool { return h.foreign }
+
+// Restore reinstalls the previous hook in place of the one that replaced it, or removes the hook if there was none.
+// A foreign hook cannot be restored; the hook is removed, and an error is returned, instead.
+func (h *Hook) Restore() error {
+	if h.commit {
+		h.ext.RegisterCommitHook(h.fn)
+	} else {
+		h.ext.RegisterRollbackHook(h.fn)
+	}
+
+	if h.foreign {
+		return errors.New("sqlite: cannot restore a hook installed outside of the package")
+	}
+	return nil
+}
+
+// RegisterCommitHook sets the commit hook for a connection, and returns the hook it replaces.
 //
 // If the callback returns non-zero the transaction will become a rollback.
 //
-// If there is an existing commit hook for this connection, it will be
-// removed. If callback is nil the existing hook (if any) will be removed
-// without creating a new one.
-func (ext *ExtensionApi) RegisterCommitHook(fn func() int) {
+// If callback is nil the existing hook (if any) will be removed without creating a new one.
+func (ext *ExtensionApi) RegisterCommitHook(fn func() int) *Hook {
 	var prev unsafe.Pointer
 	if fn == nil {
 		prev = C._sqlite3_commit_hook(ext.db, nil, nil)
 	} else {
-		prev = C._sqlite3_commit_hook(ext.db, (*[0]byte)(C.commit_hook_tramp), pointer.Save(fn))
+		prev = C._sqlite3_commit_hook(ext.db, (*[0]byte)(C.commit_hook_tramp), saveHandle(handleHook, fn))
 	}
-	pointer.Unref(prev) // safe even if it's not ours .. it'll be a no-op
+	return ext.replacedHook(prev, true)
 }
 
-// RegisterRollbackHook sets the rollback hook for a connection.
+// RegisterRollbackHook sets the rollback hook for a connection, and returns the hook it replaces.
+// The value returned by the callback is ignored.
 //
-// If there is an existing rollback hook for this connection, it will be
-// removed. If callback is nil the existing hook (if any) will be removed
-// without creating a new one.
-func (ext *ExtensionApi) RegisterRollbackHook(fn func() int) {
+// If callback is nil the existing hook (if any) will be removed without creating a new one.
+func (ext *ExtensionApi) RegisterRollbackHook(fn func() int) *Hook {
 	var prev unsafe.Pointer
 	if fn == nil {
 		prev = C._sqlite3_rollback_hook(ext.db, nil, nil)
 	} else {
-		prev = C._sqlite3_rollback_hook(ext.db, (*[0]byte)(C.rollback_hook_tramp), pointer.Save(fn))
+		prev = C._sqlite3_rollback_hook(ext.db, (*[0]byte)(C.rollback_hook_tramp), saveHandle(handleHook, fn))
+	}
+	return ext.replacedHook(prev, false)
+}
+
+// replacedHook returns the Hook for the argument of the hook that was replaced, releasing its handle if it's ours
+func (ext *ExtensionApi) replacedHook(prev unsafe.Pointer, commit bool) *Hook {
+	var hook = &Hook{ext: ext, commit: commit}
+	if prev == nil {
+		return hook
+	}
+
+	// only release handles we own; anything else is the argument of a foreign hook, which isn't ours to free
+	if fn, ok := pointer.Restore(prev).(func() int); ok {
+		hook.fn = fn
+		unrefHandle(prev)
+	} else {
+		hook.foreign = true
+		logDebug("sqlite: replaced foreign hook", "extension", ext.name, "commit", commit)
 	}
-	pointer.Unref(prev) // safe even if it's not ours .. it'll be a no-op
+	return hook
 }
 
 //export commit_hook_tramp
-func commit_hook_tramp(p unsafe.Pointer) C.int {
+func commit_hook_tramp(p unsafe.Pointer) (res C.int) {
+	defer func() { // roll the transaction back, as it'd be if the hook had failed
+		if panicked("commit hook", recover()) != nil {
+			res = C.int(1)
+		}
+	}()
+
 	var fn = pointer.Restore(p).(func() int)
 	return C.int(fn())
 }
 
 //export rollback_hook_tramp
 func rollback_hook_tramp(p unsafe.Pointer) {
-	pointer.Restore(p).(func())()
+	defer func() { _ = panicked("rollback hook", recover()) }()
+	_ = pointer.Restore(p).(func() int)()
 }
@@ -1,9 +1,14 @@
 package sqlite_test
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	. "go.riyazali.net/sqlite"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -85,3 +90,791 @@ func TestLimit(t *testing.T) {
 	}
 }
 
+func TestOnClose(t *testing.T) {
+	var calls []int
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		for i := 0; i < 3; i++ {
+			var i = i
+			if err := api.OnClose(func() { calls = append(calls, i) }); err != nil {
+				return SQLITE_ERROR, err
+			}
+		}
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		if len(calls) != 0 {
+			t.Fatalf("callbacks invoked before close: %v", calls)
+		}
+		_ = db.Close()
+	}
+
+	if fmt.Sprint(calls) != "[2 1 0]" {
+		t.Fatalf("expected callbacks to run in reverse order, got %v", calls)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	var noop = func(*ExtensionApi) (ErrorCode, error) { return SQLITE_OK, nil }
+
+	var done = make(chan struct{})
+	for i := 0; i < 8; i++ {
+		go func(i int) {
+			RegisterNamed(fmt.Sprintf("registry_%d", i), noop)
+			done <- struct{}{}
+		}(i)
+	}
+	for i := 0; i < 8; i++ {
+		<-done
+	}
+
+	var names = Registered()
+	var count int
+	for _, name := range names {
+		if len(name) > 9 && name[:9] == "registry_" {
+			count++
+		}
+	}
+	if count != 8 {
+		t.Fatalf("expected 8 registered extensions, got %v", names)
+	}
+
+	for i := 0; i < 8; i++ {
+		if !Unregister(fmt.Sprintf("registry_%d", i)) {
+			t.Fatalf("registry_%d must have been registered", i)
+		}
+	}
+	if Unregister("registry_0") {
+		t.Fatal("registry_0 must not be registered anymore")
+	}
+}
+
+func TestRegisterNamedWithConfig(t *testing.T) {
+	type config struct{ Greeting string }
+
+	RegisterNamedWithConfig("default", &config{Greeting: "hello"}, func(api *ExtensionApi) (ErrorCode, error) {
+		if cfg, ok := api.Config().(*config); !ok || cfg.Greeting != "hello" {
+			return SQLITE_ERROR, fmt.Errorf("unexpected config %#v", api.Config())
+		}
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestRegisterWithHandle(t *testing.T) {
+	var handle uintptr
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		handle = api.Connection().Handle()
+		return SQLITE_OK, nil
+	})
+
+	var called bool
+	RegisterNamed("handle", func(api *ExtensionApi) (ErrorCode, error) {
+		called = true
+		return SQLITE_OK, api.CreateFunction("upper", &Upper{})
+	})
+	defer Unregister("handle")
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // make sure the connection the handle belongs to is reused
+
+	if err = RegisterWithHandle(handle, "handle"); err != nil {
+		t.Fatal(err)
+	} else if !called {
+		t.Fatal("extension must have been initialized")
+	}
+
+	var result string
+	if err = db.QueryRow("SELECT upper('sqlite')").Scan(&result); err != nil {
+		t.Fatal(err)
+	} else if result != "SQLITE" {
+		t.Fatalf("invalid result: got %q", result)
+	}
+
+	if err = RegisterWithHandle(handle, "missing"); err == nil {
+		t.Fatal("expected error for unregistered extension")
+	}
+	if err = RegisterWithHandle(0, "handle"); err == nil {
+		t.Fatal("expected error for nil handle")
+	}
+}
+
+// PluginVersion implements a plugin_version() sql function that returns the version of the plugin that registered it
+type PluginVersion struct{ version int }
+
+func (m *PluginVersion) Args() int           { return 0 }
+func (m *PluginVersion) Deterministic() bool { return true }
+func (m *PluginVersion) Apply(ctx *Context, _ ...Value) {
+	ctx.ResultInt(m.version)
+}
+
+func TestReload(t *testing.T) {
+	var handle uintptr
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		handle = api.Connection().Handle()
+		return SQLITE_OK, nil
+	})
+
+	var calls []string
+	var plugin = func(version int) ExtensionFunc {
+		return func(api *ExtensionApi) (ErrorCode, error) {
+			calls = append(calls, fmt.Sprintf("v%d reloading=%v", version, api.Reloading()))
+			return SQLITE_OK, api.CreateFunction("plugin_version", &PluginVersion{version: version})
+		}
+	}
+	RegisterNamed("plugin", plugin(1), WithReload())
+	defer Unregister("plugin")
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // make sure the connection the handle belongs to is reused
+
+	if err = RegisterWithHandle(handle, "plugin"); err != nil {
+		t.Fatal(err)
+	}
+
+	var version = func() (v int) {
+		if err := db.QueryRow("SELECT plugin_version()").Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	if v := version(); v != 1 {
+		t.Fatalf("expected version 1 got %d", v)
+	}
+
+	RegisterNamed("plugin", plugin(2))
+	if err = Reload("plugin"); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(); v != 2 {
+		t.Fatalf("expected version 2 once reloaded got %d", v)
+	}
+	if err = Reload("plug*"); err != nil {
+		t.Fatal(err)
+	}
+
+	RegisterNamed("plugin", func(*ExtensionApi) (ErrorCode, error) { return SQLITE_ERROR, errors.New("broken") })
+	var reloadErr *ReloadError
+	if err = Reload("plugin"); !errors.As(err, &reloadErr) || len(reloadErr.Errors) != 1 {
+		t.Fatalf("expected a reload error got %v", err)
+	}
+
+	// connections aren't tracked for extensions registered without WithReload
+	RegisterNamed("static", plugin(0))
+	defer Unregister("static")
+	if err = RegisterWithHandle(handle, "static"); err != nil {
+		t.Fatal(err)
+	}
+	if err = Reload("static"); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(calls) != "[v1 reloading=false v2 reloading=true v2 reloading=true v0 reloading=false]" {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+
+	// connections are forgotten once closed
+	_ = db.Close()
+	RegisterNamed("plugin", plugin(3))
+	if err = Reload("plugin"); err != nil || len(calls) != 4 {
+		t.Fatalf("expected no connection to reload got %v (%v)", calls, err)
+	}
+}
+
+func TestRegisterWildcard(t *testing.T) {
+	var handle uintptr
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		handle = api.Connection().Handle()
+		return SQLITE_OK, nil
+	})
+
+	var loaded []string
+	var record = func(kind string) ExtensionFunc {
+		return func(api *ExtensionApi) (ErrorCode, error) {
+			loaded = append(loaded, kind+":"+api.Name())
+			return SQLITE_OK, nil
+		}
+	}
+
+	RegisterNamed("wild_*", record("prefix"))
+	RegisterNamed("wild_exact", record("exact"))
+	defer Unregister("wild_*")
+	defer Unregister("wild_exact")
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err = RegisterWithHandle(handle, "unknown"); err == nil || !strings.Contains(err.Error(), "wild_exact") {
+		t.Fatalf("expected error listing registered extensions, got %v", err)
+	}
+
+	RegisterFallback(record("fallback"))
+	defer Unregister("*")
+
+	for _, name := range []string{"wild_exact", "wild_other", "unknown"} {
+		if err = RegisterWithHandle(handle, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var expected = "exact:wild_exact prefix:wild_other fallback:unknown"
+	if got := strings.Join(loaded, " "); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+// registerElsewhere calls RegisterNamed through reflect, standing in for another package registering the extension
+func registerElsewhere(name string, fn ExtensionFunc, opts ...func(*ExtensionOptions)) {
+	var args = []reflect.Value{reflect.ValueOf(name), reflect.ValueOf(fn)}
+	for _, opt := range opts {
+		args = append(args, reflect.ValueOf(opt))
+	}
+	reflect.ValueOf(RegisterNamed).Call(args)
+}
+
+func TestDuplicateRegistration(t *testing.T) {
+	var handle uintptr
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		handle = api.Connection().Handle()
+		return SQLITE_OK, nil
+	})
+
+	var loaded []string
+	var record = func(kind string) ExtensionFunc {
+		return func(api *ExtensionApi) (ErrorCode, error) {
+			loaded = append(loaded, kind+":"+api.Name())
+			return SQLITE_OK, nil
+		}
+	}
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var load = func(name string) {
+		if err := RegisterWithHandle(handle, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const self = "go.riyazali.net/sqlite_test"
+	var conflict = func(name string) (c Conflict) {
+		for _, c = range Conflicts() {
+			if c.Name == name {
+				return c
+			}
+		}
+		return Conflict{}
+	}
+
+	// replaced by default
+	RegisterNamed("dup_replace", record("mine"))
+	registerElsewhere("dup_replace", record("theirs"))
+	defer Unregister("dup_replace")
+	load("dup_replace")
+
+	var c = conflict("dup_replace")
+	if c.Active == self || len(c.Shadowed) != 1 || c.Shadowed[0] != self {
+		t.Fatalf("expected a conflict with %s shadowed got %+v", self, c)
+	}
+
+	if err = Resolve("dup_replace", self); err != nil {
+		t.Fatal(err)
+	}
+	load("dup_replace")
+	if c = conflict("dup_replace"); c.Active != self || len(c.Shadowed) != 1 {
+		t.Fatalf("expected %s to be active got %+v", self, c)
+	}
+	if err = Resolve("dup_replace", "example.com/none"); err == nil {
+		t.Fatal("expected an error resolving to a package that didn't register the extension")
+	}
+
+	// registering again from the same package isn't a conflict
+	RegisterNamed("dup_same", record("first"))
+	RegisterNamed("dup_same", record("second"))
+	defer Unregister("dup_same")
+	load("dup_same")
+	if c = conflict("dup_same"); c.Name != "" {
+		t.Fatalf("unexpected conflict %+v", c)
+	}
+
+	// kept
+	RegisterNamed("dup_keep", record("mine"))
+	registerElsewhere("dup_keep", record("theirs"), WithDuplicatePolicy(DuplicateKeep))
+	defer Unregister("dup_keep")
+	load("dup_keep")
+
+	// panics
+	RegisterNamed("dup_panic", record("mine"))
+	defer Unregister("dup_panic")
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("expected a panic on a duplicate registration")
+			}
+		}()
+		registerElsewhere("dup_panic", record("theirs"), WithDuplicatePolicy(DuplicatePanic))
+	}()
+	load("dup_panic")
+
+	// namespaced
+	RegisterNamed("dup_ns", record("namespaced"), WithNamespace())
+	defer Unregister(self + "/dup_ns")
+	load("dup_ns")
+	load(self + "/dup_ns")
+
+	var expected = "theirs:dup_replace mine:dup_replace second:dup_same mine:dup_keep mine:dup_panic " +
+		"namespaced:dup_ns namespaced:" + self + "/dup_ns"
+	if got := strings.Join(loaded, " "); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestLoadPermanently(t *testing.T) {
+	var handle uintptr
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		handle = api.Connection().Handle()
+		return SQLITE_OK, nil
+	})
+
+	RegisterNamed("permanent", func(api *ExtensionApi) (ErrorCode, error) {
+		return SQLITE_OK_LOAD_PERMANENTLY, nil
+	})
+	defer Unregister("permanent")
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err = RegisterWithHandle(handle, "permanent"); err != nil {
+		t.Fatalf("SQLITE_OK_LOAD_PERMANENTLY must not be reported as an error: %v", err)
+	}
+}
+
+func TestSupports(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		if !api.Supports(FEATURE_WINDOW_FUNCTIONS) {
+			return SQLITE_ERROR, errors.New("window functions must be supported")
+		}
+
+		if api.Supports(FEATURE_RETURNING) != (api.Version() >= 3035000) {
+			return SQLITE_ERROR, errors.New("RETURNING support must follow library version")
+		}
+
+		if api.Supports(FEATURE_JSON) {
+			if err := api.Connection().Exec("SELECT json('{}')", func(*Stmt) error { return nil }); err != nil {
+				return SQLITE_ERROR, err
+			}
+		}
+
+		if api.Supports(Feature(-1)) {
+			return SQLITE_ERROR, errors.New("unknown feature must not be supported")
+		}
+
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestCompileOptions(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var opts = api.CompileOptions()
+		if len(opts) == 0 {
+			return SQLITE_ERROR, errors.New("expected the library to report its compile options")
+		}
+		for _, opt := range opts {
+			if !api.CompileOptionUsed(opt) {
+				return SQLITE_ERROR, fmt.Errorf("expected option %s to be used", opt)
+			}
+		}
+
+		var threadsafe, ok = api.CompileOption("SQLITE_THREADSAFE")
+		if !ok || threadsafe == "" || !api.CompileOptionUsed("THREADSAFE="+threadsafe) {
+			return SQLITE_ERROR, fmt.Errorf("unexpected THREADSAFE option %q", threadsafe)
+		}
+		if _, ok = api.CompileOption("NOT_AN_OPTION"); ok || api.CompileOptionUsed("NOT_AN_OPTION") {
+			return SQLITE_ERROR, errors.New("unknown option must not be used")
+		}
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestWithInitSQL(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		return SQLITE_OK, api.CreateFunction("upper", &Upper{})
+	}, WithInitSQL(
+		"CREATE TABLE IF NOT EXISTS shadow (name TEXT)",
+		"INSERT INTO shadow VALUES (upper('sqlite')); PRAGMA user_version = 3;",
+	))
+
+	var db, err = Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var name string
+	var version int
+	if err = db.QueryRow("SELECT name, (SELECT user_version FROM pragma_user_version) FROM shadow").Scan(&name, &version); err != nil {
+		t.Fatal(err)
+	} else if name != "SQLITE" || version != 3 {
+		t.Fatalf("unexpected result %q, %d", name, version)
+	}
+
+	Register(func(api *ExtensionApi) (ErrorCode, error) { return SQLITE_OK, nil }, WithInitSQL("SELECT * FROM missing"))
+	if _, err = Connect(Memory); err == nil || !strings.Contains(err.Error(), "no such table: missing") {
+		t.Fatalf("expected init sql failure, got %v", err)
+	}
+
+	// the extension fails with the extended code of the failing statement
+	RegisterNamed("init_sql", func(api *ExtensionApi) (ErrorCode, error) { return SQLITE_OK, nil },
+		WithInitSQL("CREATE TABLE IF NOT EXISTS u (a UNIQUE); INSERT INTO u VALUES (1); INSERT INTO u VALUES (1)"))
+	defer Unregister("init_sql")
+
+	var handle uintptr
+	Register(func(api *ExtensionApi) (ErrorCode, error) { handle = api.Connection().Handle(); return SQLITE_OK, nil })
+	if db, err = Connect(Memory); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err = RegisterWithHandle(handle, "init_sql"); err == nil || !strings.HasPrefix(err.Error(), "sqlite: "+SQLITE_CONSTRAINT_UNIQUE.String()+":") {
+		t.Fatalf("expected a unique constraint failure, got %v", err)
+	}
+}
+
+func upperFeature(api *ExtensionApi) (ErrorCode, error) {
+	return SQLITE_OK, api.CreateFunction("upper", &Upper{})
+}
+
+func brokenFeature(*ExtensionApi) (ErrorCode, error) { return SQLITE_MISUSE, nil }
+
+func TestCompose(t *testing.T) {
+	var calls []string
+	var record = func(name string) ExtensionFunc {
+		return func(*ExtensionApi) (ErrorCode, error) { calls = append(calls, name); return SQLITE_OK, nil }
+	}
+
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var code, err = Compose(record("a"), brokenFeature, record("b"))(api)
+
+		var composeErr *ComposeError
+		if code != SQLITE_MISUSE || !errors.As(err, &composeErr) || !errors.Is(err, SQLITE_MISUSE) {
+			return SQLITE_ERROR, fmt.Errorf("expected a ComposeError wrapping SQLITE_MISUSE got %v (%v)", err, code)
+		}
+		if composeErr.Index != 1 || !strings.HasSuffix(composeErr.Name, ".brokenFeature") {
+			return SQLITE_ERROR, fmt.Errorf("expected brokenFeature at index 1 got %s at %d", composeErr.Name, composeErr.Index)
+		}
+
+		var permanent = func(*ExtensionApi) (ErrorCode, error) { return SQLITE_OK_LOAD_PERMANENTLY, nil }
+		if code, err = Compose(record("e"), permanent, record("f"))(api); err != nil || code != SQLITE_OK_LOAD_PERMANENTLY {
+			return SQLITE_ERROR, fmt.Errorf("expected SQLITE_OK_LOAD_PERMANENTLY to be kept got %v (%v)", code, err)
+		}
+
+		return Compose(record("c"), upperFeature, record("d"))(api)
+	})
+
+	var db, err = Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if strings.Join(calls, ",") != "a,e,f,c,d" {
+		t.Errorf("unexpected calls %q", calls)
+	}
+
+	var upper string
+	if err = db.QueryRow("SELECT upper('composed')").Scan(&upper); err != nil {
+		t.Fatal(err)
+	} else if upper != "COMPOSED" {
+		t.Errorf("unexpected result %q", upper)
+	}
+}
+
+func TestWithVersionFunction(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) { return SQLITE_OK, nil }, WithVersionFunction())
+
+	var db, err = Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var data string
+	var version struct{ Name, Module string }
+	if err = db.QueryRow("SELECT default_version()").Scan(&data); err != nil {
+		t.Fatal(err)
+	} else if err = json.Unmarshal([]byte(data), &version); err != nil {
+		t.Fatal(err)
+	} else if version.Name != "default" || version.Module != "go.riyazali.net/sqlite" {
+		t.Fatalf("unexpected version %s", data)
+	}
+}
+
+func TestTrackHandles(t *testing.T) {
+	TrackHandles(true)
+	defer TrackHandles(false)
+
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		if err := api.CreateFunction("go_upper", &Upper{}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := api.CreateVirtualTable("args", &ArgsModule{}, []string{"a", "b"}, false); err != nil {
+			return SQLITE_ERROR, err
+		}
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var live = LiveHandles()
+	if live["function"] != 1 || live["module"] != 1 || live["virtual table"] != 1 {
+		t.Fatalf("unexpected live handles:\n%s", DumpLiveHandles())
+	}
+	if dump := DumpLiveHandles(); !strings.Contains(dump, "function: 1\n") {
+		t.Fatalf("unexpected dump:\n%s", dump)
+	}
+
+	_ = db.Close()
+
+	if live = LiveHandles(); len(live) != 0 {
+		t.Fatalf("handles must be released once the connection is closed:\n%s", DumpLiveHandles())
+	}
+}
+
+// hitsKey is the key of the per-connection counter used by Hits
+type hitsKey struct{}
+
+// Hits implements a hits() sql function that counts its calls on each connection
+type Hits struct{}
+
+func (m *Hits) Args() int           { return 0 }
+func (m *Hits) Deterministic() bool { return false }
+func (m *Hits) Apply(ctx *Context, _ ...Value) {
+	var counter = ctx.UserData(hitsKey{}).(*int)
+	*counter++
+	ctx.ResultInt(*counter)
+}
+
+func TestUserData(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		if err := api.SetUserData(hitsKey{}, new(int)); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := api.CreateFunction("hits", &Hits{}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		return SQLITE_OK, nil
+	})
+
+	var hits = func(db *sql.DB) (n int) {
+		if err := db.QueryRow("SELECT hits()").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	a, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	a.SetMaxOpenConns(1)
+
+	b, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	b.SetMaxOpenConns(1)
+
+	hits(a)
+	hits(a)
+	if n := hits(a); n != 3 {
+		t.Fatalf("expected 3 hits on the first connection, got %d", n)
+	}
+	if n := hits(b); n != 1 {
+		t.Fatalf("expected connections not to share data, got %d hits on the second one", n)
+	}
+}
+
+// storeKey is the key of the values put in the Store by TestStore
+type storeKey struct{}
+
+// closer records the names of the values closed
+type closer struct {
+	name   string
+	closed *[]string
+}
+
+func (c *closer) Close() error { *c.closed = append(*c.closed, c.name); return nil }
+
+func TestStore(t *testing.T) {
+	var closed []string
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var store = api.Store()
+		if err := store.Put(storeKey{}, &closer{name: "a", closed: &closed}); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		var c *closer
+		if !store.Get(storeKey{}, &c) || c.name != "a" {
+			return SQLITE_ERROR, fmt.Errorf("expected value a got %v", c)
+		}
+		var ioCloser io.Closer
+		if !store.Get(storeKey{}, &ioCloser) {
+			return SQLITE_ERROR, errors.New("expected value to be found as an io.Closer")
+		}
+		var s string
+		if store.Get(storeKey{}, &s) || store.Get("missing", &c) {
+			return SQLITE_ERROR, errors.New("expected values of another type, or under another key, not to be found")
+		}
+
+		if err := store.Put(storeKey{}, &closer{name: "b", closed: &closed}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := store.Put("c", &closer{name: "c", closed: &closed}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := store.Delete("c"); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if fmt.Sprint(closed) != "[a c]" {
+			return SQLITE_ERROR, fmt.Errorf("expected replaced and deleted values to be closed, got %v", closed)
+		}
+
+		return SQLITE_OK, api.OnClose(func() { closed = append(closed, "on close") })
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+
+	if fmt.Sprint(closed) != "[a c on close b]" {
+		t.Fatalf("expected the stored value to be closed with the connection, got %v", closed)
+	}
+}
+
+func TestStoreUncomparable(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var store = api.Store()
+		if err := store.Put("slice", []string{"a"}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := store.Put("slice", []string{"b"}); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		var s []string
+		if !store.Get("slice", &s) || fmt.Sprint(s) != "[b]" {
+			return SQLITE_ERROR, fmt.Errorf("expected the slice to be replaced, got %v", s)
+		}
+
+		// a comparable struct whose interface field holds an uncomparable value
+		type holder struct{ X interface{} }
+		if err := store.Put("holder", holder{[]int{1}}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := store.Put("holder", holder{[]int{2}}); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		var h holder
+		if !store.Get("holder", &h) || fmt.Sprint(h.X) != "[2]" {
+			return SQLITE_ERROR, fmt.Errorf("expected the holder to be replaced, got %v", h)
+		}
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestHooks(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+		var calls []string
+		var exec = func(sql string) error { calls = nil; return c.Exec(sql, nil) }
+
+		var first = api.RegisterCommitHook(func() int { calls = append(calls, "first"); return 0 })
+		if first.Foreign() || first.Call() != 0 {
+			return SQLITE_ERROR, errors.New("expected no previous commit hook")
+		}
+
+		var prev *Hook
+		prev = api.RegisterCommitHook(func() int { calls = append(calls, "second"); return prev.Call() })
+		if err := exec("CREATE TABLE t (a)"); err != nil {
+			return SQLITE_ERROR, err
+		} else if fmt.Sprint(calls) != "[second first]" {
+			return SQLITE_ERROR, fmt.Errorf("expected the second hook to wrap the first one, got %v", calls)
+		}
+
+		if err := prev.Restore(); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := exec("INSERT INTO t VALUES (1)"); err != nil {
+			return SQLITE_ERROR, err
+		} else if fmt.Sprint(calls) != "[first]" {
+			return SQLITE_ERROR, fmt.Errorf("expected the first hook to be restored, got %v", calls)
+		}
+		_ = first.Restore()
+
+		api.RegisterRollbackHook(func() int { calls = append(calls, "rollback"); return 0 })
+		if err := exec("BEGIN; INSERT INTO t VALUES (2); ROLLBACK"); err != nil {
+			return SQLITE_ERROR, err
+		} else if fmt.Sprint(calls) != "[rollback]" {
+			return SQLITE_ERROR, fmt.Errorf("expected the rollback hook to be called, got %v", calls)
+		}
+		api.RegisterRollbackHook(nil)
+
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
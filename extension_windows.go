@@ -0,0 +1,21 @@
+package sqlite
+
+// #include <stdlib.h>
+// #include <sqlite3ext.h>
+//
+// extern int go_sqlite3_extension_init_named(const char*, sqlite3*, char**, const sqlite3_api_routines*);
+import "C"
+import "unsafe"
+
+// sqlite3_extension_init is the default entry point of the extension, which initializes the "default" extension.
+//
+// Go generates a module-definition file listing the //export-ed functions when linking a dll, and the linker
+// then exports only those symbols. Hence, unlike other platforms (see extension.c), the entry point is
+// defined in Go so that SELECT load_extension('ext.dll') finds it.
+//
+//export sqlite3_extension_init
+func sqlite3_extension_init(db *C.sqlite3, pzErrMsg **C.char, pApi *C.sqlite3_api_routines) C.int {
+	var name = C.CString("default")
+	defer C.free(unsafe.Pointer(name))
+	return C.go_sqlite3_extension_init_named(name, db, pzErrMsg, pApi)
+}
@@ -0,0 +1,128 @@
+package sqlite
+
+// #include <stdlib.h>
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+import "C"
+
+import (
+	"strings"
+	"unsafe"
+)
+
+// Feature identifies an optional capability of the sqlite3 library the extension is loaded into
+type Feature int
+
+//noinspection GoSnakeCaseUsage
+const (
+	FEATURE_WINDOW_FUNCTIONS Feature = iota // window functions; see https://www.sqlite.org/windowfunctions.html
+	FEATURE_RETURNING                       // RETURNING clause; see https://www.sqlite.org/lang_returning.html
+	FEATURE_MATH_FUNCTIONS                  // built-in math functions; see https://www.sqlite.org/lang_mathfunc.html
+	FEATURE_JSON                            // built-in json functions; see https://www.sqlite.org/json1.html
+	FEATURE_JSONB                           // binary json functions; see https://www.sqlite.org/json1.html#jsonb
+	FEATURE_VTAB_IN                         // IN constraint handling in virtual tables; see https://www.sqlite.org/c3ref/vtab_in.html
+	FEATURE_COLUMN_METADATA                 // column metadata routines; see https://www.sqlite.org/c3ref/column_database_name.html
+	FEATURE_UNLOCK_NOTIFY                   // unlock notification; see https://www.sqlite.org/unlock_notify.html
+	FEATURE_SESSION                         // session extension; see https://www.sqlite.org/sessionintro.html
+)
+
+func (f Feature) String() string {
+	switch f {
+	case FEATURE_WINDOW_FUNCTIONS:
+		return "WINDOW_FUNCTIONS"
+	case FEATURE_RETURNING:
+		return "RETURNING"
+	case FEATURE_MATH_FUNCTIONS:
+		return "MATH_FUNCTIONS"
+	case FEATURE_JSON:
+		return "JSON"
+	case FEATURE_JSONB:
+		return "JSONB"
+	case FEATURE_VTAB_IN:
+		return "VTAB_IN"
+	case FEATURE_COLUMN_METADATA:
+		return "COLUMN_METADATA"
+	case FEATURE_UNLOCK_NOTIFY:
+		return "UNLOCK_NOTIFY"
+	case FEATURE_SESSION:
+		return "SESSION"
+	default:
+		return "<unknown feature>"
+	}
+}
+
+// Supports reports whether the sqlite3 library supports the given feature,
+// based on the library's version and the options it was compiled with.
+func (ext *ExtensionApi) Supports(feature Feature) bool { return supports(feature) }
+
+func supports(feature Feature) bool {
+	var version = int(C._sqlite3_libversion_number())
+
+	switch feature {
+	case FEATURE_WINDOW_FUNCTIONS:
+		return version >= 3025000 && !compileOptionUsed("OMIT_WINDOWFUNC")
+	case FEATURE_RETURNING:
+		return version >= 3035000
+	case FEATURE_MATH_FUNCTIONS:
+		return version >= 3035000 && compileOptionUsed("ENABLE_MATH_FUNCTIONS")
+	case FEATURE_JSON:
+		if version >= 3038000 {
+			return !compileOptionUsed("OMIT_JSON")
+		}
+		return compileOptionUsed("ENABLE_JSON1")
+	case FEATURE_JSONB:
+		return version >= 3045000 && !compileOptionUsed("OMIT_JSON")
+	case FEATURE_VTAB_IN:
+		return version >= 3038000
+	case FEATURE_COLUMN_METADATA:
+		return compileOptionUsed("ENABLE_COLUMN_METADATA")
+	case FEATURE_UNLOCK_NOTIFY:
+		return compileOptionUsed("ENABLE_UNLOCK_NOTIFY")
+	case FEATURE_SESSION:
+		return compileOptionUsed("ENABLE_SESSION") && compileOptionUsed("ENABLE_PREUPDATE_HOOK")
+	default:
+		return false
+	}
+}
+
+// CompileOptionUsed reports whether the sqlite3 library was compiled with the given option, with or without
+// the SQLITE_ prefix (eg. "ENABLE_FTS5"). An option that takes a value matches only with its value, eg. "THREADSAFE=1".
+// see: https://www.sqlite.org/c3ref/compileoption_get.html
+func (ext *ExtensionApi) CompileOptionUsed(opt string) bool { return compileOptionUsed(opt) }
+
+// CompileOptions returns the options the sqlite3 library was compiled with, without the SQLITE_ prefix
+// and in the order reported by sqlite, eg. ["COMPILER=gcc-10.2.1", "ENABLE_FTS5", "THREADSAFE=1"].
+// see: https://www.sqlite.org/compile.html
+func (ext *ExtensionApi) CompileOptions() []string {
+	var opts []string
+	for i := 0; ; i++ {
+		var opt = C._sqlite3_compileoption_get(C.int(i))
+		if opt == nil {
+			return opts
+		}
+		opts = append(opts, C.GoString(opt))
+	}
+}
+
+// CompileOption returns the value of the compile option with the given name, without the SQLITE_ prefix
+// (eg. "4" for "MAX_ATTACHED=4" or "1" for "THREADSAFE=1"). An option that doesn't take a value, like
+// ENABLE_FTS5, has an empty value. It returns false if the library wasn't compiled with the option.
+func (ext *ExtensionApi) CompileOption(name string) (string, bool) {
+	name = strings.TrimPrefix(name, "SQLITE_")
+	for _, opt := range ext.CompileOptions() {
+		if opt == name {
+			return "", true
+		}
+		if strings.HasPrefix(opt, name+"=") {
+			return opt[len(name)+1:], true
+		}
+	}
+	return "", false
+}
+
+// compileOptionUsed reports whether the library was compiled with the given option (with or without the SQLITE_ prefix)
+func compileOptionUsed(opt string) bool {
+	var copt = C.CString(opt)
+	defer C.free(unsafe.Pointer(copt))
+	return int(C._sqlite3_compileoption_used(copt)) != 0
+}
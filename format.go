@@ -0,0 +1,192 @@
+package sqlite
+
+// #include <stdlib.h>
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// Mprintf formats the arguments according to format, using sqlite's own printf implementation, and returns the result.
+// Besides the usual %d, %x, %f, %s and the like, it supports sqlite's SQL-specific conversions:
+//
+//	%q  like %s, but doubles every single quote, to be used inside an SQL string literal
+//	%Q  like %q, but also surrounds the result with single quotes; a nil argument is rendered as NULL
+//	%w  like %s, but doubles every double quote, to be used inside a quoted SQL identifier
+//
+// Using them to build SQL (eg. to declare a virtual table's schema or to access shadow tables) keeps it injection-safe.
+// Length modifiers are accepted but ignored as integer arguments are always formatted as 64-bit values.
+// see: https://www.sqlite.org/printf.html
+func Mprintf(format string, args ...interface{}) (string, error) {
+	var buf strings.Builder
+	var next = 0 // index of the next argument to consume
+
+	for i := 0; i < len(format); {
+		if format[i] != '%' {
+			buf.WriteByte(format[i])
+			i++
+			continue
+		}
+
+		// parse the conversion specification: %[flags][width][.precision][length]verb
+		var start = i
+		for i++; i < len(format) && strings.IndexByte("-+ 0#!,", format[i]) >= 0; i++ {
+		}
+		for ; i < len(format) && isDigit(format[i]); i++ {
+		}
+		if i < len(format) && format[i] == '.' {
+			for i++; i < len(format) && isDigit(format[i]); i++ {
+			}
+		}
+		var spec = format[start:i]
+		for ; i < len(format) && format[i] == 'l'; i++ {
+		}
+
+		if i >= len(format) {
+			return "", errors.New("sqlite: incomplete conversion at the end of format")
+		}
+
+		var verb = format[i]
+		i++
+
+		if verb == '%' {
+			buf.WriteByte('%')
+			continue
+		}
+
+		if next >= len(args) {
+			return "", fmt.Errorf("sqlite: missing argument for %%%c", verb)
+		}
+
+		var s, err = mprintf(spec, verb, args[next])
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(s)
+		next++
+	}
+
+	if next < len(args) {
+		return "", fmt.Errorf("sqlite: %d extra argument(s) for format", len(args)-next)
+	}
+	return buf.String(), nil
+}
+
+// QuoteIdentifier quotes s to be used as an identifier (eg. a table or column name) in SQL. It's equivalent to "%w"
+// in Mprintf, with surrounding double quotes, but doesn't call into sqlite.
+func QuoteIdentifier(s string) string { return `"` + strings.ReplaceAll(s, `"`, `""`) + `"` }
+
+// QuoteLiteral quotes s to be used as a string literal in SQL. It's equivalent to %Q in Mprintf,
+// but doesn't call into sqlite.
+func QuoteLiteral(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+
+// mprintf formats a single argument using the given conversion specification (without the length modifier) and verb
+func mprintf(spec string, verb byte, arg interface{}) (string, error) {
+	var cformat *C.char
+	var result *C.char
+
+	switch verb {
+	case 'd', 'i', 'u', 'x', 'X', 'o', 'c':
+		var v, ok = toInt64(arg)
+		if !ok {
+			return "", fmt.Errorf("sqlite: %%%c expects an integer argument, got %T", verb, arg)
+		}
+
+		if verb == 'c' {
+			cformat = C.CString(spec + "c")
+			defer C.free(unsafe.Pointer(cformat))
+			result = C._sqlite3_mprintf_int(cformat, C.int(v))
+		} else {
+			cformat = C.CString(spec + "ll" + string(verb))
+			defer C.free(unsafe.Pointer(cformat))
+			result = C._sqlite3_mprintf_int64(cformat, C.sqlite3_int64(v))
+		}
+
+	case 'f', 'e', 'E', 'g', 'G':
+		var v, ok = toFloat64(arg)
+		if !ok {
+			return "", fmt.Errorf("sqlite: %%%c expects a numeric argument, got %T", verb, arg)
+		}
+
+		cformat = C.CString(spec + string(verb))
+		defer C.free(unsafe.Pointer(cformat))
+		result = C._sqlite3_mprintf_double(cformat, C.double(v))
+
+	case 's', 'z', 'q', 'Q', 'w':
+		if verb == 'z' {
+			verb = 's' // %z frees its argument; the string here is owned by us
+		}
+
+		var carg *C.char
+		switch v := arg.(type) {
+		case nil:
+		case string:
+			carg = C.CString(v)
+			defer C.free(unsafe.Pointer(carg))
+		case []byte:
+			carg = C.CString(string(v))
+			defer C.free(unsafe.Pointer(carg))
+		default:
+			return "", fmt.Errorf("sqlite: %%%c expects a string argument, got %T", verb, arg)
+		}
+
+		cformat = C.CString(spec + string(verb))
+		defer C.free(unsafe.Pointer(cformat))
+		result = C._sqlite3_mprintf_text(cformat, carg)
+
+	default:
+		return "", fmt.Errorf("sqlite: unsupported conversion %%%c", verb)
+	}
+
+	if result == nil {
+		return "", SQLITE_NOMEM
+	}
+	defer C._sqlite3_free(unsafe.Pointer(result))
+	return C.GoString(result), nil
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+func toInt64(arg interface{}) (int64, bool) {
+	switch v := arg.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func toFloat64(arg interface{}) (float64, bool) {
+	switch v := arg.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		var i, ok = toInt64(arg)
+		return float64(i), ok
+	}
+}
@@ -16,9 +16,13 @@ import "C"
 
 import (
 	"errors"
+	"fmt"
 	"github.com/mattn/go-pointer"
+	"io"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -80,62 +84,229 @@ type WindowFunction interface {
 	Inverse(*AggregateContext, ...Value)
 }
 
-// CreateFunction creates a new custom sql function with the given name
-func (ext *ExtensionApi) CreateFunction(name string, fn Function) error {
-	var cname = C.CString(name)
-	defer C.free(unsafe.Pointer(cname))
+// FunctionOptions are the options that apply to every kind of function
+type FunctionOptions struct {
+	// DirectOnly prevents the function from being used in triggers, views, CHECK constraints and the like,
+	// ie. it can only be invoked from top-level SQL; see SQLITE_DIRECTONLY
+	DirectOnly bool
+
+	// Innocuous marks the function as safe to use in triggers and views even when the schema is untrusted,
+	// as it has no side effects and leaks no information; see SQLITE_INNOCUOUS
+	Innocuous bool
+
+	// Profile records the number and duration of the function's calls; see FunctionProfiles
+	Profile bool
+
+	// SubType declares that the function reads the subtype of its arguments with Value.SubType; see SQLITE_SUBTYPE
+	SubType bool
+
+	// ResultSubType declares that the function sets the subtype of its result with Context.ResultSubType;
+	// see SQLITE_RESULT_SUBTYPE. Setting a subtype without declaring it is reported on sqlite's error log.
+	ResultSubType bool
+}
+
+// SubTypeFunction is implemented by functions that declare their use of subtypes themselves, which has the same
+// effect as setting FunctionOptions.SubType and FunctionOptions.ResultSubType, including with CreateFunction.
+type SubTypeFunction interface {
+	Function
 
+	// SubTypes reports whether the function reads the subtype of its arguments and whether it sets the subtype of its result
+	SubTypes() (args, result bool)
+}
+
+// flags introduced in later versions of sqlite, that the bundled headers may not define
+const (
+	sqliteSubType       = 0x000100000 // SQLITE_SUBTYPE, since 3.30.0
+	sqliteResultSubType = 0x001000000 // SQLITE_RESULT_SUBTYPE, since 3.45.0
+)
+
+// subTypes reports whether fn, registered with opts, reads the subtype of its arguments and sets that of its result
+func (opts FunctionOptions) subTypes(fn Function) (args, result bool) {
+	args, result = opts.SubType, opts.ResultSubType
+	if st, ok := fn.(SubTypeFunction); ok {
+		var a, r = st.SubTypes()
+		args, result = args || a, result || r
+	}
+	return args, result
+}
+
+// flags returns the flags to pass to sqlite3_create_function_v2 and the like for fn registered with opts
+func (opts FunctionOptions) flags(fn Function) C.int {
 	var eTextRep = C.int(C.SQLITE_UTF8)
 	if fn.Deterministic() {
 		eTextRep |= C.SQLITE_DETERMINISTIC
 	}
+	if opts.DirectOnly {
+		eTextRep |= C.SQLITE_DIRECTONLY
+	}
+	if opts.Innocuous {
+		eTextRep |= C.SQLITE_INNOCUOUS
+	}
 
-	var pApp = pointer.Save(fn)
-	var destroy = (*[0]byte)(C.function_destroy)
+	// older versions reject flags they don't know about
+	var version, args, result = int(C._sqlite3_libversion_number()), false, false
+	if args, result = opts.subTypes(fn); args && version >= 3030000 {
+		eTextRep |= sqliteSubType
+	}
+	if result && version >= 3045000 {
+		eTextRep |= sqliteResultSubType
+	}
+	return eTextRep
+}
+
+// ScalarFunctionOptions are the options of CreateScalarFunction
+type ScalarFunctionOptions struct{ FunctionOptions }
+
+// AggregateFunctionOptions are the options of CreateAggregateFunction
+type AggregateFunctionOptions struct{ FunctionOptions }
+
+// WindowFunctionOptions are the options of CreateWindowFunction
+type WindowFunctionOptions struct{ FunctionOptions }
+
+// CreateFunction creates a new custom sql function with the given name. The kind of function is picked from
+// the interfaces fn implements: a WindowFunction is registered with CreateWindowFunction, any other
+// AggregateFunction with CreateAggregateFunction and a ScalarFunction with CreateScalarFunction,
+// all with default options.
+func (conn *Conn) CreateFunction(name string, fn Function) error {
+	switch fn := fn.(type) {
+	case ScalarFunction:
+		return conn.CreateScalarFunction(name, fn, ScalarFunctionOptions{})
+	case WindowFunction:
+		return conn.CreateWindowFunction(name, fn, WindowFunctionOptions{})
+	case AggregateFunction:
+		return conn.CreateAggregateFunction(name, fn, AggregateFunctionOptions{})
+	}
+
+	logDebug("sqlite: unknown function type", "function", name, "type", fmt.Sprintf("%T", fn))
+	return errors.New("sqlite: unknown function type")
+}
 
-	var res C.int
-	if _, ok := fn.(ScalarFunction); ok {
+// CreateScalarFunction creates a new custom sql scalar function with the given name
+func (conn *Conn) CreateScalarFunction(name string, fn ScalarFunction, opts ScalarFunctionOptions) error {
+	return conn.createFunction(name, fn, opts.FunctionOptions, func(cname *C.char, pApp unsafe.Pointer, destroy *[0]byte) C.int {
 		var applyTramp = (*[0]byte)(C.scalar_function_apply_tramp)
-		res = C._sqlite3_create_function_v2(ext.db, cname, C.int(fn.Args()), eTextRep, pApp, applyTramp, nil, nil, destroy)
-	} else if _, ok := fn.(AggregateFunction); ok {
+		return C._sqlite3_create_function_v2(conn.db, cname, C.int(fn.Args()), opts.flags(fn), pApp, applyTramp, nil, nil, destroy)
+	})
+}
+
+// CreateAggregateFunction creates a new custom sql aggregate function with the given name.
+// The function cannot be used as a window function, even if fn implements WindowFunction.
+func (conn *Conn) CreateAggregateFunction(name string, fn AggregateFunction, opts AggregateFunctionOptions) error {
+	return conn.createFunction(name, fn, opts.FunctionOptions, func(cname *C.char, pApp unsafe.Pointer, destroy *[0]byte) C.int {
 		var stepTramp = (*[0]byte)(C.aggregate_function_step_tramp)
 		var finalTramp = (*[0]byte)(C.aggregate_function_final_tramp)
+		return C._sqlite3_create_function_v2(conn.db, cname, C.int(fn.Args()), opts.flags(fn), pApp, nil, stepTramp, finalTramp, destroy)
+	})
+}
 
-		if _, isWindow := fn.(WindowFunction); !isWindow {
-			res = C._sqlite3_create_function_v2(ext.db, cname, C.int(fn.Args()), eTextRep, pApp, nil, stepTramp, finalTramp, destroy)
-		} else {
-			var valueTramp = (*[0]byte)(C.window_function_value_tramp)
-			var inverseTramp = (*[0]byte)(C.window_function_inverse_tramp)
-			res = C._sqlite3_create_window_function(ext.db, cname, C.int(fn.Args()), eTextRep, pApp, stepTramp, finalTramp, valueTramp, inverseTramp, destroy)
-		}
-	} else {
-		pointer.Unref(pApp)
-		return errors.New("sqlite: unknown function type")
+// CreateWindowFunction creates a new custom sql aggregate window function with the given name
+func (conn *Conn) CreateWindowFunction(name string, fn WindowFunction, opts WindowFunctionOptions) error {
+	return conn.createFunction(name, fn, opts.FunctionOptions, func(cname *C.char, pApp unsafe.Pointer, destroy *[0]byte) C.int {
+		var stepTramp = (*[0]byte)(C.aggregate_function_step_tramp)
+		var finalTramp = (*[0]byte)(C.aggregate_function_final_tramp)
+		var valueTramp = (*[0]byte)(C.window_function_value_tramp)
+		var inverseTramp = (*[0]byte)(C.window_function_inverse_tramp)
+		return C._sqlite3_create_window_function(conn.db, cname, C.int(fn.Args()), opts.flags(fn), pApp, stepTramp, finalTramp, valueTramp, inverseTramp, destroy)
+	})
+}
+
+// createFunction saves fn, profiling it if asked to, and registers it with register, which receives the name, the handle to fn and its destructor
+func (conn *Conn) createFunction(name string, fn Function, opts FunctionOptions, register func(*C.char, unsafe.Pointer, *[0]byte) C.int) error {
+	var cname = C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	var f = &function{impl: fn, name: name}
+	if opts.Profile || atomic.LoadInt32(&profileAll) != 0 {
+		f.profile = profile(name)
 	}
+	_, f.subTyped = opts.subTypes(fn)
+
+	var pApp = saveHandle(handleFunction, f)
 
-	return errorIfNotOk(res)
+	// sqlite invokes the destructor if the registration fails
+	if err := errorIfNotOk(register(cname, pApp, (*[0]byte)(C.function_destroy))); err != nil {
+		logDebug("sqlite: failed to register function", "function", name, "error", err)
+		return err
+	}
+	logDebug("sqlite: registered function", "function", name, "args", fn.Args())
+	return nil
+}
+
+// CreateFunction creates a new custom sql function with the given name
+func (ext *ExtensionApi) CreateFunction(name string, fn Function) error {
+	return ext.conn().CreateFunction(name, fn)
+}
+
+// CreateScalarFunction creates a new custom sql scalar function with the given name
+func (ext *ExtensionApi) CreateScalarFunction(name string, fn ScalarFunction, opts ScalarFunctionOptions) error {
+	return ext.conn().CreateScalarFunction(name, fn, opts)
+}
+
+// CreateAggregateFunction creates a new custom sql aggregate function with the given name
+func (ext *ExtensionApi) CreateAggregateFunction(name string, fn AggregateFunction, opts AggregateFunctionOptions) error {
+	return ext.conn().CreateAggregateFunction(name, fn, opts)
+}
+
+// CreateWindowFunction creates a new custom sql aggregate window function with the given name
+func (ext *ExtensionApi) CreateWindowFunction(name string, fn WindowFunction, opts WindowFunctionOptions) error {
+	return ext.conn().CreateWindowFunction(name, fn, opts)
 }
 
 // CreateCollation creates a new collation with the given name using the supplied comparison function.
 // The comparison function must obey the rules defined at https://www.sqlite.org/c3ref/create_collation.html
-func (ext *ExtensionApi) CreateCollation(name string, cmp func(string, string) int) error {
+func (conn *Conn) CreateCollation(name string, cmp func(string, string) int) error {
+	return conn.CreateCollationWithCloser(name, cmp, nil)
+}
+
+// CreateCollationWithCloser creates a new collation like CreateCollation does, and closes closer, if it isn't nil,
+// once the collation is replaced or the connection is closed, so that a collation that holds resources
+// (eg. the locale data of a collator) can release them.
+func (conn *Conn) CreateCollationWithCloser(name string, cmp func(string, string) int, closer io.Closer) error {
 	var cname = C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 
-	var pApp = pointer.Save(cmp)
+	var pApp = saveHandle(handleCollation, &collation{cmp: cmp, closer: closer, name: name})
 	var compare = (*[0]byte)(C.collation_function_compare_tramp)
 	var destroy = (*[0]byte)(C.function_destroy)
 
-	var res = C._sqlite3_create_collation_v2(ext.db, cname, C.SQLITE_UTF8, pApp, compare, destroy)
+	var res = C._sqlite3_create_collation_v2(conn.db, cname, C.SQLITE_UTF8, pApp, compare, destroy)
 	if err := ErrorCode(res); !err.ok() {
 		// release pApp as destroy isn't called automatically by sqlite3_create_collation_v2
-		pointer.Unref(pApp)
+		unrefHandle(pApp)
+		logDebug("sqlite: failed to register collation", "collation", name, "error", err)
 		return err
 	}
 
+	logDebug("sqlite: registered collation", "collation", name)
 	return nil
 }
 
+// CreateCollation creates a new collation with the given name using the supplied comparison function.
+func (ext *ExtensionApi) CreateCollation(name string, cmp func(string, string) int) error {
+	return ext.conn().CreateCollation(name, cmp)
+}
+
+// CreateCollationWithCloser creates a new collation that closes closer once it's destroyed; see Conn.CreateCollationWithCloser.
+func (ext *ExtensionApi) CreateCollationWithCloser(name string, cmp func(string, string) int, closer io.Closer) error {
+	return ext.conn().CreateCollationWithCloser(name, cmp, closer)
+}
+
+// function is the handle of a function registered with createFunction
+type function struct {
+	impl     Function
+	name     string
+	profile  *FunctionProfile // profile of the function, if it's profiled
+	subTyped bool             // whether the function declared setting a result subtype; see FunctionOptions.ResultSubType
+	warned   int32            // set once a missing subtype declaration is reported
+}
+
+// collation is the handle of a collation registered with CreateCollationWithCloser
+type collation struct {
+	cmp    func(string, string) int
+	closer io.Closer
+	name   string
+}
+
 func toValues(count C.int, va **C.sqlite3_value) []Value {
 	var n = int(count)
 	var values []Value
@@ -146,53 +317,132 @@ func toValues(count C.int, va **C.sqlite3_value) []Value {
 	return values
 }
 
-func getFunction(ctx *C.sqlite3_context) Function {
+// functionContext returns the Context of a call to a function registered with createFunction
+func functionContext(ctx *C.sqlite3_context) *Context {
 	var p = unsafe.Pointer(C._sqlite3_user_data(ctx))
-	return pointer.Restore(p).(Function)
+	return &Context{ptr: ctx, fn: pointer.Restore(p).(*function)}
+}
+
+// instrumentFunction reports a call to the function's method and starts a span for it (see Tracer);
+// it returns a func, to be deferred, that reports the duration of the call and ends the span with the error
+// the function failed with, if any, as reported with ctx.ResultError
+func instrumentFunction(ctx *Context, method string) func() {
+	var m, t, p = currentMetrics(), currentTracer(), ctx.fn.profile
+	if m == nil && t == nil && p == nil {
+		return func() {}
+	}
+
+	var name, start = ctx.fn.name, time.Now()
+	var end = startSpan("sqlite.function."+method, C._sqlite3_context_db_handle(ctx.ptr), AttributeFunction, name)
+	if m != nil {
+		m.Count(MetricFunctionCalls, name, 1)
+	}
+
+	var failed error
+	ctx.failed = &failed
+	return func() {
+		end(failed)
+		if m != nil {
+			observeSince(m, MetricFunctionDuration, name, start)
+		}
+		if p != nil {
+			p.record(time.Since(start))
+		}
+	}
+}
+
+// recoverFunction fails the function call with a *PanicError if it panicked; it must be deferred
+func recoverFunction(ctx *Context, callback string) {
+	if err := panicked(callback, recover()); err != nil {
+		ctx.ResultError(err)
+	}
 }
 
 // C <=> Go trampolines!
 
 //export scalar_function_apply_tramp
 func scalar_function_apply_tramp(ctx *C.sqlite3_context, n C.int, v **C.sqlite3_value) {
-	getFunction(ctx).(ScalarFunction).Apply(&Context{ptr: ctx}, toValues(n, v)...)
+	var c = functionContext(ctx)
+	defer instrumentFunction(c, "apply")() // deferred first, so that the span ends once a panic is recovered
+	defer recoverFunction(c, "xFunc")
+	c.fn.impl.(ScalarFunction).Apply(c, toValues(n, v)...)
 }
 
 //export aggregate_function_step_tramp
 func aggregate_function_step_tramp(ctx *C.sqlite3_context, n C.int, v **C.sqlite3_value) {
+	var fc = functionContext(ctx)
+	defer instrumentFunction(fc, "step")()
+	defer recoverFunction(fc, "xStep")
 	var id unsafe.Pointer = C._sqlite3_aggregate_context(ctx, C.int(1))
-	var c = &AggregateContext{Context: &Context{ptr: ctx}, id: id}
-	getFunction(ctx).(AggregateFunction).Step(c, toValues(n, v)...)
+	var c = &AggregateContext{Context: fc, id: id}
+	fc.fn.impl.(AggregateFunction).Step(c, toValues(n, v)...)
 }
 
 //export aggregate_function_final_tramp
 func aggregate_function_final_tramp(ctx *C.sqlite3_context) {
+	var fc = functionContext(ctx)
+	defer instrumentFunction(fc, "final")()
+	defer recoverFunction(fc, "xFinal")
 	var id unsafe.Pointer = C._sqlite3_aggregate_context(ctx, C.int(0))
 	defer func() { aggregateDataLock.Lock(); delete(aggregateDataStore, id); aggregateDataLock.Unlock() }() // release context value
 
-	var c = &AggregateContext{Context: &Context{ptr: ctx}, id: id}
-	getFunction(ctx).(AggregateFunction).Final(c)
+	var c = &AggregateContext{Context: fc, id: id}
+	fc.fn.impl.(AggregateFunction).Final(c)
 }
 
 //export window_function_value_tramp
 func window_function_value_tramp(ctx *C.sqlite3_context) {
+	var fc = functionContext(ctx)
+	defer instrumentFunction(fc, "value")()
+	defer recoverFunction(fc, "xValue")
 	var id unsafe.Pointer = C._sqlite3_aggregate_context(ctx, C.int(1))
-	var c = &AggregateContext{Context: &Context{ptr: ctx}, id: id}
-	getFunction(ctx).(WindowFunction).Value(c)
+	var c = &AggregateContext{Context: fc, id: id}
+	fc.fn.impl.(WindowFunction).Value(c)
 }
 
 //export window_function_inverse_tramp
 func window_function_inverse_tramp(ctx *C.sqlite3_context, n C.int, v **C.sqlite3_value) {
+	var fc = functionContext(ctx)
+	defer instrumentFunction(fc, "inverse")()
+	defer recoverFunction(fc, "xInverse")
 	var id unsafe.Pointer = C._sqlite3_aggregate_context(ctx, C.int(1))
-	var c = &AggregateContext{Context: &Context{ptr: ctx}, id: id}
-	getFunction(ctx).(WindowFunction).Inverse(c, toValues(n, v)...)
+	var c = &AggregateContext{Context: fc, id: id}
+	fc.fn.impl.(WindowFunction).Inverse(c, toValues(n, v)...)
 }
 
 //export collation_function_compare_tramp
-func collation_function_compare_tramp(pApp unsafe.Pointer, aLen C.int, a *C.char, bLen C.int, b *C.char) C.int {
-	var fn = pointer.Restore(pApp).(func(string, string) int)
+func collation_function_compare_tramp(pApp unsafe.Pointer, aLen C.int, a *C.char, bLen C.int, b *C.char) (res C.int) {
+	defer func() { // a collation cannot report errors; compare the strings as equal
+		if panicked("xCompare", recover()) != nil {
+			res = 0
+		}
+	}()
+	var fn = pointer.Restore(pApp).(*collation).cmp
 	return C.int(fn(C.GoStringN(a, aLen), C.GoStringN(b, bLen)))
 }
 
+// function_destroy releases the handle of a function or a collation, once it's replaced or the connection is closed.
+// A function that implements io.Closer is closed, as is the closer a collation is registered with.
+//
 //export function_destroy
-func function_destroy(ptr unsafe.Pointer) { pointer.Unref(ptr) }
+func function_destroy(ptr unsafe.Pointer) {
+	defer unrefHandle(ptr)
+
+	var closer io.Closer
+	var name string
+	switch v := pointer.Restore(ptr).(type) {
+	case *collation:
+		closer, name = v.closer, v.name
+	case *function:
+		closer, _ = v.impl.(io.Closer)
+		name = v.name
+	}
+	if closer == nil {
+		return
+	}
+
+	defer func() { _ = panicked("xDestroy", recover()) }()
+	if err := closer.Close(); err != nil {
+		Log(SQLITE_WARNING, fmt.Sprintf("sqlite: failed to close %s: %v", name, err))
+	}
+}
@@ -72,3 +72,104 @@ func TestCollation(t *testing.T) {
 		t.Fatalf("invalid count: got %d", count)
 	}
 }
+
+func TestVerifyCollation(t *testing.T) {
+	var corpus = []string{"", "a", "A", "aa", "aA", "b", "B", "bb", "ab", "Ab"}
+
+	var fold = func(a, b string) int { return strings.Compare(strings.ToLower(a), strings.ToLower(b)) }
+	if err := VerifyCollation(fold, corpus); err != nil {
+		t.Errorf("expected a valid collation got %v", err)
+	}
+
+	// caseInsensitive orders any two different strings both ways
+	if err := VerifyCollation(caseInsensitive, corpus); err == nil || !strings.Contains(err.Error(), "symmetric") {
+		t.Errorf("expected a symmetry violation got %v", err)
+	}
+
+	// equal lengths are equal, but otherwise strings are compared as is
+	var broken = func(a, b string) int {
+		if len(a) == len(b) {
+			return 0
+		}
+		return strings.Compare(a, b)
+	}
+	if err := VerifyCollation(broken, corpus); err == nil || !strings.Contains(err.Error(), "transitive") {
+		t.Errorf("expected a transitivity violation got %v", err)
+	}
+
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		if err := api.CreateCollation("fold", fold); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		var names, err = api.Collations()
+		if err != nil {
+			return SQLITE_ERROR, err
+		}
+		var found = map[string]bool{}
+		for _, name := range names {
+			found[name] = true
+		}
+		if !found["fold"] || !found["NOCASE"] || found["__go_sqlite_conn_state"] {
+			return SQLITE_ERROR, Error(SQLITE_ERROR, "unexpected collations: "+strings.Join(names, ", "))
+		}
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+// closerFunc is an io.Closer that calls the func it's made of
+type closerFunc func() error
+
+func (fn closerFunc) Close() error { return fn() }
+
+// Closing implements a closing() sql function that records when it's closed
+type Closing struct {
+	name   string
+	closed *[]string
+}
+
+func (m *Closing) Args() int                      { return 0 }
+func (m *Closing) Deterministic() bool            { return true }
+func (m *Closing) Apply(ctx *Context, _ ...Value) { ctx.ResultText(m.name) }
+func (m *Closing) Close() error                   { *m.closed = append(*m.closed, m.name); return nil }
+
+func TestDestroyCloses(t *testing.T) {
+	bootstrap(t)
+
+	conn, err := Open("file:closing.db?mode=memory", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var closed []string
+	if err = conn.CreateFunction("closing", &Closing{name: "first", closed: &closed}); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.CreateFunction("closing", &Closing{name: "second", closed: &closed}); err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 1 || closed[0] != "first" {
+		t.Fatalf("expected the replaced function to be closed got %v", closed)
+	}
+
+	var collator = closerFunc(func() error { closed = append(closed, "collation"); return nil })
+	if err = conn.CreateCollationWithCloser("fold", caseInsensitive, collator); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := ResultInt64(conn, "SELECT 'A' = 'a' COLLATE fold"); err != nil || n != 1 {
+		t.Fatalf("expected the collation to match got %d (%v)", n, err)
+	}
+
+	if err = conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 3 {
+		t.Fatalf("expected the function and the collation to be closed with the connection got %v", closed)
+	}
+}
@@ -2,8 +2,11 @@ package sqlite_test
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	. "go.riyazali.net/sqlite"
 )
@@ -66,8 +69,9 @@ const magic = 0xfe
 // to test subtypes.
 type X struct{}
 
-func (m *X) Args() int           { return 1 }
-func (m *X) Deterministic() bool { return true }
+func (m *X) Args() int              { return 1 }
+func (m *X) Deterministic() bool    { return true }
+func (m *X) SubTypes() (bool, bool) { return false, true }
 func (m *X) Apply(ctx *Context, values ...Value) {
 	ctx.ResultText(values[0].Text())
 	ctx.ResultSubType(magic)
@@ -77,8 +81,9 @@ func (m *X) Apply(ctx *Context, values ...Value) {
 // if s has the same subtype returned by x(s).
 type IsX struct{}
 
-func (m *IsX) Args() int           { return 1 }
-func (m *IsX) Deterministic() bool { return true }
+func (m *IsX) Args() int              { return 1 }
+func (m *IsX) Deterministic() bool    { return true }
+func (m *IsX) SubTypes() (bool, bool) { return true, false }
 func (m *IsX) Apply(ctx *Context, values ...Value) {
 	st := values[0].SubType()
 	if st == magic {
@@ -255,3 +260,265 @@ func TestDBFileName(t *testing.T) {
 		t.Fatalf("db_filename should return 'hello': got %q", result)
 	}
 }
+
+func TestConn_CreateFunction(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var conn = api.Connection()
+		if err := conn.CreateFunction("upper", &Upper{}); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		var result string
+		if err := conn.Exec("SELECT upper('sqlite')", func(stmt *Stmt) error {
+			result = stmt.ColumnText(0)
+			return nil
+		}); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		if result != "SQLITE" {
+			return SQLITE_ERROR, Error(SQLITE_ERROR, "invalid result: "+result)
+		}
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+// TooManyArgs is a scalar function that declares more arguments than sqlite allows
+type TooManyArgs struct{ Upper }
+
+func (m *TooManyArgs) Args() int { return 1000 }
+
+func TestRegistrar(t *testing.T) {
+	var failure error
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var code, err = api.Register().
+			Scalar("bad", &TooManyArgs{}).
+			Scalar("upper", &Upper{}).
+			Collation("bad", func(a, b string) int { return strings.Compare(a, b) }).
+			Done()
+
+		if code == SQLITE_OK || err == nil {
+			return SQLITE_ERROR, Error(SQLITE_ERROR, "expected registration to fail")
+		}
+		failure = err
+		return SQLITE_OK, nil
+	})
+
+	var db, err = Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var regErr *RegistrationError
+	if !errors.As(failure, &regErr) || len(regErr.Errors) != 1 {
+		t.Fatalf("expected a single registration failure, got %v", failure)
+	}
+	if !strings.Contains(failure.Error(), `scalar function "bad"`) {
+		t.Fatalf("error must describe the failed registration: %v", failure)
+	}
+
+	// registrations after the failed one must still have been made
+	var result string
+	if err = db.QueryRow("SELECT upper('sqlite') COLLATE bad").Scan(&result); err != nil {
+		t.Fatal(err)
+	} else if result != "SQLITE" {
+		t.Fatalf("invalid result: got %q", result)
+	}
+}
+
+// Typed implements a typed(n) sql scalar function that returns a differently typed Go value for each n,
+// using Context.Result
+type Typed struct{}
+
+func (m *Typed) Args() int           { return 1 }
+func (m *Typed) Deterministic() bool { return true }
+func (m *Typed) Apply(ctx *Context, values ...Value) {
+	var results = []interface{}{nil, true, uint8(7), int64(-1 << 40), float32(0.5), "", "text", []byte{0xca, 0xfe}, values[0], struct{}{}}
+	if err := ctx.Result(results[values[0].Int()]); err != nil {
+		ctx.ResultError(err)
+	}
+}
+
+func TestContext_Result(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		if err := api.CreateFunction("typed", &Typed{}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var tests = []struct{ typ, value string }{
+		{"null", ""}, {"integer", "1"}, {"integer", "7"}, {"integer", "-1099511627776"}, {"real", "0.5"},
+		{"text", ""}, {"text", "text"}, {"blob", "\xca\xfe"}, {"integer", "8"},
+	}
+
+	for n, test := range tests {
+		var typ string
+		var value sql.NullString
+		if err = db.QueryRow("SELECT typeof(typed(?)), CAST(typed(?) AS TEXT)", n, n).Scan(&typ, &value); err != nil {
+			t.Fatal(err)
+		}
+		if typ != test.typ || value.String != test.value {
+			t.Errorf("typed(%d): expected %s %q, got %s %q", n, test.typ, test.value, typ, value.String)
+		}
+	}
+
+	if _, err = db.Exec("SELECT typed(9)"); err == nil || !strings.Contains(err.Error(), "unsupported result type") {
+		t.Fatalf("expected an error for an unsupported type, got %v", err)
+	}
+}
+
+func TestMemoize(t *testing.T) {
+	var calls = 0
+	var label = Memoize(2, func(values ...Value) (interface{}, error) {
+		calls++
+		if values[1].Int() < 0 {
+			return nil, errors.New("negative")
+		}
+		return values[0].Text() + "-" + values[1].Text(), nil
+	})
+
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		if err := api.CreateFunction("label", label); err != nil {
+			return SQLITE_ERROR, err
+		}
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var series = "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 100) "
+
+	var labels string
+	if err = db.QueryRow(series + "SELECT group_concat(DISTINCT label('n', x % 3)) FROM c").Scan(&labels); err != nil {
+		t.Fatal(err)
+	}
+	if labels != "n-1,n-2,n-0" {
+		t.Fatalf("unexpected labels %q", labels)
+	}
+	if calls != 3 {
+		t.Fatalf("expected a call per distinct argument, got %d calls", calls)
+	}
+
+	// the cache only lasts for the statement
+	calls = 0
+	if err = db.QueryRow(series + "SELECT COUNT(label(x, 'n')) FROM c").Scan(new(int)); err != nil {
+		t.Fatal(err)
+	} else if calls != 100 {
+		t.Fatalf("expected a call per row, got %d calls", calls)
+	}
+
+	if _, err = db.Exec("SELECT label('n', -1)"); err == nil || !strings.Contains(err.Error(), "negative") {
+		t.Fatalf("expected error from memoized function, got %v", err)
+	}
+}
+
+// Sleepy implements a sleepy(ms) sql function that sleeps for the given number of milliseconds
+type Sleepy struct{}
+
+func (m *Sleepy) Args() int           { return 1 }
+func (m *Sleepy) Deterministic() bool { return false }
+func (m *Sleepy) Apply(ctx *Context, values ...Value) {
+	time.Sleep(time.Duration(values[0].Int()) * time.Millisecond)
+	ctx.ResultNull()
+}
+
+func TestFunctionProfiles(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var opts = ScalarFunctionOptions{FunctionOptions: FunctionOptions{Profile: true}}
+		if err := api.CreateScalarFunction("sleepy", &Sleepy{}, opts); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := api.CreateFunction("function_profiles", FunctionProfiler{}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ResetFunctionProfiles()
+	if _, err = db.Exec("SELECT sleepy(1), sleepy(5)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var profile *FunctionProfile
+	for _, p := range FunctionProfiles() {
+		if p.Name == "sleepy" {
+			profile = &p
+		}
+	}
+	if profile == nil || profile.Calls != 2 {
+		t.Fatalf("expected sleepy to be called twice, got %+v", profile)
+	}
+	if profile.Max < 5*time.Millisecond || profile.Total < 6*time.Millisecond || profile.Average() < 3*time.Millisecond {
+		t.Fatalf("expected durations to be recorded, got %+v", profile)
+	}
+
+	var profiles string
+	if err = db.QueryRow("SELECT function_profiles()").Scan(&profiles); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(profiles, `"name":"sleepy","calls":2`) {
+		t.Fatalf("expected profiles to include sleepy, got %s", profiles)
+	}
+}
+
+// Failing implements a failing(n) sql scalar function that fails with the n-th of a set of wrapped errors
+type Failing struct{}
+
+func (m *Failing) Args() int           { return 1 }
+func (m *Failing) Deterministic() bool { return true }
+func (m *Failing) Apply(ctx *Context, values ...Value) {
+	var errs = []error{
+		fmt.Errorf("failing: %w", SQLITE_CONSTRAINT_UNIQUE),
+		fmt.Errorf("failing: %w", &QueryError{Code: SQLITE_BUSY, Extended: SQLITE_BUSY_SNAPSHOT, Offset: -1}),
+	}
+	ctx.ResultError(errs[values[0].Int()])
+}
+
+func TestContext_ResultError(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+		if err := api.CreateFunction("failing", &Failing{}); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		for n, code := range []ErrorCode{SQLITE_CONSTRAINT_UNIQUE, SQLITE_BUSY_SNAPSHOT} {
+			var err = c.Exec("SELECT failing(?)", nil, n)
+			if !errors.Is(err, code) || !strings.Contains(err.Error(), "failing: ") {
+				return SQLITE_ERROR, fmt.Errorf("expected the wrapped %v to be reported, got %v", code, err)
+			}
+		}
+
+		// sqlite fails opening the connection if an error is still pending on it after loading the extension
+		return SQLITE_OK, c.Exec("SELECT 1", nil)
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
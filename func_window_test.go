@@ -156,3 +156,48 @@ func TestWindowFunction(t *testing.T) {
 		}
 	})
 }
+
+func TestCreateAggregateFunction(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		if err := api.CreateAggregateFunction("aggregate_sum", &Sum{}, AggregateFunctionOptions{}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := api.CreateWindowFunction("window_sum", &Sum{}, WindowFunctionOptions{}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		var opts = ScalarFunctionOptions{FunctionOptions: FunctionOptions{DirectOnly: true}}
+		if err := api.CreateScalarFunction("direct_upper", &Upper{}, opts); err != nil {
+			return SQLITE_ERROR, err
+		}
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	var total int
+	if err = db.QueryRow("SELECT aggregate_sum(value) FROM (SELECT 1 AS value UNION ALL SELECT 2)").Scan(&total); err != nil || total != 3 {
+		t.Fatalf("expected aggregate to sum to 3, got %d, %v", total, err)
+	}
+	if err = db.QueryRow("SELECT window_sum(1) OVER ()").Scan(&total); err != nil || total != 1 {
+		t.Fatalf("expected window function to work, got %d, %v", total, err)
+	}
+	if _, err = db.Exec("SELECT aggregate_sum(1) OVER ()"); err == nil {
+		t.Fatalf("expected aggregate-only function to be rejected as a window function")
+	}
+
+	var upper string
+	if err = db.QueryRow("SELECT direct_upper('a')").Scan(&upper); err != nil || upper != "A" {
+		t.Fatalf("expected direct-only function to work at top-level, got %q, %v", upper, err)
+	}
+	if _, err = db.Exec("CREATE VIEW v AS SELECT direct_upper('a') AS a"); err == nil {
+		_, err = db.Exec("SELECT * FROM v")
+	}
+	if err == nil {
+		t.Fatalf("expected direct-only function to be rejected in a view")
+	}
+}
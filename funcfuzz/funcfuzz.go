@@ -0,0 +1,398 @@
+//go:build static
+// +build static
+
+// Package funcfuzz provides a harness that calls scalar, aggregate and window functions built with
+// go.riyazali.net/sqlite with randomized arguments, through real SQL, to catch crashes before they are released.
+//
+// Arguments cover every sqlite type and the edge cases functions tend to mishandle: NULL, extreme integers,
+// infinite floats, empty, invalid UTF-8 and NUL-containing text, empty and huge blobs, and values carrying a subtype.
+// The harness reports:
+//
+//   - panics in any of the function's methods (which would otherwise crash the process when they reach C)
+//   - deterministic functions returning different results for the same arguments
+//   - violations reported by Options.Check, eg. a decode function not reversing its encode counterpart
+//
+// Calls that fail with an error aren't reported, as functions may legitimately reject some arguments.
+//
+// Run generates arguments with a seeded random number generator. With Go 1.18 and later, Fuzz plugs the
+// harness into native fuzzing (go test -fuzz). Like sqlitetest, the package requires the static and sqlite_vtable build tags.
+package funcfuzz
+
+import (
+	"fmt"
+	"go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/sqlitetest"
+	"math"
+	"math/rand"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// Arg is an argument passed to the function under test
+type Arg struct {
+	Value   interface{} // nil, int64, float64, string or []byte
+	SubType int         // subtype attached to the value; zero means none
+}
+
+func (a Arg) String() string {
+	var s string
+	switch v := a.Value.(type) {
+	case nil:
+		s = "NULL"
+	case []byte:
+		if len(v) > 32 {
+			s = fmt.Sprintf("blob(%d bytes)", len(v))
+		} else {
+			s = fmt.Sprintf("x'%x'", v)
+		}
+	case string:
+		if len(v) > 32 {
+			s = fmt.Sprintf("text(%d bytes)", len(v))
+		} else {
+			s = fmt.Sprintf("%q", v)
+		}
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	if a.SubType != 0 {
+		s += fmt.Sprintf(" (subtype %d)", a.SubType)
+	}
+	return s
+}
+
+// Options represents the various options that affect how a function is fuzzed
+type Options struct {
+	Iterations  int   // number of calls to generate; defaults to 200
+	Seed        int64 // seed for the random number generator; defaults to 1 so that runs are reproducible
+	MaxArgs     int   // maximum number of arguments passed to functions accepting any number (Args() == -1); defaults to 4
+	MaxRows     int   // maximum number of rows passed to aggregate and window functions; defaults to 8
+	MaxBlobSize int   // size of the huge blobs and text passed to the function; defaults to 1MiB
+
+	// Check, if set, is called with the arguments and the result of every successful call to a scalar function.
+	// Result is nil, int64, float64, string or []byte. A non-nil error is reported as a violation.
+	Check func(args []Arg, result interface{}) error
+}
+
+// WithIterations sets the number of calls to generate
+func WithIterations(n int) func(*Options) {
+	return func(opt *Options) { opt.Iterations = n }
+}
+
+// WithSeed sets the seed for the random number generator
+func WithSeed(seed int64) func(*Options) {
+	return func(opt *Options) { opt.Seed = seed }
+}
+
+// WithMaxBlobSize sets the size of the huge blobs and text passed to the function
+func WithMaxBlobSize(n int) func(*Options) {
+	return func(opt *Options) { opt.MaxBlobSize = n }
+}
+
+// WithCheck sets the function called to verify the result of every successful call to a scalar function
+func WithCheck(check func(args []Arg, result interface{}) error) func(*Options) {
+	return func(opt *Options) { opt.Check = check }
+}
+
+// counter used to register every function under a unique name
+var functions int64
+
+// name under which the function under test is registered
+const function = "funcfuzz_fn"
+
+// Run calls the function, which must implement one of sqlite.ScalarFunction, sqlite.AggregateFunction or
+// sqlite.WindowFunction, with randomized arguments, and reports any violation as a test error.
+func Run(t testing.TB, fn sqlite.Function, opts ...func(*Options)) {
+	t.Helper()
+
+	var h = newHarness(t, fn, opts...)
+	var rnd = rand.New(rand.NewSource(h.options.Seed))
+	for i := 0; i < h.options.Iterations && !t.Failed(); i++ {
+		var rows = 1
+		if h.aggregate {
+			rows = rnd.Intn(h.options.MaxRows + 1)
+		}
+
+		var args = make([][]Arg, rows)
+		var n = h.arity(rnd.Intn(h.options.MaxArgs + 1))
+		for r := range args {
+			args[r] = make([]Arg, n)
+			for i := range args[r] {
+				args[r][i] = h.generate(rnd)
+			}
+		}
+		h.call(t, args)
+	}
+}
+
+// harness registers the function under test with a database and calls it
+type harness struct {
+	db        *sqlitetest.DB
+	fn        sqlite.Function
+	options   *Options
+	aggregate bool // whether fn is an aggregate (or window) function
+	window    bool // whether fn is a window function
+
+	t       testing.TB // test the current call is being made for
+	current string     // description of the current call; included in reports
+}
+
+func newHarness(t testing.TB, fn sqlite.Function, opts ...func(*Options)) *harness {
+	t.Helper()
+
+	var options = &Options{Iterations: 200, Seed: 1, MaxArgs: 4, MaxRows: 8, MaxBlobSize: 1 << 20}
+	for _, f := range opts {
+		f(options)
+	}
+
+	var h = &harness{fn: fn, options: options, t: t}
+	var checked sqlite.Function
+	switch fn := fn.(type) {
+	case sqlite.WindowFunction:
+		checked, h.aggregate, h.window = &checkedWindow{checkedAggregate{h, fn}, fn}, true, true
+	case sqlite.AggregateFunction:
+		checked, h.aggregate = &checkedAggregate{h, fn}, true
+	case sqlite.ScalarFunction:
+		checked = &checkedScalar{h, fn}
+	default:
+		t.Fatalf("funcfuzz: %T is neither a scalar, aggregate nor window function", fn)
+	}
+
+	var extension = fmt.Sprintf("funcfuzz-%d", atomic.AddInt64(&functions, 1))
+	sqlite.RegisterNamed(extension, func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateFunction(function, checked); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		if err := api.CreateFunction("funcfuzz_subtype", &subtype{}); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+	defer sqlite.Unregister(extension)
+
+	h.db = sqlitetest.Open(t, sqlitetest.WithExtensions(extension))
+	return h
+}
+
+// arity returns the number of arguments to pass to the function, using n for functions accepting any number
+func (h *harness) arity(n int) int {
+	if args := h.fn.Args(); args >= 0 {
+		return args
+	}
+	return n
+}
+
+// generate returns a random argument
+func (h *harness) generate(rnd *rand.Rand) Arg {
+	var arg Arg
+	switch rnd.Intn(12) {
+	case 0:
+		arg.Value = nil
+	case 1:
+		arg.Value = []int64{0, 1, -1, math.MaxInt64, math.MinInt64}[rnd.Intn(5)]
+	case 2:
+		arg.Value = rnd.Int63() - rnd.Int63()
+	case 3:
+		arg.Value = []float64{0, math.Copysign(0, -1), math.Inf(1), math.Inf(-1), math.SmallestNonzeroFloat64, math.MaxFloat64}[rnd.Intn(6)]
+	case 4:
+		arg.Value = rnd.NormFloat64() * 1e6
+	case 5:
+		arg.Value = []string{"", "a", "héllo, 世界", "a\x00b", "\xff\xfe\xfd", "\xc3\x28", "NULL", "1e400"}[rnd.Intn(8)]
+	case 6:
+		var b = make([]byte, rnd.Intn(64))
+		rnd.Read(b)
+		arg.Value = string(b) // most likely invalid UTF-8
+	case 7:
+		arg.Value = strings.Repeat("x", h.options.MaxBlobSize)
+	case 8:
+		arg.Value = []byte{}
+	case 9, 10:
+		var b = make([]byte, rnd.Intn(64))
+		rnd.Read(b)
+		arg.Value = b
+	case 11:
+		arg.Value = make([]byte, h.options.MaxBlobSize)
+	}
+
+	if rnd.Intn(4) == 0 {
+		arg.SubType = 1 + rnd.Intn(255)
+	}
+	return arg
+}
+
+// call calls the function with the given rows of arguments (a single row for scalar functions)
+func (h *harness) call(t testing.TB, rows [][]Arg) {
+	t.Helper()
+	h.t = t
+
+	var query string
+	var params []interface{}
+	if !h.aggregate {
+		var placeholders []string
+		placeholders, params = bind(rows[0])
+		query = fmt.Sprintf("SELECT %s(%s)", function, strings.Join(placeholders, ", "))
+	} else {
+		var values []string
+		for _, row := range rows {
+			var placeholders, p = bind(row)
+			values = append(values, "("+strings.Join(append([]string{"0"}, placeholders...), ", ")+")")
+			params = append(params, p...)
+		}
+
+		var n = h.arity(0)
+		if len(rows) > 0 {
+			n = len(rows[0])
+		}
+
+		// VALUES names its columns column1, column2 and so on; the first one is a placeholder
+		var columns, empty = []string{}, []string{"0 AS column1"}
+		for i := 0; i < n; i++ {
+			columns = append(columns, fmt.Sprintf("column%d", i+2))
+			empty = append(empty, fmt.Sprintf("NULL AS column%d", i+2))
+		}
+
+		var source = "(SELECT " + strings.Join(empty, ", ") + " WHERE 0)"
+		if len(values) > 0 {
+			source = "(VALUES " + strings.Join(values, ", ") + ")"
+		}
+
+		var over string
+		if h.window {
+			over = " OVER (ROWS BETWEEN 1 PRECEDING AND CURRENT ROW)"
+		}
+		query = fmt.Sprintf("SELECT %s(%s)%s FROM %s", function, strings.Join(columns, ", "), over, source)
+	}
+	h.current = fmt.Sprintf("%s with %v", query, rows)
+
+	var first, err = h.query(query, params...)
+	if err != nil {
+		return
+	}
+
+	if h.fn.Deterministic() {
+		var second, err = h.query(query, params...)
+		if err != nil || !equal(first, second) {
+			h.fail("deterministic function returned %v and then %v (err: %v)", first, second, err)
+		}
+	}
+
+	if h.options.Check != nil && !h.aggregate {
+		if err = h.options.Check(rows[0], first[0]); err != nil {
+			h.fail("check failed: %v", err)
+		}
+	}
+}
+
+// bind returns the placeholders and parameters for the arguments
+func bind(args []Arg) (placeholders []string, params []interface{}) {
+	for _, arg := range args {
+		if arg.SubType != 0 {
+			placeholders = append(placeholders, fmt.Sprintf("funcfuzz_subtype(?, %d)", arg.SubType))
+		} else {
+			placeholders = append(placeholders, "?")
+		}
+		params = append(params, arg.Value)
+	}
+	return placeholders, params
+}
+
+// query runs the query and returns the values in the first column of the result
+func (h *harness) query(query string, params ...interface{}) ([]interface{}, error) {
+	var rows, err = h.db.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []interface{}
+	for rows.Next() {
+		var v interface{}
+		if err = rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, rows.Err()
+}
+
+func equal(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if fmt.Sprintf("%T %v", a[i], a[i]) != fmt.Sprintf("%T %v", b[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// fail reports a violation
+func (h *harness) fail(format string, args ...interface{}) {
+	h.t.Errorf("funcfuzz: %s (while running %s)", fmt.Sprintf(format, args...), h.current)
+}
+
+// recover reports a panic in the named method and reports it as an error to sqlite; it must be deferred
+func (h *harness) recover(method string, ctx *sqlite.Context) {
+	if r := recover(); r != nil {
+		h.fail("%s panicked: %v\n%s", method, r, debug.Stack())
+		ctx.ResultError(fmt.Errorf("funcfuzz: %s panicked: %v", method, r))
+	}
+}
+
+// subtype implements funcfuzz_subtype(value, subtype) that returns value with the given subtype
+type subtype struct{}
+
+func (*subtype) Args() int              { return 2 }
+func (*subtype) Deterministic() bool    { return true }
+func (*subtype) SubTypes() (bool, bool) { return false, true }
+func (*subtype) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
+	ctx.ResultValue(values[0])
+	ctx.ResultSubType(sqlite.SubType(values[1].Int()))
+}
+
+type checkedScalar struct {
+	*harness
+	fn sqlite.ScalarFunction
+}
+
+func (s *checkedScalar) Args() int           { return s.fn.Args() }
+func (s *checkedScalar) Deterministic() bool { return s.fn.Deterministic() }
+func (s *checkedScalar) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
+	defer s.recover("Apply", ctx)
+	s.fn.Apply(ctx, values...)
+}
+
+type checkedAggregate struct {
+	*harness
+	fn sqlite.AggregateFunction
+}
+
+func (a *checkedAggregate) Args() int           { return a.fn.Args() }
+func (a *checkedAggregate) Deterministic() bool { return a.fn.Deterministic() }
+func (a *checkedAggregate) Step(ctx *sqlite.AggregateContext, values ...sqlite.Value) {
+	defer a.recover("Step", ctx.Context)
+	a.fn.Step(ctx, values...)
+}
+
+func (a *checkedAggregate) Final(ctx *sqlite.AggregateContext) {
+	defer a.recover("Final", ctx.Context)
+	a.fn.Final(ctx)
+}
+
+type checkedWindow struct {
+	checkedAggregate
+	fn sqlite.WindowFunction
+}
+
+func (w *checkedWindow) Value(ctx *sqlite.AggregateContext) {
+	defer w.recover("Value", ctx.Context)
+	w.fn.Value(ctx)
+}
+
+func (w *checkedWindow) Inverse(ctx *sqlite.AggregateContext, values ...sqlite.Value) {
+	defer w.recover("Inverse", ctx.Context)
+	w.fn.Inverse(ctx, values...)
+}
@@ -0,0 +1,130 @@
+//go:build static
+// +build static
+
+package funcfuzz_test
+
+import (
+	"encoding/hex"
+	"fmt"
+	"go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/funcfuzz"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Hex implements a hex(...) sql scalar function that encodes the bytes of its argument
+type Hex struct{}
+
+func (*Hex) Args() int           { return 1 }
+func (*Hex) Deterministic() bool { return true }
+func (*Hex) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
+	if values[0].Type() == sqlite.SQLITE_NULL {
+		ctx.ResultNull()
+	} else {
+		ctx.ResultText(hex.EncodeToString(values[0].Blob()))
+	}
+}
+
+// checkHex verifies the result of Hex for text and blob arguments
+func checkHex(args []funcfuzz.Arg, result interface{}) error {
+	var want interface{}
+	switch v := args[0].Value.(type) {
+	case nil:
+		want = nil
+	case string:
+		want = hex.EncodeToString([]byte(v))
+	case []byte:
+		want = hex.EncodeToString(v)
+	default:
+		return nil
+	}
+
+	if want == "" {
+		want = nil // Context.ResultText returns an empty string as NULL
+	}
+
+	if result != want {
+		return fmt.Errorf("expected %.32v, got %.32v", want, result)
+	}
+	return nil
+}
+
+// TotalLength implements a total_length(...) sql aggregate function that sums the length of all its arguments
+type TotalLength struct{}
+
+func (*TotalLength) Args() int           { return -1 }
+func (*TotalLength) Deterministic() bool { return true }
+func (*TotalLength) Step(ctx *sqlite.AggregateContext, values ...sqlite.Value) {
+	var total, _ = ctx.Data().(int)
+	for _, v := range values {
+		total += v.Len()
+	}
+	ctx.SetData(total)
+}
+
+func (*TotalLength) Final(ctx *sqlite.AggregateContext) {
+	var total, _ = ctx.Data().(int)
+	ctx.ResultInt(total)
+}
+
+// FirstByte implements a first_byte(...) sql scalar function that panics on empty arguments
+type FirstByte struct{}
+
+func (*FirstByte) Args() int           { return 1 }
+func (*FirstByte) Deterministic() bool { return true }
+func (*FirstByte) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
+	ctx.ResultInt(int(values[0].Blob()[0]))
+}
+
+func TestRun(t *testing.T) {
+	t.Run("Scalar", func(t *testing.T) {
+		funcfuzz.Run(t, &Hex{}, funcfuzz.WithCheck(checkHex), funcfuzz.WithMaxBlobSize(64*1024))
+	})
+
+	t.Run("Aggregate", func(t *testing.T) {
+		funcfuzz.Run(t, &TotalLength{}, funcfuzz.WithMaxBlobSize(64*1024))
+	})
+}
+
+// recorder is a testing.TB that records errors instead of failing the test
+type recorder struct {
+	testing.TB
+	mu     sync.Mutex
+	errors []string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+func (r *recorder) Failed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.errors) > 0
+}
+
+func TestRun_Panic(t *testing.T) {
+	var r = &recorder{TB: t}
+
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+		funcfuzz.Run(r, &FirstByte{}, funcfuzz.WithMaxBlobSize(1024))
+	}()
+	<-done
+
+	if len(r.errors) == 0 {
+		t.Fatal("expected the panic to be reported")
+	} else if !strings.Contains(r.errors[0], "Apply panicked") {
+		t.Fatalf("unexpected report: %s", r.errors[0])
+	}
+}
@@ -0,0 +1,125 @@
+//go:build static && go1.18
+// +build static,go1.18
+
+package funcfuzz
+
+import (
+	"encoding/binary"
+	"go.riyazali.net/sqlite"
+	"math"
+	"testing"
+)
+
+// Fuzz plugs the harness into native fuzzing: the function is called with the arguments decoded from the
+// fuzzer's inputs, and any violation fails the test. Without -fuzz, only a built-in seed corpus is run.
+// Options controlling generation (like Iterations and Seed) are ignored.
+//
+//	func FuzzHex(f *testing.F) { funcfuzz.Fuzz(f, &Hex{}) }
+func Fuzz(f *testing.F, fn sqlite.Function, opts ...func(*Options)) {
+	f.Helper()
+
+	var h = newHarness(f, fn, opts...)
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) { h.call(t, h.decode(data)) })
+}
+
+// seeds is the corpus each fuzz test starts with; see decodeArg for the encoding
+var seeds = [][]byte{
+	{},
+	{0},
+	{1, 42, 0, 0, 0, 0, 0, 0, 0},
+	{2, 0, 0, 0, 0, 0, 0, 0xf0, 0x7f},
+	{3, 5, 'h', 'e', 'l', 'l', 'o'},
+	{3 | 10<<3, 2, '{', '}'},
+	{4, 2, 0xff, 0xfe},
+	{5, 3, 0, 1, 2},
+	{7, 0, 0, 7, 1},
+}
+
+// decode decodes the rows of arguments to pass to the function from data
+func (h *harness) decode(data []byte) [][]Arg {
+	var args []Arg
+	for len(data) > 0 {
+		var arg Arg
+		arg, data = h.decodeArg(data)
+		args = append(args, arg)
+	}
+
+	if !h.aggregate {
+		var n = h.arity(len(args))
+		if h.fn.Args() < 0 && n > h.options.MaxArgs {
+			n = h.options.MaxArgs
+		}
+		return [][]Arg{pad(args, n)}
+	}
+
+	var n = h.arity(1)
+	var rows = make([][]Arg, 0)
+	for len(args) > 0 && len(rows) < h.options.MaxRows {
+		var k = n
+		if k > len(args) {
+			k = len(args)
+		}
+		rows, args = append(rows, pad(args[:k], n)), args[k:]
+		if n == 0 {
+			args = args[1:] // every argument stands for a row with no arguments
+		}
+	}
+	return rows
+}
+
+// decodeArg decodes a single argument from data and returns the remaining bytes.
+// The first byte selects the type of the value (lower 3 bits) and its subtype (upper 5 bits).
+// Integers and floats are read from the next 8 bytes; text and blobs are prefixed with their length.
+func (h *harness) decodeArg(data []byte) (Arg, []byte) {
+	var arg = Arg{SubType: int(data[0] >> 3)}
+	var kind = data[0] & 7
+	data = data[1:]
+
+	switch kind {
+	case 0:
+		arg.Value = nil
+	case 1, 2:
+		var buf [8]byte
+		data = data[copy(buf[:], data):]
+		if bits := binary.LittleEndian.Uint64(buf[:]); kind == 1 {
+			arg.Value = int64(bits)
+		} else {
+			arg.Value = math.Float64frombits(bits)
+		}
+	case 3, 4, 5, 6:
+		var n = 0
+		if len(data) > 0 {
+			n, data = int(data[0]), data[1:]
+		}
+		if n > len(data) {
+			n = len(data)
+		}
+		if kind <= 4 {
+			arg.Value = string(data[:n])
+		} else {
+			arg.Value = append([]byte{}, data[:n]...)
+		}
+		data = data[n:]
+	case 7:
+		if len(data) > 0 && data[0]&1 == 1 {
+			arg.Value = make([]byte, h.options.MaxBlobSize)
+		} else {
+			arg.Value = string(make([]byte, h.options.MaxBlobSize))
+		}
+		if len(data) > 0 {
+			data = data[1:]
+		}
+	}
+	return arg, data
+}
+
+// pad returns args, padded with NULLs (or truncated) to n arguments
+func pad(args []Arg, n int) []Arg {
+	var padded = make([]Arg, n)
+	copy(padded, args)
+	return padded
+}
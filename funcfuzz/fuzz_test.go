@@ -0,0 +1,13 @@
+//go:build static && go1.18
+// +build static,go1.18
+
+package funcfuzz_test
+
+import (
+	"go.riyazali.net/sqlite/funcfuzz"
+	"testing"
+)
+
+func FuzzHex(f *testing.F) {
+	funcfuzz.Fuzz(f, &Hex{}, funcfuzz.WithCheck(checkHex), funcfuzz.WithMaxBlobSize(64*1024))
+}
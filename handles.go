@@ -0,0 +1,98 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"fmt"
+	"github.com/mattn/go-pointer"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// categories of handles passed to sqlite, used in leak accounting
+const (
+	handleFunction    = "function"
+	handleCollation   = "collation"
+	handleModule      = "module"
+	handleTable       = "virtual table"
+	handleCursor      = "virtual cursor"
+	handleOverload    = "overloaded function"
+	handlePointer     = "pointer"
+	handleHook        = "hook"
+	handleState       = "connection state"
+	handleVFS         = "vfs"
+	handleFile        = "file"
+	handleApplyParams = "changeset apply"
+	handleAuxData     = "auxiliary data"
+)
+
+var ( // protected registry of live handles; only populated while tracking is enabled
+	handleTracking int32
+	handlesLock    sync.Mutex
+	handles        = map[unsafe.Pointer]string{}
+)
+
+// TrackHandles enables (or disables) accounting of the handles to Go values (functions, modules, tables, cursors,
+// bound pointers and the like) that are passed to sqlite and released by sqlite through destructors.
+// Only handles created while tracking is enabled are accounted for. Use LiveHandles or DumpLiveHandles to
+// inspect the handles that are still alive, which helps long-running processes detect leaks.
+func TrackHandles(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&handleTracking, v)
+}
+
+// LiveHandles returns the number of live handles, created while tracking was enabled, per category.
+func LiveHandles() map[string]int {
+	handlesLock.Lock()
+	defer handlesLock.Unlock()
+
+	var counts = make(map[string]int)
+	for _, category := range handles {
+		counts[category]++
+	}
+	return counts
+}
+
+// DumpLiveHandles returns a human-readable summary of the live handles, created while tracking was enabled,
+// with one line per category, sorted by category.
+func DumpLiveHandles() string {
+	var counts = LiveHandles()
+	var categories = make([]string, 0, len(counts))
+	for category := range counts {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	var buf strings.Builder
+	for _, category := range categories {
+		_, _ = fmt.Fprintf(&buf, "%s: %d\n", category, counts[category])
+	}
+	return buf.String()
+}
+
+// saveHandle saves v and returns a handle that can be passed to sqlite, accounting for it if tracking is enabled
+func saveHandle(category string, v interface{}) unsafe.Pointer {
+	var p = pointer.Save(v)
+	if atomic.LoadInt32(&handleTracking) != 0 {
+		handlesLock.Lock()
+		handles[p] = category
+		handlesLock.Unlock()
+	}
+	return p
+}
+
+// unrefHandle releases a handle returned by saveHandle; it's a no-op if p isn't a known handle
+func unrefHandle(p unsafe.Pointer) {
+	pointer.Unref(p)
+
+	handlesLock.Lock()
+	delete(handles, p)
+	handlesLock.Unlock()
+}
@@ -0,0 +1,207 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// insertBatchSize is the maximum number of rows InsertMany binds to a single statement
+const insertBatchSize = 64
+
+// RowError is the error InsertMany ran into while inserting a row
+type RowError struct {
+	Row int // index of the row, starting at zero
+	Err error
+}
+
+func (e *RowError) Error() string { return fmt.Sprintf("sqlite: row %d: %v", e.Row, e.Err) }
+func (e *RowError) Unwrap() error { return e.Err }
+
+// InsertErrors is returned by InsertMany when some of the rows couldn't be inserted
+type InsertErrors []*RowError
+
+func (errs InsertErrors) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more errors)", errs[0], len(errs)-1)
+}
+
+// InsertMany inserts the rows into the given columns of table, and returns the number of rows inserted.
+// Each row must have one value per column; values are bound as with Exec.
+//
+// The rows are inserted within a single transaction (or a savepoint, if a transaction is already open) using
+// statements that are prepared once and insert many rows at a time. A row that fails to insert, because it violates
+// a constraint or has the wrong number of values, doesn't stop the others from being inserted; its error is reported,
+// along with the index of the row, in the InsertErrors returned once all the rows have been inserted.
+// Any other error rolls back all the rows and is returned as is.
+func (conn *Conn) InsertMany(table string, cols []string, rows [][]interface{}) (int, error) {
+	var i = 0
+	return conn.InsertEach(table, cols, func() ([]interface{}, bool) {
+		if i == len(rows) {
+			return nil, false
+		}
+		i++
+		return rows[i-1], true
+	})
+}
+
+// InsertEach is like InsertMany but takes its rows from next, which is called until it returns false.
+// It lets importers stream rows from their source instead of loading them all in memory first.
+func (conn *Conn) InsertEach(table string, cols []string, next func() ([]interface{}, bool)) (n int, err error) {
+	if len(cols) == 0 {
+		return 0, fmt.Errorf("sqlite: no columns to insert into %q", table)
+	}
+
+	var batchSize = insertBatchSize
+	if max := conn.Limit(LIMIT_VARIABLE_NUMBER) / len(cols); max < batchSize {
+		batchSize = max
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	var ins = &inserter{}
+	defer ins.finalize()
+	if ins.one, err = conn.prepareInsert(table, cols, 1); err != nil {
+		return 0, err
+	}
+	if batchSize > 1 {
+		if ins.many, err = conn.prepareInsert(table, cols, batchSize); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = conn.Exec("SAVEPOINT insert_many", nil); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if _, failed := err.(InsertErrors); err != nil && !failed {
+			n = 0
+			_ = conn.Exec("ROLLBACK TO insert_many", nil)
+		}
+		if rerr := conn.Exec("RELEASE insert_many", nil); err == nil {
+			err = rerr
+		}
+	}()
+
+	var batch = make([][]interface{}, 0, batchSize)
+	var indexes = make([]int, 0, batchSize) // indexes of the rows in batch
+	for index := 0; ; index++ {
+		var row, ok = next()
+		if ok {
+			if len(row) != len(cols) {
+				ins.errs = append(ins.errs, &RowError{Row: index,
+					Err: fmt.Errorf("expected %d values got %d", len(cols), len(row))})
+				continue
+			}
+			batch, indexes = append(batch, row), append(indexes, index)
+			if len(batch) < batchSize {
+				continue
+			}
+		}
+
+		if err = ins.insert(indexes, batch); err != nil {
+			return 0, err
+		}
+		batch, indexes = batch[:0], indexes[:0]
+
+		if !ok {
+			break
+		}
+	}
+
+	if len(ins.errs) > 0 {
+		return ins.n, ins.errs
+	}
+	return ins.n, nil
+}
+
+// prepareInsert prepares the statement that inserts n rows into the columns of table
+func (conn *Conn) prepareInsert(table string, cols []string, n int) (*Stmt, error) {
+	var quoted = make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = QuoteIdentifier(col)
+	}
+
+	var placeholders = "(" + strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ") + ")"
+	var values = make([]string, n)
+	for i := range values {
+		values[i] = placeholders
+	}
+
+	var query = fmt.Sprintf("INSERT INTO %s (%s) VALUES %s",
+		QuoteIdentifier(table), strings.Join(quoted, ", "), strings.Join(values, ", "))
+	var stmt, _, err = conn.Prepare(query)
+	return stmt, err
+}
+
+// inserter holds the statements and the state of a call to InsertEach
+type inserter struct {
+	one, many *Stmt // statements inserting a single row and a full batch
+	n         int   // number of rows inserted
+	errs      InsertErrors
+}
+
+// insert inserts the rows of a batch, along with their indexes. If the batch fails, its rows are inserted
+// one by one, to find out which of them failed. Only errors that aren't caused by a row are returned.
+func (ins *inserter) insert(indexes []int, batch [][]interface{}) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if ins.many != nil && len(batch) == cap(batch) {
+		if err := ins.exec(ins.many, batch); err == nil {
+			ins.n += len(batch)
+			return nil
+		} else if !isRowError(err) {
+			return err
+		}
+	}
+
+	for i, row := range batch {
+		if err := ins.exec(ins.one, [][]interface{}{row}); err == nil {
+			ins.n++
+		} else if isRowError(err) {
+			ins.errs = append(ins.errs, &RowError{Row: indexes[i], Err: err})
+		} else {
+			return err
+		}
+	}
+	return nil
+}
+
+// exec binds the rows to the statement and steps through it
+func (ins *inserter) exec(stmt *Stmt, rows [][]interface{}) error {
+	defer func() { _ = stmt.Reset() }()
+
+	var param = 1
+	for _, row := range rows {
+		for _, value := range row {
+			stmt.bindArg(param, value)
+			param++
+		}
+	}
+	var _, err = stmt.Step()
+	return err
+}
+
+func (ins *inserter) finalize() {
+	for _, stmt := range []*Stmt{ins.one, ins.many} {
+		if stmt != nil {
+			_ = stmt.Finalize()
+		}
+	}
+}
+
+// isRowError reports whether err is caused by the values of a row, rather than the state of the connection
+func isRowError(err error) bool {
+	if _, ok := ConstraintCode(err); ok {
+		return true
+	}
+	return errors.Is(err, SQLITE_MISMATCH) || errors.Is(err, SQLITE_TOOBIG) || errors.Is(err, SQLITE_RANGE)
+}
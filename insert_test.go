@@ -0,0 +1,59 @@
+package sqlite_test
+
+import (
+	"errors"
+	. "go.riyazali.net/sqlite"
+	"testing"
+)
+
+func TestInsertMany(t *testing.T) {
+	bootstrap(t)
+
+	conn, err := Open("file:insert.db?mode=memory", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err = conn.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT NOT NULL)", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows [][]interface{}
+	for i := 0; i < 200; i++ {
+		rows = append(rows, []interface{}{i, "row"})
+	}
+	rows[10][1] = nil                   // violates the NOT NULL constraint
+	rows[150] = []interface{}{151}      // has too few values
+	rows[199] = []interface{}{0, "dup"} // violates the primary key
+
+	n, err := conn.InsertMany("t", []string{"id", "name"}, rows)
+	if n != 197 {
+		t.Errorf("expected 197 rows to be inserted got %d", n)
+	}
+
+	var errs InsertErrors
+	if !errors.As(err, &errs) || len(errs) != 3 {
+		t.Fatalf("expected 3 row errors got %v", err)
+	}
+	for i, row := range []int{10, 150, 199} {
+		if errs[i].Row != row {
+			t.Errorf("expected error for row %d got %d", row, errs[i].Row)
+		}
+	}
+	if !errors.Is(errs[0], SQLITE_CONSTRAINT_NOTNULL) {
+		t.Errorf("expected a NOT NULL constraint error got %v", errs[0])
+	}
+
+	if count, err := ResultInt64(conn, "SELECT COUNT(*) FROM t"); err != nil || count != 197 {
+		t.Errorf("expected 197 rows got %d (%v)", count, err)
+	}
+
+	// anything other than a bad row rolls back every row
+	if _, err = conn.InsertMany("missing", []string{"id"}, [][]interface{}{{1}}); err == nil {
+		t.Error("expected an error inserting into a missing table")
+	}
+	if !conn.AutoCommit() {
+		t.Error("expected the savepoint to be released")
+	}
+}
@@ -0,0 +1,40 @@
+// Package fixture provides the extension shared by the tests of the packages that load extensions into connections
+// opened by other means (like autoload and the interop packages), along with the query checking it's loaded.
+package fixture
+
+import (
+	"strings"
+	"testing"
+
+	"go.riyazali.net/sqlite"
+)
+
+// Query calls the go_upper function created by the extension; it returns "SQLITE" when the extension is loaded
+const Query = "SELECT go_upper('sqlite')"
+
+// Upper implements a UPPER(...) sql scalar function
+type Upper struct{}
+
+func (m *Upper) Args() int           { return 1 }
+func (m *Upper) Deterministic() bool { return true }
+func (m *Upper) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
+	ctx.ResultText(strings.ToUpper(values[0].Text()))
+}
+
+// Register registers the extension, which creates the go_upper function, under the given name
+func Register(name string) {
+	sqlite.RegisterNamed(name, func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateFunction("go_upper", &Upper{}); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+// Check fails the test unless result is the one returned by Query
+func Check(t testing.TB, result string) {
+	t.Helper()
+	if result != "SQLITE" {
+		t.Fatalf("invalid result: got %q", result)
+	}
+}
@@ -0,0 +1,163 @@
+// Package arrow exposes Apache Arrow records as read-only sqlite virtual tables, so that analytics pipelines
+// holding their data in Arrow can query it in SQL through an extension built with go.riyazali.net/sqlite.
+//
+// Tables are built on vtabutil.ColumnarTable: the cursor walks the rows of one record at a time and reads
+// each column straight from its array.
+package arrow
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/vtabutil"
+)
+
+// Module is a read-only virtual table module over Arrow records. Open is invoked with the arguments of
+// the CREATE VIRTUAL TABLE statement (see sqlite.ParseCreationArgs) when the table is connected, to find
+// the schema of its records, and at the start of every scan, to read them. The readers it returns are released
+// once they're no longer needed.
+//
+//	api.CreateModule("trades", &arrow.Module{Open: func(args []string) (array.RecordReader, error) {
+//		return array.NewRecordReader(schema, records)
+//	}})
+type Module struct {
+	Open func(args []string) (array.RecordReader, error)
+}
+
+// Connect declares a table with a column for each field of the schema of the records returned by Open
+func (m *Module) Connect(_ *sqlite.Conn, args []string, declare func(string) error) (sqlite.VirtualTable, error) {
+	var reader, err = m.Open(args)
+	if err != nil {
+		return nil, err
+	}
+	var schema = reader.Schema()
+	reader.Release()
+
+	var decl string
+	if decl, err = Declaration(schema); err != nil {
+		return nil, err
+	}
+
+	var read = func() (vtabutil.BatchReader, error) {
+		var reader, err = m.Open(args)
+		if err != nil {
+			return nil, err
+		}
+		if !reader.Schema().Equal(schema) {
+			reader.Release()
+			return nil, errors.New("arrow: schema of the records changed since the table was connected")
+		}
+		return Reader(reader), nil
+	}
+	return &vtabutil.ColumnarTable{Read: read}, declare(decl)
+}
+
+// Declaration returns the CREATE TABLE statement declaring a virtual table with a column for each field of schema.
+// It fails if a field has a type the package doesn't support (see Vector).
+func Declaration(schema *arrow.Schema) (string, error) {
+	var columns = make([]string, len(schema.Fields()))
+	for i, field := range schema.Fields() {
+		var typ, ok = columnType(field.Type)
+		if !ok {
+			return "", fmt.Errorf("arrow: unsupported type %s of field %q", field.Type, field.Name)
+		}
+		columns[i] = strings.TrimSpace(sqlite.QuoteIdentifier(field.Name) + " " + typ)
+	}
+	return "CREATE TABLE x(" + strings.Join(columns, ", ") + ")", nil
+}
+
+// columnType returns the declared type of a column holding values of the given arrow type
+func columnType(typ arrow.DataType) (string, bool) {
+	switch typ.ID() {
+	case arrow.BOOL, arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64,
+		arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64:
+		return "INTEGER", true
+	case arrow.FLOAT32, arrow.FLOAT64:
+		return "REAL", true
+	case arrow.STRING:
+		return "TEXT", true
+	case arrow.BINARY:
+		return "BLOB", true
+	case arrow.NULL:
+		return "", true
+	}
+	return "", false
+}
+
+// Reader adapts an array.RecordReader to a vtabutil.BatchReader; releasing the BatchReader releases r
+func Reader(r array.RecordReader) vtabutil.BatchReader { return &reader{r: r} }
+
+type reader struct{ r array.RecordReader }
+
+func (r *reader) Next() bool            { return r.r.Next() }
+func (r *reader) Batch() vtabutil.Batch { return Batch(r.r.Record()) }
+func (r *reader) Err() error            { return nil } // array.RecordReader doesn't report errors
+func (r *reader) Release()              { r.r.Release() }
+
+// Batch adapts an array.Record to a vtabutil.Batch. The record must outlive the batch.
+func Batch(rec array.Record) vtabutil.Batch {
+	var b = batch{rec: rec, vectors: make([]vtabutil.Vector, rec.NumCols())}
+	for i := range b.vectors {
+		b.vectors[i] = Vector(rec.Column(i))
+	}
+	return b
+}
+
+// batch is a vtabutil.Batch over a record, with the vectors of its columns adapted up front
+type batch struct {
+	rec     array.Record
+	vectors []vtabutil.Vector
+}
+
+func (b batch) NumRows() int64               { return b.rec.NumRows() }
+func (b batch) NumCols() int64               { return b.rec.NumCols() }
+func (b batch) Column(i int) vtabutil.Vector { return b.vectors[i] }
+
+// Vector adapts an array to a vtabutil.Vector. Booleans, integers, floats, strings and binaries are supported,
+// as are arrays of the null type; Vector returns nil for an array of any other type.
+func Vector(arr array.Interface) vtabutil.Vector {
+	switch arr := arr.(type) {
+	case *array.Boolean:
+		return vector{arr, func(i int) interface{} { return arr.Value(i) }}
+	case *array.Int8:
+		return vector{arr, func(i int) interface{} { return arr.Value(i) }}
+	case *array.Int16:
+		return vector{arr, func(i int) interface{} { return arr.Value(i) }}
+	case *array.Int32:
+		return vector{arr, func(i int) interface{} { return arr.Value(i) }}
+	case *array.Int64:
+		return vector{arr, func(i int) interface{} { return arr.Value(i) }}
+	case *array.Uint8:
+		return vector{arr, func(i int) interface{} { return arr.Value(i) }}
+	case *array.Uint16:
+		return vector{arr, func(i int) interface{} { return arr.Value(i) }}
+	case *array.Uint32:
+		return vector{arr, func(i int) interface{} { return arr.Value(i) }}
+	case *array.Uint64:
+		return vector{arr, func(i int) interface{} { return arr.Value(i) }}
+	case *array.Float32:
+		return vector{arr, func(i int) interface{} { return arr.Value(i) }}
+	case *array.Float64:
+		return vector{arr, func(i int) interface{} { return arr.Value(i) }}
+	case *array.String:
+		return vector{arr, func(i int) interface{} { return arr.Value(i) }}
+	case *array.Binary:
+		return vector{arr, func(i int) interface{} { return arr.Value(i) }}
+	case *array.Null:
+		return vector{arr, func(int) interface{} { return nil }}
+	}
+	return nil
+}
+
+// vector is a vtabutil.Vector over an array, reading its values with value
+type vector struct {
+	arr   array.Interface
+	value func(i int) interface{}
+}
+
+func (v vector) IsNull(i int) bool       { return v.arr.IsNull(i) }
+func (v vector) Value(i int) interface{} { return v.value(i) }
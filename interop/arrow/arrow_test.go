@@ -0,0 +1,98 @@
+//go:build static
+// +build static
+
+package arrow_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/memory"
+	"go.riyazali.net/sqlite"
+	sqlitearrow "go.riyazali.net/sqlite/interop/arrow"
+	"go.riyazali.net/sqlite/sqlitetest"
+)
+
+var schema = arrow.NewSchema([]arrow.Field{
+	{Name: "sensor", Type: arrow.BinaryTypes.String},
+	{Name: "reading", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	{Name: "count", Type: arrow.PrimitiveTypes.Int32},
+	{Name: "ok", Type: arrow.FixedWidthTypes.Boolean},
+	{Name: "raw", Type: arrow.BinaryTypes.Binary},
+}, nil)
+
+// record builds a record of the given sensors and readings, where the readings that aren't valid are NULL
+func record(sensors []string, readings []float64, valid []bool) array.Record {
+	var b = array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	defer b.Release()
+
+	for i, sensor := range sensors {
+		b.Field(0).(*array.StringBuilder).Append(sensor)
+		b.Field(2).(*array.Int32Builder).Append(int32(i))
+		b.Field(3).(*array.BooleanBuilder).Append(i%2 == 0)
+		b.Field(4).(*array.BinaryBuilder).Append([]byte(strings.ToUpper(sensor)))
+	}
+	b.Field(1).(*array.Float64Builder).AppendValues(readings, valid)
+	return b.NewRecord()
+}
+
+func init() {
+	sqlite.RegisterNamed("arrow", func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		var module = &sqlitearrow.Module{Open: func(args []string) (array.RecordReader, error) {
+			var records = []array.Record{
+				record([]string{"a", "b"}, []float64{1.5, 0}, []bool{true, false}),
+				record(nil, nil, nil), // empty records are skipped
+				record([]string{"c"}, []float64{3.25}, nil),
+			}
+			defer func() {
+				for _, rec := range records {
+					rec.Release()
+				}
+			}()
+			return array.NewRecordReader(schema, records)
+		}}
+		if err := api.CreateModule("sensors", module); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+
+		var unsupported = arrow.NewSchema([]arrow.Field{{Name: "at", Type: arrow.FixedWidthTypes.Date32}}, nil)
+		var broken = &sqlitearrow.Module{Open: func(args []string) (array.RecordReader, error) {
+			return array.NewRecordReader(unsupported, nil)
+		}}
+		if err := api.CreateModule("unsupported", broken); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func TestModule(t *testing.T) {
+	var db = sqlitetest.Open(t, sqlitetest.WithExtensions("arrow"))
+	db.MustExec("CREATE VIRTUAL TABLE readings USING sensors")
+
+	var want = [][]interface{}{
+		{int64(1), "a", 1.5, int64(0), int64(1), []byte("A")},
+		{int64(2), "b", nil, int64(1), int64(0), []byte("B")},
+		{int64(3), "c", 3.25, int64(0), int64(1), []byte("C")},
+	}
+	for i := 0; i < 2; i++ { // every scan reads the records again
+		if got := db.QueryRows("SELECT rowid, sensor, reading, count, ok, raw FROM readings"); !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+
+	var got = db.QueryRows("SELECT name, type FROM pragma_table_info('readings')")
+	var columns = [][]interface{}{
+		{"sensor", "TEXT"}, {"reading", "REAL"}, {"count", "INTEGER"}, {"ok", "INTEGER"}, {"raw", "BLOB"},
+	}
+	if !reflect.DeepEqual(got, columns) {
+		t.Fatalf("expected columns %v, got %v", columns, got)
+	}
+
+	if _, err := db.Exec("CREATE VIRTUAL TABLE dates USING unsupported"); err == nil || !strings.Contains(err.Error(), "unsupported type") {
+		t.Fatalf("expected an error for an unsupported type, got %v", err)
+	}
+}
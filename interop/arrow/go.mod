@@ -0,0 +1,11 @@
+module go.riyazali.net/sqlite/interop/arrow
+
+go 1.15
+
+replace go.riyazali.net/sqlite => ../../
+
+require (
+	github.com/apache/arrow/go/arrow v0.0.0-20211112161151-bc219186db40
+	go.riyazali.net/sqlite v0.0.0-00010101000000-000000000000
+	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
+)
@@ -0,0 +1,64 @@
+// Package crawshaw provides helpers to use extensions built with go.riyazali.net/sqlite
+// together with crawshaw.io/sqlite, without building them as loadable shared objects.
+//
+// As crawshaw.io/sqlite statically links the sqlite3 library, the program must be built with the static build tag
+// so that the extension binds directly to the same sqlite3 library.
+package crawshaw
+
+import (
+	"crawshaw.io/sqlite"
+	"errors"
+	ext "go.riyazali.net/sqlite"
+	"reflect"
+	"runtime"
+)
+
+// Handle returns the address of the sqlite3* database handle underlying the connection.
+//
+// crawshaw.io/sqlite doesn't expose the handle and so it is read from the connection's unexported field.
+func Handle(conn *sqlite.Conn) (uintptr, error) {
+	if conn == nil {
+		return 0, errors.New("crawshaw: nil connection")
+	}
+
+	var field = reflect.ValueOf(conn).Elem().FieldByName("conn")
+	if !field.IsValid() || field.Kind() != reflect.Ptr {
+		return 0, errors.New("crawshaw: unsupported version of crawshaw.io/sqlite")
+	}
+	return field.Pointer(), nil
+}
+
+// Register initializes the extensions registered under the given names (or the default extension if no name is given)
+// with the connection. It must be called for every connection (eg. every connection created by sqlitex.Pool).
+func Register(conn *sqlite.Conn, names ...string) error {
+	if len(names) == 0 {
+		names = []string{"default"}
+	}
+
+	var handle, err = Handle(conn)
+	if err != nil {
+		return err
+	}
+	defer runtime.KeepAlive(conn)
+
+	for _, name := range names {
+		if err = ext.RegisterWithHandle(handle, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenConn opens a new connection using sqlite.OpenConn and initializes the named extensions with it.
+func OpenConn(path string, flags sqlite.OpenFlags, names ...string) (*sqlite.Conn, error) {
+	var conn, err = sqlite.OpenConn(path, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = Register(conn, names...); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,38 @@
+//go:build static
+// +build static
+
+package crawshaw_test
+
+import (
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+	ext "go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/internal/testing/fixture"
+	"go.riyazali.net/sqlite/interop/crawshaw"
+	"testing"
+)
+
+func TestOpenConn(t *testing.T) {
+	fixture.Register("crawshaw")
+	defer ext.Unregister("crawshaw")
+
+	var conn, err = crawshaw.OpenConn("file:testing.db?mode=memory", 0, "crawshaw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var result string
+	err = sqlitex.Exec(conn, fixture.Query, func(stmt *sqlite.Stmt) error {
+		result = stmt.ColumnText(0)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture.Check(t, result)
+
+	if err = crawshaw.Register(conn, "missing"); err == nil {
+		t.Fatal("expected error for unregistered extension")
+	}
+}
@@ -0,0 +1,10 @@
+module go.riyazali.net/sqlite/interop/crawshaw
+
+go 1.14
+
+replace go.riyazali.net/sqlite => ../../
+
+require (
+	crawshaw.io/sqlite v0.3.2
+	go.riyazali.net/sqlite v0.0.0-00010101000000-000000000000
+)
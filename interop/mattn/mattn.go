@@ -0,0 +1,60 @@
+// Package mattn provides helpers to use extensions built with go.riyazali.net/sqlite
+// together with github.com/mattn/go-sqlite3, without building them as loadable shared objects.
+//
+// As go-sqlite3 statically links the sqlite3 library, the program must be built with the static build tag
+// so that the extension binds directly to the same sqlite3 library.
+package mattn
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/mattn/go-sqlite3"
+	"go.riyazali.net/sqlite"
+	"reflect"
+	"runtime"
+)
+
+// Handle returns the address of the sqlite3* database handle underlying the connection.
+//
+// go-sqlite3 doesn't expose the handle and so it is read from the connection's unexported field.
+func Handle(conn *sqlite3.SQLiteConn) (uintptr, error) {
+	if conn == nil {
+		return 0, errors.New("mattn: nil connection")
+	}
+
+	var field = reflect.ValueOf(conn).Elem().FieldByName("db")
+	if !field.IsValid() || field.Kind() != reflect.Ptr {
+		return 0, errors.New("mattn: unsupported version of github.com/mattn/go-sqlite3")
+	}
+	return field.Pointer(), nil
+}
+
+// ConnectHook returns a function that can be used as sqlite3.SQLiteDriver.ConnectHook.
+// It initializes the extensions registered under the given names (or the default extension if no name is given)
+// with every new connection opened by the driver.
+func ConnectHook(names ...string) func(*sqlite3.SQLiteConn) error {
+	if len(names) == 0 {
+		names = []string{"default"}
+	}
+
+	return func(conn *sqlite3.SQLiteConn) error {
+		var handle, err = Handle(conn)
+		if err != nil {
+			return err
+		}
+		defer runtime.KeepAlive(conn)
+
+		for _, name := range names {
+			if err = sqlite.RegisterWithHandle(handle, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Register registers a new database/sql driver with the given name that
+// initializes the named extensions with every new connection. See ConnectHook for details.
+func Register(driverName string, names ...string) {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{ConnectHook: ConnectHook(names...)})
+}
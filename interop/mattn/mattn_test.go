@@ -0,0 +1,34 @@
+package mattn_test
+
+import (
+	"database/sql"
+	"go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/internal/testing/fixture"
+	"go.riyazali.net/sqlite/interop/mattn"
+	"testing"
+
+	// initializes the sqlite3_api routines when the package isn't built with the static tag
+	_ "go.riyazali.net/sqlite/internal/testing/sqlite"
+)
+
+func init() {
+	// internal/testing/sqlite loads the default extension with all connections
+	sqlite.Register(func(*sqlite.ExtensionApi) (sqlite.ErrorCode, error) { return sqlite.SQLITE_OK, nil })
+
+	fixture.Register("mattn")
+	mattn.Register("sqlite3_mattn_test", "mattn")
+}
+
+func TestConnectHook(t *testing.T) {
+	var db, err = sql.Open("sqlite3_mattn_test", "file:testing.db?mode=memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var result string
+	if err = db.QueryRow(fixture.Query).Scan(&result); err != nil {
+		t.Fatal(err)
+	}
+	fixture.Check(t, result)
+}
@@ -0,0 +1,35 @@
+package sqlite
+
+// #include <stdlib.h>
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+import "C"
+
+import "unsafe"
+
+// IsKeyword reports whether s is an SQL keyword recognized by sqlite (case-insensitively).
+// Identifiers that are keywords must be quoted when used in SQL.
+// see: https://www.sqlite.org/lang_keywords.html
+func IsKeyword(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	var cs = C.CString(s)
+	defer C.free(unsafe.Pointer(cs))
+	return C._sqlite3_keyword_check(cs, C.int(len(s))) != 0
+}
+
+// Keywords returns all the SQL keywords recognized by sqlite, in upper case.
+func Keywords() []string {
+	var n = int(C._sqlite3_keyword_count())
+	var keywords = make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		var name *C.char
+		var size C.int
+		if C._sqlite3_keyword_name(C.int(i), &name, &size) == C.SQLITE_OK {
+			keywords = append(keywords, C.GoStringN(name, size))
+		}
+	}
+	return keywords
+}
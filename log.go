@@ -0,0 +1,58 @@
+package sqlite
+
+// #include <stdlib.h>
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+import "C"
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// LogHandler receives messages written to sqlite's error log; see https://www.sqlite.org/errlog.html
+// The code is the (possibly extended) result code associated with the message.
+//
+// A handler must not call into sqlite and must be quick, as it's invoked synchronously,
+// possibly while sqlite holds internal locks.
+type LogHandler func(code ErrorCode, msg string)
+
+var ( // protected handler that receives sqlite's log messages
+	logLock    sync.RWMutex
+	logHandler LogHandler
+)
+
+// Log writes a message to sqlite's error log, using the same stream sqlite uses for its internal
+// warnings and errors. The message is delivered to the handler installed with SetLogHandler (if any).
+func Log(code ErrorCode, msg string) {
+	var cmsg = C.CString(msg)
+	defer C.free(unsafe.Pointer(cmsg))
+	C._sqlite3_log(C.int(code), cmsg)
+}
+
+// dispatchLog delivers a log message to the installed handler
+func dispatchLog(code ErrorCode, msg string) {
+	logLock.RLock()
+	var handler = logHandler
+	logLock.RUnlock()
+
+	if handler != nil {
+		handler(code, msg)
+	}
+}
+
+// debugLogger holds the func internal events are logged with (see SetLogger), wrapped in debugLoggerHolder
+// as atomic.Value cannot hold nil
+var debugLogger atomic.Value
+
+type debugLoggerHolder struct {
+	log func(msg string, args ...interface{})
+}
+
+// logDebug logs an internal event, with args as alternating keys and values, if a logger is set
+func logDebug(msg string, args ...interface{}) {
+	if h, _ := debugLogger.Load().(debugLoggerHolder); h.log != nil {
+		h.log(msg, args...)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build cgo && !static
+// +build cgo,!static
+
+package sqlite
+
+import "errors"
+
+// SetLogHandler installs fn as the handler for messages written to sqlite's error log.
+//
+// sqlite only accepts the log configuration before it's initialized, which has already happened by the time
+// a run-time loadable extension is loaded. Hence, it's only supported when the package is built with the static tag
+// (see docs/STATIC_LINKING.md); otherwise SetLogHandler always returns an error.
+func SetLogHandler(fn LogHandler) error {
+	return errors.New("sqlite: log handler can only be installed when built with the static tag")
+}
@@ -0,0 +1,40 @@
+//go:build cgo && go1.21
+// +build cgo,go1.21
+
+package sqlite
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogHandler returns a LogHandler that writes messages to the given structured logger.
+// Notices are logged at info level, warnings at warn level and everything else at error level.
+func SlogHandler(logger *slog.Logger) LogHandler {
+	return func(code ErrorCode, msg string) {
+		var level = slog.LevelError
+		switch code & 0xff {
+		case SQLITE_NOTICE:
+			level = slog.LevelInfo
+		case SQLITE_WARNING:
+			level = slog.LevelWarn
+		}
+		logger.LogAttrs(context.Background(), level, msg, slog.Int("code", int(code)), slog.String("error", code.String()))
+	}
+}
+
+// SetLogger sets the logger the package logs its internal events with, at debug level: registration of functions,
+// collations, modules and extensions, errors returned to sqlite by functions and virtual tables, hooks replaced
+// by newer ones, and the like. Passing nil disables logging, which is the default.
+//
+// Unlike SetLogHandler, which receives sqlite's own error log, it's meant to help diagnose the Go side of an extension.
+func SetLogger(logger *slog.Logger) {
+	if logger == nil {
+		debugLogger.Store(debugLoggerHolder{})
+		return
+	}
+
+	debugLogger.Store(debugLoggerHolder{log: func(msg string, args ...interface{}) {
+		logger.Log(context.Background(), slog.LevelDebug, msg, args...)
+	}})
+}
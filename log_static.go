@@ -0,0 +1,43 @@
+//go:build static
+// +build static
+
+package sqlite
+
+// #include <sqlite3ext.h>
+//
+// extern void log_tramp(void*, int, char*);
+//
+// static int _config_log(void) { return sqlite3_config(SQLITE_CONFIG_LOG, log_tramp, 0); }
+import "C"
+
+import (
+	"sync"
+	"unsafe"
+)
+
+var logConfigured sync.Once
+var logConfigError error
+
+// SetLogHandler installs fn as the handler for messages written to sqlite's error log, replacing any previous handler.
+// Passing nil discards the messages.
+//
+// sqlite only accepts the log configuration before it's initialized, and so, the first call to SetLogHandler
+// must happen before any connection is opened (or any other call that initializes the library, like
+// sqlite3_auto_extension); else it returns an error. Once installed, the handler can be replaced at any time.
+func SetLogHandler(fn LogHandler) error {
+	logConfigured.Do(func() { logConfigError = errorIfNotOk(C._config_log()) })
+	if logConfigError != nil {
+		return logConfigError
+	}
+
+	logLock.Lock()
+	defer logLock.Unlock()
+	logHandler = fn
+	return nil
+}
+
+//export log_tramp
+func log_tramp(_ unsafe.Pointer, code C.int, msg *C.char) {
+	defer func() { _ = panicked("xLog", recover()) }()
+	dispatchLog(ErrorCode(code), C.GoString(msg))
+}
@@ -0,0 +1,82 @@
+//go:build go1.21
+// +build go1.21
+
+package sqlite_test
+
+import (
+	"bytes"
+	. "go.riyazali.net/sqlite"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		Log(SQLITE_NOTICE, "extension loaded")
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+
+	// the library is initialized by now, and so, the log can't be configured anymore
+	if err = SetLogHandler(func(ErrorCode, string) {}); err == nil {
+		t.Fatal("expected error when installing handler after initialization")
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	var handler = SlogHandler(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	handler(SQLITE_WARNING_AUTOINDEX, "automatic index on t(v)")
+	handler(SQLITE_CORRUPT, "database corruption")
+
+	var lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %q", buf.String())
+	}
+	if !strings.Contains(lines[0], "level=WARN") || !strings.Contains(lines[0], "error=SQLITE_WARNING_AUTOINDEX") {
+		t.Fatalf("unexpected record %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "level=ERROR") || !strings.Contains(lines[1], `msg="database corruption"`) {
+		t.Fatalf("unexpected record %q", lines[1])
+	}
+}
+
+func TestSetLogger(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer SetLogger(nil)
+
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		if err := api.CreateFunction("logged_failing", &failing{}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err = db.Exec("SELECT logged_failing()"); err == nil {
+		t.Fatal("expected error from failing function")
+	}
+
+	for _, want := range []string{
+		`msg="sqlite: registered function" function=logged_failing`,
+		`msg="sqlite: extension initialized" extension=default`,
+		`msg="sqlite: function returned error" error="sqlite: SQLITE_CONSTRAINT"`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected log to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
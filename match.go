@@ -0,0 +1,38 @@
+package sqlite
+
+// #include <stdlib.h>
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+import "C"
+
+import "unsafe"
+
+// StrGlob reports whether str matches the given GLOB pattern, using the same (case-sensitive) matching rules
+// as sqlite's GLOB operator. Virtual tables can use it to evaluate GLOB constraints exactly like sqlite does.
+// see: https://www.sqlite.org/c3ref/strglob.html
+func StrGlob(pattern, str string) bool {
+	var cpattern, cstr = C.CString(pattern), C.CString(str)
+	defer C.free(unsafe.Pointer(cpattern))
+	defer C.free(unsafe.Pointer(cstr))
+	return C._sqlite3_strglob(cpattern, cstr) == 0
+}
+
+// StrLike reports whether str matches the given LIKE pattern, using the same (ASCII case-insensitive) matching rules
+// as sqlite's LIKE operator. If escape is non-zero, it is used as the escape character in the pattern, just like the
+// ESCAPE clause of the LIKE operator. Virtual tables can use it to evaluate LIKE constraints exactly like sqlite does.
+// see: https://www.sqlite.org/c3ref/strlike.html
+func StrLike(pattern, str string, escape rune) bool {
+	var cpattern, cstr = C.CString(pattern), C.CString(str)
+	defer C.free(unsafe.Pointer(cpattern))
+	defer C.free(unsafe.Pointer(cstr))
+	return C._sqlite3_strlike(cpattern, cstr, C.uint(escape)) == 0
+}
+
+// StrICmp compares a and b, ignoring the case of ASCII characters, like sqlite's NOCASE collation does.
+// It returns a negative value, zero or a positive value if a is less than, equal to or greater than b.
+func StrICmp(a, b string) int {
+	var ca, cb = C.CString(a), C.CString(b)
+	defer C.free(unsafe.Pointer(ca))
+	defer C.free(unsafe.Pointer(cb))
+	return int(C._sqlite3_stricmp(ca, cb))
+}
@@ -0,0 +1,96 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"strconv"
+	"strings"
+)
+
+// memoSize is the number of results a memoized function keeps per statement
+const memoSize = 256
+
+// Memoize returns a deterministic ScalarFunction, taking args arguments (or -1 for any number of them),
+// that computes its result with fn and caches it for the duration of the statement. Later calls
+// with identical arguments return the cached result without invoking fn. The result must be of a type
+// accepted by Context.Result.
+//
+// The cache is kept as auxiliary data (see Context.SetAuxData) of the function's arguments, and so it lasts
+// as long as one of the arguments is a constant, as in:
+//
+//	SELECT geocode('en', address) FROM customers
+//
+// which only invokes fn once per distinct address. It's of no help when none of the arguments are constant,
+// or when all of them are, as sqlite then evaluates the function only once anyway.
+func Memoize(args int, fn func(...Value) (interface{}, error)) ScalarFunction {
+	return &memoized{args: args, fn: fn}
+}
+
+type memoized struct {
+	args int
+	fn   func(...Value) (interface{}, error)
+}
+
+func (m *memoized) Args() int           { return m.args }
+func (m *memoized) Deterministic() bool { return true }
+
+func (m *memoized) Apply(ctx *Context, values ...Value) {
+	var cache map[string]interface{}
+	for i := range values {
+		if c, ok := ctx.AuxData(i).(map[string]interface{}); ok {
+			cache = c
+			break
+		}
+	}
+
+	var key = memoKey(values)
+	if result, ok := cache[key]; ok {
+		_ = ctx.Result(result) // succeeded the first time
+		return
+	}
+
+	var result, err = m.fn(values...)
+	if err == nil {
+		err = ctx.Result(result)
+	}
+	if err != nil {
+		ctx.ResultError(err)
+		return
+	}
+
+	if len(values) == 0 {
+		return
+	}
+	if cache != nil && len(cache) < memoSize {
+		cache[key] = result
+		return
+	}
+
+	cache = map[string]interface{}{key: result}
+	for i := range values { // sqlite only keeps the ones set on constant arguments
+		ctx.SetAuxData(i, cache)
+	}
+}
+
+// memoKey encodes the type and value of the arguments into a string that's equal for identical arguments
+func memoKey(values []Value) string {
+	var buf strings.Builder
+	for _, value := range values {
+		var typ = value.Type()
+		buf.WriteByte(byte(typ))
+		switch typ {
+		case SQLITE_INTEGER:
+			buf.WriteString(strconv.FormatInt(value.Int64(), 10))
+		case SQLITE_FLOAT:
+			buf.WriteString(strconv.FormatFloat(value.Float(), 'g', -1, 64))
+		case SQLITE_TEXT, SQLITE_BLOB:
+			var b = value.Blob()
+			buf.WriteString(strconv.Itoa(len(b)))
+			buf.WriteByte(':')
+			buf.Write(b)
+		}
+		buf.WriteByte(';')
+	}
+	return buf.String()
+}
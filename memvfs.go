@@ -0,0 +1,297 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// MemoryVFSName is the name under which RegisterMemoryVFS registers the memory-backed VFS
+const MemoryVFSName = "gomem"
+
+// MemoryVFSOptions represents the various options that affect the behaviour of a MemoryVFS
+type MemoryVFSOptions struct {
+	MaxSize int64 // maximum size of a single file, in bytes; writes beyond it fail with SQLITE_FULL. Zero means unlimited
+}
+
+// WithMaxSize limits the size of every file in the MemoryVFS to the given number of bytes
+func WithMaxSize(n int64) func(*MemoryVFSOptions) {
+	return func(opt *MemoryVFSOptions) { opt.MaxSize = n }
+}
+
+// MemoryVFS is a VFS that keeps all files in memory.
+//
+// Unlike sqlite's :memory: databases, files are shared by all connections in the process that open the same name
+// (eg. file:test.db?vfs=gomem) and live until they are deleted. This makes it possible to use isolated in-memory
+// databases with a pool of connections (like database/sql's) and get deterministic behaviour, independent of the disk.
+// Temporary files and files opened with OPEN_DELETEONCLOSE are deleted once closed.
+type MemoryVFS struct {
+	options MemoryVFSOptions
+
+	mu    sync.Mutex
+	files map[string]*memoryFile
+	temps int // counter used to name temporary files
+}
+
+// NewMemoryVFS creates a new, empty, MemoryVFS. Use RegisterVFS to register it with sqlite.
+func NewMemoryVFS(opts ...func(*MemoryVFSOptions)) *MemoryVFS {
+	var vfs = &MemoryVFS{files: make(map[string]*memoryFile)}
+	for _, f := range opts {
+		f(&vfs.options)
+	}
+	return vfs
+}
+
+// RegisterMemoryVFS registers a new MemoryVFS under MemoryVFSName
+func RegisterMemoryVFS(opts ...func(*MemoryVFSOptions)) error {
+	return RegisterVFS(MemoryVFSName, NewMemoryVFS(opts...), false)
+}
+
+// Open implements VFS.Open
+func (vfs *MemoryVFS) Open(name string, flags OpenFlag) (File, error) {
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+
+	var deleteOnClose = flags&OPEN_DELETEONCLOSE != 0
+	if name == "" {
+		vfs.temps++
+		name, deleteOnClose = fmt.Sprintf("temp-%d", vfs.temps), true
+	}
+
+	var file, exists = vfs.files[name]
+	if !exists {
+		if flags&OPEN_CREATE == 0 {
+			return nil, SQLITE_CANTOPEN
+		}
+		file = &memoryFile{name: name}
+		vfs.files[name] = file
+	} else if flags&OPEN_EXCLUSIVE != 0 && flags&OPEN_CREATE != 0 {
+		return nil, SQLITE_CANTOPEN
+	}
+
+	file.refs++
+	return &memoryHandle{vfs: vfs, file: file, readOnly: flags&OPEN_READONLY != 0, deleteOnClose: deleteOnClose}, nil
+}
+
+// Delete implements VFS.Delete
+func (vfs *MemoryVFS) Delete(name string, _ bool) error {
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+
+	if _, exists := vfs.files[name]; !exists {
+		return SQLITE_IOERR_DELETE_NOENT
+	}
+	delete(vfs.files, name)
+	return nil
+}
+
+// Access implements VFS.Access
+func (vfs *MemoryVFS) Access(name string, _ AccessFlag) (bool, error) {
+	vfs.mu.Lock()
+	defer vfs.mu.Unlock()
+
+	var _, exists = vfs.files[name]
+	return exists, nil
+}
+
+// FullPathname implements VFS.FullPathname. Names are used as-is.
+func (vfs *MemoryVFS) FullPathname(name string) (string, error) { return name, nil }
+
+// memoryFile is a file stored in a MemoryVFS, shared by all handles that have it open
+type memoryFile struct {
+	name string
+	refs int // number of open handles; guarded by MemoryVFS.mu
+
+	mu        sync.RWMutex
+	data      []byte
+	shared    int  // number of handles holding a SHARED (or higher) lock
+	reserved  bool // a handle holds a RESERVED (or higher) lock
+	pending   bool // a handle holds a PENDING (or higher) lock
+	exclusive bool // a handle holds an EXCLUSIVE lock
+}
+
+// memoryHandle is an open handle to a memoryFile
+type memoryHandle struct {
+	vfs           *MemoryVFS
+	file          *memoryFile
+	level         LockLevel
+	readOnly      bool
+	deleteOnClose bool
+}
+
+func (h *memoryHandle) ReadAt(p []byte, off int64) (int, error) {
+	h.file.mu.RLock()
+	defer h.file.mu.RUnlock()
+
+	if off >= int64(len(h.file.data)) {
+		return 0, io.EOF
+	}
+
+	var n = copy(p, h.file.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (h *memoryHandle) WriteAt(p []byte, off int64) (int, error) {
+	if h.readOnly {
+		return 0, SQLITE_READONLY
+	}
+
+	h.file.mu.Lock()
+	defer h.file.mu.Unlock()
+
+	var end = off + int64(len(p))
+	if limit := h.vfs.options.MaxSize; limit > 0 && end > limit {
+		return 0, SQLITE_FULL
+	}
+
+	if end > int64(len(h.file.data)) {
+		h.file.grow(end)
+	}
+	return copy(h.file.data[off:], p), nil
+}
+
+func (h *memoryHandle) Truncate(size int64) error {
+	h.file.mu.Lock()
+	defer h.file.mu.Unlock()
+
+	if limit := h.vfs.options.MaxSize; limit > 0 && size > limit {
+		return SQLITE_FULL
+	}
+
+	if size < int64(len(h.file.data)) {
+		h.file.data = h.file.data[:size]
+	} else {
+		h.file.grow(size)
+	}
+	return nil
+}
+
+func (h *memoryHandle) Sync(SyncFlag) error { return nil }
+
+func (h *memoryHandle) Size() (int64, error) {
+	h.file.mu.RLock()
+	defer h.file.mu.RUnlock()
+	return int64(len(h.file.data)), nil
+}
+
+func (h *memoryHandle) Lock(level LockLevel) error {
+	h.file.mu.Lock()
+	defer h.file.mu.Unlock()
+
+	if h.level >= level {
+		return nil
+	}
+
+	var f = h.file
+	switch level {
+	case LOCK_SHARED:
+		if f.pending || f.exclusive {
+			return SQLITE_BUSY
+		}
+		f.shared++
+	case LOCK_RESERVED:
+		if f.reserved {
+			return SQLITE_BUSY
+		}
+		f.reserved = true
+	case LOCK_PENDING, LOCK_EXCLUSIVE:
+		if h.level < LOCK_PENDING {
+			if f.pending {
+				return SQLITE_BUSY
+			}
+			f.pending = true
+			if h.level < LOCK_RESERVED {
+				f.reserved = true
+			}
+			h.level = LOCK_PENDING
+		}
+		if level == LOCK_PENDING {
+			return nil
+		}
+		if f.shared > 1 {
+			return SQLITE_BUSY // other readers are still active; keep the PENDING lock to keep new ones out
+		}
+		f.exclusive = true
+	}
+
+	h.level = level
+	return nil
+}
+
+func (h *memoryHandle) Unlock(level LockLevel) error {
+	h.file.mu.Lock()
+	defer h.file.mu.Unlock()
+	h.unlock(level)
+	return nil
+}
+
+// unlock downgrades the lock held by the handle to the given level; must be called with file.mu held
+func (h *memoryHandle) unlock(level LockLevel) {
+	if h.level <= level {
+		return
+	}
+
+	var f = h.file
+	if h.level >= LOCK_EXCLUSIVE {
+		f.exclusive = false
+	}
+	if h.level >= LOCK_PENDING {
+		f.pending = false
+	}
+	if h.level >= LOCK_RESERVED {
+		f.reserved = false
+	}
+	if level == LOCK_NONE && h.level >= LOCK_SHARED {
+		f.shared--
+	}
+	h.level = level
+}
+
+func (h *memoryHandle) CheckReservedLock() (bool, error) {
+	h.file.mu.RLock()
+	defer h.file.mu.RUnlock()
+	return h.file.reserved || h.file.pending || h.file.exclusive, nil
+}
+
+func (h *memoryHandle) SectorSize() int { return 512 }
+
+func (h *memoryHandle) DeviceCharacteristics() DeviceCharacteristic {
+	return IOCAP_SAFE_APPEND | IOCAP_SEQUENTIAL | IOCAP_POWERSAFE_OVERWRITE
+}
+
+func (h *memoryHandle) Close() error {
+	h.file.mu.Lock()
+	h.unlock(LOCK_NONE)
+	h.file.mu.Unlock()
+
+	h.vfs.mu.Lock()
+	defer h.vfs.mu.Unlock()
+
+	h.file.refs--
+	if h.deleteOnClose && h.file.refs == 0 && h.vfs.files[h.file.name] == h.file {
+		delete(h.vfs.files, h.file.name)
+	}
+	return nil
+}
+
+// grow extends the file with zeroes to the given size; must be called with mu held
+func (f *memoryFile) grow(size int64) {
+	if size <= int64(cap(f.data)) {
+		var n = len(f.data)
+		f.data = f.data[:size]
+		for i := n; i < len(f.data); i++ {
+			f.data[i] = 0
+		}
+		return
+	}
+
+	var data = make([]byte, size, size+size/4)
+	copy(data, f.data)
+	f.data = data
+}
@@ -0,0 +1,97 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metric identifies a measurement reported to Metrics
+type Metric string
+
+const (
+	MetricFunctionCalls    Metric = "function_calls"    // calls to Apply, Step, Final, Value and Inverse; labelled with the function's name
+	MetricFunctionDuration Metric = "function_duration" // duration of the above calls; labelled with the function's name
+	MetricBestIndexCalls   Metric = "best_index_calls"  // calls to VirtualTable.BestIndex; labelled with the module's name
+	MetricFilterCalls      Metric = "filter_calls"      // calls to VirtualCursor.Filter; labelled with the module's name
+	MetricRowsScanned      Metric = "rows_scanned"      // rows returned by virtual table cursors; labelled with the module's name
+	MetricErrors           Metric = "errors"            // errors returned to sqlite by functions and virtual tables; labelled with the error code
+)
+
+// Metrics receives measurements about the calls sqlite makes into the extension's functions and virtual tables,
+// so that they can be exported to a monitoring system (like expvar or Prometheus). Implementations must be safe
+// for concurrent use and should return quickly, as they are called from sqlite's callbacks.
+type Metrics interface {
+	// Count adds delta to the counter identified by metric and label
+	Count(metric Metric, label string, delta int64)
+
+	// Observe records d in the histogram identified by metric and label
+	Observe(metric Metric, label string, d time.Duration)
+}
+
+// metrics holds the Metrics set with SetMetrics, wrapped in metricsHolder as atomic.Value cannot hold nil
+var metrics atomic.Value
+
+type metricsHolder struct{ m Metrics }
+
+// SetMetrics sets the Metrics measurements are reported to. Passing nil disables reporting, which is the default.
+func SetMetrics(m Metrics) { metrics.Store(metricsHolder{m}) }
+
+// currentMetrics returns the Metrics set with SetMetrics, or nil if reporting is disabled
+func currentMetrics() Metrics {
+	var h, _ = metrics.Load().(metricsHolder)
+	return h.m
+}
+
+// observeSince records the time elapsed since start; meant to be deferred
+func observeSince(m Metrics, metric Metric, label string, start time.Time) {
+	m.Observe(metric, label, time.Since(start))
+}
+
+// countError reports an error returned to sqlite
+func countError(code ErrorCode) {
+	if m := currentMetrics(); m != nil {
+		m.Count(MetricErrors, code.String(), 1)
+	}
+}
+
+// ExpvarMetrics returns a Metrics that publishes measurements in m. Every metric is an *expvar.Map, keyed by label.
+// Counters are *expvar.Int. Histograms are summarized by two *expvar.Int per label: <label>.count, the number of
+// observations, and <label>.nanos, their sum.
+//
+//	sqlite.SetMetrics(sqlite.ExpvarMetrics(expvar.NewMap("sqlite")))
+func ExpvarMetrics(m *expvar.Map) Metrics { return &expvarMetrics{m: m} }
+
+type expvarMetrics struct {
+	mu sync.Mutex // serializes creation of the per-metric maps
+	m  *expvar.Map
+}
+
+func (e *expvarMetrics) metric(metric Metric) *expvar.Map {
+	if v, ok := e.m.Get(string(metric)).(*expvar.Map); ok {
+		return v
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if v, ok := e.m.Get(string(metric)).(*expvar.Map); ok {
+		return v
+	}
+	var v = new(expvar.Map).Init()
+	e.m.Set(string(metric), v)
+	return v
+}
+
+func (e *expvarMetrics) Count(metric Metric, label string, delta int64) {
+	e.metric(metric).Add(label, delta)
+}
+
+func (e *expvarMetrics) Observe(metric Metric, label string, d time.Duration) {
+	var v = e.metric(metric)
+	v.Add(label+".count", 1)
+	v.Add(label+".nanos", int64(d))
+}
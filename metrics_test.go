@@ -0,0 +1,104 @@
+package sqlite_test
+
+import (
+	"expvar"
+	"sync"
+	"testing"
+	"time"
+
+	. "go.riyazali.net/sqlite"
+)
+
+// recordingMetrics is a Metrics that records all counters
+type recordingMetrics struct {
+	mu           sync.Mutex
+	counters     map[string]int64
+	observations int
+}
+
+func (r *recordingMetrics) Count(metric Metric, label string, delta int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters[string(metric)+"/"+label] += delta
+}
+
+func (r *recordingMetrics) Observe(Metric, string, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observations++
+}
+
+// failing implements a sql scalar function that always fails with SQLITE_CONSTRAINT
+type failing struct{}
+
+func (*failing) Args() int                      { return 0 }
+func (*failing) Deterministic() bool            { return true }
+func (*failing) Apply(ctx *Context, _ ...Value) { ctx.ResultError(SQLITE_CONSTRAINT) }
+
+func TestMetrics(t *testing.T) {
+	var metrics = &recordingMetrics{counters: make(map[string]int64)}
+	SetMetrics(metrics)
+	defer SetMetrics(nil)
+
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		if err := api.CreateFunction("metrics_upper", &Upper{}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := api.CreateFunction("metrics_failing", &failing{}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := api.CreateVirtualTable("metrics_args", &ArgsModule{}, []string{"a", "b", "c"}, false); err != nil {
+			return SQLITE_ERROR, err
+		}
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var count int
+	if err = db.QueryRow("SELECT COUNT(metrics_upper(arg)) FROM metrics_args").Scan(&count); err != nil {
+		t.Fatal(err)
+	} else if count != 3 {
+		t.Fatalf("expected 3 rows, got %d", count)
+	}
+
+	for key, want := range map[string]int64{
+		"function_calls/metrics_upper": 3,
+		"rows_scanned/metrics_args":    3,
+		"filter_calls/metrics_args":    1,
+	} {
+		if got := metrics.counters[key]; got != want {
+			t.Errorf("expected %s to be %d, got %d", key, want, got)
+		}
+	}
+
+	if metrics.counters["best_index_calls/metrics_args"] == 0 {
+		t.Error("expected best_index_calls to be counted")
+	}
+	if metrics.observations != 3 {
+		t.Errorf("expected 3 observations, got %d", metrics.observations)
+	}
+
+	// errors from functions are counted by code
+	if _, err = db.Exec("SELECT metrics_failing()"); err == nil {
+		t.Fatal("expected error from failing function")
+	} else if got := metrics.counters["errors/SQLITE_CONSTRAINT"]; got != 1 {
+		t.Fatalf("expected 1 error to be counted, got %d", got)
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	var vars = new(expvar.Map).Init()
+	var m = ExpvarMetrics(vars)
+	m.Count(MetricErrors, "SQLITE_ERROR", 2)
+	m.Observe(MetricFunctionDuration, "upper", time.Second)
+
+	var want = `{"errors": {"SQLITE_ERROR": 2}, "function_duration": {"upper.count": 1, "upper.nanos": 1000000000}}`
+	if got := vars.String(); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
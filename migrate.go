@@ -0,0 +1,80 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import "fmt"
+
+// Migration is a step of a schema migration, like creating or altering the shadow tables of a module.
+type Migration struct {
+	// Version is the value of the main database's user_version once the step is applied. Steps are applied in the
+	// order of their versions, and only those with a version greater than the database's user_version are applied.
+	Version int32
+
+	SQL string            // statements run by the step; may contain multiple semicolon-separated statements
+	Fn  func(*Conn) error // run after SQL, for changes that can't be expressed in SQL alone; optional
+}
+
+// Migrate brings the schema up to date by applying, in order, the migrations whose version is greater than the
+// user_version of the main database, setting the user_version after every step. It returns the versions applied.
+//
+// Steps are applied within a single transaction (or a savepoint, if a transaction is already open) and so,
+// if any of them fails, the schema is left as it was, and the error is returned along with the version
+// of the step that failed. The migrations must be sorted by version, and their versions must be unique.
+func (conn *Conn) Migrate(migrations []Migration) ([]int32, error) {
+	return conn.migrate(migrations, false)
+}
+
+// MigrateDryRun applies the migrations like Migrate does, and then rolls them back. It returns the versions
+// that Migrate would apply, or the error it would run into, without changing the schema.
+func (conn *Conn) MigrateDryRun(migrations []Migration) ([]int32, error) {
+	return conn.migrate(migrations, true)
+}
+
+func (conn *Conn) migrate(migrations []Migration, dryRun bool) (applied []int32, err error) {
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			return nil, fmt.Errorf("sqlite: migration %d is out of order", migrations[i].Version)
+		}
+	}
+
+	if err = conn.Exec("SAVEPOINT migrate", nil); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil || dryRun {
+			_ = conn.Exec("ROLLBACK TO migrate", nil)
+		}
+		if rerr := conn.Exec("RELEASE migrate", nil); err == nil {
+			err = rerr
+		}
+	}()
+
+	var current int32
+	if current, err = conn.UserVersion(); err != nil {
+		return nil, err
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		if m.SQL != "" {
+			if err = conn.Exec(m.SQL, nil); err != nil {
+				return nil, fmt.Errorf("sqlite: migration %d: %w", m.Version, err)
+			}
+		}
+		if m.Fn != nil {
+			if err = m.Fn(conn); err != nil {
+				return nil, fmt.Errorf("sqlite: migration %d: %w", m.Version, err)
+			}
+		}
+		if err = conn.SetUserVersion(m.Version); err != nil {
+			return nil, err
+		}
+		applied = append(applied, m.Version)
+	}
+
+	return applied, nil
+}
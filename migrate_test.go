@@ -0,0 +1,56 @@
+package sqlite_test
+
+import (
+	"errors"
+	. "go.riyazali.net/sqlite"
+	"reflect"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	bootstrap(t)
+
+	conn, err := Open("file:migrate.db?mode=memory", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var migrations = []Migration{
+		{Version: 1, SQL: "CREATE TABLE shadow (id INTEGER PRIMARY KEY)"},
+		{Version: 2, SQL: "ALTER TABLE shadow ADD COLUMN name TEXT"},
+	}
+
+	if applied, err := conn.MigrateDryRun(migrations); err != nil || !reflect.DeepEqual(applied, []int32{1, 2}) {
+		t.Fatalf("expected dry run to apply [1 2] got %v (%v)", applied, err)
+	}
+	if v, _ := conn.UserVersion(); v != 0 {
+		t.Fatalf("expected dry run to leave the schema untouched, got version %d", v)
+	}
+
+	if applied, err := conn.Migrate(migrations[:1]); err != nil || !reflect.DeepEqual(applied, []int32{1}) {
+		t.Fatalf("expected [1] to be applied got %v (%v)", applied, err)
+	}
+	if applied, err := conn.Migrate(migrations); err != nil || !reflect.DeepEqual(applied, []int32{2}) {
+		t.Fatalf("expected [2] to be applied got %v (%v)", applied, err)
+	}
+
+	// a failing step rolls back every step applied with it
+	var boom = errors.New("boom")
+	migrations = append(migrations,
+		Migration{Version: 3, SQL: "CREATE INDEX shadow_name ON shadow (name)"},
+		Migration{Version: 4, Fn: func(*Conn) error { return boom }})
+	if _, err = conn.Migrate(migrations); !errors.Is(err, boom) {
+		t.Fatalf("expected migration to fail with boom got %v", err)
+	}
+	if v, _ := conn.UserVersion(); v != 2 {
+		t.Fatalf("expected version 2 got %d", v)
+	}
+	if n, _ := ResultInt64(conn, "SELECT COUNT(*) FROM sqlite_master WHERE name = 'shadow_name'"); n != 0 {
+		t.Fatal("expected index to be rolled back")
+	}
+
+	if _, err = conn.Migrate([]Migration{{Version: 2}, {Version: 1}}); err == nil {
+		t.Fatal("expected migrations out of order to fail")
+	}
+}
@@ -0,0 +1,77 @@
+package sqlite
+
+// #include <stdlib.h>
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+//
+// extern int go_sqlite3_api_initialized(void);
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// OpenFlags is the set of flags that control how Open opens a connection. It is an alias of OpenFlag;
+// flags meant for VFS (like OPEN_MAIN_DB) must not be used with Open.
+type OpenFlags = OpenFlag
+
+// DefaultOpenFlags are used by Open when no flags are given.
+// The database is opened for reading and writing, it is created if it doesn't exist and uri filenames are allowed.
+const DefaultOpenFlags = OPEN_READWRITE | OPEN_CREATE | OPEN_URI
+
+// Open opens a new connection to the database at uri. It is intended for extensions that need connections
+// of their own (eg. to perform maintenance in the background), without pulling in a separate driver.
+// If flags is zero, DefaultOpenFlags are used. The connection must be closed with Close when no longer in use.
+//
+// As with the rest of the package, the sqlite3_api routines must be available; unless the package is
+// built with the static tag, the extension must have been loaded by sqlite at least once.
+// see: https://www.sqlite.org/c3ref/open.html
+func Open(uri string, flags OpenFlags) (*Conn, error) {
+	if C.go_sqlite3_api_initialized() == 0 {
+		return nil, errApiNotInitialized
+	}
+
+	if flags == 0 {
+		flags = DefaultOpenFlags
+	}
+
+	var curi = C.CString(uri)
+	defer C.free(unsafe.Pointer(curi))
+
+	var db *C.sqlite3
+	if res := ErrorCode(C._sqlite3_open_v2(curi, &db, C.int(flags), nil)); !res.ok() {
+		if db == nil {
+			return nil, res
+		}
+		var err = Error(res, C.GoString(C._sqlite3_errmsg(db)))
+		C._sqlite3_close_v2(db)
+		return nil, err
+	}
+
+	var conn = wrap(db)
+	conn.opened = true
+	return conn, nil
+}
+
+// Close closes a connection opened with Open. Any prepared statement that is not yet finalized keeps
+// the underlying handle alive until it's finalized (see sqlite3_close_v2). Calling Close more than once has no effect.
+//
+// Connections not opened with Open (eg. the one returned by ExtensionApi.Connection) are owned
+// by sqlite, or by another driver, and Close returns an error for them.
+// see: https://www.sqlite.org/c3ref/close.html
+func (conn *Conn) Close() error {
+	if !conn.opened {
+		return errors.New("sqlite: connection wasn't opened with Open and cannot be closed")
+	}
+
+	if conn.db == nil {
+		return nil
+	}
+
+	if err := errorIfNotOk(C._sqlite3_close_v2(conn.db)); err != nil {
+		return err
+	}
+	conn.db = nil
+	return nil
+}
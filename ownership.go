@@ -0,0 +1,82 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+)
+
+// non-zero when ownership checks are enabled
+var ownershipChecks int32
+
+// SetOwnershipChecks enables (or disables) a debug mode that detects a Conn being used by more than one goroutine.
+//
+// When enabled, the first goroutine that calls Prepare, Exec or Stmt.Step on a Conn becomes its owner, and any
+// such call from another goroutine panics with a message identifying both goroutines, instead of corrupting
+// state or crashing deep inside cgo. Use Conn.Disown to hand a connection over to another goroutine.
+// Ownership belongs to the underlying connection, and so, it's shared by every Conn wrapping it
+// (like the ones returned by ExtensionApi.Connection and Context.GetConnection).
+//
+// The checks rely on parsing the goroutine's stack header and add noticeable overhead to every call,
+// and so, they're meant to be enabled in tests and during debugging only.
+func SetOwnershipChecks(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&ownershipChecks, v)
+}
+
+// Disown releases the connection from the goroutine that owns it, allowing another goroutine to take it over.
+// It is only meaningful when ownership checks are enabled (see SetOwnershipChecks).
+func (conn *Conn) Disown() {
+	connStateLock.Lock()
+	var state, ok = connStateStore[conn.db]
+	connStateLock.Unlock()
+	if ok {
+		atomic.StoreInt64(&state.owner, 0)
+	}
+}
+
+// checkOwner panics if ownership checks are enabled and the connection is owned by another goroutine
+func (conn *Conn) checkOwner() {
+	if atomic.LoadInt32(&ownershipChecks) == 0 {
+		return
+	}
+
+	var state, err = stateOf(conn.db)
+	if err != nil {
+		logDebug("sqlite: failed to track the owner of the connection", "error", err)
+		return
+	}
+
+	var id = goroutineID()
+	if atomic.CompareAndSwapInt64(&state.owner, 0, id) {
+		return
+	}
+
+	if owner := atomic.LoadInt64(&state.owner); owner != id {
+		panic(fmt.Sprintf("sqlite: Conn owned by goroutine %d used from goroutine %d; "+
+			"a Conn can only be used by one goroutine at a time (use Conn.Disown to hand it over)", owner, id))
+	}
+}
+
+// goroutineID returns the id of the calling goroutine, as reported in its stack trace
+func goroutineID() int64 {
+	var buf [64]byte
+	var header = buf[:runtime.Stack(buf[:], false)]
+
+	// the header looks like "goroutine 42 [running]:"
+	header = bytes.TrimPrefix(header, []byte("goroutine "))
+	if i := bytes.IndexByte(header, ' '); i > 0 {
+		header = header[:i]
+	}
+
+	var id, _ = strconv.ParseInt(string(header), 10, 64)
+	return id
+}
@@ -0,0 +1,52 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// PanicError is reported to sqlite in place of a panic raised by a callback, like a function's Apply or a cursor's
+// Column. A panic must not unwind through sqlite's C frames, as that would take down the whole process; instead,
+// the trampolines recover from it and fail the call (with SQLITE_ERROR, or the closest code the callback can return).
+type PanicError struct {
+	Callback string      // callback that panicked, eg. "xColumn"
+	Value    interface{} // value passed to panic
+	Stack    []byte      // stack trace of the goroutine that panicked
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("sqlite: panic in %s: %v", e.Callback, e.Value)
+}
+
+// logPanicStacks is non-zero if recovered panics are written to sqlite's error log
+var logPanicStacks int32
+
+// SetPanicStackLogging sets whether recovered panics are written, along with the stack of the goroutine that
+// panicked, to sqlite's error log (see SetLogHandler). It's disabled by default, as the message is also reported
+// as the error of the statement that triggered the callback.
+func SetPanicStackLogging(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&logPanicStacks, v)
+}
+
+// panicked wraps a value recovered from a panic in callback into a *PanicError; it returns nil if r is nil.
+// It must be called in the deferred func that recovered, so that the stack still includes the frames that panicked.
+func panicked(callback string, r interface{}) *PanicError {
+	if r == nil {
+		return nil
+	}
+
+	var err = &PanicError{Callback: callback, Value: r, Stack: debug.Stack()}
+	logDebug("sqlite: recovered from panic", "callback", callback, "panic", r, "stack", string(err.Stack))
+	if atomic.LoadInt32(&logPanicStacks) != 0 && callback != "xLog" {
+		Log(SQLITE_ERROR, fmt.Sprintf("%s\n%s", err.Error(), err.Stack))
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package sqlite_test
+
+import (
+	"strings"
+	"testing"
+
+	. "go.riyazali.net/sqlite"
+)
+
+// Panicky implements a panicky() sql scalar function that always panics
+type Panicky struct{}
+
+func (m *Panicky) Args() int                    { return 0 }
+func (m *Panicky) Deterministic() bool          { return true }
+func (m *Panicky) Apply(_ *Context, _ ...Value) { panic("boom") }
+
+// PanicModule is a virtual table module whose cursors panic in the method named by the table's argument
+type PanicModule struct{}
+
+func (m *PanicModule) Connect(_ *Conn, args []string, declare func(string) error) (VirtualTable, error) {
+	var method = ParseCreationArgs(args).Options[0]
+	if method == "connect" {
+		panic("boom")
+	}
+	return &PanicTable{method: method}, declare("CREATE TABLE x(value TEXT)")
+}
+
+type PanicTable struct{ method string }
+
+func (t *PanicTable) BestIndex(_ *IndexInfoInput) (*IndexInfoOutput, error) {
+	return &IndexInfoOutput{EstimatedCost: 1}, nil
+}
+func (t *PanicTable) Open() (VirtualCursor, error) { return &PanicCursor{method: t.method}, nil }
+func (t *PanicTable) Disconnect() error            { return nil }
+func (t *PanicTable) Destroy() error               { return nil }
+
+type PanicCursor struct {
+	method string
+	pos    int
+}
+
+func (c *PanicCursor) panics(method string) {
+	if c.method == method {
+		panic("boom")
+	}
+}
+
+func (c *PanicCursor) Filter(int, string, ...Value) error { c.panics("filter"); return nil }
+func (c *PanicCursor) Next() error                        { c.panics("next"); c.pos++; return nil }
+func (c *PanicCursor) Rowid() (int64, error)              { c.panics("rowid"); return int64(c.pos), nil }
+func (c *PanicCursor) Eof() bool                          { c.panics("eof"); return c.pos >= 2 }
+func (c *PanicCursor) Close() error                       { return nil }
+func (c *PanicCursor) Column(ctx *VirtualTableContext, _ int) error {
+	c.panics("column")
+	ctx.ResultText("value")
+	return nil
+}
+
+func TestPanicRecovery(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		if err := api.CreateFunction("panicky", &Panicky{}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := api.CreateModule("panics", &PanicModule{}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := api.CreateCollation("panicky", func(string, string) int { panic("boom") }); err != nil {
+			return SQLITE_ERROR, err
+		}
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var expectPanic = func(t *testing.T, sql string) {
+		var rows, err = db.Query(sql)
+		if err == nil {
+			for rows.Next() {
+			}
+			err = rows.Err()
+			_ = rows.Close()
+		}
+
+		if err == nil || !strings.Contains(err.Error(), "panic") || !strings.Contains(err.Error(), "boom") {
+			t.Fatalf("expected the panic to be reported as an error, got %v", err)
+		}
+	}
+
+	t.Run("Function", func(t *testing.T) { expectPanic(t, "SELECT panicky()") })
+
+	for _, method := range []string{"filter", "next", "rowid", "eof", "column"} {
+		var method = method
+		t.Run("Cursor_"+method, func(t *testing.T) {
+			if _, err := db.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS panics_" + method + " USING panics(" + method + ")"); err != nil {
+				t.Fatal(err)
+			}
+			expectPanic(t, "SELECT rowid, value FROM panics_"+method)
+		})
+	}
+
+	t.Run("Connect", func(t *testing.T) {
+		if _, err := db.Exec("CREATE VIRTUAL TABLE panics_connect USING panics(connect)"); err == nil || !strings.Contains(err.Error(), "boom") {
+			t.Fatalf("expected the panic to be reported as an error, got %v", err)
+		}
+	})
+
+	t.Run("Collation", func(t *testing.T) { // collations can't fail, but the process must survive
+		var cmp int
+		if err := db.QueryRow("SELECT 'a' = 'b' COLLATE panicky").Scan(&cmp); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// the connection must still be usable after all that
+	var n int
+	if err := db.QueryRow("SELECT 1").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("expected connection to be usable, got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,51 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// cursorPool holds the idle cursors of a table, as C-side allocations that still hold the handle to the Go cursor
+type cursorPool struct {
+	mu   sync.Mutex
+	size int
+	idle []unsafe.Pointer
+}
+
+// get returns an idle cursor, or nil if there are none
+func (p *cursorPool) get() unsafe.Pointer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.idle) == 0 {
+		return nil
+	}
+	var cur = p.idle[len(p.idle)-1]
+	p.idle = p.idle[:len(p.idle)-1]
+	return cur
+}
+
+// put returns cur to the pool, reporting false if the pool is full
+func (p *cursorPool) put(cur unsafe.Pointer) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.idle) >= p.size {
+		return false
+	}
+	p.idle = append(p.idle, cur)
+	return true
+}
+
+// drain empties the pool, returning the cursors it held
+func (p *cursorPool) drain() []unsafe.Pointer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var idle = p.idle
+	p.idle = nil
+	return idle
+}
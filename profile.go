@@ -0,0 +1,120 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FunctionProfile summarizes the time spent in a function, across every connection it's registered with.
+// Every call to Apply, Step, Final, Value and Inverse counts as a call.
+type FunctionProfile struct {
+	Name  string        `json:"name"`
+	Calls int64         `json:"calls"`
+	Total time.Duration `json:"total"`
+	Max   time.Duration `json:"max"`
+}
+
+// Average returns the average duration of a call
+func (p FunctionProfile) Average() time.Duration {
+	if p.Calls == 0 {
+		return 0
+	}
+	return p.Total / time.Duration(p.Calls)
+}
+
+var (
+	profileAll int32 // set by ProfileFunctions
+
+	profilesLock sync.Mutex
+	profiles     = map[string]*FunctionProfile{} // profiles by function name
+)
+
+// ProfileFunctions enables (or disables) profiling of the functions registered from now on, as if they were
+// registered with FunctionOptions.Profile. Use FunctionProfiles, or the FunctionProfiler sql function,
+// to find the functions slowing down queries.
+func ProfileFunctions(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&profileAll, v)
+}
+
+// FunctionProfiles returns the profiles of the functions registered with profiling enabled,
+// sorted by the total time spent in them, slowest first.
+func FunctionProfiles() []FunctionProfile {
+	profilesLock.Lock()
+	defer profilesLock.Unlock()
+
+	var list = make([]FunctionProfile, 0, len(profiles))
+	for _, p := range profiles {
+		list = append(list, *p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Total != list[j].Total {
+			return list[i].Total > list[j].Total
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// ResetFunctionProfiles clears the calls and durations recorded so far
+func ResetFunctionProfiles() {
+	profilesLock.Lock()
+	defer profilesLock.Unlock()
+	for name, p := range profiles {
+		*p = FunctionProfile{Name: name}
+	}
+}
+
+// profile returns the profile of the function registered with the given name, creating it if needed
+func profile(name string) *FunctionProfile {
+	profilesLock.Lock()
+	defer profilesLock.Unlock()
+
+	var p, ok = profiles[name]
+	if !ok {
+		p = &FunctionProfile{Name: name}
+		profiles[name] = p
+	}
+	return p
+}
+
+// record records a call that lasted d
+func (p *FunctionProfile) record(d time.Duration) {
+	profilesLock.Lock()
+	defer profilesLock.Unlock()
+
+	p.Calls++
+	p.Total += d
+	if d > p.Max {
+		p.Max = d
+	}
+}
+
+// FunctionProfiler implements a scalar sql function that returns FunctionProfiles as a JSON array,
+// with durations in nanoseconds, to inspect profiles from sql:
+//
+//	api.CreateFunction("function_profiles", sqlite.FunctionProfiler{})
+//
+//	SELECT json_extract(value, '$.name'), json_extract(value, '$.total') FROM json_each(function_profiles())
+type FunctionProfiler struct{}
+
+func (FunctionProfiler) Args() int           { return 0 }
+func (FunctionProfiler) Deterministic() bool { return false }
+
+func (FunctionProfiler) Apply(ctx *Context, _ ...Value) {
+	var b, err = json.Marshal(FunctionProfiles())
+	if err != nil {
+		ctx.ResultError(err)
+		return
+	}
+	ctx.ResultText(string(b))
+}
@@ -0,0 +1,119 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Querier is implemented by types that can prepare statements, like *Conn.
+type Querier interface {
+	Prepare(query string) (*Stmt, int, error)
+}
+
+// Execer is implemented by types that can execute queries, like *Conn.
+type Execer interface {
+	Exec(query string, fn func(stmt *Stmt) error, args ...interface{}) error
+	LastInsertRowID() int64
+}
+
+// QueryExecer combines Querier and Execer. It describes the subset of Conn that
+// virtual tables and functions usually need, and can be replaced with a mock in unit tests.
+type QueryExecer interface {
+	Querier
+	Execer
+}
+
+var _ QueryExecer = (*Conn)(nil)
+
+// ErrNoRows is returned by the Result* helpers when the query doesn't return any row
+var ErrNoRows = errors.New("sqlite: query returned no rows")
+
+// ResultInt64 executes a query that returns a single row and returns the value of its first column as an int64.
+// It returns ErrNoRows if the query returns no rows, and an error if it returns more than one.
+func ResultInt64(db Execer, query string, args ...interface{}) (v int64, err error) {
+	err = result(db, query, func(stmt *Stmt) { v = stmt.ColumnInt64(0) }, args...)
+	return v, err
+}
+
+// ResultText executes a query that returns a single row and returns the value of its first column as a string.
+// It returns ErrNoRows if the query returns no rows, and an error if it returns more than one.
+func ResultText(db Execer, query string, args ...interface{}) (v string, err error) {
+	err = result(db, query, func(stmt *Stmt) { v = stmt.ColumnText(0) }, args...)
+	return v, err
+}
+
+// Insert executes the INSERT query and returns the rowid of the inserted row.
+func Insert(db Execer, query string, args ...interface{}) (int64, error) {
+	if err := db.Exec(query, nil, args...); err != nil {
+		return 0, err
+	}
+	return db.LastInsertRowID(), nil
+}
+
+// QueryMaps executes the query and returns each row it returns as a map from the column names to their values.
+// It's meant for quick introspection and tests, rather than for performance sensitive code. Values are mapped
+// from their sqlite datatype as follows:
+//
+//	INTEGER  int64
+//	REAL     float64
+//	TEXT     string
+//	BLOB     []byte, copied from the row
+//	NULL     nil
+//
+// Columns with the same name (eg. from a join) overwrite each other, with the last one winning, and so,
+// they should be given distinct aliases. It returns no rows, rather than an error, if the query returns no rows.
+func (conn *Conn) QueryMaps(query string, args ...interface{}) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	var names []string
+	var err = conn.Exec(query, func(stmt *Stmt) error {
+		if names == nil {
+			names = make([]string, stmt.ColumnCount())
+			for i := range names {
+				names[i] = stmt.ColumnName(i)
+			}
+		}
+
+		var row = make(map[string]interface{}, len(names))
+		for i, name := range names {
+			switch stmt.ColumnType(i) {
+			case SQLITE_INTEGER:
+				row[name] = stmt.ColumnInt64(i)
+			case SQLITE_FLOAT:
+				row[name] = stmt.ColumnFloat(i)
+			case SQLITE_TEXT:
+				row[name] = stmt.ColumnText(i)
+			case SQLITE_BLOB:
+				row[name] = stmt.ColumnValue(i).Blob()
+			default:
+				row[name] = nil
+			}
+		}
+		rows = append(rows, row)
+		return nil
+	}, args...)
+
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// result executes the query and calls fn with the only row in its result
+func result(db Execer, query string, fn func(stmt *Stmt), args ...interface{}) error {
+	var rows = 0
+	var err = db.Exec(query, func(stmt *Stmt) error {
+		if rows++; rows > 1 {
+			return fmt.Errorf("sqlite: query %q returned more than one row", query)
+		}
+		fn(stmt)
+		return nil
+	}, args...)
+
+	if err == nil && rows == 0 {
+		err = ErrNoRows
+	}
+	return err
+}
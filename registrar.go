@@ -0,0 +1,80 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Registrar provides a fluent interface to register several functions, collations and modules at once.
+// Registration continues past failures and all errors are reported together by Done.
+//
+//	return api.Register().
+//		Scalar("upper", &Upper{}).
+//		Aggregate("sum", &Sum{}).
+//		Module("csv", &CsvModule{}).
+//		Collation("nocase", nocase).
+//		Done()
+type Registrar struct {
+	conn   *Conn
+	errors []error
+}
+
+// Register returns a new Registrar that registers items with the connection.
+func (ext *ExtensionApi) Register() *Registrar { return &Registrar{conn: ext.conn()} }
+
+// Scalar registers a scalar function with the given name
+func (r *Registrar) Scalar(name string, fn ScalarFunction) *Registrar {
+	return r.record("scalar function", name, r.conn.CreateFunction(name, fn))
+}
+
+// Aggregate registers an aggregate function with the given name
+func (r *Registrar) Aggregate(name string, fn AggregateFunction) *Registrar {
+	return r.record("aggregate function", name, r.conn.CreateFunction(name, fn))
+}
+
+// Window registers an aggregate window function with the given name
+func (r *Registrar) Window(name string, fn WindowFunction) *Registrar {
+	return r.record("window function", name, r.conn.CreateFunction(name, fn))
+}
+
+// Collation registers a collation with the given name
+func (r *Registrar) Collation(name string, cmp func(string, string) int) *Registrar {
+	return r.record("collation", name, r.conn.CreateCollation(name, cmp))
+}
+
+// Module registers a virtual table module with the given name
+func (r *Registrar) Module(name string, module Module, opts ...func(*ModuleOptions)) *Registrar {
+	return r.record("module", name, r.conn.CreateModule(name, module, opts...))
+}
+
+// Done completes the registration. Its return values can be returned as-is from an ExtensionFunc.
+// If any of the registrations failed, it returns a *RegistrationError listing all the failures.
+func (r *Registrar) Done() (ErrorCode, error) {
+	if len(r.errors) == 0 {
+		return SQLITE_OK, nil
+	}
+	return SQLITE_ERROR, &RegistrationError{Errors: r.errors}
+}
+
+func (r *Registrar) record(kind, name string, err error) *Registrar {
+	if err != nil {
+		r.errors = append(r.errors, fmt.Errorf("%s %q: %w", kind, name, err))
+	}
+	return r
+}
+
+// RegistrationError is returned by Registrar.Done when one or more registrations failed
+type RegistrationError struct {
+	Errors []error // errors for each failed registration, in order
+}
+
+func (e *RegistrationError) Error() string {
+	var messages = make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return "sqlite: registration failed: " + strings.Join(messages, "; ")
+}
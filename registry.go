@@ -0,0 +1,197 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// DuplicatePolicy decides what RegisterNamed does when another package already registered an extension under
+// the same name. Registering a name again from the same package always replaces the previous registration.
+type DuplicatePolicy int
+
+const (
+	DuplicateReplace DuplicatePolicy = iota // the new registration replaces the existing one; the default
+	DuplicateKeep                           // the existing registration is kept and the new one is ignored
+	DuplicatePanic                          // RegisterNamed panics, like database/sql.Register does
+)
+
+// WithDuplicatePolicy sets what happens if an extension was already registered under the same name by another
+// package. Whatever the policy, the registrations that are not in use are remembered, and are reported by
+// Conflicts, so that shadowed extensions in large dependency graphs can be detected, and picked with Resolve.
+func WithDuplicatePolicy(policy DuplicatePolicy) func(*ExtensionOptions) {
+	return func(opt *ExtensionOptions) { opt.OnDuplicate = policy }
+}
+
+// WithNamespace registers the extension under its name qualified with the path of the module of the package
+// registering it (eg. "example.com/geo/geo" for "geo" registered from example.com/geo/pkg), so that packages
+// from different modules can't shadow each other. The extension can still be loaded under its plain name,
+// as long as it's the only namespaced extension with that name and nothing's registered under the plain name.
+// The path of the package is used in place of the module path if the module isn't known to the build info.
+func WithNamespace() func(*ExtensionOptions) {
+	return func(opt *ExtensionOptions) { opt.Namespace = true }
+}
+
+// shadowed holds the registrations, by other packages, that aren't in use for each name; protected by extensionsLock
+var shadowed = make(map[string][]*registration)
+
+// register adds reg to the registry under name, applying its duplicate policy and namespace
+func register(name string, reg *registration) {
+	if reg.options.Namespace {
+		name = moduleOf(reg.registrant) + "/" + name
+	}
+
+	extensionsLock.Lock()
+	defer extensionsLock.Unlock()
+
+	var existing, found = extensions[name]
+	if !found || existing.registrant == reg.registrant {
+		extensions[name] = reg
+		return
+	}
+
+	switch reg.options.OnDuplicate {
+	case DuplicatePanic:
+		panic(fmt.Sprintf("sqlite: extension %q registered by both %s and %s", name, existing.registrant, reg.registrant))
+	case DuplicateKeep:
+		shadow(name, reg)
+	default:
+		unshadow(name, reg.registrant)
+		shadow(name, existing)
+		extensions[name] = reg
+	}
+	logDebug("sqlite: extension registered by more than one package", "extension", name,
+		"active", extensions[name].registrant, "registrants", []string{existing.registrant, reg.registrant})
+}
+
+// shadow remembers reg as a registration of name that isn't in use, in place of an earlier one from the same package
+func shadow(name string, reg *registration) {
+	unshadow(name, reg.registrant)
+	shadowed[name] = append(shadowed[name], reg)
+}
+
+// unshadow forgets the registration of name by the package with the given path that isn't in use, if any
+func unshadow(name, pkg string) {
+	var regs []*registration
+	for _, r := range shadowed[name] {
+		if r.registrant != pkg {
+			regs = append(regs, r)
+		}
+	}
+	if len(regs) == 0 {
+		delete(shadowed, name)
+	} else {
+		shadowed[name] = regs
+	}
+}
+
+// lookupNamespaced returns the only namespaced extension registered with the given plain name; see WithNamespace.
+// It must be called with extensionsLock held.
+func lookupNamespaced(name string) (*registration, bool) {
+	var match *registration
+	for qualified, reg := range extensions {
+		if reg.options.Namespace && reg.short == name && qualified != name {
+			if match != nil {
+				return nil, false // ambiguous; it must be loaded with its qualified name
+			}
+			match = reg
+		}
+	}
+	return match, match != nil
+}
+
+// Conflict describes a name that more than one package registered an extension under
+type Conflict struct {
+	Name     string   // name the extensions are registered under
+	Active   string   // path of the package whose registration is in use
+	Shadowed []string // paths of the packages whose registrations aren't in use
+}
+
+// Conflicts returns the names that more than one package registered an extension under, sorted by name.
+// Applications can check it on startup to detect extensions shadowed by their dependencies, and pick the
+// registration to use with Resolve.
+func Conflicts() []Conflict {
+	extensionsLock.RLock()
+	defer extensionsLock.RUnlock()
+
+	var conflicts []Conflict
+	for name, regs := range shadowed {
+		var conflict = Conflict{Name: name, Active: extensions[name].registrant}
+		for _, reg := range regs {
+			conflict.Shadowed = append(conflict.Shadowed, reg.registrant)
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Name < conflicts[j].Name })
+	return conflicts
+}
+
+// Resolve makes the registration of the extension by the package with the given path the one in use for name,
+// shadowing the one currently in use. Connections that have already loaded the extension are not affected.
+// It returns an error if the package didn't register an extension under name.
+func Resolve(name, pkg string) error {
+	extensionsLock.Lock()
+	defer extensionsLock.Unlock()
+
+	var active, found = extensions[name]
+	if found && active.registrant == pkg {
+		return nil
+	}
+	for _, reg := range shadowed[name] {
+		if reg.registrant == pkg {
+			unshadow(name, pkg)
+			if found {
+				shadow(name, active)
+			}
+			extensions[name] = reg
+			return nil
+		}
+	}
+	return fmt.Errorf("sqlite: no extension %q registered by %s", name, pkg)
+}
+
+// registrant returns the path of the package that called into this package to register an extension
+func registrant() string {
+	var pcs [16]uintptr
+	var frames = runtime.CallersFrames(pcs[:runtime.Callers(2, pcs[:])])
+	for {
+		var frame, more = frames.Next()
+		if pkg := packageOf(frame.Function); pkg != modulePath && pkg != "" {
+			return pkg
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// packageOf returns the path of the package of the function with the given fully-qualified name
+func packageOf(fn string) string {
+	var slash = strings.LastIndex(fn, "/")
+	if dot := strings.IndexByte(fn[slash+1:], '.'); dot >= 0 {
+		return fn[:slash+1+dot]
+	}
+	return ""
+}
+
+// moduleOf returns the path of the module of the given package, as recorded in the build info, or pkg itself
+func moduleOf(pkg string) string {
+	var info, ok = debug.ReadBuildInfo()
+	if !ok {
+		return pkg
+	}
+
+	var module = pkg
+	var longest = -1
+	for _, m := range append([]*debug.Module{&info.Main}, info.Deps...) {
+		if m.Path != "" && (pkg == m.Path || strings.HasPrefix(pkg, m.Path+"/")) && len(m.Path) > longest {
+			module, longest = m.Path, len(m.Path)
+		}
+	}
+	return module
+}
@@ -0,0 +1,133 @@
+package sqlite
+
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+import "C"
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ( // protected set of the open connections each extension was loaded on, by the name it was loaded under
+	loadedLock sync.Mutex
+	loaded     = make(map[string]map[*C.struct_sqlite3]struct{})
+)
+
+// WithReload tracks the connections the extension is loaded on, until they're closed, so that Reload can find them.
+// Tracking relies on Conn.OnClose, and so, it's opt-in: it adds the package's hidden collation to the connection,
+// which shows up in PRAGMA collation_list.
+func WithReload() func(*ExtensionOptions) {
+	return func(opt *ExtensionOptions) { opt.Reloadable = true }
+}
+
+// trackLoaded records that the extension was loaded under name on db, until the connection is closed
+func trackLoaded(name string, db *C.struct_sqlite3) {
+	loadedLock.Lock()
+	var _, found = loaded[name][db]
+	if !found {
+		if loaded[name] == nil {
+			loaded[name] = make(map[*C.struct_sqlite3]struct{})
+		}
+		loaded[name][db] = struct{}{}
+	}
+	loadedLock.Unlock()
+	if found {
+		return
+	}
+
+	var err = wrap(db).OnClose(func() {
+		loadedLock.Lock()
+		defer loadedLock.Unlock()
+		if delete(loaded[name], db); len(loaded[name]) == 0 {
+			delete(loaded, name)
+		}
+	})
+	if err != nil {
+		logDebug("sqlite: failed to track connection", "extension", name, "error", err)
+	}
+}
+
+// Reload re-runs the extension registered under the given name on every open connection it was loaded on with
+// WithReload, so that
+// the functions, modules and hooks it registers are replaced by the ones of the extension currently registered,
+// eg. after a new version of it was registered with RegisterNamed. It lets plugin systems reload their Go logic
+// without restarting the host process. A name ending with an asterisk reloads every extension loaded under a name
+// starting with the given prefix. InitSQL isn't executed again; see ExtensionApi.Reloading.
+//
+// Virtual tables already connected keep using the module they were connected with until they're reconnected,
+// eg. once the schema changes. sqlite doesn't allow replacing a function while a statement is running on the
+// connection, and so, connections should be idle; and they mustn't be closed while being reloaded.
+// Reload continues past failures, and returns a *ReloadError listing them.
+func Reload(name string) error {
+	type target struct {
+		name string
+		db   *C.struct_sqlite3
+	}
+
+	var targets []target
+	loadedLock.Lock()
+	for loadedName, dbs := range loaded {
+		if loadedName != name && !(strings.HasSuffix(name, "*") && strings.HasPrefix(loadedName, name[:len(name)-1])) {
+			continue
+		}
+		for db := range dbs {
+			targets = append(targets, target{name: loadedName, db: db})
+		}
+	}
+	loadedLock.Unlock()
+
+	sort.Slice(targets, func(i, j int) bool { return targets[i].name < targets[j].name })
+
+	var errs []error
+	for _, t := range targets {
+		if err := reload(t.name, t.db); err != nil {
+			errs = append(errs, fmt.Errorf("extension %q on connection %#x: %w", t.name, wrap(t.db).Handle(), err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ReloadError{Errors: errs}
+	}
+	return nil
+}
+
+// reload re-runs the extension registered under name on db
+func reload(name string, db *C.struct_sqlite3) (err error) {
+	defer func() {
+		if perr := panicked("sqlite3_extension_init", recover()); perr != nil {
+			err = perr
+		}
+	}()
+
+	var reg, found = lookup(name)
+	if !found {
+		return fmt.Errorf("no extension with name '%s' registered", name)
+	}
+
+	var code ErrorCode
+	if code, err = reg.fn(&ExtensionApi{db: db, name: name, config: reg.options.Config, reloading: true}); err == nil && !code.ok() {
+		err = code
+	}
+	if err != nil {
+		logDebug("sqlite: extension failed to reload", "extension", name, "error", err)
+		return err
+	}
+	logDebug("sqlite: extension reloaded", "extension", name)
+	return nil
+}
+
+// ReloadError is returned by Reload when the extension failed to be reloaded on one or more connections
+type ReloadError struct {
+	Errors []error // errors for each connection the extension failed to be reloaded on
+}
+
+func (e *ReloadError) Error() string {
+	var messages = make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return "sqlite: reload failed: " + strings.Join(messages, "; ")
+}
@@ -0,0 +1,74 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy configures how Stmt.Step retries when the database is busy (SQLITE_BUSY) or locked (SQLITE_LOCKED),
+// so that callers don't have to wrap every call in their own retry loop. Locks held by connections sharing
+// the same cache are handled separately, by waiting for them to be released (see Stmt.Step).
+//
+// The policy is applied on top of sqlite's own busy handler (see https://www.sqlite.org/c3ref/busy_timeout.html),
+// which, if set, is invoked before SQLITE_BUSY is returned.
+type RetryPolicy struct {
+	MaxRetries int           // maximum number of retries; zero disables retrying
+	Backoff    time.Duration // delay before the first retry; doubled on every subsequent retry
+	MaxBackoff time.Duration // upper bound of the delay; zero means no bound
+	Jitter     float64       // fraction of the delay (0 to 1) that is randomized, to spread out competing retries
+	Deadline   time.Duration // maximum time spent retrying a single call to Step; zero means no limit
+}
+
+// DefaultRetryPolicy is a RetryPolicy suitable for most applications with a handful of competing writers
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 10,
+	Backoff:    5 * time.Millisecond,
+	MaxBackoff: 500 * time.Millisecond,
+	Jitter:     0.2,
+	Deadline:   5 * time.Second,
+}
+
+// SetRetryPolicy sets the policy Stmt.Step follows for statements prepared on the connection.
+// Passing nil disables retrying, which is the default.
+func (conn *Conn) SetRetryPolicy(policy *RetryPolicy) {
+	if policy != nil {
+		var p = *policy // guard against later changes by the caller
+		policy = &p
+	}
+	conn.retry = policy
+}
+
+// delay returns how long to wait before the given retry (starting at zero) of a call started at start,
+// and reports false if the policy doesn't allow for another retry
+func (policy *RetryPolicy) delay(retry int, start time.Time) (time.Duration, bool) {
+	if policy == nil || retry >= policy.MaxRetries {
+		return 0, false
+	}
+
+	var d = policy.Backoff
+	for i := 0; i < retry && (policy.MaxBackoff == 0 || d < policy.MaxBackoff); i++ {
+		d *= 2
+	}
+	if policy.MaxBackoff > 0 && d > policy.MaxBackoff {
+		d = policy.MaxBackoff
+	}
+
+	if policy.Jitter > 0 && d > 0 {
+		var spread = time.Duration(float64(d) * policy.Jitter)
+		if spread > 0 {
+			d = d - spread + time.Duration(rand.Int63n(int64(2*spread)))
+		}
+	}
+
+	if policy.Deadline > 0 {
+		if remaining := policy.Deadline - time.Since(start); remaining <= 0 {
+			return 0, false
+		} else if d > remaining {
+			d = remaining
+		}
+	}
+	return d, true
+}
@@ -0,0 +1,66 @@
+package sqlite_test
+
+import (
+	. "go.riyazali.net/sqlite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	bootstrap(t)
+
+	dir, err := ioutil.TempDir("", "retry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var path = filepath.Join(dir, "test.db")
+	writer, err := Open(path, DefaultOpenFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	other, err := Open(path, DefaultOpenFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	var exec = func(conn *Conn, sql string) error { return conn.Exec(sql, nil) }
+
+	if err = exec(writer, "BEGIN IMMEDIATE"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = exec(other, "BEGIN IMMEDIATE"); err == nil {
+		t.Fatal("expected SQLITE_BUSY without a retry policy")
+	}
+
+	other.SetRetryPolicy(&RetryPolicy{MaxRetries: 3, Backoff: time.Millisecond})
+	if err = exec(other, "BEGIN IMMEDIATE"); err == nil {
+		t.Fatal("expected SQLITE_BUSY once retries are exhausted")
+	}
+
+	// the writer commits while the other connection is retrying
+	other.SetRetryPolicy(&DefaultRetryPolicy)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = exec(writer, "COMMIT")
+	}()
+
+	// the script carries on past the statement that was retried
+	if err = exec(other, "SELECT 1; BEGIN IMMEDIATE; CREATE TABLE t (a);"); err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+	if err = exec(other, "COMMIT"); err != nil {
+		t.Fatal(err)
+	}
+	if err = exec(other, "INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatalf("expected the rest of the script to run, got %v", err)
+	}
+}
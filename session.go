@@ -0,0 +1,537 @@
+//go:build session
+// +build session
+
+package sqlite
+
+// The session extension isn't part of sqlite3_api_routines and so its routines are linked directly.
+// The host sqlite3 library must be compiled with SQLITE_ENABLE_SESSION and SQLITE_ENABLE_PREUPDATE_HOOK.
+// see: https://www.sqlite.org/sessionintro.html
+
+// #cgo CFLAGS: -DSQLITE_ENABLE_SESSION -DSQLITE_ENABLE_PREUPDATE_HOOK
+//
+// #include <stdlib.h>
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+//
+// extern int changeset_filter_tramp(void*, char*);
+// extern int changeset_conflict_tramp(void*, int, sqlite3_changeset_iter*);
+//
+// static int _sqlite3changeset_apply(sqlite3 *db, int n, void *changeset, int filter, void *pCtx, void **ppRebase, int *pnRebase) {
+//   return sqlite3changeset_apply_v2(db, n, changeset,
+//     filter ? (int(*)(void*, const char*)) changeset_filter_tramp : 0,
+//     (int(*)(void*, int, sqlite3_changeset_iter*)) changeset_conflict_tramp, pCtx, ppRebase, pnRebase, 0);
+// }
+import "C"
+
+import (
+	"github.com/mattn/go-pointer"
+	"unsafe"
+)
+
+// Session is a wrapper over sqlite3_session object that records changes made to one or more tables
+// of a database and packages those changes into a changeset (or patchset).
+//
+// see: https://www.sqlite.org/session/session.html
+type Session struct {
+	ptr *C.sqlite3_session
+}
+
+// CreateSession creates a new session object attached to the given schema (eg. "main", "temp" or an attached database).
+// A newly created session doesn't monitor any tables. Use Session.Attach to attach tables to it.
+//
+// see: https://www.sqlite.org/session/sqlite3session_create.html
+func (conn *Conn) CreateSession(schema string) (*Session, error) {
+	var cschema = C.CString(schema)
+	defer C.free(unsafe.Pointer(cschema))
+
+	var session = &Session{}
+	if err := errorIfNotOk(C.sqlite3session_create(conn.db, cschema, &session.ptr)); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Attach attaches the named table to the session. Changes to the table made after the call are recorded by the session.
+// If table is an empty string, changes are recorded for all tables in the database.
+//
+// see: https://www.sqlite.org/session/sqlite3session_attach.html
+func (session *Session) Attach(table string) error {
+	var ctable *C.char
+	if table != "" {
+		ctable = C.CString(table)
+		defer C.free(unsafe.Pointer(ctable))
+	}
+	return errorIfNotOk(C.sqlite3session_attach(session.ptr, ctable))
+}
+
+// Enable enables or disables the recording of changes by the session. It returns the new state of the session.
+//
+// see: https://www.sqlite.org/session/sqlite3session_enable.html
+func (session *Session) Enable(enable bool) bool {
+	var v = C.int(0)
+	if enable {
+		v = 1
+	}
+	return int(C.sqlite3session_enable(session.ptr, v)) != 0
+}
+
+// Enabled reports whether the session is currently recording changes.
+func (session *Session) Enabled() bool {
+	return int(C.sqlite3session_enable(session.ptr, -1)) != 0
+}
+
+// SetIndirect sets the indirect change flag for the session. Changes recorded while the flag is set are marked as indirect.
+// It returns the new value of the flag.
+//
+// see: https://www.sqlite.org/session/sqlite3session_indirect.html
+func (session *Session) SetIndirect(indirect bool) bool {
+	var v = C.int(0)
+	if indirect {
+		v = 1
+	}
+	return int(C.sqlite3session_indirect(session.ptr, v)) != 0
+}
+
+// IsEmpty returns true if no changes have been recorded by the session.
+//
+// see: https://www.sqlite.org/session/sqlite3session_isempty.html
+func (session *Session) IsEmpty() bool {
+	return int(C.sqlite3session_isempty(session.ptr)) != 0
+}
+
+// Changeset returns a changeset containing all the changes recorded by the session.
+//
+// see: https://www.sqlite.org/session/sqlite3session_changeset.html
+func (session *Session) Changeset() ([]byte, error) {
+	var n C.int
+	var buf unsafe.Pointer
+	if err := errorIfNotOk(C.sqlite3session_changeset(session.ptr, &n, &buf)); err != nil {
+		return nil, err
+	}
+	return takeBuffer(buf, n), nil
+}
+
+// Patchset returns a patchset containing all the changes recorded by the session.
+// A patchset is a more compact form of changeset which doesn't contain the original values of updated / deleted rows.
+//
+// see: https://www.sqlite.org/session/sqlite3session_patchset.html
+func (session *Session) Patchset() ([]byte, error) {
+	var n C.int
+	var buf unsafe.Pointer
+	if err := errorIfNotOk(C.sqlite3session_patchset(session.ptr, &n, &buf)); err != nil {
+		return nil, err
+	}
+	return takeBuffer(buf, n), nil
+}
+
+// Delete deletes the session object. It must be called before the connection the session is attached to is closed.
+//
+// see: https://www.sqlite.org/session/sqlite3session_delete.html
+func (session *Session) Delete() {
+	if session.ptr != nil {
+		C.sqlite3session_delete(session.ptr)
+		session.ptr = nil
+	}
+}
+
+// ChangeOp identifies the kind of change recorded for a row in a changeset
+type ChangeOp int
+
+//noinspection GoSnakeCaseUsage
+const (
+	CHANGE_INSERT = ChangeOp(C.SQLITE_INSERT)
+	CHANGE_UPDATE = ChangeOp(C.SQLITE_UPDATE)
+	CHANGE_DELETE = ChangeOp(C.SQLITE_DELETE)
+)
+
+func (op ChangeOp) String() string {
+	switch op {
+	case CHANGE_INSERT:
+		return "INSERT"
+	case CHANGE_UPDATE:
+		return "UPDATE"
+	case CHANGE_DELETE:
+		return "DELETE"
+	default:
+		return "<unknown change op>"
+	}
+}
+
+// ConflictType is the type of conflict reported to the conflict handler when applying a changeset
+type ConflictType int
+
+//noinspection GoSnakeCaseUsage
+const (
+	CHANGESET_DATA        = ConflictType(C.SQLITE_CHANGESET_DATA)
+	CHANGESET_NOTFOUND    = ConflictType(C.SQLITE_CHANGESET_NOTFOUND)
+	CHANGESET_CONFLICT    = ConflictType(C.SQLITE_CHANGESET_CONFLICT)
+	CHANGESET_CONSTRAINT  = ConflictType(C.SQLITE_CHANGESET_CONSTRAINT)
+	CHANGESET_FOREIGN_KEY = ConflictType(C.SQLITE_CHANGESET_FOREIGN_KEY)
+)
+
+// ConflictAction is the value returned by a conflict handler to tell sqlite how to handle the conflict
+type ConflictAction int
+
+//noinspection GoSnakeCaseUsage
+const (
+	CHANGESET_OMIT    = ConflictAction(C.SQLITE_CHANGESET_OMIT)
+	CHANGESET_REPLACE = ConflictAction(C.SQLITE_CHANGESET_REPLACE)
+	CHANGESET_ABORT   = ConflictAction(C.SQLITE_CHANGESET_ABORT)
+)
+
+// ConflictHandler is invoked when a change cannot be applied cleanly to the target database.
+// The iterator points at the change that caused the conflict and must not be retained after the handler returns.
+type ConflictHandler func(ConflictType, *ChangesetIterator) ConflictAction
+
+// ChangesetIterator points to a single change within a changeset.
+//
+// see: https://www.sqlite.org/session/changeset_iter.html
+type ChangesetIterator struct {
+	ptr *C.sqlite3_changeset_iter
+	buf unsafe.Pointer // copy of the changeset being iterated; nil if the iterator is owned by sqlite
+}
+
+// NewChangesetIterator creates an iterator to iterate over the contents of the changeset.
+// The iterator initially points before the first change; call Next to advance it.
+// The iterator must be finalized with Finalize once done.
+//
+// see: https://www.sqlite.org/session/sqlite3changeset_start.html
+func NewChangesetIterator(changeset []byte) (*ChangesetIterator, error) {
+	var iter = &ChangesetIterator{buf: C.CBytes(changeset)}
+	if err := errorIfNotOk(C.sqlite3changeset_start(&iter.ptr, C.int(len(changeset)), iter.buf)); err != nil {
+		C.free(iter.buf)
+		return nil, err
+	}
+	return iter, nil
+}
+
+// Next advances the iterator to the next change in the changeset.
+// It returns false once all the changes have been visited.
+//
+// see: https://www.sqlite.org/session/sqlite3changeset_next.html
+func (iter *ChangesetIterator) Next() (bool, error) {
+	switch res := ErrorCode(C.sqlite3changeset_next(iter.ptr)); res {
+	case SQLITE_ROW:
+		return true, nil
+	case SQLITE_DONE:
+		return false, nil
+	default:
+		return false, res
+	}
+}
+
+// Finalize releases the iterator created with NewChangesetIterator.
+// It reports any error that was encountered while iterating over the changeset.
+//
+// see: https://www.sqlite.org/session/sqlite3changeset_finalize.html
+func (iter *ChangesetIterator) Finalize() error {
+	if iter.buf == nil {
+		return nil // iterators passed to a ConflictHandler are owned by sqlite
+	}
+	defer func() { C.free(iter.buf); iter.buf, iter.ptr = nil, nil }()
+	return errorIfNotOk(C.sqlite3changeset_finalize(iter.ptr))
+}
+
+// Operation returns the name of the table affected by the current change, the number of columns in that table,
+// the type of change and whether the change was marked as indirect.
+//
+// see: https://www.sqlite.org/session/sqlite3changeset_op.html
+func (iter *ChangesetIterator) Operation() (table string, columns int, op ChangeOp, indirect bool, err error) {
+	var ctable *C.char
+	var ccols, cop, cindirect C.int
+	if err = errorIfNotOk(C.sqlite3changeset_op(iter.ptr, &ctable, &ccols, &cop, &cindirect)); err != nil {
+		return "", 0, 0, false, err
+	}
+	return C.GoString(ctable), int(ccols), ChangeOp(cop), int(cindirect) != 0, nil
+}
+
+// PrimaryKey returns a slice with one entry per column of the table affected by the current change.
+// An entry is set to true if the corresponding column is part of the table's primary key.
+//
+// see: https://www.sqlite.org/session/sqlite3changeset_pk.html
+func (iter *ChangesetIterator) PrimaryKey() ([]bool, error) {
+	var pk *C.uchar
+	var n C.int
+	if err := errorIfNotOk(C.sqlite3changeset_pk(iter.ptr, &pk, &n)); err != nil {
+		return nil, err
+	}
+
+	var columns = make([]bool, int(n))
+	for i, b := range C.GoBytes(unsafe.Pointer(pk), n) {
+		columns[i] = b != 0
+	}
+	return columns, nil
+}
+
+// Old returns the original value of the i-th column for an UPDATE or DELETE change.
+// For an UPDATE, the returned value is nil (see Value.IsNil) if the column wasn't modified.
+//
+// see: https://www.sqlite.org/session/sqlite3changeset_old.html
+func (iter *ChangesetIterator) Old(i int) (Value, error) {
+	var v *C.sqlite3_value
+	if err := errorIfNotOk(C.sqlite3changeset_old(iter.ptr, C.int(i), &v)); err != nil {
+		return Value{}, err
+	}
+	return Value{ptr: v}, nil
+}
+
+// New returns the updated value of the i-th column for an UPDATE or INSERT change.
+// For an UPDATE, the returned value is nil (see Value.IsNil) if the column wasn't modified.
+//
+// see: https://www.sqlite.org/session/sqlite3changeset_new.html
+func (iter *ChangesetIterator) New(i int) (Value, error) {
+	var v *C.sqlite3_value
+	if err := errorIfNotOk(C.sqlite3changeset_new(iter.ptr, C.int(i), &v)); err != nil {
+		return Value{}, err
+	}
+	return Value{ptr: v}, nil
+}
+
+// Conflict returns the value of the i-th column of the conflicting row in the target database.
+// It is only valid from within a ConflictHandler invoked with CHANGESET_DATA or CHANGESET_CONFLICT.
+//
+// see: https://www.sqlite.org/session/sqlite3changeset_conflict.html
+func (iter *ChangesetIterator) Conflict(i int) (Value, error) {
+	var v *C.sqlite3_value
+	if err := errorIfNotOk(C.sqlite3changeset_conflict(iter.ptr, C.int(i), &v)); err != nil {
+		return Value{}, err
+	}
+	return Value{ptr: v}, nil
+}
+
+// ForeignKeyConflicts returns the number of foreign key constraint violations.
+// It is only valid from within a ConflictHandler invoked with CHANGESET_FOREIGN_KEY.
+//
+// see: https://www.sqlite.org/session/sqlite3changeset_fk_conflicts.html
+func (iter *ChangesetIterator) ForeignKeyConflicts() (int, error) {
+	var n C.int
+	if err := errorIfNotOk(C.sqlite3changeset_fk_conflicts(iter.ptr, &n)); err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// applyContext is the state shared with the filter and conflict trampolines during ApplyChangeset
+type applyContext struct {
+	filter   func(string) bool
+	conflict ConflictHandler
+	panic    error // panic recovered from filter or conflict, if any
+}
+
+// ApplyChangeset applies the changeset to the connection's main database.
+//
+// If filter is non-nil it is invoked with the name of each table affected by the changeset
+// and changes for the table are only applied if it returns true. If conflict is nil,
+// any conflict aborts the operation and rolls back all the changes applied so far.
+//
+// see: https://www.sqlite.org/session/sqlite3changeset_apply.html
+func (conn *Conn) ApplyChangeset(changeset []byte, filter func(table string) bool, conflict ConflictHandler) error {
+	return conn.applyChangeset(changeset, filter, conflict, nil, nil)
+}
+
+// ApplyChangesetWithRebase works like ApplyChangeset but additionally returns a rebase buffer
+// which can be passed to Rebaser.Configure to rebase other changesets on top of this one.
+//
+// see: https://www.sqlite.org/session/sqlite3changeset_apply.html
+func (conn *Conn) ApplyChangesetWithRebase(changeset []byte, filter func(table string) bool, conflict ConflictHandler) ([]byte, error) {
+	var n C.int
+	var rebase unsafe.Pointer
+	if err := conn.applyChangeset(changeset, filter, conflict, &rebase, &n); err != nil {
+		if rebase != nil {
+			C._sqlite3_free(rebase)
+		}
+		return nil, err
+	}
+	return takeBuffer(rebase, n), nil
+}
+
+func (conn *Conn) applyChangeset(changeset []byte, filter func(string) bool, conflict ConflictHandler, rebase *unsafe.Pointer, n *C.int) error {
+	if conflict == nil {
+		conflict = func(ConflictType, *ChangesetIterator) ConflictAction { return CHANGESET_ABORT }
+	}
+
+	var hasFilter = C.int(0)
+	if filter != nil {
+		hasFilter = 1
+	}
+
+	// changeset is copied over to C heap as the iterator passed to the callbacks references it
+	var buf = C.CBytes(changeset)
+	defer C.free(buf)
+
+	var ctx = &applyContext{filter: filter, conflict: conflict}
+	var pCtx = saveHandle(handleApplyParams, ctx)
+	defer unrefHandle(pCtx)
+
+	var err = errorIfNotOk(C._sqlite3changeset_apply(conn.db, C.int(len(changeset)), buf, hasFilter, pCtx, rebase, n))
+	if ctx.panic != nil {
+		return ctx.panic
+	}
+	return err
+}
+
+//export changeset_filter_tramp
+func changeset_filter_tramp(pCtx unsafe.Pointer, table *C.char) (res C.int) {
+	var ctx = pointer.Restore(pCtx).(*applyContext)
+	defer func() { // skip the table; the panic is returned once the changeset is applied
+		if err := panicked("xFilter", recover()); err != nil {
+			ctx.panic, res = err, C.int(0)
+		}
+	}()
+
+	if ctx.filter(C.GoString(table)) {
+		return C.int(1)
+	}
+	return C.int(0)
+}
+
+//export changeset_conflict_tramp
+func changeset_conflict_tramp(pCtx unsafe.Pointer, eConflict C.int, iter *C.sqlite3_changeset_iter) (res C.int) {
+	var ctx = pointer.Restore(pCtx).(*applyContext)
+	defer func() {
+		if err := panicked("xConflict", recover()); err != nil {
+			ctx.panic, res = err, C.int(CHANGESET_ABORT)
+		}
+	}()
+
+	return C.int(ctx.conflict(ConflictType(eConflict), &ChangesetIterator{ptr: iter}))
+}
+
+// InvertChangeset returns a changeset that reverts the changes in the given changeset.
+//
+// see: https://www.sqlite.org/session/sqlite3changeset_invert.html
+func InvertChangeset(changeset []byte) ([]byte, error) {
+	var in = C.CBytes(changeset)
+	defer C.free(in)
+
+	var n C.int
+	var buf unsafe.Pointer
+	if err := errorIfNotOk(C.sqlite3changeset_invert(C.int(len(changeset)), in, &n, &buf)); err != nil {
+		return nil, err
+	}
+	return takeBuffer(buf, n), nil
+}
+
+// ConcatChangesets returns a single changeset equivalent to applying a followed by b.
+//
+// see: https://www.sqlite.org/session/sqlite3changeset_concat.html
+func ConcatChangesets(a, b []byte) ([]byte, error) {
+	var ca, cb = C.CBytes(a), C.CBytes(b)
+	defer C.free(ca)
+	defer C.free(cb)
+
+	var n C.int
+	var buf unsafe.Pointer
+	if err := errorIfNotOk(C.sqlite3changeset_concat(C.int(len(a)), ca, C.int(len(b)), cb, &n, &buf)); err != nil {
+		return nil, err
+	}
+	return takeBuffer(buf, n), nil
+}
+
+// Changegroup combines multiple changesets (or patchsets) into a single one.
+//
+// see: https://www.sqlite.org/session/changegroup.html
+type Changegroup struct {
+	ptr *C.sqlite3_changegroup
+}
+
+// NewChangegroup creates a new, empty changegroup. It must be deleted with Delete once done.
+//
+// see: https://www.sqlite.org/session/sqlite3changegroup_new.html
+func NewChangegroup() (*Changegroup, error) {
+	var group = &Changegroup{}
+	if err := errorIfNotOk(C.sqlite3changegroup_new(&group.ptr)); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// Add adds all the changes in the given changeset (or patchset) to the changegroup.
+//
+// see: https://www.sqlite.org/session/sqlite3changegroup_add.html
+func (group *Changegroup) Add(changeset []byte) error {
+	var buf = C.CBytes(changeset)
+	defer C.free(buf)
+	return errorIfNotOk(C.sqlite3changegroup_add(group.ptr, C.int(len(changeset)), buf))
+}
+
+// Output returns a changeset (or patchset) containing all the changes added to the changegroup so far.
+//
+// see: https://www.sqlite.org/session/sqlite3changegroup_output.html
+func (group *Changegroup) Output() ([]byte, error) {
+	var n C.int
+	var buf unsafe.Pointer
+	if err := errorIfNotOk(C.sqlite3changegroup_output(group.ptr, &n, &buf)); err != nil {
+		return nil, err
+	}
+	return takeBuffer(buf, n), nil
+}
+
+// Delete deletes the changegroup object.
+//
+// see: https://www.sqlite.org/session/sqlite3changegroup_delete.html
+func (group *Changegroup) Delete() {
+	if group.ptr != nil {
+		C.sqlite3changegroup_delete(group.ptr)
+		group.ptr = nil
+	}
+}
+
+// Rebaser rebases changesets on top of the changes applied by conflicting remote changesets.
+// The rebase buffers it is configured with are obtained from Conn.ApplyChangesetWithRebase.
+//
+// see: https://www.sqlite.org/session/rebaser.html
+type Rebaser struct {
+	ptr *C.sqlite3_rebaser
+}
+
+// NewRebaser creates a new rebaser object. It must be deleted with Delete once done.
+//
+// see: https://www.sqlite.org/session/sqlite3rebaser_create.html
+func NewRebaser() (*Rebaser, error) {
+	var rebaser = &Rebaser{}
+	if err := errorIfNotOk(C.sqlite3rebaser_create(&rebaser.ptr)); err != nil {
+		return nil, err
+	}
+	return rebaser, nil
+}
+
+// Configure configures the rebaser with the rebase buffer returned by Conn.ApplyChangesetWithRebase.
+//
+// see: https://www.sqlite.org/session/sqlite3rebaser_configure.html
+func (rebaser *Rebaser) Configure(rebase []byte) error {
+	var buf = C.CBytes(rebase)
+	defer C.free(buf)
+	return errorIfNotOk(C.sqlite3rebaser_configure(rebaser.ptr, C.int(len(rebase)), buf))
+}
+
+// Rebase rebases the given changeset based on the buffers the rebaser was configured with.
+//
+// see: https://www.sqlite.org/session/sqlite3rebaser_rebase.html
+func (rebaser *Rebaser) Rebase(changeset []byte) ([]byte, error) {
+	var in = C.CBytes(changeset)
+	defer C.free(in)
+
+	var n C.int
+	var buf unsafe.Pointer
+	if err := errorIfNotOk(C.sqlite3rebaser_rebase(rebaser.ptr, C.int(len(changeset)), in, &n, &buf)); err != nil {
+		return nil, err
+	}
+	return takeBuffer(buf, n), nil
+}
+
+// Delete deletes the rebaser object.
+//
+// see: https://www.sqlite.org/session/sqlite3rebaser_delete.html
+func (rebaser *Rebaser) Delete() {
+	if rebaser.ptr != nil {
+		C.sqlite3rebaser_delete(rebaser.ptr)
+		rebaser.ptr = nil
+	}
+}
+
+// takeBuffer copies a buffer allocated by sqlite into go memory and releases the original buffer
+func takeBuffer(buf unsafe.Pointer, n C.int) []byte {
+	defer C._sqlite3_free(buf)
+	return C.GoBytes(buf, n)
+}
@@ -0,0 +1,244 @@
+//go:build session
+// +build session
+
+package sqlite_test
+
+import (
+	"errors"
+	"fmt"
+	. "go.riyazali.net/sqlite"
+	"testing"
+)
+
+// count returns the number of rows in the given table
+func count(c *Conn, table string) (n int, err error) {
+	err = c.Exec(fmt.Sprintf("SELECT COUNT(*) FROM %s", table), func(stmt *Stmt) error {
+		n = stmt.ColumnInt(0)
+		return nil
+	})
+	return n, err
+}
+
+func TestSession(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+
+		if err := c.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT)", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		var session, err = c.CreateSession("main")
+		if err != nil {
+			return SQLITE_ERROR, err
+		}
+		defer session.Delete()
+
+		if err = session.Attach(""); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		if !session.IsEmpty() {
+			return SQLITE_ERROR, errors.New("session must be empty")
+		}
+
+		if err = c.Exec("INSERT INTO t VALUES (1, 'a'), (2, 'b')", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		var changeset []byte
+		if changeset, err = session.Changeset(); err != nil {
+			return SQLITE_ERROR, err
+		} else if len(changeset) == 0 {
+			return SQLITE_ERROR, errors.New("changeset must not be empty")
+		}
+
+		session.Enable(false)
+		if err = c.Exec("DELETE FROM t", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		// filtering out the table must leave it untouched
+		if err = c.ApplyChangeset(changeset, func(string) bool { return false }, nil); err != nil {
+			return SQLITE_ERROR, err
+		} else if n, _ := count(c, "t"); n != 0 {
+			return SQLITE_ERROR, fmt.Errorf("expected 0 rows got %d", n)
+		}
+
+		if err = c.ApplyChangeset(changeset, nil, nil); err != nil {
+			return SQLITE_ERROR, err
+		} else if n, _ := count(c, "t"); n != 2 {
+			return SQLITE_ERROR, fmt.Errorf("expected 2 rows got %d", n)
+		}
+
+		// re-applying the changeset conflicts with the existing rows
+		var conflicts int
+		err = c.ApplyChangeset(changeset, nil, func(typ ConflictType, iter *ChangesetIterator) ConflictAction {
+			if typ != CHANGESET_CONFLICT {
+				return CHANGESET_ABORT
+			}
+			if table, _, op, _, err := iter.Operation(); err != nil || table != "t" || op != CHANGE_INSERT {
+				return CHANGESET_ABORT
+			}
+			if v, err := iter.Conflict(0); err != nil || v.Int() == 0 {
+				return CHANGESET_ABORT
+			}
+			conflicts++
+			return CHANGESET_OMIT
+		})
+		if err != nil {
+			return SQLITE_ERROR, err
+		} else if conflicts != 2 {
+			return SQLITE_ERROR, fmt.Errorf("expected 2 conflicts got %d", conflicts)
+		}
+
+		// without a conflict handler, conflicts abort the operation
+		if err = c.ApplyChangeset(changeset, nil, nil); err == nil {
+			return SQLITE_ERROR, errors.New("expected apply to abort")
+		}
+
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestChangesetTooling(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+
+		if err := c.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT)", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		// record returns the changeset produced by running the given sql
+		var record = func(sql string) ([]byte, error) {
+			var session, err = c.CreateSession("main")
+			if err != nil {
+				return nil, err
+			}
+			defer session.Delete()
+
+			if err = session.Attach("t"); err != nil {
+				return nil, err
+			}
+			if err = c.Exec(sql, nil); err != nil {
+				return nil, err
+			}
+			return session.Changeset()
+		}
+
+		var first, second []byte
+		var err error
+		if first, err = record("INSERT INTO t VALUES (1, 'a')"); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if second, err = record("UPDATE t SET name = 'b' WHERE id = 1"); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		// iterate over the update
+		var iter *ChangesetIterator
+		if iter, err = NewChangesetIterator(second); err != nil {
+			return SQLITE_ERROR, err
+		}
+		var changes int
+		for {
+			var ok bool
+			if ok, err = iter.Next(); err != nil {
+				return SQLITE_ERROR, err
+			} else if !ok {
+				break
+			}
+			changes++
+
+			if _, columns, op, _, err := iter.Operation(); err != nil || columns != 2 || op != CHANGE_UPDATE {
+				return SQLITE_ERROR, fmt.Errorf("unexpected operation %s on %d columns (%v)", op, columns, err)
+			}
+			if pk, err := iter.PrimaryKey(); err != nil || len(pk) != 2 || !pk[0] || pk[1] {
+				return SQLITE_ERROR, fmt.Errorf("unexpected primary key %v (%v)", pk, err)
+			}
+			if old, err := iter.Old(1); err != nil || old.Text() != "a" {
+				return SQLITE_ERROR, fmt.Errorf("unexpected old value (%v)", err)
+			}
+			if val, err := iter.New(1); err != nil || val.Text() != "b" {
+				return SQLITE_ERROR, fmt.Errorf("unexpected new value (%v)", err)
+			}
+		}
+		if err = iter.Finalize(); err != nil {
+			return SQLITE_ERROR, err
+		} else if changes != 1 {
+			return SQLITE_ERROR, fmt.Errorf("expected 1 change got %d", changes)
+		}
+
+		// concatenating and grouping both collapse the two changes into a single insert
+		var concat, grouped []byte
+		if concat, err = ConcatChangesets(first, second); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		var group *Changegroup
+		if group, err = NewChangegroup(); err != nil {
+			return SQLITE_ERROR, err
+		}
+		defer group.Delete()
+		if err = group.Add(first); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err = group.Add(second); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if grouped, err = group.Output(); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if string(concat) != string(grouped) {
+			return SQLITE_ERROR, errors.New("concat and changegroup must produce the same changeset")
+		}
+
+		// inverting the combined changeset reverts everything
+		var inverse []byte
+		if inverse, err = InvertChangeset(concat); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err = c.ApplyChangeset(inverse, nil, nil); err != nil {
+			return SQLITE_ERROR, err
+		} else if n, _ := count(c, "t"); n != 0 {
+			return SQLITE_ERROR, fmt.Errorf("expected 0 rows got %d", n)
+		}
+
+		// apply with rebase and rebase a concurrent change on top of it
+		var rebase []byte
+		if err = c.Exec("INSERT INTO t VALUES (1, 'x')", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+		rebase, err = c.ApplyChangesetWithRebase(first, nil, func(ConflictType, *ChangesetIterator) ConflictAction {
+			return CHANGESET_REPLACE
+		})
+		if err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		var rebaser *Rebaser
+		if rebaser, err = NewRebaser(); err != nil {
+			return SQLITE_ERROR, err
+		}
+		defer rebaser.Delete()
+		if err = rebaser.Configure(rebase); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if _, err = rebaser.Rebase(second); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
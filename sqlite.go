@@ -9,9 +9,13 @@ package sqlite
 import "C"
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"runtime"
+	"strings"
+	"sync"
+	"time"
 	"unsafe"
 )
 
@@ -21,44 +25,210 @@ import (
 // building a prepared statement (and operations on a prepared statement)
 //
 // A Conn can only be used by goroutine at a time.
+// See SetOwnershipChecks for a debug mode that detects violations.
 type Conn struct {
 	db         *C.sqlite3      // reference to the underlying sqlite3 database handle
-	unlockNote *C._unlock_note // reference to the unlock_note struct used for unlock notification .. defined in blocking_step.h
+	unlockNote *C._unlock_note // reference to the unlock_note struct used for unlock notification .. allocated on first use
+	opened     bool            // whether the connection was opened with Open, and so, must be closed with Close
+	retry      *RetryPolicy    // policy followed by Step when the database is busy or locked; see SetRetryPolicy
+	autoReset  bool            // whether statements prepared on the connection reset once done; see SetAutoReset
+	timeout    time.Duration   // time statements are allowed to run before they're interrupted; see SetQueryTimeout
 }
 
 // wrap wraps the provided handle to sqlite3 database, yielding Conn
-func wrap(db *C.sqlite3) *Conn {
-	var c = &Conn{db: db, unlockNote: C._unlock_note_alloc()}
+func wrap(db *C.sqlite3) *Conn { return &Conn{db: db} }
 
-	// ensure unlock_note is free'd when connection is no longer in use
-	runtime.SetFinalizer(c, func(c *Conn) {
-		C._unlock_note_free(c.unlockNote)
+var ( // whether the library supports unlock notification; detected on first use
+	unlockNotifyOnce      sync.Once
+	unlockNotifySupported bool
+)
+
+// maxUnlockAttempts is the number of times waitForUnlock backs off before giving up,
+// when the library doesn't support unlock notification (roughly 10 seconds in total)
+const maxUnlockAttempts = 100
+
+// waitForUnlock blocks until the shared-cache lock that caused SQLITE_LOCKED_SHAREDCACHE is released, using
+// sqlite3_unlock_notify. If the library is compiled without SQLITE_ENABLE_UNLOCK_NOTIFY, it sleeps instead,
+// backing off exponentially with the number of previous attempts, and gives up after maxUnlockAttempts.
+func (conn *Conn) waitForUnlock(attempt int) C.int {
+	unlockNotifyOnce.Do(func() {
+		unlockNotifySupported = C._unlock_notify_available() != 0 && supports(FEATURE_UNLOCK_NOTIFY)
 	})
 
-	return c
+	if !unlockNotifySupported {
+		if attempt >= maxUnlockAttempts {
+			return C.SQLITE_LOCKED_SHAREDCACHE
+		}
+
+		var backoff = time.Millisecond << uint(attempt)
+		if attempt > 6 || backoff > 100*time.Millisecond {
+			backoff = 100 * time.Millisecond
+		}
+		time.Sleep(backoff)
+		return C.SQLITE_OK
+	}
+
+	if conn.unlockNote == nil {
+		conn.unlockNote = C._unlock_note_alloc()
+
+		// ensure unlock_note is free'd when connection is no longer in use
+		runtime.SetFinalizer(conn, func(c *Conn) {
+			C._unlock_note_free(c.unlockNote)
+		})
+	}
+	return C._wait_for_unlock_notify(conn.db, conn.unlockNote)
 }
 
+// Handle returns the address of the underlying sqlite3* database handle.
+// It can be passed to other drivers or libraries that operate on raw sqlite3 handles.
+func (conn *Conn) Handle() uintptr { return uintptr(unsafe.Pointer(conn.db)) }
+
 // LastInsertRowID reports the rowid of the most recently successful INSERT.
 // see: https://www.sqlite.org/c3ref/last_insert_rowid.html
 func (conn *Conn) LastInsertRowID() int64 {
 	return int64(C._sqlite3_last_insert_rowid(conn.db))
 }
 
+// Changes reports the number of rows changed, inserted or deleted by the most recently completed
+// INSERT, UPDATE or DELETE statement, not counting the changes made by triggers.
+// see: https://www.sqlite.org/c3ref/changes.html
+func (conn *Conn) Changes() int64 {
+	return int64(C._sqlite3_changes(conn.db))
+}
+
+// TotalChanges reports the number of rows changed, inserted or deleted by all the INSERT, UPDATE and DELETE statements
+// completed since the connection was opened, including the changes made by triggers. Comparing it before and after
+// a statement tells whether the statement changed anything, which Changes alone can't tell.
+// see: https://www.sqlite.org/c3ref/total_changes.html
+func (conn *Conn) TotalChanges() int64 {
+	return int64(C._sqlite3_total_changes(conn.db))
+}
+
 // AutoCommit returns the status of the auto_commit setting
 func (conn *Conn) AutoCommit() bool {
 	return int(C._sqlite3_get_autocommit(conn.db)) != 0
 }
 
+// SetAutoReset sets whether statements prepared on the connection from now on are reset by Stmt.Step once they
+// have stepped through all of their rows, which avoids the locks held by statements that are never reset.
+// It's off by default; see Stmt.SetAutoReset.
+func (conn *Conn) SetAutoReset(enabled bool) { conn.autoReset = enabled }
+
+// Limit queries for the limit with given identifier
+// see: https://www.sqlite.org/c3ref/limit.html
+func (conn *Conn) Limit(id LimitId) int {
+	return int(C._sqlite3_limit(conn.db, C.int(id), C.int(-1)))
+}
+
+// SetLimit sets the limit for the given identifier and returns the prior value of the limit
+// see: https://www.sqlite.org/c3ref/limit.html
+func (conn *Conn) SetLimit(id LimitId, val int) int {
+	return int(C._sqlite3_limit(conn.db, C.int(id), C.int(val)))
+}
+
+// ReleaseMemory attempts to free as much heap memory as possible from the database connection,
+// by releasing unused pages held in the connection's page cache.
+// see: https://www.sqlite.org/c3ref/db_release_memory.html
+func (conn *Conn) ReleaseMemory() error {
+	return errorIfNotOk(C._sqlite3_db_release_memory(conn.db))
+}
+
+// SetWALAutoCheckpoint makes the connection checkpoint the write-ahead log once it grows past the given number of pages,
+// on the commit that grows it. A non-positive value disables automatic checkpointing altogether, eg. for extensions
+// that write heavily to their shadow tables and would rather checkpoint on their own, with PRAGMA wal_checkpoint.
+// The default is 1000 pages. It has no effect unless the database is in WAL mode, and it replaces any WAL hook
+// registered on the connection. The current value is returned by PRAGMA wal_autocheckpoint.
+// see: https://www.sqlite.org/c3ref/wal_autocheckpoint.html
+func (conn *Conn) SetWALAutoCheckpoint(pages int) error {
+	if pages < 0 {
+		pages = 0
+	}
+	return errorIfNotOk(C._sqlite3_wal_autocheckpoint(conn.db, C.int(pages)))
+}
+
+// CacheFlush writes any dirty pages in the connection's page cache to disk, without ending
+// an open write transaction. It returns SQLITE_BUSY if some pages could not be written due to locks.
+// see: https://www.sqlite.org/c3ref/db_cacheflush.html
+func (conn *Conn) CacheFlush() error {
+	return errorIfNotOk(C._sqlite3_db_cacheflush(conn.db))
+}
+
+// EnableLoadExtension enables or disables loading extensions with LoadExtension.
+// It only toggles the C-level interface; the load_extension() SQL function stays disabled.
+// see: https://www.sqlite.org/c3ref/c_dbconfig_defensive.html#sqlitedbconfigenableloadextension
+func (conn *Conn) EnableLoadExtension(on bool) error {
+	var v = C.int(0)
+	if on {
+		v = 1
+	}
+	return errorIfNotOk(C._sqlite3_db_config_int(conn.db, C.SQLITE_DBCONFIG_ENABLE_LOAD_EXTENSION, v, nil))
+}
+
+// LoadExtension loads the sqlite3 extension from the shared library at path, using the given entrypoint.
+// If entrypoint is empty, sqlite derives the name of the entrypoint from the file name.
+//
+// Loading extensions must first be enabled for the connection (see EnableLoadExtension).
+// see: https://www.sqlite.org/c3ref/load_extension.html
+func (conn *Conn) LoadExtension(path, entrypoint string) error {
+	var cpath = C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	var cproc *C.char
+	if entrypoint != "" {
+		cproc = C.CString(entrypoint)
+		defer C.free(unsafe.Pointer(cproc))
+	}
+
+	var msg *C.char
+	if res := ErrorCode(C._sqlite3_load_extension(conn.db, cpath, cproc, &msg)); !res.ok() {
+		if msg != nil {
+			defer C._sqlite3_free(unsafe.Pointer(msg))
+			return Error(res, C.GoString(msg))
+		}
+		return res
+	}
+	return nil
+}
+
+// UserVersion returns the value of the user_version field in the main database's header.
+// see: https://www.sqlite.org/pragma.html#pragma_user_version
+func (conn *Conn) UserVersion() (int32, error) { return conn.pragmaInt32("user_version") }
+
+// SetUserVersion sets the value of the user_version field in the main database's header.
+// see: https://www.sqlite.org/pragma.html#pragma_user_version
+func (conn *Conn) SetUserVersion(v int32) error { return conn.setPragmaInt32("user_version", v) }
+
+// ApplicationID returns the value of the application_id field in the main database's header.
+// see: https://www.sqlite.org/pragma.html#pragma_application_id
+func (conn *Conn) ApplicationID() (int32, error) { return conn.pragmaInt32("application_id") }
+
+// SetApplicationID sets the value of the application_id field in the main database's header.
+// see: https://www.sqlite.org/pragma.html#pragma_application_id
+func (conn *Conn) SetApplicationID(v int32) error { return conn.setPragmaInt32("application_id", v) }
+
+func (conn *Conn) pragmaInt32(name string) (int32, error) {
+	var v, err = ResultInt64(conn, fmt.Sprintf("PRAGMA %s", name))
+	return int32(v), err
+}
+
+// pragma arguments cannot be bound as parameters and so the value is formatted into the query
+func (conn *Conn) setPragmaInt32(name string, v int32) error {
+	return conn.Exec(fmt.Sprintf("PRAGMA %s = %d", name, v), nil)
+}
+
 // Prepare prepares a query and returns an Stmt.
 //
 // If the query has any unprocessed trailing bytes, its count is returned.
 // see: https://www.sqlite.org/c3ref/prepare.html
 func (conn *Conn) Prepare(query string) (*Stmt, int, error) {
+	conn.checkOwner()
+
 	var stmt = &Stmt{
 		conn:      conn,
 		query:     query,
 		bindNames: make(map[string]int),
 		colNames:  make(map[string]int),
+		autoReset: conn.autoReset,
 	}
 
 	var sql = C.CString(query)
@@ -66,7 +236,7 @@ func (conn *Conn) Prepare(query string) (*Stmt, int, error) {
 	var trailing *C.char
 
 	var res = C._sqlite3_prepare_v2(conn.db, sql, -1, &stmt.stmt, &trailing)
-	if err := ErrorCode(res); !err.ok() {
+	if err := queryError(conn.db, res, query); err != nil {
 		return nil, 0, err
 	}
 
@@ -87,9 +257,162 @@ func (conn *Conn) Prepare(query string) (*Stmt, int, error) {
 	return stmt, int(C.strlen(trailing)), nil
 }
 
+// PrepareNext prepares the first statement in sql, and returns it along with the rest of sql, that follows it.
+// The returned statement is nil if sql has no statement, but only whitespace and comments.
+func (conn *Conn) PrepareNext(sql string) (stmt *Stmt, rest string, err error) {
+	var trailing int
+	if stmt, trailing, err = conn.Prepare(sql); err != nil {
+		return nil, "", err
+	}
+
+	rest = sql[len(sql)-trailing:]
+	if stmt.stmt == nil {
+		return nil, rest, nil
+	}
+	stmt.query = sql[:len(sql)-trailing]
+	return stmt, rest, nil
+}
+
+// Script iterates over the statements of an SQL script, preparing them one at a time; see Conn.PrepareScript.
+//
+//	var script = conn.PrepareScript(sql)
+//	defer script.Close()
+//	for script.Next() {
+//		// bind and step through script.Stmt()
+//	}
+//	if err := script.Err(); err != nil { ... }
+type Script struct {
+	conn *Conn
+	rest string
+	stmt *Stmt
+	err  error
+}
+
+// PrepareScript returns a Script over the statements in sql. Statements are only prepared as the iteration
+// reaches them, and so, each statement can refer to the tables created by the statements that precede it.
+func (conn *Conn) PrepareScript(sql string) *Script { return &Script{conn: conn, rest: sql} }
+
+// Next finalizes the current statement and prepares the next one. It returns false once there are no more
+// statements, or if preparing the next one fails, in which case the error is reported by Err.
+func (script *Script) Next() bool {
+	if script.err = script.finalize(); script.err != nil {
+		return false
+	}
+
+	for script.stmt == nil && strings.TrimSpace(script.rest) != "" {
+		if script.stmt, script.rest, script.err = script.conn.PrepareNext(script.rest); script.err != nil {
+			return false
+		}
+	}
+	return script.stmt != nil
+}
+
+// Stmt returns the current statement. It's valid until the next call to Next or Close.
+func (script *Script) Stmt() *Stmt { return script.stmt }
+
+// Rest returns the part of the script that follows the current statement
+func (script *Script) Rest() string { return script.rest }
+
+// Err returns the error that stopped the iteration, if any
+func (script *Script) Err() error { return script.err }
+
+// Close finalizes the current statement, if any, and stops the iteration
+func (script *Script) Close() error {
+	script.rest = ""
+	return script.finalize()
+}
+
+func (script *Script) finalize() (err error) {
+	if script.stmt != nil {
+		err, script.stmt = script.stmt.Finalize(), nil
+	}
+	return err
+}
+
+// ExecScript executes every statement in the script in turn, calling fn, if it's not nil, for every row they return.
+// Unlike Exec, fn receives the rows of all the statements, and the iteration stops at the first error.
+func (conn *Conn) ExecScript(sql string, fn func(stmt *Stmt) error) (err error) {
+	var script = conn.PrepareScript(sql)
+	defer func() {
+		if cerr := script.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	for script.Next() {
+		for {
+			var stmt = script.Stmt()
+			if hasRow, err := stmt.Step(); err != nil {
+				return err
+			} else if !hasRow {
+				break
+			}
+			if fn != nil {
+				if err := fn(stmt); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return script.Err()
+}
+
 // Exec executes an SQLite query without caching the underlying query.
 // It is the spiritual equivalent of sqlite3_exec.
-func (conn *Conn) Exec(query string, fn func(stmt *Stmt) error, args ...interface{}) (err error) {
+//
+// When fn is nil and no args are given, the query is run in a single call into sqlite, as sqlite3_exec does,
+// which avoids the overhead of preparing and stepping through the statement from Go.
+// In that case, query may contain multiple semicolon-separated statements. A statement that fails because
+// the database is busy or locked is still handled as Stmt.Step would: shared-cache locks are waited for, and
+// other errors are retried as per the connection's RetryPolicy (see Conn.SetRetryPolicy).
+func (conn *Conn) Exec(query string, fn func(stmt *Stmt) error, args ...interface{}) error {
+	return conn.exec(query, fn, false, args)
+}
+
+// Result summarizes the effect of a statement run with ExecResult
+type Result struct {
+	Changes         int64 // rows changed, inserted or deleted by the statement; zero unless it's an INSERT, UPDATE or DELETE
+	LastInsertRowID int64 // rowid of the most recent successful INSERT on the connection
+}
+
+// ExecResult is like Exec but also returns the number of rows the statement changed and the last inserted rowid,
+// captured as soon as the statement completes, so that they don't reflect the statements run after it
+// (eg. by another Exec, or a deferred cleanup). A statement that isn't an INSERT, UPDATE or DELETE has no changes,
+// even though Conn.Changes still reports those of the last one that was.
+func (conn *Conn) ExecResult(query string, fn func(stmt *Stmt) error, args ...interface{}) (Result, error) {
+	var total = conn.TotalChanges()
+	if err := conn.exec(query, fn, false, args); err != nil {
+		return Result{}, err
+	}
+
+	var result = Result{LastInsertRowID: conn.LastInsertRowID()}
+	if conn.TotalChanges() != total {
+		result.Changes = conn.Changes()
+	}
+	return result, nil
+}
+
+// ErrNotReadOnly is returned by ExecReadOnly for statements that may change the database
+var ErrNotReadOnly = errors.New("sqlite: statement is not read-only")
+
+// ExecReadOnly is like Exec but refuses to run a statement that may change the database, as reported by
+// Stmt.Readonly, returning an error that wraps ErrNotReadOnly instead. It lets extensions that evaluate SQL supplied
+// by their users (eg. filters or computed views) guarantee that the SQL doesn't write to the database.
+// Unlike Exec, query must be a single statement.
+//
+// Statements that only change the state of the connection, like BEGIN, COMMIT, SAVEPOINT, ATTACH and DETACH,
+// count as read-only. Functions invoked by the statement are free to write to the database on their own.
+func (conn *Conn) ExecReadOnly(query string, fn func(stmt *Stmt) error, args ...interface{}) error {
+	return conn.exec(query, fn, true, args)
+}
+
+func (conn *Conn) exec(query string, fn func(stmt *Stmt) error, readOnly bool, args []interface{}) (err error) {
+	conn.checkOwner()
+
+	if fn == nil && len(args) == 0 && !readOnly {
+		return conn.execScript(query)
+	}
+
 	var stmt *Stmt
 	var trailingBytes int
 	if stmt, trailingBytes, err = conn.Prepare(query); err != nil {
@@ -104,30 +427,12 @@ func (conn *Conn) Exec(query string, fn func(stmt *Stmt) error, args ...interfac
 	if trailingBytes != 0 {
 		return fmt.Errorf("exec: query %q has trailing bytes", query)
 	}
+	if readOnly && !stmt.Readonly() {
+		return fmt.Errorf("%w: %q", ErrNotReadOnly, query)
+	}
 
 	for i, arg := range args {
-		i++ // parameters are 1-indexed
-		v := reflect.ValueOf(arg)
-		switch v.Kind() {
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			stmt.BindInt64(i, v.Int())
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-			stmt.BindInt64(i, int64(v.Uint()))
-		case reflect.Float32, reflect.Float64:
-			stmt.BindFloat(i, v.Float())
-		case reflect.String:
-			stmt.BindText(i, v.String())
-		case reflect.Bool:
-			stmt.BindBool(i, v.Bool())
-		case reflect.Invalid:
-			stmt.BindNull(i)
-		default:
-			if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
-				stmt.BindBytes(i, v.Bytes())
-			} else {
-				stmt.BindText(i, fmt.Sprintf("%v", arg))
-			}
-		}
+		stmt.bindArg(i+1, arg) // parameters are 1-indexed
 	}
 	for {
 		hasRow, err := stmt.Step()
@@ -146,3 +451,103 @@ func (conn *Conn) Exec(query string, fn func(stmt *Stmt) error, args ...interfac
 
 	return nil
 }
+
+// execScript runs the statements in query with a single call into sqlite, as sqlite3_exec does. A statement that
+// fails because the database is busy or locked is run again with Step, so that it waits for shared-cache locks or
+// is retried as per the connection's RetryPolicy, and the rest of the script carries on from there.
+func (conn *Conn) execScript(query string) error {
+	var deadline time.Time
+	if conn.timeout > 0 {
+		deadline = time.Now().Add(conn.timeout)
+	}
+
+	for rest := query; rest != ""; {
+		var sql = C.CString(rest)
+		var failed C.int
+		var stop = func() bool { return false }
+		if !deadline.IsZero() {
+			stop = interruptAt(conn.db, deadline)
+		}
+		var res = C._sqlite3_exec(conn.db, sql, &failed)
+		C.free(unsafe.Pointer(sql))
+		if stop() && res == C.SQLITE_INTERRUPT {
+			return &TimeoutError{SQL: query, Deadline: deadline}
+		}
+
+		if res == C.SQLITE_OK {
+			return nil
+		} else if !conn.retryable(res) {
+			var err = queryError(conn.db, res, query)
+			// sqlite reports the offset from the start of the failing statement, not of the script
+			if qe, ok := err.(*QueryError); ok && qe.Offset >= 0 {
+				qe.Offset += len(query) - len(rest) + int(failed)
+			}
+			return err
+		}
+
+		var stmt, next, err = conn.PrepareNext(rest[failed:])
+		if err != nil {
+			return err
+		}
+		if stmt != nil {
+			stmt.SetDeadline(deadline)
+			if err = stmt.exhaust(); err != nil {
+				return err
+			}
+		}
+		rest = next
+	}
+	return nil
+}
+
+// retryable reports whether the statement that failed with res, as run by execScript, is worth running again with Step
+func (conn *Conn) retryable(res C.int) bool {
+	switch uint8(res) { // reduce to non-extended error code
+	case C.SQLITE_BUSY:
+		return conn.retry != nil
+	case C.SQLITE_LOCKED:
+		// Step waits for locks held by connections sharing the same cache, with or without a retry policy
+		return conn.retry != nil || C._sqlite3_extended_errcode(conn.db) == C.SQLITE_LOCKED_SHAREDCACHE
+	}
+	return false
+}
+
+// exhaust steps through all the rows of the statement and finalizes it
+func (stmt *Stmt) exhaust() (err error) {
+	defer func() {
+		if ferr := stmt.Finalize(); err == nil {
+			err = ferr
+		}
+	}()
+
+	for {
+		if hasRow, err := stmt.Step(); err != nil || !hasRow {
+			return err
+		}
+	}
+}
+
+// bindArg binds arg to the i-th parameter, picking the binding that fits the argument's kind
+func (stmt *Stmt) bindArg(i int, arg interface{}) {
+	v := reflect.ValueOf(arg)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		stmt.BindInt64(i, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		stmt.BindInt64(i, int64(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		stmt.BindFloat(i, v.Float())
+	case reflect.String:
+		stmt.BindText(i, v.String())
+	case reflect.Bool:
+		stmt.BindBool(i, v.Bool())
+	case reflect.Invalid:
+		stmt.BindNull(i)
+	default:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			stmt.BindBytes(i, v.Bytes())
+		} else {
+			stmt.BindText(i, fmt.Sprintf("%v", arg))
+		}
+	}
+}
@@ -3,6 +3,7 @@ package sqlite_test
 import (
 	"database/sql"
 	_ "github.com/mattn/go-sqlite3"
+	. "go.riyazali.net/sqlite"
 	_ "go.riyazali.net/sqlite/internal/testing/sqlite"
 	"os"
 	"testing"
@@ -25,4 +26,17 @@ func Connect(dataSourceName string) (db *sql.DB, err error) {
 		return nil, err
 	}
 	return db, nil
-}
\ No newline at end of file
+}
+
+// bootstrap registers an extension that does nothing, replacing the one registered by an earlier test,
+// and opens a first connection, which makes sure sqlite3_api routines are initialized
+// before the test calls into them.
+func bootstrap(t *testing.T) {
+	t.Helper()
+	Register(func(api *ExtensionApi) (ErrorCode, error) { return SQLITE_OK, nil })
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
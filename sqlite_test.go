@@ -0,0 +1,992 @@
+package sqlite_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	. "go.riyazali.net/sqlite"
+	"testing"
+	"time"
+)
+
+func TestUserVersion(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+
+		if err := c.SetUserVersion(42); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if v, err := c.UserVersion(); err != nil {
+			return SQLITE_ERROR, err
+		} else if v != 42 {
+			return SQLITE_ERROR, fmt.Errorf("expected user_version 42 got %d", v)
+		}
+
+		if err := c.SetApplicationID(-7); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if v, err := c.ApplicationID(); err != nil {
+			return SQLITE_ERROR, err
+		} else if v != -7 {
+			return SQLITE_ERROR, fmt.Errorf("expected application_id -7 got %d", v)
+		}
+
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestExec_MultipleStatements(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+
+		var script = "CREATE TABLE t (a); INSERT INTO t VALUES (1); INSERT INTO t VALUES (2);"
+		if err := c.Exec(script, nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		if err := c.Exec("INSERT INTO missing VALUES (1)", nil); err == nil {
+			return SQLITE_ERROR, fmt.Errorf("expected an error")
+		}
+
+		var n int
+		if err := c.Exec("SELECT COUNT(*) FROM t", func(stmt *Stmt) error { n = stmt.ColumnInt(0); return nil }); err != nil {
+			return SQLITE_ERROR, err
+		} else if n != 2 {
+			return SQLITE_ERROR, fmt.Errorf("expected 2 rows got %d", n)
+		}
+
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestReleaseMemory(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+
+		if err := c.Exec("CREATE TABLE t (a); BEGIN; INSERT INTO t VALUES (randomblob(4096));", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := c.CacheFlush(); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := c.Exec("COMMIT", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := c.ReleaseMemory(); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestConn_Limit(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+
+		var prev = c.Limit(LIMIT_VARIABLE_NUMBER)
+		if v := c.SetLimit(LIMIT_VARIABLE_NUMBER, 10); v != prev {
+			return SQLITE_ERROR, fmt.Errorf("expected prior limit %d got %d", prev, v)
+		}
+		if v := api.Limit(LIMIT_VARIABLE_NUMBER); v != 10 {
+			return SQLITE_ERROR, fmt.Errorf("expected limit 10 got %d", v)
+		}
+
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestSetWALAutoCheckpoint(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+
+		for _, pages := range []int{50, 0, -1} {
+			if err := c.SetWALAutoCheckpoint(pages); err != nil {
+				return SQLITE_ERROR, err
+			}
+
+			var expected = int64(pages)
+			if pages < 0 {
+				expected = 0
+			}
+			if v, err := ResultInt64(c, "PRAGMA wal_autocheckpoint"); err != nil {
+				return SQLITE_ERROR, err
+			} else if v != expected {
+				return SQLITE_ERROR, fmt.Errorf("expected %d pages got %d", expected, v)
+			}
+		}
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestBind64(t *testing.T) {
+	bootstrap(t)
+
+	conn, err := Open("file:bind64.db?mode=memory", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	stmt, _, err := conn.Prepare("SELECT ?, length(?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Finalize()
+
+	stmt.BindText64(1, "sqlite")
+	stmt.BindBytes64(2, []byte{1, 2, 3})
+	if _, err = stmt.Step(); err != nil {
+		t.Fatal(err)
+	} else if text, n := stmt.ColumnText(0), stmt.ColumnInt(1); text != "sqlite" || n != 3 {
+		t.Fatalf("expected sqlite, 3 got %q, %d", text, n)
+	}
+	_ = stmt.Reset()
+
+	// values larger than the length limit are refused rather than truncated
+	conn.SetLimit(LIMIT_LENGTH, 4)
+	stmt.BindText64(1, "sqlite")
+	if _, err = stmt.Step(); !errors.Is(err, SQLITE_TOOBIG) {
+		t.Fatalf("expected SQLITE_TOOBIG got %v", err)
+	}
+	stmt.BindText64(1, "")
+	stmt.BindBytes64(2, []byte{1, 2, 3, 4, 5})
+	if _, err = stmt.Step(); !errors.Is(err, SQLITE_TOOBIG) {
+		t.Fatalf("expected SQLITE_TOOBIG got %v", err)
+	}
+}
+
+func TestLoadExtension(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+
+		if err := api.LoadExtension("./testdata/does-not-exist", ""); err == nil {
+			return SQLITE_ERROR, fmt.Errorf("expected an error")
+		} else if !strings.Contains(err.Error(), "not authorized") {
+			return SQLITE_ERROR, fmt.Errorf("expected loading to be disabled, got: %v", err)
+		}
+
+		if err := c.EnableLoadExtension(true); err != nil {
+			return SQLITE_ERROR, err
+		}
+		defer func() { _ = c.EnableLoadExtension(false) }()
+
+		// the sql function must remain disabled
+		if err := c.Exec("SELECT load_extension('./testdata/does-not-exist')", func(*Stmt) error { return nil }); err == nil {
+			return SQLITE_ERROR, fmt.Errorf("expected load_extension() to be disabled")
+		}
+
+		// clear the connection's error state, else sqlite reports it as a failure to open the connection
+		if err := c.Exec("SELECT 1", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		if err := api.LoadExtension("./testdata/does-not-exist", ""); err == nil {
+			return SQLITE_ERROR, fmt.Errorf("expected an error")
+		} else if strings.Contains(err.Error(), "not authorized") {
+			return SQLITE_ERROR, fmt.Errorf("expected loading to be enabled, got: %v", err)
+		}
+
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestStatus(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var conn = api.Connection()
+		if err := conn.Exec("CREATE TABLE t(v); INSERT INTO t VALUES (1)", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		if used, _, err := api.Status(DBSTATUS_SCHEMA_USED, false); err != nil {
+			return SQLITE_ERROR, err
+		} else if used <= 0 {
+			return SQLITE_ERROR, fmt.Errorf("expected schema memory to be in use, got %d", used)
+		}
+
+		if _, _, err := api.Status(DbStatusOp(-1), false); err == nil {
+			return SQLITE_ERROR, fmt.Errorf("expected error for unknown status op")
+		}
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if used := MemoryUsed(); used <= 0 {
+		t.Fatalf("expected memory to be in use, got %d", used)
+	}
+	if high := MemoryHighwater(false); high < MemoryUsed() {
+		t.Fatalf("highwater %d must not be less than memory used", high)
+	}
+
+	if current, highwater, err := Status(STATUS_MALLOC_COUNT, false); err != nil {
+		t.Fatal(err)
+	} else if current <= 0 || highwater < current {
+		t.Fatalf("unexpected malloc count: current=%d highwater=%d", current, highwater)
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	bootstrap(t)
+
+	for _, s := range []string{"SELECT", "select", "Table"} {
+		if !IsKeyword(s) {
+			t.Fatalf("%q must be a keyword", s)
+		}
+	}
+	for _, s := range []string{"", "users", "selected"} {
+		if IsKeyword(s) {
+			t.Fatalf("%q must not be a keyword", s)
+		}
+	}
+
+	var keywords = Keywords()
+	if len(keywords) < 100 {
+		t.Fatalf("expected over 100 keywords, got %d", len(keywords))
+	}
+	for _, kw := range keywords {
+		if !IsKeyword(kw) {
+			t.Fatalf("%q returned by Keywords must be a keyword", kw)
+		}
+	}
+}
+
+func TestStringMatching(t *testing.T) {
+	bootstrap(t)
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var cases = []struct {
+		pattern, str string
+		escape       rune
+	}{
+		{"a%", "ABC", 0},
+		{"_b_", "abc", 0},
+		{"100!%", "100%", '!'},
+		{"100!%", "1000", '!'},
+		{"%é%", "café", 0},
+	}
+
+	for _, c := range cases {
+		var expected bool
+		if c.escape == 0 {
+			err = db.QueryRow("SELECT ? LIKE ?", c.str, c.pattern).Scan(&expected)
+		} else {
+			err = db.QueryRow("SELECT ? LIKE ? ESCAPE ?", c.str, c.pattern, string(c.escape)).Scan(&expected)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := StrLike(c.pattern, c.str, c.escape); got != expected {
+			t.Errorf("StrLike(%q, %q, %q): expected %v, got %v", c.pattern, c.str, c.escape, expected, got)
+		}
+	}
+
+	if !StrGlob("a*[0-9]", "abc9") || StrGlob("a*", "ABC") {
+		t.Error("StrGlob must match like the GLOB operator")
+	}
+
+	if StrICmp("hello", "HELLO") != 0 || StrICmp("a", "B") >= 0 || StrICmp("b", "A") <= 0 {
+		t.Error("StrICmp must compare ignoring case")
+	}
+}
+
+func TestMprintf(t *testing.T) {
+	bootstrap(t)
+
+	var cases = []struct {
+		format   string
+		args     []interface{}
+		expected string
+	}{
+		{"INSERT INTO %w VALUES (%Q, %Q)", []interface{}{`my"table`, "it's", nil}, `INSERT INTO my""table VALUES ('it''s', NULL)`},
+		{"'%q'", []interface{}{"o'clock"}, "'o''clock'"},
+		{"%d %5.2f %x %%", []interface{}{int64(1) << 40, 3.14159, 255}, "1099511627776  3.14 ff %"},
+		{"%-4s|%lld", []interface{}{"ab", 7}, "ab  |7"},
+	}
+
+	for _, c := range cases {
+		if got, err := Mprintf(c.format, c.args...); err != nil {
+			t.Fatal(err)
+		} else if got != c.expected {
+			t.Errorf("Mprintf(%q): expected %q, got %q", c.format, c.expected, got)
+		}
+	}
+
+	if _, err := Mprintf("%d", "not a number"); err == nil {
+		t.Error("expected error for mismatched argument")
+	}
+	if _, err := Mprintf("%s %s", "one"); err == nil {
+		t.Error("expected error for missing argument")
+	}
+
+	if q, _ := Mprintf(`"%w"`, `a"b`); QuoteIdentifier(`a"b`) != q {
+		t.Errorf("QuoteIdentifier must match %%w, got %s", QuoteIdentifier(`a"b`))
+	}
+	if q, _ := Mprintf("%Q", "a'b"); QuoteLiteral("a'b") != q {
+		t.Errorf("QuoteLiteral must match %%Q, got %s", QuoteLiteral("a'b"))
+	}
+}
+
+func TestOwnershipChecks(t *testing.T) {
+	SetOwnershipChecks(true)
+	defer SetOwnershipChecks(false)
+
+	var conn, other *Conn
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		conn, other = api.Connection(), api.Connection()
+		return SQLITE_OK, conn.Exec("SELECT 1", nil)
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var use = func(conn *Conn) (msg interface{}) {
+		var done = make(chan interface{})
+		go func() {
+			defer func() { done <- recover() }()
+			_ = conn.Exec("SELECT 1", nil)
+		}()
+		return <-done
+	}
+
+	if msg := use(conn); msg == nil {
+		t.Fatal("expected panic when the connection is used from another goroutine")
+	} else if !strings.Contains(fmt.Sprint(msg), "one goroutine at a time") {
+		t.Fatalf("unexpected panic: %v", msg)
+	}
+
+	// ownership is shared by every Conn wrapping the same connection
+	if msg := use(other); msg == nil {
+		t.Fatal("expected panic when another wrapper of the connection is used from another goroutine")
+	}
+
+	conn.Disown()
+	if msg := use(other); msg != nil {
+		t.Fatalf("disowned connection must be usable from another goroutine: %v", msg)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	var closeErr error
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		closeErr = api.Connection().Close()
+		return SQLITE_OK, nil
+	})
+
+	// the first connection makes sure sqlite3_api routines are initialized
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+
+	if closeErr == nil {
+		t.Fatal("expected error when closing a connection not opened with Open")
+	}
+
+	conn, err := Open("file:open.db?mode=memory", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = conn.Exec("CREATE TABLE t(v); INSERT INTO t VALUES (1), (2)", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	if err = conn.Exec("SELECT COUNT(*) FROM t", func(stmt *Stmt) error {
+		count = stmt.ColumnInt64(0)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	} else if count != 2 {
+		t.Fatalf("expected 2 rows, got %d", count)
+	}
+
+	if err = conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Close(); err != nil {
+		t.Fatalf("expected repeated Close to be a no-op, got %v", err)
+	}
+
+	if _, err = Open("file:no-such-dir/test.db", OPEN_READONLY|OPEN_URI); err == nil {
+		t.Fatal("expected error when opening a missing database read-only")
+	}
+}
+
+// mockExecer is an Execer that returns canned results without touching a database
+type mockExecer struct {
+	queries []string
+	rowid   int64
+}
+
+func (m *mockExecer) Exec(query string, _ func(*Stmt) error, _ ...interface{}) error {
+	m.queries = append(m.queries, query)
+	return nil
+}
+
+func (m *mockExecer) LastInsertRowID() int64 { return m.rowid }
+
+func TestQueryExecer(t *testing.T) {
+	t.Run("Mock", func(t *testing.T) {
+		var mock = &mockExecer{rowid: 7}
+		if id, err := Insert(mock, "INSERT INTO t VALUES (?)", 1); err != nil {
+			t.Fatal(err)
+		} else if id != 7 {
+			t.Fatalf("expected rowid 7, got %d", id)
+		}
+
+		if _, err := ResultInt64(mock, "SELECT COUNT(*) FROM t"); err != ErrNoRows {
+			t.Fatalf("expected ErrNoRows, got %v", err)
+		}
+
+		if len(mock.queries) != 2 {
+			t.Fatalf("expected 2 queries, got %q", mock.queries)
+		}
+	})
+
+	t.Run("Conn", func(t *testing.T) {
+		Register(func(api *ExtensionApi) (ErrorCode, error) {
+			var db QueryExecer = api.Connection()
+
+			if err := db.Exec("CREATE TABLE t(v TEXT)", nil); err != nil {
+				return SQLITE_ERROR, err
+			}
+
+			if id, err := Insert(db, "INSERT INTO t VALUES (?)", "hello"); err != nil {
+				return SQLITE_ERROR, err
+			} else if id != 1 {
+				return SQLITE_ERROR, fmt.Errorf("expected rowid 1, got %d", id)
+			}
+			_, _ = Insert(db, "INSERT INTO t VALUES (?)", "world")
+
+			if v, err := ResultText(db, "SELECT v FROM t WHERE rowid = ?", 2); err != nil {
+				return SQLITE_ERROR, err
+			} else if v != "world" {
+				return SQLITE_ERROR, fmt.Errorf("expected 'world', got %q", v)
+			}
+
+			if _, err := ResultText(db, "SELECT v FROM t"); err == nil {
+				return SQLITE_ERROR, fmt.Errorf("expected error when query returns more than one row")
+			}
+
+			if _, err := ResultInt64(db, "SELECT rowid FROM t WHERE v = 'none'"); err != ErrNoRows {
+				return SQLITE_ERROR, fmt.Errorf("expected ErrNoRows, got %v", err)
+			}
+			return SQLITE_OK, nil
+		})
+
+		if db, err := Connect(Memory); err != nil {
+			t.Fatal(err)
+		} else {
+			_ = db.Close()
+		}
+	})
+}
+
+func TestQueryMaps(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var conn = api.Connection()
+
+		var rows, err = conn.QueryMaps("SELECT * FROM (VALUES (1, 2.5, 'a', x'01', NULL), (?, 0.0, '', x'', ?))", 2, "b")
+		if err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		var expected = []map[string]interface{}{
+			{"column1": int64(1), "column2": 2.5, "column3": "a", "column4": []byte{1}, "column5": nil},
+			{"column1": int64(2), "column2": 0.0, "column3": "", "column4": []byte{}, "column5": "b"},
+		}
+		if !reflect.DeepEqual(rows, expected) {
+			return SQLITE_ERROR, fmt.Errorf("expected %v got %v", expected, rows)
+		}
+
+		if rows, err = conn.QueryMaps("SELECT 1 WHERE 0"); err != nil || len(rows) != 0 {
+			return SQLITE_ERROR, fmt.Errorf("expected no rows got %v (%v)", rows, err)
+		}
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestAutoReset(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+
+		// stepping through all the rows of the statement, and then binding the next value
+		var run = func(stmt *Stmt, v int64) error {
+			stmt.BindInt64(1, v)
+			for {
+				if row, err := stmt.Step(); err != nil {
+					return err
+				} else if !row {
+					return nil
+				} else if got := stmt.ColumnInt64(0); got != v {
+					return fmt.Errorf("expected %d got %d", v, got)
+				}
+			}
+		}
+
+		var stmt, _, err = c.Prepare("SELECT ?")
+		if err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err = run(stmt, 1); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err = run(stmt, 2); err == nil {
+			return SQLITE_ERROR, fmt.Errorf("expected binding to a statement that isn't reset to fail")
+		}
+		_ = stmt.Finalize()
+
+		c.SetAutoReset(true)
+		if stmt, _, err = c.Prepare("SELECT ?"); err != nil {
+			return SQLITE_ERROR, err
+		}
+		defer stmt.Finalize()
+		for v := int64(1); v <= 3; v++ {
+			if err = run(stmt, v); err != nil {
+				return SQLITE_ERROR, err
+			}
+		}
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestColumnSchema(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+
+		if err := c.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT NOT NULL, note VARCHAR(10))", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		var stmt, _, err = c.Prepare("SELECT id, name AS n, note, 1 + 1 AS two FROM t")
+		if err != nil {
+			return SQLITE_ERROR, err
+		}
+		defer stmt.Finalize()
+
+		var expected = []ColumnInfo{
+			{Name: "id", DeclType: "INTEGER", Database: "main", Table: "t", Origin: "id", PrimaryKey: true},
+			{Name: "n", DeclType: "TEXT", Database: "main", Table: "t", Origin: "name", NotNull: true},
+			{Name: "note", DeclType: "VARCHAR(10)", Database: "main", Table: "t", Origin: "note"},
+			{Name: "two"},
+		}
+		if !api.Supports(FEATURE_COLUMN_METADATA) {
+			for i := range expected {
+				expected[i] = ColumnInfo{Name: expected[i].Name, DeclType: expected[i].DeclType}
+			}
+		}
+
+		if schema := stmt.ColumnSchema(); !reflect.DeepEqual(schema, expected) {
+			return SQLITE_ERROR, fmt.Errorf("expected %+v got %+v", expected, schema)
+		}
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestGetTimeAndJSON(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+
+		var expected = time.Date(2024, 3, 1, 12, 30, 15, 0, time.UTC)
+		var query = `SELECT 1709296215 AS unix, 2460371.0210069446 AS julian, '2024-03-01 12:30:15' AS text,
+			'2024-03-01T14:30:15+02:00' AS zoned, julianday('2024-03-01 12:30:18') AS inexact,
+			NULL AS empty, '{"a": [1, 2]}' AS doc`
+
+		var err = c.Exec(query, func(stmt *Stmt) error {
+			for _, col := range []string{"unix", "julian", "text", "zoned"} {
+				if v, err := stmt.GetTime(col); err != nil {
+					return err
+				} else if !v.Equal(expected) {
+					return fmt.Errorf("%s: expected %v got %v", col, expected, v)
+				}
+			}
+
+			// the julian day is a few microseconds short of the time it stands for
+			var inexact = expected.Add(3 * time.Second)
+			if v, err := stmt.GetTime("inexact"); err != nil {
+				return err
+			} else if !v.Equal(inexact) {
+				return fmt.Errorf("inexact: expected %v got %v", inexact, v)
+			}
+
+			if v, err := stmt.GetTime("empty"); err != nil || !v.IsZero() {
+				return fmt.Errorf("expected zero time for NULL got %v (%v)", v, err)
+			}
+			if _, err := stmt.GetTime("missing"); err == nil {
+				return errors.New("expected an error for a missing column")
+			}
+
+			var doc struct{ A []int }
+			if err := stmt.GetJSON("doc", &doc); err != nil {
+				return err
+			} else if !reflect.DeepEqual(doc.A, []int{1, 2}) {
+				return fmt.Errorf("unexpected document %+v", doc)
+			}
+			if err := stmt.GetJSON("text", &doc); err == nil {
+				return errors.New("expected an error for malformed json")
+			}
+			return nil
+		})
+		if err != nil {
+			return SQLITE_ERROR, err
+		}
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestExecError(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var script = "CREATE TABLE t (a); INSERT INTO t VALUES (1); SELECT missing FROM t"
+
+		var qe *QueryError
+		if err := api.Connection().Exec(script, nil); !errors.As(err, &qe) {
+			return SQLITE_ERROR, fmt.Errorf("expected a *QueryError got %v", err)
+		}
+		if qe.SQL != script {
+			return SQLITE_ERROR, fmt.Errorf("expected the script as the failing sql got %q", qe.SQL)
+		}
+
+		// sqlite3_error_offset is only available since 3.38.0
+		var expected = -1
+		if api.Version() >= 3038000 {
+			expected = strings.Index(script, "missing")
+		}
+		if qe.Offset != expected {
+			return SQLITE_ERROR, fmt.Errorf("expected offset %d got %d", expected, qe.Offset)
+		}
+
+		// sqlite fails opening the connection if an error is still pending on it after loading the extension
+		return SQLITE_OK, api.Connection().Exec("SELECT 1", nil)
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestExecReadOnly(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+
+		if err := c.Exec("CREATE TABLE t (a); INSERT INTO t VALUES (1)", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		var n int
+		if err := c.ExecReadOnly("SELECT COUNT(*) FROM t WHERE a = ?", func(stmt *Stmt) error {
+			n = stmt.ColumnInt(0)
+			return nil
+		}, 1); err != nil {
+			return SQLITE_ERROR, err
+		} else if n != 1 {
+			return SQLITE_ERROR, fmt.Errorf("expected 1 row got %d", n)
+		}
+
+		for _, query := range []string{"INSERT INTO t VALUES (2)", "DELETE FROM t", "DROP TABLE t", "PRAGMA user_version = 1"} {
+			if err := c.ExecReadOnly(query, nil); !errors.Is(err, ErrNotReadOnly) {
+				return SQLITE_ERROR, fmt.Errorf("expected %q to be rejected got %v", query, err)
+			}
+		}
+
+		if count, _ := ResultInt64(c, "SELECT COUNT(*) FROM t"); count != 1 {
+			return SQLITE_ERROR, fmt.Errorf("expected the table to be left untouched got %d rows", count)
+		}
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestExecResult(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+
+		if err := c.Exec("CREATE TABLE t (a)", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		var steps = []struct {
+			query    string
+			args     []interface{}
+			expected Result
+		}{
+			{query: "INSERT INTO t VALUES (?), (?)", args: []interface{}{1, 2}, expected: Result{Changes: 2, LastInsertRowID: 2}},
+			{query: "UPDATE t SET a = a * 10", expected: Result{Changes: 2, LastInsertRowID: 2}},
+			{query: "SELECT * FROM t", expected: Result{Changes: 0, LastInsertRowID: 2}},
+			{query: "DELETE FROM t WHERE a = ?", args: []interface{}{10}, expected: Result{Changes: 1, LastInsertRowID: 2}},
+			{query: "UPDATE t SET a = 0 WHERE a < 0", expected: Result{Changes: 0, LastInsertRowID: 2}},
+		}
+
+		for _, step := range steps {
+			if result, err := c.ExecResult(step.query, nil, step.args...); err != nil {
+				return SQLITE_ERROR, err
+			} else if result != step.expected {
+				return SQLITE_ERROR, fmt.Errorf("expected %+v for %q got %+v", step.expected, step.query, result)
+			}
+		}
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestPrepareScript(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+
+		var stmt, rest, err = c.PrepareNext("SELECT 1; SELECT 2 -- two")
+		if err != nil {
+			return SQLITE_ERROR, err
+		}
+		_ = stmt.Finalize()
+		if rest != " SELECT 2 -- two" {
+			return SQLITE_ERROR, fmt.Errorf("unexpected rest %q", rest)
+		}
+		if stmt, rest, err = c.PrepareNext(" -- only a comment"); err != nil || stmt != nil || rest != "" {
+			return SQLITE_ERROR, fmt.Errorf("expected no statement got %v, %q (%v)", stmt, rest, err)
+		}
+
+		// the iteration stops at the statement that fails to prepare
+		var s = c.PrepareScript("SELECT 1; SELECT * FROM missing; SELECT 3")
+		var n = 0
+		for s.Next() {
+			n++
+		}
+		if n != 1 || s.Err() == nil {
+			return SQLITE_ERROR, fmt.Errorf("expected the script to stop at the second statement, got %d (%v)", n, s.Err())
+		}
+		if err = s.Close(); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		var script = `
+			CREATE TABLE t (a);
+			INSERT INTO t VALUES (1), (2); -- statements can refer to the ones before them
+			SELECT a FROM t;
+			SELECT a * 10 FROM t;
+		`
+		var values []int64
+		if err = c.ExecScript(script, func(stmt *Stmt) error {
+			values = append(values, stmt.ColumnInt64(0))
+			return nil
+		}); err != nil {
+			return SQLITE_ERROR, err
+		} else if fmt.Sprint(values) != "[1 2 10 20]" {
+			return SQLITE_ERROR, fmt.Errorf("unexpected values %v", values)
+		}
+		return SQLITE_OK, nil
+	})
+
+	if db, err := Connect(Memory); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = db.Close()
+	}
+}
+
+func TestSharedCacheLock(t *testing.T) {
+	bootstrap(t)
+
+	const uri = "file:unlock.db?mode=memory&cache=shared"
+	writer, err := Open(uri, DefaultOpenFlags|OPEN_SHAREDCACHE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	reader, err := Open(uri, DefaultOpenFlags|OPEN_SHAREDCACHE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	if err = writer.Exec("CREATE TABLE t(v); BEGIN; INSERT INTO t VALUES (1)", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the reader is blocked by the writer's open transaction, and must wait for it to commit
+	var done = make(chan error)
+	go func() {
+		done <- writer.Exec("COMMIT", nil)
+	}()
+
+	var count int
+	if err = reader.Exec("SELECT COUNT(*) FROM t", func(stmt *Stmt) error {
+		count = stmt.ColumnInt(0)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("expected reader to see the committed row, got %d rows", count)
+	}
+
+	// the same goes for Exec without a callback, which runs the statement in a single call into sqlite
+	if err = writer.Exec("BEGIN; INSERT INTO t VALUES (2)", nil); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		done <- writer.Exec("COMMIT", nil)
+	}()
+
+	if err = reader.Exec("SELECT 1; SELECT COUNT(*) FROM t", nil); err != nil {
+		t.Fatalf("expected the reader to wait for the writer to commit, got %v", err)
+	}
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var c = api.Connection()
+
+		var _, _, err = c.Prepare("SELECT * FROM WHERE")
+		var qe *QueryError
+		if !errors.As(err, &qe) {
+			return SQLITE_ERROR, fmt.Errorf("expected *QueryError, got %T", err)
+		}
+		if qe.Code != SQLITE_ERROR || qe.SQL != "SELECT * FROM WHERE" || !strings.Contains(qe.Msg, "syntax error") {
+			return SQLITE_ERROR, fmt.Errorf("unexpected error details %+v", qe)
+		}
+
+		if err = c.Exec("CREATE TABLE t(v UNIQUE); INSERT INTO t VALUES (1)", nil); err != nil {
+			return SQLITE_ERROR, err
+		}
+
+		err = c.Exec("INSERT INTO t VALUES (?)", nil, 1)
+		if !errors.Is(err, SQLITE_CONSTRAINT) || !errors.Is(err, SQLITE_CONSTRAINT_UNIQUE) {
+			return SQLITE_ERROR, fmt.Errorf("expected unique constraint violation, got %v", err)
+		}
+		if !errors.As(err, &qe) || qe.SQL != "INSERT INTO t VALUES (?)" {
+			return SQLITE_ERROR, fmt.Errorf("expected the failing sql to be reported, got %+v", qe)
+		}
+
+		// sqlite fails opening the connection if an error is still pending on it after loading the extension
+		return SQLITE_OK, c.Exec("SELECT 1", nil)
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+}
+
+func TestErrorCode_String(t *testing.T) {
+	var codes = map[ErrorCode]string{
+		SQLITE_CONSTRAINT_UNIQUE:   "SQLITE_CONSTRAINT_UNIQUE",
+		SQLITE_CONSTRAINT_DATATYPE: "SQLITE_CONSTRAINT_DATATYPE",
+		SQLITE_IOERR_CORRUPTFS:     "SQLITE_IOERR_CORRUPTFS",
+		SQLITE_IOERR_IN_PAGE:       "SQLITE_IOERR_IN_PAGE",
+		SQLITE_BUSY_SNAPSHOT:       "SQLITE_BUSY_SNAPSHOT",
+		SQLITE_BUSY_TIMEOUT:        "SQLITE_BUSY_TIMEOUT",
+		SQLITE_LOCKED_VTAB:         "SQLITE_LOCKED_VTAB",
+		SQLITE_CANTOPEN_SYMLINK:    "SQLITE_CANTOPEN_SYMLINK",
+		SQLITE_CORRUPT_INDEX:       "SQLITE_CORRUPT_INDEX",
+		SQLITE_NOTICE_RBU:          "SQLITE_NOTICE_RBU",
+		ErrorCode(12345):           "SQLITE_UNKNOWN_ERR(12345)",
+	}
+
+	for code, name := range codes {
+		if got := code.String(); got != name {
+			t.Errorf("ErrorCode(%d).String() = %q, want %q", int(code), got, name)
+		}
+	}
+
+	if got := SQLITE_IOERR_IN_PAGE & 0xff; got != SQLITE_IOERR {
+		t.Errorf("expected SQLITE_IOERR_IN_PAGE to extend SQLITE_IOERR, got %v", got)
+	}
+}
@@ -0,0 +1,240 @@
+//go:build static
+// +build static
+
+// Package sqlitetest provides helpers to unit-test extensions built with go.riyazali.net/sqlite
+// without building them as loadable shared objects or wiring up a database driver.
+//
+// Databases are opened using the sqlite3 library bundled with github.com/mattn/go-sqlite3, and the registered
+// extensions are initialized on every connection. As the extension must bind directly to the same sqlite3 library,
+// tests must be run with the static build tag, along with mattn's sqlite_vtable tag that enables the column metadata
+// routines this package binds to (eg. go test -tags "static sqlite_vtable" ./...).
+package sqlitetest
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"flag"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/interop/mattn"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// update, when set, makes Golden overwrite the golden files with the actual results
+var update = flag.Bool("sqlitetest.update", false, "update golden files instead of comparing against them")
+
+// counter used to give every in-memory database a unique name
+var databases int64
+
+// Options represents the various options that affect how a test database is opened
+type Options struct {
+	Extensions     []string // names of the registered extensions to initialize; defaults to the default extension
+	DataSourceName string   // address of the database; defaults to a new, private, in-memory database
+}
+
+// WithExtensions initializes the extensions registered under the given names with the database
+func WithExtensions(names ...string) func(*Options) {
+	return func(opt *Options) { opt.Extensions = append(opt.Extensions, names...) }
+}
+
+// WithDataSourceName opens the database at the given address (eg. a file in t.TempDir()) instead of in memory
+func WithDataSourceName(dsn string) func(*Options) {
+	return func(opt *Options) { opt.DataSourceName = dsn }
+}
+
+// DB is a database opened for the duration of a test. It embeds *sql.DB and
+// adds helpers that fail the test (rather than returning an error) when something goes wrong.
+type DB struct {
+	*sql.DB
+	t testing.TB
+}
+
+// Open opens a new database, initializes the registered extensions with it and arranges for it
+// to be closed when the test completes. It fails the test if the database cannot be opened or
+// if any of the extensions fails to initialize.
+//
+// Unless another address is given using WithDataSourceName, every call opens a new in-memory database.
+// The pool is limited to a single connection so that all statements see the same data.
+func Open(t testing.TB, opts ...func(*Options)) *DB {
+	t.Helper()
+
+	var options = &Options{}
+	for _, f := range opts {
+		f(options)
+	}
+
+	if options.DataSourceName == "" {
+		var n = atomic.AddInt64(&databases, 1)
+		options.DataSourceName = fmt.Sprintf("file:sqlitetest-%d.db?mode=memory", n)
+	}
+
+	var db = sql.OpenDB(&connector{
+		driver: &sqlite3.SQLiteDriver{ConnectHook: mattn.ConnectHook(options.Extensions...)},
+		dsn:    options.DataSourceName,
+	})
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		t.Fatalf("sqlitetest: failed to open database: %v", err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+	return &DB{DB: db, t: t}
+}
+
+// MustExec executes the query and fails the test if it returns an error.
+func (db *DB) MustExec(query string, args ...interface{}) sql.Result {
+	db.t.Helper()
+
+	var res, err = db.Exec(query, args...)
+	if err != nil {
+		db.t.Fatalf("sqlitetest: failed to execute %q: %v", query, err)
+	}
+	return res
+}
+
+// QueryRows executes the query and returns all the rows in the result.
+// Values are returned as-is from the driver (ie. int64, float64, string, []byte or nil).
+// It fails the test if the query returns an error.
+func (db *DB) QueryRows(query string, args ...interface{}) [][]interface{} {
+	db.t.Helper()
+
+	var _, rows = db.query(query, args...)
+	return rows
+}
+
+// QueryRow executes a query that is expected to return exactly one row and returns its values.
+// It fails the test if the query returns an error or doesn't return exactly one row.
+func (db *DB) QueryRow(query string, args ...interface{}) []interface{} {
+	db.t.Helper()
+
+	var rows = db.QueryRows(query, args...)
+	if len(rows) != 1 {
+		db.t.Fatalf("sqlitetest: expected %q to return a single row, got %d", query, len(rows))
+	}
+	return rows[0]
+}
+
+// Golden executes the query and compares its formatted result (see Format) against the contents of
+// testdata/<name>.golden. It fails the test if they don't match. When the test is run with
+// -sqlitetest.update the golden file is (re)written with the actual result instead.
+func (db *DB) Golden(name, query string, args ...interface{}) {
+	db.t.Helper()
+
+	var columns, rows = db.query(query, args...)
+	AssertGolden(db.t, name, Format(columns, rows))
+}
+
+// query executes the query and returns the names of the columns and all the rows in the result
+func (db *DB) query(query string, args ...interface{}) ([]string, [][]interface{}) {
+	db.t.Helper()
+
+	var rs, err = db.Query(query, args...)
+	if err != nil {
+		db.t.Fatalf("sqlitetest: failed to query %q: %v", query, err)
+	}
+	defer rs.Close()
+
+	columns, err := rs.Columns()
+	if err != nil {
+		db.t.Fatalf("sqlitetest: failed to read columns of %q: %v", query, err)
+	}
+
+	var rows = make([][]interface{}, 0)
+	for rs.Next() {
+		var values = make([]interface{}, len(columns))
+		var dest = make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+
+		if err = rs.Scan(dest...); err != nil {
+			db.t.Fatalf("sqlitetest: failed to scan row of %q: %v", query, err)
+		}
+		rows = append(rows, values)
+	}
+
+	if err = rs.Err(); err != nil {
+		db.t.Fatalf("sqlitetest: failed to query %q: %v", query, err)
+	}
+	return columns, rows
+}
+
+// Format renders the columns and rows as text, one line per row with the values separated by " | ",
+// preceded by a line with the column names. NULL is rendered as NULL and blobs as hexadecimal x'..' literals.
+func Format(columns []string, rows [][]interface{}) string {
+	var buf bytes.Buffer
+	buf.WriteString(strings.Join(columns, " | "))
+	buf.WriteByte('\n')
+
+	for _, row := range rows {
+		for i, value := range row {
+			if i > 0 {
+				buf.WriteString(" | ")
+			}
+			switch v := value.(type) {
+			case nil:
+				buf.WriteString("NULL")
+			case []byte:
+				fmt.Fprintf(&buf, "x'%x'", v)
+			default:
+				fmt.Fprint(&buf, v)
+			}
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// AssertGolden compares got against the contents of testdata/<name>.golden and fails the test if they don't match.
+// When the test is run with -sqlitetest.update the golden file is (re)written with got instead.
+func AssertGolden(t testing.TB, name, got string) {
+	t.Helper()
+
+	var path = filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("sqlitetest: failed to create golden file: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("sqlitetest: failed to update golden file: %v", err)
+		}
+		return
+	}
+
+	var want, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("sqlitetest: failed to read golden file (run with -sqlitetest.update to create it): %v", err)
+	}
+
+	if string(want) != got {
+		t.Errorf("sqlitetest: result doesn't match %s\n--- want:\n%s--- got:\n%s", path, want, got)
+	}
+}
+
+// AssertCollation fails the test if cmp doesn't have the properties sqlite requires of a collation,
+// over the strings in the corpus; see sqlite.VerifyCollation.
+func AssertCollation(t testing.TB, cmp func(string, string) int, corpus []string) {
+	t.Helper()
+	if err := sqlite.VerifyCollation(cmp, corpus); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// connector is a driver.Connector that opens connections with the given driver and address
+type connector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c *connector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+func (c *connector) Driver() driver.Driver                        { return c.driver }
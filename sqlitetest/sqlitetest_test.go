@@ -0,0 +1,49 @@
+//go:build static
+// +build static
+
+package sqlitetest_test
+
+import (
+	"go.riyazali.net/sqlite/internal/testing/fixture"
+	"go.riyazali.net/sqlite/sqlitetest"
+	"strings"
+	"testing"
+)
+
+func init() { fixture.Register("sqlitetest") }
+
+func TestOpen(t *testing.T) {
+	var db = sqlitetest.Open(t, sqlitetest.WithExtensions("sqlitetest"))
+
+	db.MustExec("CREATE TABLE t(v TEXT)")
+	db.MustExec("INSERT INTO t VALUES (?), (?), (NULL)", "hello", "world")
+
+	var rows = db.QueryRows("SELECT go_upper(v) FROM t ORDER BY rowid")
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+	if rows[0][0] != "HELLO" || rows[1][0] != "WORLD" || rows[2][0] != nil {
+		t.Fatalf("unexpected result: %v", rows)
+	}
+
+	if row := db.QueryRow("SELECT COUNT(*) FROM t"); row[0] != int64(3) {
+		t.Fatalf("expected 3, got %v", row[0])
+	}
+
+	// every database is isolated from the others
+	var other = sqlitetest.Open(t, sqlitetest.WithExtensions("sqlitetest"))
+	if _, err := other.Exec("SELECT * FROM t"); err == nil {
+		t.Fatal("table must not exist in a different database")
+	}
+}
+
+func TestGolden(t *testing.T) {
+	var db = sqlitetest.Open(t, sqlitetest.WithExtensions("sqlitetest"))
+
+	db.Golden("upper", "SELECT go_upper(column1) AS name, column2 AS n, column3 AS b "+
+		"FROM (VALUES ('alpha', 1, x'cafe'), ('beta', 2.5, NULL))")
+}
+
+func TestAssertCollation(t *testing.T) {
+	sqlitetest.AssertCollation(t, strings.Compare, []string{"", "a", "b", "ab", "B"})
+}
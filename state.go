@@ -0,0 +1,165 @@
+package sqlite
+
+// #include <stdlib.h>
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+//
+// extern void conn_state_destroy(void*);
+//
+// // never invoked; the collation only exists so that its destructor runs when the connection closes
+// static int conn_state_compare(void *p, int n1, const void *a, int n2, const void *b) { return 0; }
+//
+// static int _register_conn_state(sqlite3 *db, const char *name, void *pApp) {
+//   return _sqlite3_create_collation_v2(db, name, SQLITE_UTF8, pApp, conn_state_compare, conn_state_destroy);
+// }
+import "C"
+
+import (
+	"github.com/mattn/go-pointer"
+	"sync"
+	"unsafe"
+)
+
+// name of the hidden collation used to get notified when a connection is closed
+const connStateCollation = "__go_sqlite_conn_state"
+
+var ( // protected store used to track per-connection state
+	connStateLock  sync.Mutex
+	connStateStore = map[*C.struct_sqlite3]*connState{}
+)
+
+// connState holds state that is associated with an sqlite3 database connection
+// and that must outlive individual Conn wrappers created for the connection.
+type connState struct {
+	mu      sync.Mutex
+	db      *C.struct_sqlite3
+	owner   int64 // id of the goroutine that owns the connection; see SetOwnershipChecks
+	onClose []func()
+	data    map[interface{}]interface{} // see SetUserData
+	store   map[interface{}]interface{} // see Store
+}
+
+// stateOf returns the state associated with the given connection, creating it if required.
+//
+// When first created, a hidden collation with a destructor is registered with the connection.
+// sqlite invokes the destructor when the connection is closed, which we use to release the state.
+func stateOf(db *C.struct_sqlite3) (*connState, error) {
+	connStateLock.Lock()
+	defer connStateLock.Unlock()
+
+	if state, ok := connStateStore[db]; ok {
+		return state, nil
+	}
+
+	var cname = C.CString(connStateCollation)
+	defer C.free(unsafe.Pointer(cname))
+
+	var state = &connState{db: db}
+	var pApp = saveHandle(handleState, state)
+	if err := errorIfNotOk(C._register_conn_state(db, cname, pApp)); err != nil {
+		unrefHandle(pApp)
+		return nil, err
+	}
+
+	connStateStore[db] = state
+	return state, nil
+}
+
+// OnClose registers fn to be invoked when the connection is closed.
+// Callbacks are invoked in the reverse order of their registration.
+func (conn *Conn) OnClose(fn func()) error {
+	var state, err = stateOf(conn.db)
+	if err != nil {
+		return err
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.onClose = append(state.onClose, fn)
+	return nil
+}
+
+// OnClose registers fn to be invoked when the connection is closed.
+// It can be used to deterministically release any per-connection resources allocated by the extension.
+func (ext *ExtensionApi) OnClose(fn func()) error { return ext.conn().OnClose(fn) }
+
+// SetUserData associates value with key on the connection, so that the functions and virtual tables
+// an extension registers can find per-connection state, set up in its ExtensionFunc, with Context.UserData
+// or Conn.UserData instead of sharing globals across connections. A nil value removes the key.
+//
+// As with context.WithValue, keys should be of an unexported type to avoid collisions between extensions.
+// The data is dropped when the connection is closed; use OnClose to release any resources it holds.
+func (conn *Conn) SetUserData(key, value interface{}) error {
+	var state, err = stateOf(conn.db)
+	if err != nil {
+		return err
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if value == nil {
+		delete(state.data, key)
+		return nil
+	}
+	if state.data == nil {
+		state.data = make(map[interface{}]interface{})
+	}
+	state.data[key] = value
+	return nil
+}
+
+// UserData returns the value associated with key on the connection by SetUserData, or nil if there's none.
+func (conn *Conn) UserData(key interface{}) interface{} {
+	connStateLock.Lock()
+	var state, ok = connStateStore[conn.db]
+	connStateLock.Unlock()
+	if !ok {
+		return nil
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.data[key]
+}
+
+// SetUserData associates value with key on the connection being initialized; see Conn.SetUserData.
+func (ext *ExtensionApi) SetUserData(key, value interface{}) error {
+	return ext.conn().SetUserData(key, value)
+}
+
+//export conn_state_destroy
+func conn_state_destroy(ptr unsafe.Pointer) {
+	var state = pointer.Restore(ptr).(*connState)
+	defer unrefHandle(ptr)
+
+	connStateLock.Lock()
+	if connStateStore[state.db] == state {
+		delete(connStateStore, state.db)
+	}
+	connStateLock.Unlock()
+
+	state.mu.Lock()
+	var callbacks, stored = state.onClose, state.store
+	state.onClose, state.data, state.store = nil, nil, nil
+	state.mu.Unlock()
+
+	for i := len(callbacks) - 1; i >= 0; i-- {
+		runOnClose(callbacks[i])
+	}
+
+	// stored values are closed last, as the OnClose callbacks may still hold on to them
+	for key, v := range stored {
+		var key, v = key, v
+		runOnClose(func() {
+			if err := closeStored(v); err != nil {
+				logDebug("sqlite: failed to close stored value", "key", key, "error", err)
+			}
+		})
+	}
+}
+
+// runOnClose runs a callback registered with OnClose, recovering from any panic so that the rest still run
+func runOnClose(fn func()) {
+	defer func() { _ = panicked("OnClose", recover()) }()
+	fn()
+}
@@ -0,0 +1,81 @@
+package sqlite
+
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+import "C"
+
+// StatusOp identifies a process-wide runtime status counter
+// see: https://www.sqlite.org/c3ref/c_status_malloc_count.html
+type StatusOp int
+
+//noinspection GoSnakeCaseUsage
+const (
+	STATUS_MEMORY_USED        = StatusOp(C.SQLITE_STATUS_MEMORY_USED)        // memory checked out using sqlite3_malloc()
+	STATUS_PAGECACHE_USED     = StatusOp(C.SQLITE_STATUS_PAGECACHE_USED)     // pages used out of the page cache memory
+	STATUS_PAGECACHE_OVERFLOW = StatusOp(C.SQLITE_STATUS_PAGECACHE_OVERFLOW) // page cache allocations that overflowed to sqlite3_malloc()
+	STATUS_MALLOC_SIZE        = StatusOp(C.SQLITE_STATUS_MALLOC_SIZE)        // largest memory allocation request (highwater only)
+	STATUS_PARSER_STACK       = StatusOp(C.SQLITE_STATUS_PARSER_STACK)       // deepest parser stack (highwater only)
+	STATUS_PAGECACHE_SIZE     = StatusOp(C.SQLITE_STATUS_PAGECACHE_SIZE)     // largest page cache allocation request (highwater only)
+	STATUS_MALLOC_COUNT       = StatusOp(C.SQLITE_STATUS_MALLOC_COUNT)       // number of outstanding memory allocations
+)
+
+// DbStatusOp identifies a per-connection runtime status counter
+// see: https://www.sqlite.org/c3ref/c_dbstatus_options.html
+type DbStatusOp int
+
+//noinspection GoSnakeCaseUsage
+const (
+	DBSTATUS_LOOKASIDE_USED      = DbStatusOp(C.SQLITE_DBSTATUS_LOOKASIDE_USED)      // lookaside memory slots in use
+	DBSTATUS_CACHE_USED          = DbStatusOp(C.SQLITE_DBSTATUS_CACHE_USED)          // heap memory used by all pager caches
+	DBSTATUS_SCHEMA_USED         = DbStatusOp(C.SQLITE_DBSTATUS_SCHEMA_USED)         // heap memory used to store schemas
+	DBSTATUS_STMT_USED           = DbStatusOp(C.SQLITE_DBSTATUS_STMT_USED)           // heap and lookaside memory used by prepared statements
+	DBSTATUS_LOOKASIDE_HIT       = DbStatusOp(C.SQLITE_DBSTATUS_LOOKASIDE_HIT)       // malloc attempts satisfied using lookaside memory (highwater only)
+	DBSTATUS_LOOKASIDE_MISS_SIZE = DbStatusOp(C.SQLITE_DBSTATUS_LOOKASIDE_MISS_SIZE) // malloc attempts that failed due to the amount requested (highwater only)
+	DBSTATUS_LOOKASIDE_MISS_FULL = DbStatusOp(C.SQLITE_DBSTATUS_LOOKASIDE_MISS_FULL) // malloc attempts that failed as lookaside memory was full (highwater only)
+	DBSTATUS_CACHE_HIT           = DbStatusOp(C.SQLITE_DBSTATUS_CACHE_HIT)           // pager cache hits
+	DBSTATUS_CACHE_MISS          = DbStatusOp(C.SQLITE_DBSTATUS_CACHE_MISS)          // pager cache misses
+	DBSTATUS_CACHE_WRITE         = DbStatusOp(C.SQLITE_DBSTATUS_CACHE_WRITE)         // dirty cache entries written to disk
+	DBSTATUS_DEFERRED_FKS        = DbStatusOp(C.SQLITE_DBSTATUS_DEFERRED_FKS)        // 1 if there are unresolved deferred foreign key constraints
+	DBSTATUS_CACHE_USED_SHARED   = DbStatusOp(C.SQLITE_DBSTATUS_CACHE_USED_SHARED)   // like DBSTATUS_CACHE_USED, but shared caches are divided evenly
+	DBSTATUS_CACHE_SPILL         = DbStatusOp(C.SQLITE_DBSTATUS_CACHE_SPILL)         // dirty cache entries written to disk in the middle of a transaction
+)
+
+// Status returns the current value and the highest recorded value of the given process-wide status counter.
+// If reset is set, the highest recorded value is reset to the current value.
+func Status(op StatusOp, reset bool) (current, highwater int64, err error) {
+	var cur, high C.sqlite3_int64
+	if err = errorIfNotOk(C._sqlite3_status64(C.int(op), &cur, &high, boolToInt(reset))); err != nil {
+		return 0, 0, err
+	}
+	return int64(cur), int64(high), nil
+}
+
+// MemoryUsed returns the number of bytes of memory currently outstanding (malloced but not freed) by sqlite
+func MemoryUsed() int64 { return int64(C._sqlite3_memory_used()) }
+
+// MemoryHighwater returns the maximum value of MemoryUsed since the highwater mark was last reset.
+// If reset is set, the highwater mark is reset to the current value of MemoryUsed.
+func MemoryHighwater(reset bool) int64 { return int64(C._sqlite3_memory_highwater(boolToInt(reset))) }
+
+// Status returns the current value and the highest recorded value of the given status counter of the connection.
+// If reset is set, the highest recorded value is reset to the current value.
+func (conn *Conn) Status(op DbStatusOp, reset bool) (current, highwater int, err error) {
+	var cur, high C.int
+	if err = errorIfNotOk(C._sqlite3_db_status(conn.db, C.int(op), &cur, &high, boolToInt(reset))); err != nil {
+		return 0, 0, err
+	}
+	return int(cur), int(high), nil
+}
+
+// Status returns the current value and the highest recorded value of the given status counter of the connection.
+// It allows an extension to report health metrics about the database it runs inside.
+func (ext *ExtensionApi) Status(op DbStatusOp, reset bool) (current, highwater int, err error) {
+	return ext.conn().Status(op, reset)
+}
+
+func boolToInt(b bool) C.int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -14,13 +14,19 @@ package sqlite
 // static int transient_bind_blob(sqlite3_stmt* stmt, int col, unsigned char* p, int n) {
 //	return _sqlite3_bind_blob(stmt, col, p, n, SQLITE_TRANSIENT);
 // }
+// static int transient_bind_blob64(sqlite3_stmt* stmt, int col, unsigned char* p, sqlite3_uint64 n) {
+//	return _sqlite3_bind_blob64(stmt, col, p, n, SQLITE_TRANSIENT);
+// }
 import "C"
 
 import (
 	"bytes"
-	"github.com/mattn/go-pointer"
+	"encoding/json"
+	"fmt"
+	"math"
 	"reflect"
 	"runtime"
+	"time"
 	"unsafe"
 )
 
@@ -38,7 +44,11 @@ type Stmt struct {
 	bindNames  map[string]int
 	colNames   map[string]int
 	bindErr    error
-	lastHasRow bool // last bool returned by Step
+	lastHasRow bool         // last bool returned by Step
+	autoReset  bool         // whether Step resets the statement once it's done; see SetAutoReset
+	schema     []ColumnInfo // result columns, once described by ColumnSchema
+	deadline   time.Time    // time by which the statement must be done; see SetDeadline
+	started    time.Time    // time the current run of the statement started; only tracked with a query timeout
 }
 
 // Finalize deletes a prepared statement.
@@ -61,26 +71,41 @@ func (stmt *Stmt) Finalize() error {
 // Note that any parameter values bound to the statement are retained.
 // To clear bound values, call ClearBindings.
 //
+// As with Step, locks held by connections sharing the same cache are waited for, and
+// other SQLITE_BUSY and SQLITE_LOCKED errors are retried as per the connection's
+// RetryPolicy, if any (see Conn.SetRetryPolicy).
+//
 // see: https://www.sqlite.org/c3ref/reset.html
 func (stmt *Stmt) Reset() error {
 	stmt.lastHasRow = false
 	var res C.int
-	for {
+	var start, retry = time.Now(), 0
+	for attempt := 0; ; attempt++ {
 		res = C._sqlite3_reset(stmt.stmt)
-		if res != C.SQLITE_LOCKED_SHAREDCACHE {
-			break
+		if res == C.SQLITE_LOCKED_SHAREDCACHE {
+			// An SQLITE_LOCKED_SHAREDCACHE error has been seen from sqlite3_reset
+			// in the wild, but so far has eluded exact test case replication.
+			var err = ErrorCode(stmt.conn.waitForUnlock(attempt))
+			if !err.ok() {
+				return err
+			}
+			continue
 		}
-		// An SQLITE_LOCKED_SHAREDCACHE error has been seen from sqlite3_reset
-		// in the wild, but so far has eluded exact test case replication.
-		var err = ErrorCode(C._wait_for_unlock_notify(stmt.conn.db, stmt.conn.unlockNote))
-		if !err.ok() {
-			return err
+
+		if code := uint8(res); (code != C.SQLITE_BUSY && code != C.SQLITE_LOCKED) || !stmt.backoff(&retry, start) {
+			break
 		}
 	}
 
 	return errorIfNotOk(res)
 }
 
+// SetAutoReset sets whether Step resets the statement once it has stepped through all of its rows, as it does
+// when it fails, which releases the locks and resources it holds without an explicit call to Reset.
+// Bound parameters are retained, and the next call to Step runs the statement again.
+// It overrides the mode set for the connection with Conn.SetAutoReset.
+func (stmt *Stmt) SetAutoReset(enabled bool) { stmt.autoReset = enabled }
+
 // ClearBindings clears all bound parameter values on a statement.
 //
 // see: https://www.sqlite.org/c3ref/clear_bindings.html
@@ -103,7 +128,11 @@ func (stmt *Stmt) ClearBindings() error {
 // Shared cache
 //
 // If Shared Cache mode is enabled, this Step method uses sqlite3_unlock_notify
-// to handle any SQLITE_LOCKED errors.
+// to handle any SQLITE_LOCKED errors. If the library is compiled without
+// SQLITE_ENABLE_UNLOCK_NOTIFY, Step retries with an exponential backoff instead.
+//
+// Other SQLITE_BUSY and SQLITE_LOCKED errors are retried as per the connection's
+// RetryPolicy, if any (see Conn.SetRetryPolicy).
 //
 // Without the shared cache, SQLite will block for
 // several seconds while trying to acquire the write lock.
@@ -117,13 +146,34 @@ func (stmt *Stmt) ClearBindings() error {
 //
 // For far more details, see: http://www.sqlite.org/unlock_notify.html
 func (stmt *Stmt) Step() (rowReturned bool, err error) {
+	stmt.conn.checkOwner()
+
 	if err = stmt.bindErr; err != nil {
 		stmt.bindErr = nil
 		_ = stmt.Reset()
 		return false, err
 	}
 
-	if rowReturned, err = stmt.step(); err != nil {
+	var deadline, stop = stmt.deadlineFor(time.Now()), func() bool { return false }
+	if !deadline.IsZero() {
+		if !time.Now().Before(deadline) {
+			stmt.lastHasRow = false
+			C._sqlite3_reset(stmt.stmt)
+			return false, &TimeoutError{SQL: stmt.query, Deadline: deadline}
+		}
+		stop = interruptAt(stmt.conn.db, deadline)
+	}
+
+	rowReturned, err = stmt.step()
+	if stop() && err == SQLITE_INTERRUPT {
+		err = &TimeoutError{SQL: stmt.query, Deadline: deadline}
+	}
+	if err != nil {
+		if code, ok := err.(ErrorCode); ok {
+			err = queryError(stmt.conn.db, C.int(code), stmt.query)
+		}
+		C._sqlite3_reset(stmt.stmt)
+	} else if !rowReturned && stmt.autoReset {
 		C._sqlite3_reset(stmt.stmt)
 	}
 
@@ -132,16 +182,29 @@ func (stmt *Stmt) Step() (rowReturned bool, err error) {
 }
 
 func (stmt *Stmt) step() (bool, error) {
-	for {
+	var start, retry = time.Now(), 0
+	for attempt := 0; ; attempt++ {
 		switch res := C._sqlite3_step(stmt.stmt); uint8(res) { // reduce to non-extended error code
+		case C.SQLITE_BUSY:
+			if !stmt.backoff(&retry, start) {
+				return false, ErrorCode(res)
+			}
+			// loop
 		case C.SQLITE_LOCKED:
+			if res == C.SQLITE_LOCKED { // extended result codes aren't enabled on the connection
+				res = C._sqlite3_extended_errcode(stmt.conn.db)
+			}
 			if res != C.SQLITE_LOCKED_SHAREDCACHE {
 				// don't call wait_for_unlock_notify as it might deadlock, see:
 				// see: https://github.com/crawshaw/sqlite/issues/6
-				return false, ErrorCode(res)
+				if !stmt.backoff(&retry, start) {
+					return false, ErrorCode(res)
+				}
+				C._sqlite3_reset(stmt.stmt)
+				continue
 			}
 
-			if res = C._wait_for_unlock_notify(stmt.conn.db, stmt.conn.unlockNote); res != C.SQLITE_OK {
+			if res = stmt.conn.waitForUnlock(attempt); res != C.SQLITE_OK {
 				return false, ErrorCode(res)
 			}
 			C._sqlite3_reset(stmt.stmt)
@@ -156,6 +219,16 @@ func (stmt *Stmt) step() (bool, error) {
 	}
 }
 
+// backoff waits before the next retry as per the connection's RetryPolicy, reporting false if it mustn't be retried
+func (stmt *Stmt) backoff(retry *int, start time.Time) bool {
+	var d, ok = stmt.conn.retry.delay(*retry, start)
+	if ok {
+		*retry++
+		time.Sleep(d)
+	}
+	return ok
+}
+
 func (stmt *Stmt) handleBindErr(res C.int) {
 	if err := ErrorCode(res); !err.ok() && stmt.bindErr == nil {
 		stmt.bindErr = err
@@ -239,6 +312,10 @@ func (stmt *Stmt) BindBytes(param int, value []byte) {
 	if stmt.stmt == nil {
 		return
 	}
+	if len(value) > math.MaxInt32 { // the length wouldn't fit in sqlite3_bind_blob's int
+		stmt.BindBytes64(param, value)
+		return
+	}
 	var v *C.uchar
 	if len(value) != 0 {
 		v = (*C.uchar)(unsafe.Pointer(&value[0]))
@@ -248,6 +325,22 @@ func (stmt *Stmt) BindBytes(param int, value []byte) {
 	stmt.handleBindErr(res)
 }
 
+// BindBytes64 binds value to a numbered stmt parameter, like BindBytes does, passing its length to sqlite
+// as a 64-bit integer (with sqlite3_bind_blob64), so that a value larger than sqlite's length limit
+// (see LIMIT_LENGTH) fails with SQLITE_TOOBIG rather than be truncated.
+func (stmt *Stmt) BindBytes64(param int, value []byte) {
+	if stmt.stmt == nil {
+		return
+	}
+	var v *C.uchar
+	if len(value) != 0 {
+		v = (*C.uchar)(unsafe.Pointer(&value[0]))
+	}
+	res := C.transient_bind_blob64(stmt.stmt, C.int(param), v, C.sqlite3_uint64(len(value)))
+	runtime.KeepAlive(value)
+	stmt.handleBindErr(res)
+}
+
 var emptyCstr = C.CString("")
 
 // BindText binds value to a numbered stmt parameter.
@@ -255,6 +348,10 @@ func (stmt *Stmt) BindText(param int, value string) {
 	if stmt.stmt == nil {
 		return
 	}
+	if len(value) > math.MaxInt32 { // the length wouldn't fit in sqlite3_bind_text's int
+		stmt.BindText64(param, value)
+		return
+	}
 	var v *C.char
 	var free *[0]byte
 	if len(value) == 0 {
@@ -267,6 +364,25 @@ func (stmt *Stmt) BindText(param int, value string) {
 	stmt.handleBindErr(res)
 }
 
+// BindText64 binds value to a numbered stmt parameter, like BindText does, passing its length to sqlite
+// as a 64-bit integer (with sqlite3_bind_text64), so that a value larger than sqlite's length limit
+// (see LIMIT_LENGTH) fails with SQLITE_TOOBIG rather than be truncated.
+func (stmt *Stmt) BindText64(param int, value string) {
+	if stmt.stmt == nil {
+		return
+	}
+	var v *C.char
+	var free *[0]byte
+	if len(value) == 0 {
+		v = emptyCstr
+	} else {
+		v = C.CString(value)
+		free = (*[0]byte)(C.free)
+	}
+	res := C._sqlite3_bind_text64(stmt.stmt, C.int(param), v, C.sqlite3_uint64(len(value)), free)
+	stmt.handleBindErr(res)
+}
+
 // BindFloat binds value to a numbered stmt parameter.
 func (stmt *Stmt) BindFloat(param int, value float64) {
 	if stmt.stmt == nil {
@@ -310,7 +426,7 @@ func (stmt *Stmt) BindPointer(param int, arg interface{}) {
 	if stmt.stmt == nil {
 		return
 	}
-	ptr := pointer.Save(arg)
+	ptr := saveHandle(handlePointer, arg)
 	res := C._sqlite3_bind_pointer(stmt.stmt, C.int(param), ptr, pointerType, (*[0]byte)(C.pointer_destructor_hook_tramp))
 	stmt.handleBindErr(res)
 }
@@ -433,10 +549,65 @@ func (stmt *Stmt) ColumnValue(col int) Value {
 }
 
 // ColumnLen returns the number of bytes in a query result.
+// It always fits in an int, as sqlite caps the length of any value at 2^31-1 bytes (see LIMIT_LENGTH).
 func (stmt *Stmt) ColumnLen(col int) int {
 	return int(C._sqlite3_column_bytes(stmt.stmt, C.int(col)))
 }
 
+// ColumnTime returns a query result as a time.Time. Numbers are read following this package's own convention,
+// not sqlite's (whose date and time functions take any bare number as a julian day, unless given 'unixepoch'):
+// an INTEGER is the number of seconds since the unix epoch and a REAL is a julian day number. A TEXT is
+// a date and time in one of the ISO-8601 formats sqlite understands (eg. "2006-01-02 15:04:05.000").
+// Times without a time zone are in UTC. A NULL results in the zero time.
+//
+// see: https://www.sqlite.org/lang_datefunc.html
+func (stmt *Stmt) ColumnTime(col int) (time.Time, error) {
+	switch stmt.ColumnType(col) {
+	case SQLITE_INTEGER:
+		return time.Unix(stmt.ColumnInt64(col), 0).UTC(), nil
+	case SQLITE_FLOAT:
+		var ms = (stmt.ColumnFloat(col) - 2440587.5) * 86400000 // julian day to milliseconds since the epoch
+		return time.Unix(0, int64(math.Round(ms))*int64(time.Millisecond)).UTC(), nil
+	case SQLITE_TEXT:
+		return parseTime(stmt.ColumnText(col))
+	case SQLITE_NULL:
+		return time.Time{}, nil
+	default:
+		return time.Time{}, fmt.Errorf("sqlite: cannot convert %s to time", stmt.ColumnType(col))
+	}
+}
+
+// timeFormats are the formats of the date and time strings understood by sqlite, most specific first
+var timeFormats = []string{
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04Z07:00",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, format := range timeFormats {
+		if t, err := time.ParseInLocation(format, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("sqlite: cannot parse %q as time", s)
+}
+
+// ColumnJSON unmarshals a query result, holding a JSON document as TEXT or BLOB, into v.
+// A NULL leaves v untouched. Binary JSON (JSONB) isn't supported.
+func (stmt *Stmt) ColumnJSON(col int, v interface{}) error {
+	if stmt.ColumnType(col) == SQLITE_NULL {
+		return nil
+	}
+	return json.Unmarshal(stmt.columnBytes(col), v) // doesn't retain the bytes, and so, there's no need to copy them
+}
+
 func (stmt *Stmt) ColumnDatabaseName(col int) string {
 	return C.GoString((*C.char)(unsafe.Pointer(C._sqlite3_column_database_name(stmt.stmt, C.int(col)))))
 }
@@ -449,6 +620,65 @@ func (stmt *Stmt) ColumnOriginName(col int) string {
 	return C.GoString((*C.char)(unsafe.Pointer(C._sqlite3_column_origin_name(stmt.stmt, C.int(col)))))
 }
 
+// ColumnDeclType returns the declared type of the table column the result column originates from,
+// or an empty string if it's an expression or a subquery rather than a table column.
+//
+// see: https://www.sqlite.org/c3ref/column_decltype.html
+func (stmt *Stmt) ColumnDeclType(col int) string {
+	return C.GoString(C._sqlite3_column_decltype(stmt.stmt, C.int(col)))
+}
+
+// ColumnInfo describes a column in the result set of a statement
+type ColumnInfo struct {
+	Name     string // name of the column, as given by the AS clause or derived from the expression
+	DeclType string // declared type of the table column it originates from; see Stmt.ColumnDeclType
+
+	// Database, Table and Origin name the table column the result column originates from. They're empty for
+	// expressions, and when the library isn't compiled with SQLITE_ENABLE_COLUMN_METADATA.
+	Database, Table, Origin string
+
+	NotNull    bool // whether the originating table column has a NOT NULL constraint
+	PrimaryKey bool // whether the originating table column is part of the table's primary key
+}
+
+// ColumnSchema describes all the columns in the result set of the statement, gathering in one call what
+// ColumnName, ColumnDeclType, ColumnDatabaseName, ColumnTableName and ColumnOriginName report for each column,
+// along with the constraints of the originating table columns. It's meant for generic serializers that need
+// to know about every column before reading any row.
+//
+// The description is computed on the first call and shared by later calls; the returned slice must not be modified.
+func (stmt *Stmt) ColumnSchema() []ColumnInfo {
+	if stmt.schema != nil {
+		return stmt.schema
+	}
+
+	var metadata = supports(FEATURE_COLUMN_METADATA)
+	var schema = make([]ColumnInfo, stmt.ColumnCount())
+	for i := range schema {
+		var info = &schema[i]
+		info.Name = stmt.ColumnName(i)
+		info.DeclType = stmt.ColumnDeclType(i)
+		if !metadata {
+			continue
+		}
+
+		var db, table, origin = C._sqlite3_column_database_name(stmt.stmt, C.int(i)),
+			C._sqlite3_column_table_name(stmt.stmt, C.int(i)), C._sqlite3_column_origin_name(stmt.stmt, C.int(i))
+		if origin == nil {
+			continue // not a table column
+		}
+		info.Database, info.Table, info.Origin = C.GoString(db), C.GoString(table), C.GoString(origin)
+
+		var notNull, primaryKey, autoinc C.int
+		if C._sqlite3_table_column_metadata(stmt.conn.db, db, table, origin, &notNull, &primaryKey, &autoinc) == C.SQLITE_OK {
+			info.NotNull, info.PrimaryKey = notNull != 0, primaryKey != 0
+		}
+	}
+
+	stmt.schema = schema
+	return schema
+}
+
 // ColumnIndex returns the index of the column with the given name.
 //
 // If there is no column with the given name ColumnIndex returns -1.
@@ -527,6 +757,24 @@ func (stmt *Stmt) GetLen(colName string) int {
 	return stmt.ColumnLen(col)
 }
 
+// GetTime returns a query result value for colName as a time.Time; see ColumnTime.
+func (stmt *Stmt) GetTime(colName string) (time.Time, error) {
+	col, found := stmt.colNames[colName]
+	if !found {
+		return time.Time{}, fmt.Errorf("sqlite: no column named %q", colName)
+	}
+	return stmt.ColumnTime(col)
+}
+
+// GetJSON unmarshals a query result value for colName into v; see ColumnJSON.
+func (stmt *Stmt) GetJSON(colName string, v interface{}) error {
+	col, found := stmt.colNames[colName]
+	if !found {
+		return fmt.Errorf("sqlite: no column named %q", colName)
+	}
+	return stmt.ColumnJSON(col, v)
+}
+
 // Readonly returns true if this statement is readonly and makes no direct changes to the content of the database file.
 // See: https://www.sqlite.org/c3ref/stmt_readonly.html
 func (stmt *Stmt) Readonly() bool {
@@ -0,0 +1,112 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"io"
+	"reflect"
+)
+
+// Store is a registry of Go objects associated with a connection, so that the functions, hooks and virtual tables
+// an extension registers have a place to share state, rather than passing objects around with BindPointer.
+// Unlike with SetUserData, values are retrieved with their type checked, and the ones that implement io.Closer
+// are closed once they're replaced, deleted, or the connection is closed.
+//
+// As with context.WithValue, keys should be of an unexported type to avoid collisions between extensions.
+type Store struct{ conn *Conn }
+
+// Store returns the object store of the connection
+func (conn *Conn) Store() *Store { return &Store{conn: conn} }
+
+// Store returns the object store of the connection being initialized; see Conn.Store.
+func (ext *ExtensionApi) Store() *Store { return ext.conn().Store() }
+
+// Put stores v under key, replacing the value stored under it before, if any, which is closed if it's an io.Closer.
+// A nil value deletes the key.
+func (s *Store) Put(key, v interface{}) error {
+	if v == nil {
+		return s.Delete(key)
+	}
+
+	var state, err = stateOf(s.conn.db)
+	if err != nil {
+		return err
+	}
+
+	state.mu.Lock()
+	var prev, replaced = state.store[key]
+	if state.store == nil {
+		state.store = make(map[interface{}]interface{})
+	}
+	state.store[key] = v
+	state.mu.Unlock()
+
+	if replaced && !sameStored(prev, v) {
+		return closeStored(prev)
+	}
+	return nil
+}
+
+// Get finds the value stored under key and, if it's assignable to the type target points to, sets target to it
+// and returns true. It panics if target isn't a non-nil pointer, as errors.As does:
+//
+//	var cache *Cache
+//	if conn.Store().Get(cacheKey{}, &cache) { ... }
+func (s *Store) Get(key, target interface{}) bool {
+	var val = reflect.ValueOf(target)
+	if target == nil || val.Kind() != reflect.Ptr || val.IsNil() {
+		panic("sqlite: Store.Get target must be a non-nil pointer")
+	}
+
+	connStateLock.Lock()
+	var state, ok = connStateStore[s.conn.db]
+	connStateLock.Unlock()
+	if !ok {
+		return false
+	}
+
+	state.mu.Lock()
+	var v, found = state.store[key]
+	state.mu.Unlock()
+	if !found || !reflect.TypeOf(v).AssignableTo(val.Type().Elem()) {
+		return false
+	}
+	val.Elem().Set(reflect.ValueOf(v))
+	return true
+}
+
+// Delete removes the value stored under key, closing it if it's an io.Closer
+func (s *Store) Delete(key interface{}) error {
+	connStateLock.Lock()
+	var state, ok = connStateStore[s.conn.db]
+	connStateLock.Unlock()
+	if !ok {
+		return nil
+	}
+
+	state.mu.Lock()
+	var v, found = state.store[key]
+	delete(state.store, key)
+	state.mu.Unlock()
+
+	if found {
+		return closeStored(v)
+	}
+	return nil
+}
+
+// sameStored reports whether a and b are the same value. Values holding uncomparable types (slices, maps and funcs),
+// even in the interface fields of a comparable struct, are never the same, as comparing them panics.
+func sameStored(a, b interface{}) (same bool) {
+	defer func() { _ = recover() }()
+	return a == b
+}
+
+// closeStored closes a value removed from a Store, if it's an io.Closer
+func closeStored(v interface{}) error {
+	if closer, ok := v.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
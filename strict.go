@@ -0,0 +1,293 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+)
+
+// affinity is the type affinity of a column; see https://www.sqlite.org/datatype3.html#type_affinity
+type affinity int
+
+const (
+	affinityBlob affinity = iota // also used for ANY in strict tables
+	affinityText
+	affinityNumeric
+	affinityInteger
+	affinityReal
+)
+
+// declaredColumn is a column of a table, as declared by a module
+type declaredColumn struct {
+	name     string
+	typ      string // declared type, without HIDDEN
+	affinity affinity
+	notNull  bool
+}
+
+// declaredTable is the schema declared by a module's Create or Connect, as parsed by parseDeclaration
+type declaredTable struct {
+	name    string
+	strict  bool
+	columns []declaredColumn
+}
+
+// check returns an error if a result of type typ cannot be stored in column i
+func (t *declaredTable) check(i int, typ ColumnType) error {
+	if i < 0 || i >= len(t.columns) {
+		return nil // sqlite rejects those before asking for the column
+	}
+
+	var column = t.columns[i]
+	if typ == SQLITE_NULL {
+		if column.notNull {
+			return Error(SQLITE_CONSTRAINT_NOTNULL, fmt.Sprintf("NOT NULL constraint failed: %s.%s", t.name, column.name))
+		}
+		return nil
+	}
+
+	var ok bool
+	switch column.affinity {
+	case affinityBlob:
+		ok = !t.strict || strings.EqualFold(column.typ, "ANY") || typ == SQLITE_BLOB
+	case affinityText:
+		ok = typ == SQLITE_TEXT
+	case affinityNumeric:
+		ok = typ == SQLITE_INTEGER || typ == SQLITE_FLOAT
+	case affinityInteger:
+		ok = typ == SQLITE_INTEGER
+	case affinityReal:
+		ok = typ == SQLITE_FLOAT || typ == SQLITE_INTEGER
+	}
+
+	if !ok {
+		var declared = column.typ
+		if declared == "" {
+			declared = "untyped"
+		}
+		return Error(SQLITE_CONSTRAINT_DATATYPE, fmt.Sprintf("cannot store %s value in %s column %s.%s", typeName(typ), declared, t.name, column.name))
+	}
+	return nil
+}
+
+// typeName returns the name sqlite uses for a storage class in its error messages
+func typeName(typ ColumnType) string {
+	switch typ {
+	case SQLITE_INTEGER:
+		return "INTEGER"
+	case SQLITE_FLOAT:
+		return "REAL"
+	case SQLITE_TEXT:
+		return "TEXT"
+	case SQLITE_BLOB:
+		return "BLOB"
+	default:
+		return "NULL"
+	}
+}
+
+// keywords that start a column constraint, ending the column's type
+var constraintKeywords = map[string]bool{
+	"CONSTRAINT": true, "PRIMARY": true, "NOT": true, "NULL": true, "UNIQUE": true, "CHECK": true,
+	"DEFAULT": true, "COLLATE": true, "REFERENCES": true, "GENERATED": true, "AS": true,
+}
+
+// keywords that start a table constraint rather than a column definition
+var tableConstraintKeywords = map[string]bool{
+	"CONSTRAINT": true, "PRIMARY": true, "UNIQUE": true, "CHECK": true, "FOREIGN": true,
+}
+
+// parseDeclaration parses the CREATE TABLE statement a module declares its schema with. It returns the declared table,
+// and the statement to pass on to sqlite3_declare_vtab, without the STRICT table option as sqlite ignores it
+// for virtual tables.
+func parseDeclaration(table, sql string) (*declaredTable, string, error) {
+	var open = strings.IndexByte(sql, '(')
+	var end = matchingParen(sql, open)
+	if open < 0 || end < 0 {
+		return nil, "", fmt.Errorf("sqlite: malformed table declaration: %s", sql)
+	}
+
+	var decl = &declaredTable{name: table}
+	var options []string
+	for _, option := range splitTopLevel(sql[end+1:]) {
+		if strings.EqualFold(option, "STRICT") {
+			decl.strict = true
+		} else if option != "" {
+			options = append(options, option)
+		}
+	}
+
+	for _, definition := range splitTopLevel(sql[open+1 : end]) {
+		var tokens = tokenize(definition)
+		if len(tokens) == 0 || tableConstraintKeywords[strings.ToUpper(tokens[0])] {
+			continue
+		}
+
+		var column = declaredColumn{name: unquoteIdentifier(tokens[0])}
+		var typ []string
+		var i = 1
+		for ; i < len(tokens) && !constraintKeywords[strings.ToUpper(tokens[i])]; i++ {
+			if !strings.EqualFold(tokens[i], "HIDDEN") {
+				typ = append(typ, tokens[i])
+			}
+		}
+		for ; i+1 < len(tokens); i++ {
+			if strings.EqualFold(tokens[i], "NOT") && strings.EqualFold(tokens[i+1], "NULL") {
+				column.notNull = true
+			}
+		}
+		column.typ = strings.Join(typ, " ")
+		column.affinity = affinityOf(column.typ)
+
+		if decl.strict {
+			switch strings.ToUpper(column.typ) {
+			case "INT", "INTEGER", "REAL", "TEXT", "BLOB", "ANY":
+			case "":
+				return nil, "", fmt.Errorf("sqlite: missing datatype for %s.%s", table, column.name)
+			default:
+				return nil, "", fmt.Errorf("sqlite: unknown datatype for %s.%s: %q", table, column.name, column.typ)
+			}
+		}
+		decl.columns = append(decl.columns, column)
+	}
+
+	var declared = sql[:end+1]
+	if len(options) > 0 {
+		declared += " " + strings.Join(options, ", ")
+	}
+	return decl, declared, nil
+}
+
+// affinityOf determines the affinity of a column from its declared type, following sqlite's rules
+func affinityOf(typ string) affinity {
+	var t = strings.ToUpper(typ)
+	switch {
+	case strings.Contains(t, "INT"):
+		return affinityInteger
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		return affinityText
+	case t == "", t == "ANY", strings.Contains(t, "BLOB"):
+		return affinityBlob
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"):
+		return affinityReal
+	default:
+		return affinityNumeric
+	}
+}
+
+// scan walks over s, calling fn with the index of every byte that is outside quotes, along with the nesting depth
+// of parentheses at it. It stops early if fn returns false.
+func scan(s string, fn func(i, depth int) bool) {
+	var depth = 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\'', '"', '`', '[':
+			var closing = c
+			if c == '[' {
+				closing = ']'
+			}
+			if j := strings.IndexByte(s[i+1:], closing); j >= 0 {
+				i += j + 1
+				continue
+			}
+			return
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if !fn(i, depth) {
+			return
+		}
+	}
+}
+
+// matchingParen returns the index of the parenthesis closing the one at open, or -1
+func matchingParen(s string, open int) int {
+	if open < 0 {
+		return -1
+	}
+	var end = -1
+	scan(s[open:], func(i, depth int) bool {
+		if depth == 0 {
+			end = open + i
+			return false
+		}
+		return true
+	})
+	return end
+}
+
+// splitTopLevel splits s at the commas that are outside quotes and parentheses, trimming spaces around each part
+func splitTopLevel(s string) []string {
+	var parts []string
+	var start = 0
+	scan(s, func(i, depth int) bool {
+		if s[i] == ',' && depth == 0 {
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+		return true
+	})
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
+// tokenize splits s at the spaces that are outside quotes and parentheses
+func tokenize(s string) []string {
+	var tokens []string
+	var start, depth = -1, 0
+	for i := 0; i < len(s); i++ {
+		var c = s[i]
+		if isSpace(c) && depth == 0 {
+			if start >= 0 {
+				tokens, start = append(tokens, s[start:i]), -1
+			}
+			continue
+		}
+
+		if start < 0 {
+			start = i
+		}
+		switch c {
+		case '\'', '"', '`', '[':
+			var closing = c
+			if c == '[' {
+				closing = ']'
+			}
+			if j := strings.IndexByte(s[i+1:], closing); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(s)
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, s[start:])
+	}
+	return tokens
+}
+
+func isSpace(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' }
+
+// unquoteIdentifier removes the quotes around an sql identifier, if any
+func unquoteIdentifier(s string) string {
+	if len(s) >= 2 {
+		switch s[0] {
+		case '"', '`':
+			if s[len(s)-1] == s[0] {
+				return strings.Replace(s[1:len(s)-1], s[:1]+s[:1], s[:1], -1)
+			}
+		case '[':
+			if s[len(s)-1] == ']' {
+				return s[1 : len(s)-1]
+			}
+		}
+	}
+	return s
+}
@@ -0,0 +1,114 @@
+package sqlite
+
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+import "C"
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// attributes set on the spans started by a Tracer
+const (
+	AttributeStatement = "db.statement"    // text of the statement being run, if any
+	AttributeFunction  = "sqlite.function" // name of the function
+	AttributeModule    = "sqlite.module"   // name of the virtual table's module
+)
+
+// Tracer starts spans around the calls sqlite makes into the extension, so that the latency introduced by Go
+// code is visible in (distributed) traces. It is meant to be adapted to a tracing system, like OpenTelemetry.
+//
+// Spans are started for:
+//
+//   - sqlite.vtab.create and sqlite.vtab.connect: calls to Module.Create and Module.Connect
+//   - sqlite.vtab.scan: scans of a virtual table, from the call to VirtualCursor.Filter until VirtualCursor.Eof
+//     reports the end of the rows (or the cursor is closed)
+//   - sqlite.vtab.begin, sqlite.vtab.sync, sqlite.vtab.commit and sqlite.vtab.rollback: calls to the transaction methods
+//   - sqlite.function.apply, sqlite.function.step, sqlite.function.final, sqlite.function.value and sqlite.function.inverse:
+//     calls to the methods of scalar, aggregate and window functions
+//
+// Implementations must be safe for concurrent use. As sqlite's callbacks don't carry a context.Context, spans
+// are children of whatever the implementation considers current.
+type Tracer interface {
+	// Start starts a span with the given name and attributes (see the Attribute* constants)
+	Start(name string, attributes map[string]string) Span
+}
+
+// Span is a span started by a Tracer
+type Span interface {
+	// End ends the span, recording the error if it isn't nil
+	End(err error)
+}
+
+// tracer holds the Tracer set with SetTracer, wrapped in tracerHolder as atomic.Value cannot hold nil
+var tracer atomic.Value
+
+type tracerHolder struct{ t Tracer }
+
+// SetTracer sets the Tracer used to trace calls into the extension. Passing nil disables tracing, which is the default.
+//
+// Tracing is opt-in as finding the text of the statement being run requires going through
+// all the statements prepared on the connection on every traced call.
+func SetTracer(t Tracer) { tracer.Store(tracerHolder{t}) }
+
+// currentTracer returns the Tracer set with SetTracer, or nil if tracing is disabled
+func currentTracer() Tracer {
+	var h, _ = tracer.Load().(tracerHolder)
+	return h.t
+}
+
+var scans sync.Map // virtual cursor handles -> Span of the scan in progress
+
+// startSpan starts a span with the given name, labelling it with the key and value, and with the statement
+// being run on the connection db. It returns a func to end the span, which is a no-op if tracing is disabled.
+func startSpan(name string, db *C.sqlite3, key, value string) func(error) {
+	var t = currentTracer()
+	if t == nil {
+		return func(error) {}
+	}
+
+	var attributes = map[string]string{key: value}
+	if sql := runningStatement(db); sql != "" {
+		attributes[AttributeStatement] = sql
+	}
+	return t.Start(name, attributes).End
+}
+
+// startTableSpan starts a span for a call to the virtual table
+func startTableSpan(name string, table *virtualTable) func(error) {
+	return startSpan(name, table.db, AttributeModule, table.name)
+}
+
+// startScan starts the span of a scan by the cursor (identified by its handle) of the table,
+// ending the previous one if it's still in progress
+func startScan(cursor unsafe.Pointer, table *virtualTable) {
+	endScan(cursor, nil)
+	if currentTracer() == nil {
+		return
+	}
+	scans.Store(cursor, startTableSpan("sqlite.vtab.scan", table))
+}
+
+// endScan ends the span of the scan by the cursor, if any
+func endScan(cursor unsafe.Pointer, err error) {
+	if end, ok := scans.Load(cursor); ok {
+		scans.Delete(cursor)
+		end.(func(error))(err)
+	}
+}
+
+// runningStatement returns the text of the most recently prepared statement that is being run on the connection
+func runningStatement(db *C.sqlite3) string {
+	if db == nil {
+		return ""
+	}
+
+	for stmt := C._sqlite3_next_stmt(db, nil); stmt != nil; stmt = C._sqlite3_next_stmt(db, stmt) {
+		if C._sqlite3_stmt_busy(stmt) != 0 {
+			return C.GoString(C._sqlite3_sql(stmt))
+		}
+	}
+	return ""
+}
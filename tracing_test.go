@@ -0,0 +1,149 @@
+package sqlite_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	. "go.riyazali.net/sqlite"
+)
+
+// recordingTracer is a Tracer that records all the spans it ends
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []recordedSpan
+}
+
+type recordedSpan struct {
+	name       string
+	attributes map[string]string
+	err        error
+}
+
+func (r *recordingTracer) Start(name string, attributes map[string]string) Span {
+	return &recordingSpan{tracer: r, span: recordedSpan{name: name, attributes: attributes}}
+}
+
+// find returns the first span with the given name
+func (r *recordingTracer) find(name string) (recordedSpan, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, span := range r.spans {
+		if span.name == name {
+			return span, true
+		}
+	}
+	return recordedSpan{}, false
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	span   recordedSpan
+}
+
+func (s *recordingSpan) End(err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.span.err = err
+	s.tracer.spans = append(s.tracer.spans, s.span)
+}
+
+func TestTracer(t *testing.T) {
+	var tracer = &recordingTracer{}
+	SetTracer(tracer)
+	defer SetTracer(nil)
+
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		if err := api.CreateFunction("tracing_upper", &Upper{}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := api.CreateVirtualTable("tracing_args", &ArgsModule{}, []string{"a", "b"}, false); err != nil {
+			return SQLITE_ERROR, err
+		}
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const query = "SELECT COUNT(tracing_upper(arg)) FROM tracing_args"
+
+	var count int
+	if err = db.QueryRow(query).Scan(&count); err != nil {
+		t.Fatal(err)
+	} else if count != 2 {
+		t.Fatalf("expected 2 rows, got %d", count)
+	}
+
+	if _, ok := tracer.find("sqlite.vtab.create"); !ok {
+		t.Error("expected a sqlite.vtab.create span")
+	}
+
+	for name, attribute := range map[string]string{
+		"sqlite.vtab.scan":      AttributeModule,
+		"sqlite.function.apply": AttributeFunction,
+	} {
+		span, ok := tracer.find(name)
+		if !ok {
+			t.Errorf("expected a %s span", name)
+			continue
+		}
+		if span.err != nil {
+			t.Errorf("expected %s span to succeed, got %v", name, span.err)
+		}
+		if span.attributes[attribute] == "" {
+			t.Errorf("expected %s span to have the %s attribute, got %v", name, attribute, span.attributes)
+		}
+		if span.attributes[AttributeStatement] != query {
+			t.Errorf("expected %s span to have the statement text, got %q", name, span.attributes[AttributeStatement])
+		}
+	}
+}
+
+func TestTracer_FunctionErrors(t *testing.T) {
+	var tracer = &recordingTracer{}
+	SetTracer(tracer)
+	defer SetTracer(nil)
+
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		if err := api.CreateFunction("tracing_failing", &Failing{}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := api.CreateFunction("tracing_panicky", &Panicky{}); err != nil {
+			return SQLITE_ERROR, err
+		}
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, query := range []string{"SELECT tracing_failing(0)", "SELECT tracing_panicky()"} {
+		if _, err = db.Exec(query); err == nil {
+			t.Fatalf("expected %q to fail", query)
+		}
+	}
+
+	var failures = map[string]error{}
+	tracer.mu.Lock()
+	for _, span := range tracer.spans {
+		if span.name == "sqlite.function.apply" {
+			failures[span.attributes[AttributeFunction]] = span.err
+		}
+	}
+	tracer.mu.Unlock()
+
+	if err := failures["tracing_failing"]; !errors.Is(err, SQLITE_CONSTRAINT_UNIQUE) {
+		t.Errorf("expected the span to record the function's error, got %v", err)
+	}
+	var panicErr *PanicError
+	if err := failures["tracing_panicky"]; !errors.As(err, &panicErr) {
+		t.Errorf("expected the span to record the panic, got %v", err)
+	}
+}
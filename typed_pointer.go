@@ -0,0 +1,56 @@
+package sqlite
+
+// #include <stdlib.h>
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+//
+// // destructor function defined in ./context.go
+// extern void pointer_destructor_hook_tramp(void*);
+import "C"
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/mattn/go-pointer"
+)
+
+var ( // pointer types of the Go types bound with BindPointerT, interned as sqlite requires them to be static strings
+	typedPointerLock  sync.Mutex
+	typedPointerTypes = map[reflect.Type]*C.char{}
+)
+
+// pointerTypeOf returns the pointer type used for values of the Go type typ. It's unique to the type, even
+// across types with the same name from different packages, and it's never freed.
+// see: https://sqlite.org/bindptr.html#pointer_types_are_static_strings
+func pointerTypeOf(typ reflect.Type) *C.char {
+	typedPointerLock.Lock()
+	defer typedPointerLock.Unlock()
+
+	if name, ok := typedPointerTypes[typ]; ok {
+		return name
+	}
+	var name = C.CString(fmt.Sprintf("golang:%d:%s", len(typedPointerTypes), typ))
+	typedPointerTypes[typ] = name
+	return name
+}
+
+// bindTypedPointer binds arg with the pointer type of typ; see BindPointerT
+func (stmt *Stmt) bindTypedPointer(param int, arg interface{}, typ reflect.Type) {
+	if stmt.stmt == nil {
+		return
+	}
+	ptr := saveHandle(handlePointer, arg)
+	res := C._sqlite3_bind_pointer(stmt.stmt, C.int(param), ptr, pointerTypeOf(typ), (*[0]byte)(C.pointer_destructor_hook_tramp))
+	stmt.handleBindErr(res)
+}
+
+// typedPointer returns the value bound with the pointer type of typ, reporting false if there's none; see ValuePointerT
+func (v Value) typedPointer(typ reflect.Type) (interface{}, bool) {
+	var ptr = C._sqlite3_value_pointer(v.ptr, pointerTypeOf(typ))
+	if ptr == nil {
+		return nil, false
+	}
+	return pointer.Restore(ptr), true
+}
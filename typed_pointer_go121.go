@@ -0,0 +1,24 @@
+//go:build cgo && go1.21
+// +build cgo,go1.21
+
+package sqlite
+
+import "reflect"
+
+// BindPointerT binds v with the parameter, like Stmt.BindPointer does, but with a pointer type derived from T,
+// so that it can only be retrieved as a T, with ValuePointerT. Retrieving it as another type (or with Value.Pointer)
+// finds nothing, rather than a value that panics on a type assertion.
+// see: https://sqlite.org/bindptr.html
+func BindPointerT[T any](stmt *Stmt, param int, v T) {
+	stmt.bindTypedPointer(param, v, typeOf[T]())
+}
+
+// ValuePointerT returns the value bound as a T with BindPointerT, and reports false if v doesn't hold one
+func ValuePointerT[T any](v Value) (T, bool) {
+	var p, ok = v.typedPointer(typeOf[T]())
+	var t, _ = p.(T) // p is nil if T is an interface type, and a nil interface was bound
+	return t, ok
+}
+
+// typeOf returns the reflect.Type of T, even if T is an interface type
+func typeOf[T any]() reflect.Type { return reflect.TypeOf((*T)(nil)).Elem() }
@@ -0,0 +1,66 @@
+//go:build go1.21
+// +build go1.21
+
+package sqlite_test
+
+import (
+	. "go.riyazali.net/sqlite"
+	"testing"
+)
+
+type label struct{ name string }
+
+// Label implements a label(...) sql function that returns the name of the *label bound with its argument
+type Label struct{}
+
+func (m *Label) Args() int           { return 1 }
+func (m *Label) Deterministic() bool { return true }
+func (m *Label) Apply(ctx *Context, values ...Value) {
+	if l, ok := ValuePointerT[*label](values[0]); ok {
+		ctx.ResultText(l.name)
+	} else {
+		ctx.ResultText("none")
+	}
+}
+
+func TestBindPointerT(t *testing.T) {
+	bootstrap(t)
+
+	conn, err := Open("file:pointer.db?mode=memory", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err = conn.CreateFunction("label", &Label{}); err != nil {
+		t.Fatal(err)
+	}
+
+	stmt, _, err := conn.Prepare("SELECT label(?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Finalize()
+
+	var tests = []struct {
+		bind     func()
+		expected string
+	}{
+		{bind: func() { BindPointerT(stmt, 1, &label{name: "a"}) }, expected: "a"},
+		{bind: func() { BindPointerT(stmt, 1, label{name: "b"}) }, expected: "none"},
+		{bind: func() { BindPointerT(stmt, 1, "c") }, expected: "none"},
+		{bind: func() { stmt.BindPointer(1, &label{name: "d"}) }, expected: "none"},
+		{bind: func() { stmt.BindText(1, "e") }, expected: "none"},
+	}
+
+	for _, test := range tests {
+		test.bind()
+		if _, err = stmt.Step(); err != nil {
+			t.Fatal(err)
+		}
+		if got := stmt.ColumnText(0); got != test.expected {
+			t.Errorf("expected %q got %q", test.expected, got)
+		}
+		_ = stmt.Reset()
+	}
+}
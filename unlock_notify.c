@@ -20,6 +20,12 @@
 
 SQLITE_EXTENSION_INIT3
 
+// when statically linked, the library may have been compiled without SQLITE_ENABLE_UNLOCK_NOTIFY;
+// a weak reference allows linking against it, and _unlock_notify_available to detect it
+#if defined(SQLITE_CORE) && !defined(_WIN32)
+#pragma weak sqlite3_unlock_notify
+#endif
+
 _unlock_note* _unlock_note_alloc() {
 	_unlock_note* un = (_unlock_note*)malloc(sizeof(_unlock_note));
 	pthread_mutex_init(&un->mu, 0);
@@ -60,4 +66,15 @@ int _wait_for_unlock_notify(sqlite3 *db, _unlock_note* un) {
 	}
 
 	return res;
-}
\ No newline at end of file
+}
+
+// _unlock_notify_available reports whether the library provides sqlite3_unlock_notify
+int _unlock_notify_available(void) {
+#ifndef SQLITE_CORE
+	return sqlite3_api->unlock_notify != 0;
+#elif !defined(_WIN32)
+	return sqlite3_unlock_notify != 0;
+#else
+	return 1;
+#endif
+}
@@ -14,4 +14,6 @@ _unlock_note* _unlock_note_alloc();
 void _unlock_note_fire(_unlock_note* un);
 void _unlock_note_free(_unlock_note* un);
 
-int _wait_for_unlock_notify(sqlite3 *db, _unlock_note* un);
\ No newline at end of file
+int _wait_for_unlock_notify(sqlite3 *db, _unlock_note* un);
+
+int _unlock_notify_available(void);
\ No newline at end of file
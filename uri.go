@@ -0,0 +1,132 @@
+package sqlite
+
+// #include <stdlib.h>
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Filename is the name of a database file, as known to sqlite, along with any query parameters
+// passed in the URI used to open it. It lets modules read options passed in the database URI
+// (eg. file:data.db?csv_dir=/tmp) and locate files that live next to the database.
+//
+// A Filename is only valid while the database it refers to is open.
+// see: https://www.sqlite.org/uri.html and https://www.sqlite.org/c3ref/uri_boolean.html
+type Filename struct{ ptr *C.char }
+
+// Filename returns the filename of the database with the given schema name (eg. "main") attached to the connection.
+// It returns false if there's no database with the given name attached to the connection.
+func (conn *Conn) Filename(schema string) (Filename, bool) {
+	var cschema = C.CString(schema)
+	defer C.free(unsafe.Pointer(cschema))
+
+	var ptr = C._sqlite3_db_filename(conn.db, cschema)
+	return Filename{ptr: ptr}, ptr != nil
+}
+
+// Filename returns the filename of the database with the given schema name attached to the connection.
+func (ext *ExtensionApi) Filename(schema string) (Filename, bool) { return ext.conn().Filename(schema) }
+
+// ReadOnly reports whether the database with the given schema name (eg. "main") attached to the connection is
+// read-only, eg. because it was attached with ?mode=ro. Modules that write to their shadow tables can use it to
+// refuse a table in a read-only database with a clear error, rather than fail midway through a write.
+// It returns an error if there's no database with the given name attached to the connection.
+// see: https://www.sqlite.org/c3ref/db_readonly.html
+func (conn *Conn) ReadOnly(schema string) (bool, error) {
+	var cschema = C.CString(schema)
+	defer C.free(unsafe.Pointer(cschema))
+
+	switch C._sqlite3_db_readonly(conn.db, cschema) {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	}
+	return false, fmt.Errorf("sqlite: no database named %q attached to the connection", schema)
+}
+
+// ReadOnly reports whether the database with the given schema name attached to the connection is read-only.
+func (ext *ExtensionApi) ReadOnly(schema string) (bool, error) { return ext.conn().ReadOnly(schema) }
+
+// String returns the absolute path of the database file; it's empty for temporary and in-memory databases.
+func (f Filename) String() string { return C.GoString(f.ptr) }
+
+// Parameter returns the value of the URI query parameter with the given key. It returns false if there's no such
+// parameter. A parameter that has no value (eg. ?flag) is reported with an empty value.
+func (f Filename) Parameter(key string) (string, bool) {
+	if f.ptr == nil {
+		return "", false
+	}
+
+	var ckey = C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+
+	var value = C._sqlite3_uri_parameter(f.ptr, ckey)
+	return C.GoString(value), value != nil
+}
+
+// Boolean returns the value of the URI query parameter with the given key interpreted as a boolean (eg. 1, yes, true,
+// on or 0, no, false, off), or def if there's no such parameter or if its value isn't a boolean.
+func (f Filename) Boolean(key string, def bool) bool {
+	if f.ptr == nil {
+		return def
+	}
+
+	var ckey = C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	return C._sqlite3_uri_boolean(f.ptr, ckey, boolToInt(def)) != 0
+}
+
+// Int64 returns the value of the URI query parameter with the given key interpreted as an integer,
+// or def if there's no such parameter or if its value isn't an integer.
+func (f Filename) Int64(key string, def int64) int64 {
+	if f.ptr == nil {
+		return def
+	}
+
+	var ckey = C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	return int64(C._sqlite3_uri_int64(f.ptr, ckey, C.sqlite3_int64(def)))
+}
+
+// Keys returns the keys of all the URI query parameters, in the order they appear in the URI.
+func (f Filename) Keys() []string {
+	var keys []string
+	if f.ptr == nil {
+		return keys
+	}
+
+	for i := 0; ; i++ {
+		var key = C._sqlite3_uri_key(f.ptr, C.int(i))
+		if key == nil {
+			return keys
+		}
+		keys = append(keys, C.GoString(key))
+	}
+}
+
+// Database returns the path of the database file.
+func (f Filename) Database() string {
+	return f.name(func(p *C.char) *C.char { return C._sqlite3_filename_database(p) })
+}
+
+// Journal returns the path of the rollback journal of the database.
+func (f Filename) Journal() string {
+	return f.name(func(p *C.char) *C.char { return C._sqlite3_filename_journal(p) })
+}
+
+// WAL returns the path of the write-ahead log of the database.
+func (f Filename) WAL() string {
+	return f.name(func(p *C.char) *C.char { return C._sqlite3_filename_wal(p) })
+}
+
+func (f Filename) name(fn func(*C.char) *C.char) string {
+	if f.ptr == nil || *f.ptr == 0 {
+		return "" // temporary or in-memory database
+	}
+	return C.GoString(fn(f.ptr))
+}
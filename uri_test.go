@@ -0,0 +1,91 @@
+package sqlite_test
+
+import (
+	. "go.riyazali.net/sqlite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFilename(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uri")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var path = filepath.Join(dir, "test.db")
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		var filename, ok = api.Filename("main")
+		if !ok {
+			return SQLITE_ERROR, Error(SQLITE_ERROR, "main database must have a filename")
+		}
+
+		if v, found := filename.Parameter("csv_dir"); !found || v != "/tmp/csv" {
+			return SQLITE_ERROR, Error(SQLITE_ERROR, "unexpected csv_dir: "+v)
+		}
+		if _, found := filename.Parameter("missing"); found {
+			return SQLITE_ERROR, Error(SQLITE_ERROR, "missing parameter must not be found")
+		}
+		if !filename.Boolean("flag", false) || filename.Boolean("missing", false) {
+			return SQLITE_ERROR, Error(SQLITE_ERROR, "unexpected boolean parameter")
+		}
+		if filename.Int64("n", 0) != 42 || filename.Int64("missing", 7) != 7 {
+			return SQLITE_ERROR, Error(SQLITE_ERROR, "unexpected integer parameter")
+		}
+		if keys := filename.Keys(); !reflect.DeepEqual(keys, []string{"csv_dir", "flag", "n"}) {
+			return SQLITE_ERROR, Error(SQLITE_ERROR, "unexpected keys")
+		}
+
+		if filename.Database() != path || filename.Journal() != path+"-journal" || filename.WAL() != path+"-wal" {
+			return SQLITE_ERROR, Error(SQLITE_ERROR, "unexpected file names: "+filename.Database())
+		}
+
+		if _, ok = api.Filename("no_such_schema"); ok {
+			return SQLITE_ERROR, Error(SQLITE_ERROR, "unknown schema must not have a filename")
+		}
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect("file:" + path + "?csv_dir=/tmp/csv&flag=yes&n=42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+}
+
+func TestReadOnly(t *testing.T) {
+	bootstrap(t)
+
+	dir, err := ioutil.TempDir("", "readonly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var path = filepath.Join(dir, "test.db")
+	conn, err := Open(path, DefaultOpenFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err = conn.Exec("CREATE TABLE t (a)", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Exec("ATTACH ? AS ro", nil, "file:"+path+"?mode=ro"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ro, err := conn.ReadOnly("main"); err != nil || ro {
+		t.Fatalf("expected main to be writeable got %v (%v)", ro, err)
+	}
+	if ro, err := conn.ReadOnly("ro"); err != nil || !ro {
+		t.Fatalf("expected ro to be read-only got %v (%v)", ro, err)
+	}
+	if _, err := conn.ReadOnly("missing"); err == nil {
+		t.Fatal("expected an error for a database that isn't attached")
+	}
+}
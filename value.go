@@ -40,6 +40,18 @@ func (t ColumnType) String() string {
 	}
 }
 
+// SubType is a small integer that functions attach to their results, with Context.ResultSubType, to pass
+// additional information about a value to the functions that receive it as an argument. Only its lower 8 bits
+// are preserved by sqlite, and subtypes are never stored in the database.
+// see: https://www.sqlite.org/c3ref/result_subtype.html
+type SubType uint
+
+//noinspection GoSnakeCaseUsage
+const (
+	SUBTYPE_NONE SubType = 0   // value without a subtype
+	SUBTYPE_JSON SubType = 'J' // JSON text, as produced and recognized by sqlite's json functions
+)
+
 // Value is an *C.sqlite3_value.
 // Value represent all values that can be stored in a database table.
 // It is used to extract column values from sql queries.
@@ -53,7 +65,7 @@ func (v Value) Int64() int64     { return int64(C._sqlite3_value_int64(v.ptr)) }
 func (v Value) Float() float64   { return float64(C._sqlite3_value_double(v.ptr)) }
 func (v Value) Len() int         { return int(C._sqlite3_value_bytes(v.ptr)) }
 func (v Value) Type() ColumnType { return ColumnType(C._sqlite3_value_type(v.ptr)) }
-func (v Value) SubType() int     { return int(C._sqlite3_value_subtype(v.ptr)) }
+func (v Value) SubType() SubType { return SubType(C._sqlite3_value_subtype(v.ptr)) }
 func (v Value) NoChange() bool   { return int(C._sqlite3_value_nochange(v.ptr)) == 1 }
 
 func (v Value) Text() string {
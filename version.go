@@ -0,0 +1,85 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// modulePath is the path of this package's module, looked up in the build info for its version
+const modulePath = "go.riyazali.net/sqlite"
+
+// WithVersionFunction registers a <name>_version() function on every connection the extension is loaded on, where
+// name is the name it was loaded under (eg. geo_version() for an extension loaded as geo). The function returns
+// a JSON object with the name, along with the path and version of the module the extension was built from,
+// and the version of this package it was built with, as recorded by debug.ReadBuildInfo:
+//
+//	{"name":"geo","module":"example.com/geo","version":"v1.2.0","package":"v0.3.1"}
+//
+// It lets operators verify which build of an extension a connection actually loaded.
+func WithVersionFunction() func(*ExtensionOptions) {
+	return func(opt *ExtensionOptions) { opt.VersionFunction = true }
+}
+
+// buildVersion is the build information returned by the function registered with WithVersionFunction
+type buildVersion struct {
+	Name    string `json:"name"`
+	Module  string `json:"module,omitempty"`  // path of the main module
+	Version string `json:"version,omitempty"` // version of the main module
+	Package string `json:"package,omitempty"` // version of this package
+}
+
+var ( // build information of the binary; read on first use
+	buildInfoOnce sync.Once
+	buildInfo     buildVersion
+)
+
+// readBuildVersion returns the build information of the binary, without the name of the extension
+func readBuildVersion() buildVersion {
+	buildInfoOnce.Do(func() {
+		var info, ok = debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		buildInfo.Module, buildInfo.Version = info.Main.Path, info.Main.Version
+		if info.Main.Path == modulePath {
+			buildInfo.Package = info.Main.Version
+		}
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				if buildInfo.Package = dep.Version; dep.Replace != nil {
+					buildInfo.Package = dep.Replace.Version
+				}
+			}
+		}
+	})
+	return buildInfo
+}
+
+// versionFunction implements the <name>_version() function registered with WithVersionFunction
+type versionFunction struct{ version string }
+
+func (v *versionFunction) Args() int                      { return 0 }
+func (v *versionFunction) Deterministic() bool            { return true }
+func (v *versionFunction) Apply(ctx *Context, _ ...Value) { ctx.ResultText(v.version) }
+
+// createVersionFunction registers the <name>_version() function of the extension loaded under name
+func createVersionFunction(conn *Conn, name string) error {
+	var version = readBuildVersion()
+	version.Name = name
+
+	var data, err = json.Marshal(version)
+	if err != nil {
+		return err
+	}
+
+	var opts = ScalarFunctionOptions{FunctionOptions{Innocuous: true}}
+	if err = conn.CreateScalarFunction(name+"_version", &versionFunction{version: string(data)}, opts); err != nil {
+		return fmt.Errorf("sqlite: failed to register %s_version(): %w", name, err)
+	}
+	return nil
+}
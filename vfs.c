@@ -0,0 +1,284 @@
+// This file defines the sqlite3_vfs implementations backed by Go.
+// See vfs.go for details.
+
+#include <stdlib.h>
+#include <string.h>
+#include "vfs.h"
+
+SQLITE_EXTENSION_INIT3
+
+// hooks to call into golang functionality defined in vfs.go
+extern int  go_shim_open(void*, char*, int, sqlite3_file*, void**);
+extern int  go_shim_read(void*, void*, int, sqlite3_int64);
+extern int  go_shim_write(void*, void*, int, sqlite3_int64);
+extern int  go_shim_close(void*);
+
+extern int  go_vfs_open(void*, char*, int, void**);
+extern int  go_vfs_delete(void*, char*, int);
+extern int  go_vfs_access(void*, char*, int, int*);
+extern int  go_vfs_full_pathname(void*, char*, int, char*);
+extern int  go_vfs_file_close(void*);
+extern int  go_vfs_file_read(void*, void*, int, sqlite3_int64);
+extern int  go_vfs_file_write(void*, void*, int, sqlite3_int64);
+extern int  go_vfs_file_truncate(void*, sqlite3_int64);
+extern int  go_vfs_file_sync(void*, int);
+extern int  go_vfs_file_size(void*, sqlite3_int64*);
+extern int  go_vfs_file_lock(void*, int);
+extern int  go_vfs_file_unlock(void*, int);
+extern int  go_vfs_file_check_reserved_lock(void*, int*);
+extern int  go_vfs_file_sector_size(void*);
+extern int  go_vfs_file_device_characteristics(void*);
+
+//- shim io methods; everything except reads and writes is delegated to the real file
+//-----------------------------
+
+#define REAL_FILE(f) (((go_shim_file*)(f))->real)
+#define REAL_METHODS(f) (REAL_FILE(f)->pMethods)
+
+static int shim_close(sqlite3_file *f) {
+	go_shim_file *p = (go_shim_file*) f;
+	int rc = SQLITE_OK, rc2 = SQLITE_OK;
+	if (p->impl) {
+		rc = go_shim_close(p->impl);
+		p->impl = 0;
+	}
+	if (p->real->pMethods) {
+		rc2 = p->real->pMethods->xClose(p->real);
+	}
+	return rc != SQLITE_OK ? rc : rc2;
+}
+
+static int shim_read(sqlite3_file *f, void *buf, int n, sqlite3_int64 offset) {
+	go_shim_file *p = (go_shim_file*) f;
+	if (p->impl) {
+		return go_shim_read(p->impl, buf, n, offset);
+	}
+	return p->real->pMethods->xRead(p->real, buf, n, offset);
+}
+
+static int shim_write(sqlite3_file *f, const void *buf, int n, sqlite3_int64 offset) {
+	go_shim_file *p = (go_shim_file*) f;
+	if (p->impl) {
+		return go_shim_write(p->impl, (void*) buf, n, offset);
+	}
+	return p->real->pMethods->xWrite(p->real, buf, n, offset);
+}
+
+static int shim_truncate(sqlite3_file *f, sqlite3_int64 size) { return REAL_METHODS(f)->xTruncate(REAL_FILE(f), size); }
+static int shim_sync(sqlite3_file *f, int flags) { return REAL_METHODS(f)->xSync(REAL_FILE(f), flags); }
+static int shim_file_size(sqlite3_file *f, sqlite3_int64 *size) { return REAL_METHODS(f)->xFileSize(REAL_FILE(f), size); }
+static int shim_lock(sqlite3_file *f, int lock) { return REAL_METHODS(f)->xLock(REAL_FILE(f), lock); }
+static int shim_unlock(sqlite3_file *f, int lock) { return REAL_METHODS(f)->xUnlock(REAL_FILE(f), lock); }
+static int shim_check_reserved_lock(sqlite3_file *f, int *out) { return REAL_METHODS(f)->xCheckReservedLock(REAL_FILE(f), out); }
+static int shim_file_control(sqlite3_file *f, int op, void *arg) { return REAL_METHODS(f)->xFileControl(REAL_FILE(f), op, arg); }
+static int shim_sector_size(sqlite3_file *f) { return REAL_METHODS(f)->xSectorSize(REAL_FILE(f)); }
+static int shim_device_characteristics(sqlite3_file *f) { return REAL_METHODS(f)->xDeviceCharacteristics(REAL_FILE(f)); }
+
+static int shim_shm_map(sqlite3_file *f, int pg, int pgsz, int extend, void volatile **pp) {
+	return REAL_METHODS(f)->xShmMap(REAL_FILE(f), pg, pgsz, extend, pp);
+}
+static int shim_shm_lock(sqlite3_file *f, int offset, int n, int flags) { return REAL_METHODS(f)->xShmLock(REAL_FILE(f), offset, n, flags); }
+static void shim_shm_barrier(sqlite3_file *f) { REAL_METHODS(f)->xShmBarrier(REAL_FILE(f)); }
+static int shim_shm_unmap(sqlite3_file *f, int delete) { return REAL_METHODS(f)->xShmUnmap(REAL_FILE(f), delete); }
+
+// memory-mapped I/O would bypass the shim, and so it is always disabled
+static int shim_fetch(sqlite3_file *f, sqlite3_int64 offset, int amt, void **pp) { *pp = 0; return SQLITE_OK; }
+static int shim_unfetch(sqlite3_file *f, sqlite3_int64 offset, void *p) { return SQLITE_OK; }
+
+static const sqlite3_io_methods shim_io_methods_v1 = {
+	1, shim_close, shim_read, shim_write, shim_truncate, shim_sync, shim_file_size, shim_lock, shim_unlock,
+	shim_check_reserved_lock, shim_file_control, shim_sector_size, shim_device_characteristics,
+};
+
+static const sqlite3_io_methods shim_io_methods_v3 = {
+	3, shim_close, shim_read, shim_write, shim_truncate, shim_sync, shim_file_size, shim_lock, shim_unlock,
+	shim_check_reserved_lock, shim_file_control, shim_sector_size, shim_device_characteristics,
+	shim_shm_map, shim_shm_lock, shim_shm_barrier, shim_shm_unmap, shim_fetch, shim_unfetch,
+};
+
+int _shim_real_read(sqlite3_file *real, void *buf, int n, sqlite3_int64 offset) {
+	return real->pMethods->xRead(real, buf, n, offset);
+}
+
+int _shim_real_write(sqlite3_file *real, const void *buf, int n, sqlite3_int64 offset) {
+	return real->pMethods->xWrite(real, buf, n, offset);
+}
+
+int _shim_real_size(sqlite3_file *real, sqlite3_int64 *size) {
+	return real->pMethods->xFileSize(real, size);
+}
+
+//- shim vfs methods; everything except opening files is delegated to the real vfs
+//-----------------------------
+
+#define REAL_VFS(v) (((go_shim_vfs*)(v))->real)
+
+static int shim_open(sqlite3_vfs *vfs, const char *name, sqlite3_file *f, int flags, int *out) {
+	go_shim_vfs *v = (go_shim_vfs*) vfs;
+	go_shim_file *p = (go_shim_file*) f;
+	int rc;
+
+	memset(p, 0, sizeof(go_shim_file));
+	p->real = (sqlite3_file*) &p[1];
+
+	rc = v->real->xOpen(v->real, name, p->real, flags, out);
+	if (rc == SQLITE_OK) {
+		rc = go_shim_open(v->shim, (char*) name, flags, p->real, &p->impl);
+	}
+
+	if (rc != SQLITE_OK) {
+		// p->base.pMethods is left NULL, so sqlite won't close the file; we've to close the real file ourselves
+		if (p->real->pMethods) {
+			p->real->pMethods->xClose(p->real);
+		}
+		return rc;
+	}
+
+	p->base.pMethods = p->real->pMethods->iVersion >= 2 ? &shim_io_methods_v3 : &shim_io_methods_v1;
+	return SQLITE_OK;
+}
+
+static int shim_delete(sqlite3_vfs *v, const char *name, int sync) { return REAL_VFS(v)->xDelete(REAL_VFS(v), name, sync); }
+static int shim_access(sqlite3_vfs *v, const char *name, int flags, int *out) { return REAL_VFS(v)->xAccess(REAL_VFS(v), name, flags, out); }
+static int shim_full_pathname(sqlite3_vfs *v, const char *name, int n, char *out) { return REAL_VFS(v)->xFullPathname(REAL_VFS(v), name, n, out); }
+static void* shim_dl_open(sqlite3_vfs *v, const char *name) { return REAL_VFS(v)->xDlOpen(REAL_VFS(v), name); }
+static void shim_dl_error(sqlite3_vfs *v, int n, char *msg) { REAL_VFS(v)->xDlError(REAL_VFS(v), n, msg); }
+static void (*shim_dl_sym(sqlite3_vfs *v, void *p, const char *sym))(void) { return REAL_VFS(v)->xDlSym(REAL_VFS(v), p, sym); }
+static void shim_dl_close(sqlite3_vfs *v, void *p) { REAL_VFS(v)->xDlClose(REAL_VFS(v), p); }
+static int shim_randomness(sqlite3_vfs *v, int n, char *out) { return REAL_VFS(v)->xRandomness(REAL_VFS(v), n, out); }
+static int shim_sleep(sqlite3_vfs *v, int micros) { return REAL_VFS(v)->xSleep(REAL_VFS(v), micros); }
+static int shim_current_time(sqlite3_vfs *v, double *out) { return REAL_VFS(v)->xCurrentTime(REAL_VFS(v), out); }
+static int shim_get_last_error(sqlite3_vfs *v, int n, char *out) { return REAL_VFS(v)->xGetLastError(REAL_VFS(v), n, out); }
+static int shim_current_time_int64(sqlite3_vfs *v, sqlite3_int64 *out) { return REAL_VFS(v)->xCurrentTimeInt64(REAL_VFS(v), out); }
+
+go_shim_vfs* _allocate_shim_vfs(const char *name, sqlite3_vfs *real, void *shim) {
+	go_shim_vfs *v = (go_shim_vfs*) malloc(sizeof(go_shim_vfs) + strlen(name) + 1);
+	if (!v) {
+		return 0;
+	}
+	memset(v, 0, sizeof(go_shim_vfs));
+
+	v->real = real;
+	v->shim = shim;
+
+	v->base.iVersion = real->iVersion >= 2 ? 2 : 1;
+	v->base.szOsFile = sizeof(go_shim_file) + real->szOsFile;
+	v->base.mxPathname = real->mxPathname;
+	v->base.zName = strcpy((char*) &v[1], name);
+	v->base.xOpen = shim_open;
+	v->base.xDelete = shim_delete;
+	v->base.xAccess = shim_access;
+	v->base.xFullPathname = shim_full_pathname;
+	v->base.xDlOpen = shim_dl_open;
+	v->base.xDlError = shim_dl_error;
+	v->base.xDlSym = shim_dl_sym;
+	v->base.xDlClose = shim_dl_close;
+	v->base.xRandomness = shim_randomness;
+	v->base.xSleep = shim_sleep;
+	v->base.xCurrentTime = shim_current_time;
+	v->base.xGetLastError = shim_get_last_error;
+	if (v->base.iVersion >= 2) {
+		v->base.xCurrentTimeInt64 = shim_current_time_int64;
+	}
+	return v;
+}
+
+void _free_shim_vfs(go_shim_vfs *vfs) { free(vfs); }
+
+//- go vfs io methods; every call is routed to the Go File
+//-----------------------------
+
+#define GO_FILE(f) (((go_vfs_file*)(f))->impl)
+
+static int go_file_close(sqlite3_file *f) {
+	int rc = go_vfs_file_close(GO_FILE(f));
+	GO_FILE(f) = 0;
+	return rc;
+}
+
+static int go_file_read(sqlite3_file *f, void *buf, int n, sqlite3_int64 offset) { return go_vfs_file_read(GO_FILE(f), buf, n, offset); }
+static int go_file_write(sqlite3_file *f, const void *buf, int n, sqlite3_int64 offset) { return go_vfs_file_write(GO_FILE(f), (void*) buf, n, offset); }
+static int go_file_truncate(sqlite3_file *f, sqlite3_int64 size) { return go_vfs_file_truncate(GO_FILE(f), size); }
+static int go_file_sync(sqlite3_file *f, int flags) { return go_vfs_file_sync(GO_FILE(f), flags); }
+static int go_file_size(sqlite3_file *f, sqlite3_int64 *size) { return go_vfs_file_size(GO_FILE(f), size); }
+static int go_file_lock(sqlite3_file *f, int lock) { return go_vfs_file_lock(GO_FILE(f), lock); }
+static int go_file_unlock(sqlite3_file *f, int lock) { return go_vfs_file_unlock(GO_FILE(f), lock); }
+static int go_file_check_reserved_lock(sqlite3_file *f, int *out) { return go_vfs_file_check_reserved_lock(GO_FILE(f), out); }
+static int go_file_control(sqlite3_file *f, int op, void *arg) { return SQLITE_NOTFOUND; }
+static int go_file_sector_size(sqlite3_file *f) { return go_vfs_file_sector_size(GO_FILE(f)); }
+static int go_file_device_characteristics(sqlite3_file *f) { return go_vfs_file_device_characteristics(GO_FILE(f)); }
+
+static const sqlite3_io_methods go_io_methods = {
+	1, go_file_close, go_file_read, go_file_write, go_file_truncate, go_file_sync, go_file_size, go_file_lock,
+	go_file_unlock, go_file_check_reserved_lock, go_file_control, go_file_sector_size, go_file_device_characteristics,
+};
+
+//- go vfs methods; file-related routines are routed to the Go VFS, rest are delegated to the fallback vfs
+//-----------------------------
+
+#define GO_VFS(v) (((go_vfs*)(v))->impl)
+#define FALLBACK_VFS(v) (((go_vfs*)(v))->fallback)
+
+static int go_open(sqlite3_vfs *v, const char *name, sqlite3_file *f, int flags, int *out) {
+	go_vfs_file *p = (go_vfs_file*) f;
+	int rc;
+
+	memset(p, 0, sizeof(go_vfs_file));
+	rc = go_vfs_open(GO_VFS(v), (char*) name, flags, &p->impl);
+	if (rc != SQLITE_OK) {
+		return rc;
+	}
+
+	if (out) {
+		*out = flags;
+	}
+	p->base.pMethods = &go_io_methods;
+	return SQLITE_OK;
+}
+
+static int go_delete(sqlite3_vfs *v, const char *name, int sync) { return go_vfs_delete(GO_VFS(v), (char*) name, sync); }
+static int go_access(sqlite3_vfs *v, const char *name, int flags, int *out) { return go_vfs_access(GO_VFS(v), (char*) name, flags, out); }
+static int go_full_pathname(sqlite3_vfs *v, const char *name, int n, char *out) { return go_vfs_full_pathname(GO_VFS(v), (char*) name, n, out); }
+static void* go_dl_open(sqlite3_vfs *v, const char *name) { return FALLBACK_VFS(v)->xDlOpen(FALLBACK_VFS(v), name); }
+static void go_dl_error(sqlite3_vfs *v, int n, char *msg) { FALLBACK_VFS(v)->xDlError(FALLBACK_VFS(v), n, msg); }
+static void (*go_dl_sym(sqlite3_vfs *v, void *p, const char *sym))(void) { return FALLBACK_VFS(v)->xDlSym(FALLBACK_VFS(v), p, sym); }
+static void go_dl_close(sqlite3_vfs *v, void *p) { FALLBACK_VFS(v)->xDlClose(FALLBACK_VFS(v), p); }
+static int go_randomness(sqlite3_vfs *v, int n, char *out) { return FALLBACK_VFS(v)->xRandomness(FALLBACK_VFS(v), n, out); }
+static int go_sleep(sqlite3_vfs *v, int micros) { return FALLBACK_VFS(v)->xSleep(FALLBACK_VFS(v), micros); }
+static int go_current_time(sqlite3_vfs *v, double *out) { return FALLBACK_VFS(v)->xCurrentTime(FALLBACK_VFS(v), out); }
+static int go_get_last_error(sqlite3_vfs *v, int n, char *out) { return FALLBACK_VFS(v)->xGetLastError(FALLBACK_VFS(v), n, out); }
+static int go_current_time_int64(sqlite3_vfs *v, sqlite3_int64 *out) { return FALLBACK_VFS(v)->xCurrentTimeInt64(FALLBACK_VFS(v), out); }
+
+go_vfs* _allocate_go_vfs(const char *name, sqlite3_vfs *fallback, void *impl) {
+	go_vfs *v = (go_vfs*) malloc(sizeof(go_vfs) + strlen(name) + 1);
+	if (!v) {
+		return 0;
+	}
+	memset(v, 0, sizeof(go_vfs));
+
+	v->fallback = fallback;
+	v->impl = impl;
+
+	v->base.iVersion = fallback->iVersion >= 2 ? 2 : 1;
+	v->base.szOsFile = sizeof(go_vfs_file);
+	v->base.mxPathname = 512;
+	v->base.zName = strcpy((char*) &v[1], name);
+	v->base.xOpen = go_open;
+	v->base.xDelete = go_delete;
+	v->base.xAccess = go_access;
+	v->base.xFullPathname = go_full_pathname;
+	v->base.xDlOpen = go_dl_open;
+	v->base.xDlError = go_dl_error;
+	v->base.xDlSym = go_dl_sym;
+	v->base.xDlClose = go_dl_close;
+	v->base.xRandomness = go_randomness;
+	v->base.xSleep = go_sleep;
+	v->base.xCurrentTime = go_current_time;
+	v->base.xGetLastError = go_get_last_error;
+	if (v->base.iVersion >= 2) {
+		v->base.xCurrentTimeInt64 = go_current_time_int64;
+	}
+	return v;
+}
+
+void _free_go_vfs(go_vfs *vfs) { free(vfs); }
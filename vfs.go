@@ -0,0 +1,601 @@
+package sqlite
+
+// #include <stdlib.h>
+// #include <sqlite3ext.h>
+// #include "bridge.h"
+// #include "vfs.h"
+//
+// extern int go_sqlite3_api_initialized(void);
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mattn/go-pointer"
+	"io"
+	"sync"
+	"unsafe"
+)
+
+// OpenFlag is the set of flags passed to Open when opening a connection, and to a VFS when a file is opened.
+// see: https://www.sqlite.org/c3ref/c_open_autoproxy.html
+type OpenFlag int
+
+//noinspection GoSnakeCaseUsage
+const (
+	OPEN_READONLY      = OpenFlag(C.SQLITE_OPEN_READONLY)
+	OPEN_READWRITE     = OpenFlag(C.SQLITE_OPEN_READWRITE)
+	OPEN_CREATE        = OpenFlag(C.SQLITE_OPEN_CREATE)
+	OPEN_DELETEONCLOSE = OpenFlag(C.SQLITE_OPEN_DELETEONCLOSE)
+	OPEN_EXCLUSIVE     = OpenFlag(C.SQLITE_OPEN_EXCLUSIVE)
+	OPEN_MAIN_DB       = OpenFlag(C.SQLITE_OPEN_MAIN_DB)
+	OPEN_TEMP_DB       = OpenFlag(C.SQLITE_OPEN_TEMP_DB)
+	OPEN_TRANSIENT_DB  = OpenFlag(C.SQLITE_OPEN_TRANSIENT_DB)
+	OPEN_MAIN_JOURNAL  = OpenFlag(C.SQLITE_OPEN_MAIN_JOURNAL)
+	OPEN_TEMP_JOURNAL  = OpenFlag(C.SQLITE_OPEN_TEMP_JOURNAL)
+	OPEN_SUBJOURNAL    = OpenFlag(C.SQLITE_OPEN_SUBJOURNAL)
+	OPEN_SUPER_JOURNAL = OpenFlag(C.SQLITE_OPEN_SUPER_JOURNAL)
+	OPEN_WAL           = OpenFlag(C.SQLITE_OPEN_WAL)
+	OPEN_URI           = OpenFlag(C.SQLITE_OPEN_URI)
+	OPEN_MEMORY        = OpenFlag(C.SQLITE_OPEN_MEMORY)
+	OPEN_NOMUTEX       = OpenFlag(C.SQLITE_OPEN_NOMUTEX)
+	OPEN_FULLMUTEX     = OpenFlag(C.SQLITE_OPEN_FULLMUTEX)
+	OPEN_SHAREDCACHE   = OpenFlag(C.SQLITE_OPEN_SHAREDCACHE)
+	OPEN_PRIVATECACHE  = OpenFlag(C.SQLITE_OPEN_PRIVATECACHE)
+	OPEN_NOFOLLOW      = OpenFlag(C.SQLITE_OPEN_NOFOLLOW)
+)
+
+// FileIO provides positional reads and writes on a file opened through a VFS.
+//
+// ReadAt follows the io.ReaderAt contract. A read that extends past the end of the file must return io.EOF
+// along with the number of bytes read; sqlite treats the remainder of the buffer as zeroes.
+type FileIO interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// Shim intercepts reads and writes on files opened through a shim VFS (see RegisterShimVFS),
+// for example, to implement page-level encryption, compression, checksumming or I/O accounting.
+type Shim interface {
+	// Open is invoked after the underlying VFS has successfully opened the file with the given name and flags.
+	// The name is empty for temporary files. base provides access to the underlying file.
+	//
+	// Open returns the FileIO used for all subsequent reads and writes on the file, typically one that wraps base.
+	// If it returns nil, I/O on the file is passed through to the underlying VFS without calling into Go.
+	// If the returned FileIO also implements io.Closer, it is closed before the underlying file is.
+	Open(name string, flags OpenFlag, base FileIO) (FileIO, error)
+}
+
+// LockLevel is the level of lock held on a file opened through a VFS.
+// see: https://www.sqlite.org/c3ref/c_lock_exclusive.html
+type LockLevel int
+
+//noinspection GoSnakeCaseUsage
+const (
+	LOCK_NONE      = LockLevel(C.SQLITE_LOCK_NONE)
+	LOCK_SHARED    = LockLevel(C.SQLITE_LOCK_SHARED)
+	LOCK_RESERVED  = LockLevel(C.SQLITE_LOCK_RESERVED)
+	LOCK_PENDING   = LockLevel(C.SQLITE_LOCK_PENDING)
+	LOCK_EXCLUSIVE = LockLevel(C.SQLITE_LOCK_EXCLUSIVE)
+)
+
+// SyncFlag is the set of flags passed to File.Sync
+// see: https://www.sqlite.org/c3ref/c_sync_dataonly.html
+type SyncFlag int
+
+//noinspection GoSnakeCaseUsage
+const (
+	SYNC_NORMAL   = SyncFlag(C.SQLITE_SYNC_NORMAL)
+	SYNC_FULL     = SyncFlag(C.SQLITE_SYNC_FULL)
+	SYNC_DATAONLY = SyncFlag(C.SQLITE_SYNC_DATAONLY)
+)
+
+// AccessFlag is the kind of access VFS.Access is asked to check for
+// see: https://www.sqlite.org/c3ref/c_access_exists.html
+type AccessFlag int
+
+//noinspection GoSnakeCaseUsage
+const (
+	ACCESS_EXISTS    = AccessFlag(C.SQLITE_ACCESS_EXISTS)
+	ACCESS_READWRITE = AccessFlag(C.SQLITE_ACCESS_READWRITE)
+	ACCESS_READ      = AccessFlag(C.SQLITE_ACCESS_READ)
+)
+
+// DeviceCharacteristic is a set of flags describing the I/O characteristics of a file
+// see: https://www.sqlite.org/c3ref/c_iocap_atomic.html
+type DeviceCharacteristic int
+
+//noinspection GoSnakeCaseUsage
+const (
+	IOCAP_ATOMIC                = DeviceCharacteristic(C.SQLITE_IOCAP_ATOMIC)
+	IOCAP_SAFE_APPEND           = DeviceCharacteristic(C.SQLITE_IOCAP_SAFE_APPEND)
+	IOCAP_SEQUENTIAL            = DeviceCharacteristic(C.SQLITE_IOCAP_SEQUENTIAL)
+	IOCAP_UNDELETABLE_WHEN_OPEN = DeviceCharacteristic(C.SQLITE_IOCAP_UNDELETABLE_WHEN_OPEN)
+	IOCAP_POWERSAFE_OVERWRITE   = DeviceCharacteristic(C.SQLITE_IOCAP_POWERSAFE_OVERWRITE)
+	IOCAP_IMMUTABLE             = DeviceCharacteristic(C.SQLITE_IOCAP_IMMUTABLE)
+	IOCAP_BATCH_ATOMIC          = DeviceCharacteristic(C.SQLITE_IOCAP_BATCH_ATOMIC)
+)
+
+// VFS is a virtual file system implemented in Go (see RegisterVFS).
+// see: https://www.sqlite.org/c3ref/vfs.html
+type VFS interface {
+	// Open opens the file with the given name. The name is empty for temporary files,
+	// in which case the implementation must make up a unique one.
+	Open(name string, flags OpenFlag) (File, error)
+
+	// Delete deletes the file with the given name. If syncDir is set, the directory entry
+	// of the deleted file must be synced to persistent storage before returning.
+	Delete(name string, syncDir bool) error
+
+	// Access reports whether the file with the given name exists, or is readable / writable.
+	Access(name string, flags AccessFlag) (bool, error)
+
+	// FullPathname returns the canonical (absolute) form of the given name.
+	FullPathname(name string) (string, error)
+}
+
+// URIVFS is an optional interface that VFS implementations can implement to receive the Filename of the file being
+// opened, instead of just its name, which gives access to the query parameters of the URI used to open the database.
+type URIVFS interface {
+	VFS
+
+	// OpenFilename is invoked instead of Open. URI parameters are available for main database files, journals
+	// and write-ahead logs. The name is empty (Filename.String returns "") for temporary files.
+	OpenFilename(name Filename, flags OpenFlag) (File, error)
+}
+
+// File is a file opened through a VFS implemented in Go.
+// see: https://www.sqlite.org/c3ref/io_methods.html
+type File interface {
+	FileIO
+
+	// Truncate truncates (or extends) the file to the given size.
+	Truncate(size int64) error
+
+	// Sync flushes the contents of the file to persistent storage.
+	Sync(flags SyncFlag) error
+
+	// Size returns the current size of the file.
+	Size() (int64, error)
+
+	// Lock upgrades the lock held on the file to the given level. It returns SQLITE_BUSY if the lock
+	// can't be acquired as it's held by another connection.
+	Lock(LockLevel) error
+
+	// Unlock downgrades the lock held on the file to the given level (either LOCK_SHARED or LOCK_NONE).
+	Unlock(LockLevel) error
+
+	// CheckReservedLock reports whether any connection holds a RESERVED, PENDING or EXCLUSIVE lock on the file.
+	CheckReservedLock() (bool, error)
+
+	// SectorSize returns the sector size of the underlying storage.
+	SectorSize() int
+
+	// DeviceCharacteristics returns the I/O characteristics of the underlying storage.
+	DeviceCharacteristics() DeviceCharacteristic
+
+	// Close closes the file.
+	Close() error
+}
+
+var ( // protected registry of vfs registered by this package
+	vfsLock  sync.Mutex
+	vfsStore = map[string]func() error{} // maps name to a function that unregisters the vfs and releases it
+)
+
+// RegisterShimVFS registers a new VFS with the given name that wraps the VFS named base (or the default VFS, if base
+// is empty). The new VFS delegates everything to base, except reads and writes which are routed through shim.
+// Memory-mapped I/O is disabled on files opened through it, as it would otherwise bypass the shim.
+//
+// VFS are global to the process and outlive connections. Use the vfs= query parameter of an URI filename
+// (or set makeDefault) to open a database with the new VFS. Use UnregisterVFS to remove it.
+func RegisterShimVFS(name, base string, shim Shim, makeDefault bool) error {
+	if C.go_sqlite3_api_initialized() == 0 {
+		return errApiNotInitialized
+	}
+
+	var cbase *C.char
+	if base != "" {
+		cbase = C.CString(base)
+		defer C.free(unsafe.Pointer(cbase))
+	}
+
+	var real = C._sqlite3_vfs_find(cbase)
+	if real == nil {
+		return fmt.Errorf("sqlite: no vfs with name '%s' registered", base)
+	}
+
+	var cname = C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	vfsLock.Lock()
+	defer vfsLock.Unlock()
+
+	if C._sqlite3_vfs_find(cname) != nil {
+		return fmt.Errorf("sqlite: vfs with name '%s' already registered", name)
+	}
+
+	var handle = saveHandle(handleVFS, shim)
+	var vfs = C._allocate_shim_vfs(cname, real, handle)
+	if vfs == nil {
+		unrefHandle(handle)
+		return SQLITE_NOMEM
+	}
+
+	return addVFS(name, &vfs.base, makeDefault, func() {
+		C._free_shim_vfs(vfs)
+		unrefHandle(handle)
+	})
+}
+
+// RegisterVFS registers vfs, a VFS implemented in Go, under the given name. Randomness, sleep, current time and
+// dynamic loading routines are delegated to the default VFS. Shared memory (and hence WAL mode, unless exclusive
+// locking mode is used) and memory-mapped I/O are not supported.
+//
+// VFS are global to the process and outlive connections. Use the vfs= query parameter of an URI filename
+// (or set makeDefault) to open a database with the new VFS. Use UnregisterVFS to remove it.
+func RegisterVFS(name string, vfs VFS, makeDefault bool) error {
+	if C.go_sqlite3_api_initialized() == 0 {
+		return errApiNotInitialized
+	}
+
+	var fallback = C._sqlite3_vfs_find(nil)
+	if fallback == nil {
+		return errors.New("sqlite: no default vfs registered")
+	}
+
+	var cname = C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	vfsLock.Lock()
+	defer vfsLock.Unlock()
+
+	if C._sqlite3_vfs_find(cname) != nil {
+		return fmt.Errorf("sqlite: vfs with name '%s' already registered", name)
+	}
+
+	var handle = saveHandle(handleVFS, vfs)
+	var impl = C._allocate_go_vfs(cname, fallback, handle)
+	if impl == nil {
+		unrefHandle(handle)
+		return SQLITE_NOMEM
+	}
+
+	return addVFS(name, &impl.base, makeDefault, func() {
+		C._free_go_vfs(impl)
+		unrefHandle(handle)
+	})
+}
+
+// addVFS registers vfs with sqlite and records it in the registry; release is invoked once the vfs is unregistered,
+// or if the registration fails. Must be called with vfsLock held.
+func addVFS(name string, vfs *C.sqlite3_vfs, makeDefault bool, release func()) error {
+	if err := errorIfNotOk(C._sqlite3_vfs_register(vfs, boolToInt(makeDefault))); err != nil {
+		release()
+		return err
+	}
+
+	vfsStore[name] = func() error {
+		if err := errorIfNotOk(C._sqlite3_vfs_unregister(vfs)); err != nil {
+			return err
+		}
+		release()
+		return nil
+	}
+	return nil
+}
+
+// UnregisterVFS unregisters the VFS with the given name, previously registered by this package, and releases it.
+// The VFS must not be in use by any open connection.
+func UnregisterVFS(name string) error {
+	vfsLock.Lock()
+	defer vfsLock.Unlock()
+
+	var unregister, found = vfsStore[name]
+	if !found {
+		return fmt.Errorf("sqlite: no vfs with name '%s' registered", name)
+	}
+
+	if err := unregister(); err != nil {
+		return err
+	}
+	delete(vfsStore, name)
+	return nil
+}
+
+var errApiNotInitialized = errors.New("sqlite: sqlite3_api routines are not initialized; build with the static tag to link extension statically")
+
+// shimBase provides access to the file opened by the VFS wrapped by a shim VFS
+type shimBase struct{ file *C.sqlite3_file }
+
+func (b *shimBase) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	var res = C._shim_real_read(b.file, unsafe.Pointer(&p[0]), C.int(len(p)), C.sqlite3_int64(off))
+	if res == C.SQLITE_IOERR_SHORT_READ {
+		// sqlite doesn't report the number of bytes read, and so we work it out from the file's size
+		var size C.sqlite3_int64
+		if err := errorIfNotOk(C._shim_real_size(b.file, &size)); err != nil {
+			return 0, err
+		}
+
+		var n = int64(size) - off
+		if n < 0 {
+			n = 0
+		}
+		return int(n), io.EOF
+	}
+
+	if err := errorIfNotOk(res); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (b *shimBase) WriteAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if err := errorIfNotOk(C._shim_real_write(b.file, unsafe.Pointer(&p[0]), C.int(len(p)), C.sqlite3_int64(off))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// vfsErrorCode returns the code to report to sqlite for err; fallback is used unless err carries a code of its own
+func vfsErrorCode(err error, fallback ErrorCode) C.int {
+	switch e := err.(type) {
+	case ErrorCode:
+		return C.int(e)
+	case *errorCodeWithMessage:
+		return C.int(e.code)
+	case *QueryError:
+		return C.int(e.Extended)
+	default:
+		return C.int(fallback)
+	}
+}
+
+// recoverVFS fails the call with code if it panicked; it must be deferred
+func recoverVFS(callback string, code ErrorCode, res *C.int) {
+	if panicked(callback, recover()) != nil {
+		*res = C.int(code)
+	}
+}
+
+// bytesOf returns a slice backed by the n bytes of c memory at p
+func bytesOf(p unsafe.Pointer, n int) []byte { return (*[1 << 30]byte)(p)[:n:n] }
+
+// readAt reads n bytes at the given offset from file into buf, following the semantics of xRead
+func readAt(file FileIO, buf unsafe.Pointer, n C.int, offset C.sqlite3_int64) C.int {
+	var p = bytesOf(buf, int(n))
+
+	var read, err = file.ReadAt(p, int64(offset))
+	if err != nil && err != io.EOF {
+		return vfsErrorCode(err, SQLITE_IOERR_READ)
+	}
+
+	// io.ReaderAt allows a full read to come with io.EOF, which isn't a short read
+	if read < len(p) {
+		for i := read; i < len(p); i++ {
+			p[i] = 0 // sqlite requires the unread part of the buffer to be zero-filled
+		}
+		return C.SQLITE_IOERR_SHORT_READ
+	}
+	return C.SQLITE_OK
+}
+
+// writeAt writes n bytes from buf to file at the given offset, following the semantics of xWrite
+func writeAt(file FileIO, buf unsafe.Pointer, n C.int, offset C.sqlite3_int64) C.int {
+	var p = bytesOf(buf, int(n))
+
+	var written, err = file.WriteAt(p, int64(offset))
+	if err != nil {
+		return vfsErrorCode(err, SQLITE_IOERR_WRITE)
+	} else if written < len(p) {
+		return C.SQLITE_IOERR_WRITE
+	}
+	return C.SQLITE_OK
+}
+
+//export go_shim_open
+func go_shim_open(shim unsafe.Pointer, name *C.char, flags C.int, file *C.sqlite3_file, out *unsafe.Pointer) (res C.int) {
+	defer recoverVFS("xOpen", SQLITE_CANTOPEN, &res)
+	var impl, err = pointer.Restore(shim).(Shim).Open(C.GoString(name), OpenFlag(flags), &shimBase{file: file})
+	if err != nil {
+		return vfsErrorCode(err, SQLITE_CANTOPEN)
+	}
+
+	if impl != nil {
+		*out = saveHandle(handleFile, impl)
+	}
+	return C.SQLITE_OK
+}
+
+//export go_shim_read
+func go_shim_read(impl, buf unsafe.Pointer, n C.int, offset C.sqlite3_int64) (res C.int) {
+	defer recoverVFS("xRead", SQLITE_IOERR_READ, &res)
+	return readAt(pointer.Restore(impl).(FileIO), buf, n, offset)
+}
+
+//export go_shim_write
+func go_shim_write(impl, buf unsafe.Pointer, n C.int, offset C.sqlite3_int64) (res C.int) {
+	defer recoverVFS("xWrite", SQLITE_IOERR_WRITE, &res)
+	return writeAt(pointer.Restore(impl).(FileIO), buf, n, offset)
+}
+
+//export go_shim_close
+func go_shim_close(impl unsafe.Pointer) (res C.int) {
+	defer recoverVFS("xClose", SQLITE_IOERR_CLOSE, &res)
+	var file = pointer.Restore(impl)
+	defer unrefHandle(impl)
+
+	if closer, ok := file.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return vfsErrorCode(err, SQLITE_IOERR_CLOSE)
+		}
+	}
+	return C.SQLITE_OK
+}
+
+func goFile(p unsafe.Pointer) File { return pointer.Restore(p).(File) }
+
+//export go_vfs_open
+func go_vfs_open(vfs unsafe.Pointer, name *C.char, flags C.int, out *unsafe.Pointer) (res C.int) {
+	defer recoverVFS("xOpen", SQLITE_CANTOPEN, &res)
+	var file File
+	var err error
+	if impl, ok := pointer.Restore(vfs).(URIVFS); ok {
+		file, err = impl.OpenFilename(Filename{ptr: name}, OpenFlag(flags))
+	} else {
+		file, err = pointer.Restore(vfs).(VFS).Open(C.GoString(name), OpenFlag(flags))
+	}
+
+	if err != nil {
+		return vfsErrorCode(err, SQLITE_CANTOPEN)
+	}
+
+	*out = saveHandle(handleFile, file)
+	return C.SQLITE_OK
+}
+
+//export go_vfs_delete
+func go_vfs_delete(vfs unsafe.Pointer, name *C.char, syncDir C.int) (res C.int) {
+	defer recoverVFS("xDelete", SQLITE_IOERR_DELETE, &res)
+	if err := pointer.Restore(vfs).(VFS).Delete(C.GoString(name), syncDir != 0); err != nil {
+		return vfsErrorCode(err, SQLITE_IOERR_DELETE)
+	}
+	return C.SQLITE_OK
+}
+
+//export go_vfs_access
+func go_vfs_access(vfs unsafe.Pointer, name *C.char, flags C.int, out *C.int) (res C.int) {
+	defer recoverVFS("xAccess", SQLITE_IOERR_ACCESS, &res)
+	var ok, err = pointer.Restore(vfs).(VFS).Access(C.GoString(name), AccessFlag(flags))
+	if err != nil {
+		return vfsErrorCode(err, SQLITE_IOERR_ACCESS)
+	}
+
+	*out = 0
+	if ok {
+		*out = 1
+	}
+	return C.SQLITE_OK
+}
+
+//export go_vfs_full_pathname
+func go_vfs_full_pathname(vfs unsafe.Pointer, name *C.char, n C.int, out *C.char) (res C.int) {
+	defer recoverVFS("xFullPathname", SQLITE_CANTOPEN, &res)
+	var path, err = pointer.Restore(vfs).(VFS).FullPathname(C.GoString(name))
+	if err != nil {
+		return vfsErrorCode(err, SQLITE_CANTOPEN)
+	}
+
+	if len(path) >= int(n) {
+		return C.SQLITE_CANTOPEN
+	}
+
+	var buf = bytesOf(unsafe.Pointer(out), int(n))
+	buf[copy(buf, path)] = 0
+	return C.SQLITE_OK
+}
+
+//export go_vfs_file_close
+func go_vfs_file_close(file unsafe.Pointer) (res C.int) {
+	defer recoverVFS("xClose", SQLITE_IOERR_CLOSE, &res)
+	defer unrefHandle(file)
+	if err := goFile(file).Close(); err != nil {
+		return vfsErrorCode(err, SQLITE_IOERR_CLOSE)
+	}
+	return C.SQLITE_OK
+}
+
+//export go_vfs_file_read
+func go_vfs_file_read(file, buf unsafe.Pointer, n C.int, offset C.sqlite3_int64) (res C.int) {
+	defer recoverVFS("xRead", SQLITE_IOERR_READ, &res)
+	return readAt(goFile(file), buf, n, offset)
+}
+
+//export go_vfs_file_write
+func go_vfs_file_write(file, buf unsafe.Pointer, n C.int, offset C.sqlite3_int64) (res C.int) {
+	defer recoverVFS("xWrite", SQLITE_IOERR_WRITE, &res)
+	return writeAt(goFile(file), buf, n, offset)
+}
+
+//export go_vfs_file_truncate
+func go_vfs_file_truncate(file unsafe.Pointer, size C.sqlite3_int64) (res C.int) {
+	defer recoverVFS("xTruncate", SQLITE_IOERR_TRUNCATE, &res)
+	if err := goFile(file).Truncate(int64(size)); err != nil {
+		return vfsErrorCode(err, SQLITE_IOERR_TRUNCATE)
+	}
+	return C.SQLITE_OK
+}
+
+//export go_vfs_file_sync
+func go_vfs_file_sync(file unsafe.Pointer, flags C.int) (res C.int) {
+	defer recoverVFS("xSync", SQLITE_IOERR_FSYNC, &res)
+	if err := goFile(file).Sync(SyncFlag(flags)); err != nil {
+		return vfsErrorCode(err, SQLITE_IOERR_FSYNC)
+	}
+	return C.SQLITE_OK
+}
+
+//export go_vfs_file_size
+func go_vfs_file_size(file unsafe.Pointer, out *C.sqlite3_int64) (res C.int) {
+	defer recoverVFS("xFileSize", SQLITE_IOERR_FSTAT, &res)
+	var size, err = goFile(file).Size()
+	if err != nil {
+		return vfsErrorCode(err, SQLITE_IOERR_FSTAT)
+	}
+
+	*out = C.sqlite3_int64(size)
+	return C.SQLITE_OK
+}
+
+//export go_vfs_file_lock
+func go_vfs_file_lock(file unsafe.Pointer, level C.int) (res C.int) {
+	defer recoverVFS("xLock", SQLITE_IOERR_LOCK, &res)
+	if err := goFile(file).Lock(LockLevel(level)); err != nil {
+		return vfsErrorCode(err, SQLITE_IOERR_LOCK)
+	}
+	return C.SQLITE_OK
+}
+
+//export go_vfs_file_unlock
+func go_vfs_file_unlock(file unsafe.Pointer, level C.int) (res C.int) {
+	defer recoverVFS("xUnlock", SQLITE_IOERR_UNLOCK, &res)
+	if err := goFile(file).Unlock(LockLevel(level)); err != nil {
+		return vfsErrorCode(err, SQLITE_IOERR_UNLOCK)
+	}
+	return C.SQLITE_OK
+}
+
+//export go_vfs_file_check_reserved_lock
+func go_vfs_file_check_reserved_lock(file unsafe.Pointer, out *C.int) (res C.int) {
+	defer recoverVFS("xCheckReservedLock", SQLITE_IOERR_CHECKRESERVEDLOCK, &res)
+	var reserved, err = goFile(file).CheckReservedLock()
+	if err != nil {
+		return vfsErrorCode(err, SQLITE_IOERR_CHECKRESERVEDLOCK)
+	}
+
+	*out = 0
+	if reserved {
+		*out = 1
+	}
+	return C.SQLITE_OK
+}
+
+//export go_vfs_file_sector_size
+func go_vfs_file_sector_size(file unsafe.Pointer) C.int {
+	defer func() { _ = panicked("xSectorSize", recover()) }() // sqlite uses its default size for 0
+	return C.int(goFile(file).SectorSize())
+}
+
+//export go_vfs_file_device_characteristics
+func go_vfs_file_device_characteristics(file unsafe.Pointer) C.int {
+	defer func() { _ = panicked("xDeviceCharacteristics", recover()) }()
+	return C.int(goFile(file).DeviceCharacteristics())
+}
@@ -0,0 +1,45 @@
+// This file declares the sqlite3_vfs implementations backed by Go.
+// See vfs.go for details.
+
+#include <sqlite3ext.h>
+
+// go_shim_vfs is an sqlite3_vfs that wraps another vfs and delegates to it,
+// while letting Go code intercept reads and writes on the files it opens.
+typedef struct go_shim_vfs {
+	sqlite3_vfs base;
+	sqlite3_vfs *real; // the wrapped vfs
+	void *shim;        // handle to the Go Shim
+} go_shim_vfs;
+
+// go_shim_file is a file opened through a go_shim_vfs.
+// The file opened by the wrapped vfs is allocated right after it.
+typedef struct go_shim_file {
+	sqlite3_file base;
+	sqlite3_file *real; // the file opened by the wrapped vfs
+	void *impl;         // handle to the Go FileIO; NULL if the shim passes I/O through
+} go_shim_file;
+
+go_shim_vfs* _allocate_shim_vfs(const char *name, sqlite3_vfs *real, void *shim);
+void _free_shim_vfs(go_shim_vfs *vfs);
+
+// read from, write to and query the size of the file opened by the wrapped vfs
+int _shim_real_read(sqlite3_file *real, void *buf, int n, sqlite3_int64 offset);
+int _shim_real_write(sqlite3_file *real, const void *buf, int n, sqlite3_int64 offset);
+int _shim_real_size(sqlite3_file *real, sqlite3_int64 *size);
+
+// go_vfs is an sqlite3_vfs implemented in Go. Routines that aren't related to files
+// (randomness, sleep, current time and dynamic loading) are delegated to the fallback vfs.
+typedef struct go_vfs {
+	sqlite3_vfs base;
+	sqlite3_vfs *fallback; // the vfs used for routines not implemented in Go
+	void *impl;            // handle to the Go VFS
+} go_vfs;
+
+// go_vfs_file is a file opened through a go_vfs
+typedef struct go_vfs_file {
+	sqlite3_file base;
+	void *impl; // handle to the Go File
+} go_vfs_file;
+
+go_vfs* _allocate_go_vfs(const char *name, sqlite3_vfs *fallback, void *impl);
+void _free_go_vfs(go_vfs *vfs);
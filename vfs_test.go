@@ -0,0 +1,283 @@
+package sqlite_test
+
+import (
+	"bytes"
+	"database/sql"
+	. "go.riyazali.net/sqlite"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// XorShim is a Shim that "encrypts" every byte written to a file by xor-ing it with a key
+type XorShim struct {
+	key           byte
+	reads, writes int64
+}
+
+func (s *XorShim) Open(_ string, _ OpenFlag, base FileIO) (FileIO, error) {
+	return &xorFile{shim: s, base: base}, nil
+}
+
+type xorFile struct {
+	shim *XorShim
+	base FileIO
+}
+
+func (f *xorFile) ReadAt(p []byte, off int64) (int, error) {
+	atomic.AddInt64(&f.shim.reads, 1)
+	n, err := f.base.ReadAt(p, off)
+	for i := 0; i < n; i++ {
+		p[i] ^= f.shim.key
+	}
+	return n, err
+}
+
+func (f *xorFile) WriteAt(p []byte, off int64) (int, error) {
+	atomic.AddInt64(&f.shim.writes, 1)
+	var buf = make([]byte, len(p))
+	for i := range p {
+		buf[i] = p[i] ^ f.shim.key
+	}
+	return f.base.WriteAt(buf, off)
+}
+
+func TestRegisterShimVFS(t *testing.T) {
+	bootstrap(t)
+
+	var shim = &XorShim{key: 0x5a}
+	if err := RegisterShimVFS("xor", "", shim, false); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := UnregisterVFS("xor"); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if err := RegisterShimVFS("xor", "", shim, false); err == nil {
+		t.Fatal("expected error when registering a duplicate vfs")
+	}
+	if err := RegisterShimVFS("other", "no-such-vfs", shim, false); err == nil {
+		t.Fatal("expected error when wrapping an unknown vfs")
+	}
+
+	dir, err := ioutil.TempDir("", "shim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var path = filepath.Join(dir, "test.db")
+	db, err := Connect("file:" + path + "?vfs=xor")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = db.Exec("CREATE TABLE t(v TEXT); INSERT INTO t VALUES ('hello'), ('world')"); err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+
+	if atomic.LoadInt64(&shim.writes) == 0 {
+		t.Fatal("writes must have gone through the shim")
+	}
+
+	if contents, err := ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if bytes.HasPrefix(contents, []byte("SQLite format 3")) {
+		t.Fatal("database file must not be stored in plain text")
+	}
+
+	if db, err = Connect("file:" + path + "?vfs=xor"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var count int
+	if err = db.QueryRow("SELECT COUNT(*) FROM t").Scan(&count); err != nil {
+		t.Fatal(err)
+	} else if count != 2 {
+		t.Fatalf("expected 2 rows, got %d", count)
+	}
+}
+
+// EOFShim is a Shim whose files return io.EOF along with reads that reach the end of the file, as io.ReaderAt allows
+type EOFShim struct{}
+
+func (EOFShim) Open(name string, _ OpenFlag, base FileIO) (FileIO, error) {
+	return &eofFile{name: name, base: base}, nil
+}
+
+type eofFile struct {
+	name string
+	base FileIO
+}
+
+func (f *eofFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.base.ReadAt(p, off)
+	if info, serr := os.Stat(f.name); err == nil && serr == nil && off+int64(n) >= info.Size() {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *eofFile) WriteAt(p []byte, off int64) (int, error) { return f.base.WriteAt(p, off) }
+
+func TestShimVFSReadAtEOF(t *testing.T) {
+	bootstrap(t)
+
+	if err := RegisterShimVFS("eof", "", EOFShim{}, false); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = UnregisterVFS("eof") }()
+
+	var dir = t.TempDir()
+	var src, dst = filepath.Join(dir, "src.db"), filepath.Join(dir, "dst.db")
+
+	db, err := Connect("file:" + src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err = db.Exec("PRAGMA journal_mode = WAL; PRAGMA wal_autocheckpoint = 0; " +
+		"CREATE TABLE t(v); INSERT INTO t VALUES (1), (2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// copy the database and its write-ahead log while the connection is open, so that the copy needs recovering
+	for _, suffix := range []string{"", "-wal"} {
+		if contents, err := ioutil.ReadFile(src + suffix); err != nil {
+			t.Fatal(err)
+		} else if err = ioutil.WriteFile(dst+suffix, contents, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = db.Close()
+
+	// a full read of the last frame of the log is no short read, even if it comes with io.EOF
+	if db, err = Connect("file:" + dst + "?vfs=eof"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var count int
+	if err = db.QueryRow("SELECT COUNT(*) FROM t").Scan(&count); err != nil {
+		t.Fatal(err)
+	} else if count != 2 {
+		t.Fatalf("expected 2 rows, got %d", count)
+	}
+}
+
+func TestMemoryVFS(t *testing.T) {
+	bootstrap(t)
+
+	if err := RegisterMemoryVFS(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = UnregisterVFS(MemoryVFSName) }()
+
+	if err := RegisterVFS("gomem-limited", NewMemoryVFS(WithMaxSize(16*1024)), false); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = UnregisterVFS("gomem-limited") }()
+
+	t.Run("Shared", func(t *testing.T) {
+		var writer, reader, err = connectPair("file:shared.db?vfs=gomem")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer writer.Close()
+		defer reader.Close()
+
+		if _, err = writer.Exec("CREATE TABLE t(v); INSERT INTO t VALUES (1), (2), (3)"); err != nil {
+			t.Fatal(err)
+		}
+
+		var count int
+		if err = reader.QueryRow("SELECT COUNT(*) FROM t").Scan(&count); err != nil {
+			t.Fatal(err)
+		} else if count != 3 {
+			t.Fatalf("expected 3 rows, got %d", count)
+		}
+	})
+
+	t.Run("Isolated", func(t *testing.T) {
+		db, err := Connect("file:other.db?vfs=gomem")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		if _, err = db.Exec("SELECT * FROM t"); err == nil {
+			t.Fatal("table must not exist in a different database")
+		}
+	})
+
+	t.Run("MaxSize", func(t *testing.T) {
+		db, err := Connect("file:limited.db?vfs=gomem-limited")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		if _, err = db.Exec("CREATE TABLE t(v); INSERT INTO t VALUES (zeroblob(64 * 1024))"); err == nil {
+			t.Fatal("expected error when exceeding the maximum size")
+		} else if !strings.Contains(err.Error(), "full") {
+			t.Fatalf("expected SQLITE_FULL, got %v", err)
+		}
+	})
+}
+
+// connectPair opens two separate connections to the database at the given address
+func connectPair(dataSourceName string) (*sql.DB, *sql.DB, error) {
+	var first, err = Connect(dataSourceName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	second, err := Connect(dataSourceName)
+	if err != nil {
+		_ = first.Close()
+		return nil, nil, err
+	}
+	return first, second, nil
+}
+
+// TaggingVFS is a MemoryVFS that records the tag URI parameter of every main database it opens
+type TaggingVFS struct {
+	*MemoryVFS
+	tags []string
+}
+
+func (vfs *TaggingVFS) OpenFilename(name Filename, flags OpenFlag) (File, error) {
+	if flags&OPEN_MAIN_DB != 0 {
+		var tag, _ = name.Parameter("tag")
+		vfs.tags = append(vfs.tags, tag)
+	}
+	return vfs.Open(name.String(), flags)
+}
+
+func TestURIVFS(t *testing.T) {
+	bootstrap(t)
+
+	var vfs = &TaggingVFS{MemoryVFS: NewMemoryVFS()}
+	if err := RegisterVFS("gomem-tagging", vfs, false); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = UnregisterVFS("gomem-tagging") }()
+
+	db, err := Connect("file:tagged.db?vfs=gomem-tagging&tag=hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+
+	if len(vfs.tags) == 0 || vfs.tags[0] != "hello" {
+		t.Fatalf("expected tag to be passed to the vfs, got %q", vfs.tags)
+	}
+}
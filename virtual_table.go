@@ -22,6 +22,9 @@ package sqlite
 // extern int x_sync_tramp(sqlite3_vtab*);
 // extern int x_commit_tramp(sqlite3_vtab*);
 // extern int x_rollback_tramp(sqlite3_vtab*);
+// extern int x_savepoint_tramp(sqlite3_vtab*, int);
+// extern int x_release_tramp(sqlite3_vtab*, int);
+// extern int x_rollback_to_tramp(sqlite3_vtab*, int);
 //
 // typedef void (*overloaded_function)(sqlite3_context*,int,sqlite3_value**);
 // extern int x_find_function_tramp(sqlite3_vtab*, int, char*, overloaded_function*, void**);
@@ -77,6 +80,7 @@ import (
 	"github.com/mattn/go-pointer"
 	"reflect"
 	"strings"
+	"sync"
 	"unsafe"
 )
 
@@ -97,8 +101,9 @@ func (ctx *VirtualTableContext) NoChange() bool {
 // all of which the implementer must provide in order to satisfy a sqlite_module interface.
 type Module interface {
 	// Connect connects to an existing instance and establishes a new connection to an existing virtual table.
-	// It receives a slice of arguments passed to the module and a method to declare the virtual table's schema.
-	// Connect must call declare or else the operation would fail and error would be returned to sqlite.
+	// It receives a slice of arguments passed to the module (see ParseCreationArgs) and a method to declare
+	// the virtual table's schema. Connect must call declare or else the operation would fail and error would be
+	// returned to sqlite.
 	//
 	// If a module only declares a Connect method than it's an eponymous module (by default) and can either be
 	// invoked directly or be used in a CREATE VIRTUAL TABLE statement. To make eponymous-only use EponymousOnly(true).
@@ -106,13 +111,37 @@ type Module interface {
 	Connect(_ *Conn, args []string, declare func(string) error) (VirtualTable, error)
 }
 
+// CreationArgs are the arguments passed to a module's Create and Connect methods, split into their parts.
+// Use ParseCreationArgs to obtain them from the args slice.
+type CreationArgs struct {
+	Module  string   // name of the module, as used in the CREATE VIRTUAL TABLE statement
+	Schema  string   // name of the database the table belongs to, eg. "main" or "temp"
+	Table   string   // name of the table being created or connected to
+	Options []string // arguments given to the module in the CREATE VIRTUAL TABLE statement, if any
+}
+
+// ParseCreationArgs splits the args passed to Create and Connect into their parts. sqlite always passes
+// the names of the module, the database and the table first, followed by the module's own arguments.
+func ParseCreationArgs(args []string) CreationArgs {
+	var parsed CreationArgs
+	var names = []*string{&parsed.Module, &parsed.Schema, &parsed.Table}
+	for i := 0; i < len(args) && i < len(names); i++ {
+		*names[i] = args[i]
+	}
+	if len(args) > len(names) {
+		parsed.Options = args[len(names):]
+	}
+	return parsed
+}
+
 // StatefulModule is one which requires prior state initialization before one can connect to it.
 type StatefulModule interface {
 	Module
 
 	// Create creates a new instance of a virtual table in response to a CREATE VIRTUAL TABLE statement.
-	// It receives a slice of arguments passed to the module and a method to declare the virtual table's schema.
-	// Create must call declare or else the operation would fail and error would be returned to sqlite.
+	// It receives a slice of arguments passed to the module (see ParseCreationArgs) and a method to declare
+	// the virtual table's schema. Create must call declare or else the operation would fail and error would be
+	// returned to sqlite.
 	Create(_ *Conn, args []string, declare func(string) error) (VirtualTable, error)
 }
 
@@ -203,6 +232,24 @@ type TwoPhaseCommitter interface {
 	Sync() error
 }
 
+// Savepointer is an optional interface that VirtualTable implementations (which also implements Transactional)
+// can implement to enable support for nested transactions, ie. savepoints and statement rollbacks.
+// See vtabutil.Savepoints for an implementation that keeps track of the nesting rules described below.
+type Savepointer interface {
+	Transactional
+
+	// Savepoint signals that the current state of the table should be saved as savepoint n.
+	// A later call to RollbackTo(r) reverts the table to the state it had when Savepoint(r) was invoked.
+	Savepoint(n int) error
+
+	// Release invalidates all savepoints with n or greater identifiers.
+	Release(n int) error
+
+	// RollbackTo reverts the table to the state it had when Savepoint(n) was invoked, and invalidates
+	// all savepoints with identifiers greater than n.
+	RollbackTo(n int) error
+}
+
 // OverloadableVirtualTable is an optional interface the VirtualTable implementations can implement
 // to allow them an opportunity to overload functions, replacing them with optimised implementations.
 // For more details and implementation notes, please refer to official
@@ -253,6 +300,18 @@ type VirtualCursor interface {
 	Close() error
 }
 
+// ResettableCursor is an optional interface that VirtualCursor implementations can implement to be reused
+// across scans of the same table, for modules registered with CursorPool. Reset is invoked in place of Close
+// when sqlite is done with the cursor, and must release whatever the cursor holds on to for the scan while
+// keeping its buffers, so that the next Filter starts afresh. If Reset returns an error, the cursor is closed instead.
+// Pooled cursors are closed when their table is disconnected.
+type ResettableCursor interface {
+	VirtualCursor
+
+	// Reset prepares the cursor to be returned by a later Open of the same table.
+	Reset() error
+}
+
 // ConstraintOp op-code passed as input in BestIndex
 type ConstraintOp C.int
 
@@ -342,11 +401,18 @@ type ModuleOptions struct {
 	ReadOnly       bool // Insert / Update / Delete is not allowed on read-only tables
 	Transactional  bool // Transactional must be set if the table implements the optional Transactional interface
 	TwoPhaseCommit bool // TwoPhaseCommit must be set if the table supports two-phase commits (implies Transactional)
+	Savepoints     bool // Savepoints must be set if the table implements the optional Savepointer interface (implies Transactional)
+	Strict         bool // Strict validates the values returned by VirtualCursor.Column against the declared column types
 	Overloadable   bool // Overloadable must be set if the table supports overloading default functions / operations
+	CursorPool     int  // CursorPool is the number of idle cursors kept for reuse by each table; see CursorPool()
+
+	// ConstraintSupport must be set if the table reports constraint violations with ConstraintError,
+	// for sqlite to resolve them as per the statement's ON CONFLICT clause
+	ConstraintSupport bool
 }
 
 // CreateModule creates a named virtual table module with the given name and module as implementation.
-func (ext *ExtensionApi) CreateModule(name string, module Module, opts ...func(*ModuleOptions)) error {
+func (conn *Conn) CreateModule(name string, module Module, opts ...func(*ModuleOptions)) error {
 	var cname = C.CString(name)
 	defer C.free(unsafe.Pointer(cname))
 
@@ -365,6 +431,7 @@ func (ext *ExtensionApi) CreateModule(name string, module Module, opts ...func(*
 	var xUpdate *[0]byte                                       // sqlite3_vtab writeable routine
 	var xBegin, xCommit, xRollback *[0]byte                    // sqlite3_vtab transactional routines
 	var xSync *[0]byte                                         // sqlite3_vtab two-phase commit routine
+	var xSavepoint, xRelease, xRollbackTo *[0]byte             // sqlite3_vtab nested transaction routines
 	var xFindFunction *[0]byte                                 // sqlite3_vtab overload-able routine
 	var xFilter, xNext, xRowid, xColumn, xEof, xClose *[0]byte // sqlite3_vtab cursor routines
 
@@ -390,7 +457,7 @@ func (ext *ExtensionApi) CreateModule(name string, module Module, opts ...func(*
 		xUpdate = (*[0]byte)(C.x_update_tramp)
 	}
 
-	if opt.Transactional {
+	if opt.Transactional || opt.Savepoints {
 		xBegin = (*[0]byte)(C.x_begin_tramp)
 		xCommit = (*[0]byte)(C.x_commit_tramp)
 		xRollback = (*[0]byte)(C.x_rollback_tramp)
@@ -400,6 +467,12 @@ func (ext *ExtensionApi) CreateModule(name string, module Module, opts ...func(*
 		}
 	}
 
+	if opt.Savepoints {
+		xSavepoint = (*[0]byte)(C.x_savepoint_tramp)
+		xRelease = (*[0]byte)(C.x_release_tramp)
+		xRollbackTo = (*[0]byte)(C.x_rollback_to_tramp)
+	}
+
 	if opt.Overloadable {
 		xFindFunction = (*[0]byte)(C.x_find_function_tramp)
 	}
@@ -413,6 +486,9 @@ func (ext *ExtensionApi) CreateModule(name string, module Module, opts ...func(*
 
 	var sqliteModule = C._allocate_sqlite3_module()
 	sqliteModule.iVersion = 0
+	if opt.Savepoints {
+		sqliteModule.iVersion = 2 // xSavepoint, xRelease and xRollbackTo are only used with version 2 and later
+	}
 	sqliteModule.xCreate = xCreate
 	sqliteModule.xConnect = xConnect
 	sqliteModule.xBestIndex = xBestIndex
@@ -431,9 +507,23 @@ func (ext *ExtensionApi) CreateModule(name string, module Module, opts ...func(*
 	sqliteModule.xCommit = xCommit
 	sqliteModule.xRollback = xRollback
 	sqliteModule.xFindFunction = xFindFunction
+	sqliteModule.xSavepoint = xSavepoint
+	sqliteModule.xRelease = xRelease
+	sqliteModule.xRollbackTo = xRollbackTo
+
+	var pAux = saveHandle(handleModule, &virtualModule{module: module, name: name, opts: *opt})
+	var res = C._sqlite3_create_module_v2(conn.db, cname, sqliteModule, pAux, (*[0]byte)(C.module_destroy))
+	if err := errorIfNotOk(res); err != nil {
+		logDebug("sqlite: failed to register module", "module", name, "error", err)
+		return err
+	}
+	logDebug("sqlite: registered module", "module", name)
+	return nil
+}
 
-	var res = C._sqlite3_create_module_v2(ext.db, cname, sqliteModule, pointer.Save(module), (*[0]byte)(C.module_destroy))
-	return errorIfNotOk(res)
+// CreateModule creates a named virtual table module with the given name and module as implementation.
+func (ext *ExtensionApi) CreateModule(name string, module Module, opts ...func(*ModuleOptions)) error {
+	return ext.conn().CreateModule(name, module, opts...)
 }
 
 // OverloadFunction registers a global version of a function with a particular name and number of parameters. If no such
@@ -468,6 +558,40 @@ func Transaction(b bool) func(*ModuleOptions) {
 	return func(m *ModuleOptions) { m.Transactional = b }
 }
 
+// Strict makes the package validate that every value returned by the module's VirtualCursor.Column matches
+// the type declared for the column, failing the query with a descriptive error (SQLITE_CONSTRAINT_DATATYPE or
+// SQLITE_CONSTRAINT_NOTNULL) instead of letting sqlite silently convert or store a mistyped value.
+//
+// Columns accept values of their affinity: INTEGER columns accept integers, REAL columns accept
+// integers and floats, NUMERIC columns accept either, TEXT columns accept text and columns declared without
+// a type (or as BLOB) accept anything. NULL is accepted unless the column is declared NOT NULL.
+// If the declaration ends with STRICT, column types must be one of INT, INTEGER, REAL, TEXT, BLOB or ANY,
+// as in a STRICT table, and BLOB columns only accept blobs.
+func Strict(b bool) func(*ModuleOptions) {
+	return func(m *ModuleOptions) { m.Strict = b }
+}
+
+// CursorPool makes each table of the module keep up to n of its closed cursors for reuse, instead of allocating
+// new ones on every Open. Only cursors implementing ResettableCursor are pooled, and a cursor returned from the pool
+// is reused without invoking the table's Open. Pooling reduces allocations for tables that are scanned at a high rate,
+// such as eponymous table-valued functions.
+func CursorPool(n int) func(*ModuleOptions) {
+	return func(m *ModuleOptions) { m.CursorPool = n }
+}
+
+// ConstraintSupport marks the module as reporting constraint violations with ConstraintError, so that sqlite
+// honours the ON CONFLICT clause of statements writing to its tables (ROLLBACK, ABORT and FAIL), rather than
+// always aborting the statement. A write failing with a ConstraintError is skipped under CONFLICT_IGNORE,
+// while CONFLICT_REPLACE must be implemented by the table; see Conn.OnConflict.
+func ConstraintSupport(b bool) func(*ModuleOptions) {
+	return func(m *ModuleOptions) { m.ConstraintSupport = b }
+}
+
+// Savepoints marks the module as supporting nested transactions. The module then also needs to implement Savepointer interface.
+func Savepoints(b bool) func(*ModuleOptions) {
+	return func(m *ModuleOptions) { m.Savepoints = b }
+}
+
 // TwoPhaseCommit marks the module as supporting two-phased commits.
 func TwoPhaseCommit(b bool) func(*ModuleOptions) {
 	return func(m *ModuleOptions) { m.TwoPhaseCommit = b }
@@ -478,19 +602,38 @@ func Overloadable(b bool) func(*ModuleOptions) {
 	return func(m *ModuleOptions) { m.Overloadable = b }
 }
 
+// virtualModule is a module registered with CreateModule, passed to sqlite as the client data of the sqlite3_module
+type virtualModule struct {
+	module Module
+	name   string
+	opts   ModuleOptions
+}
+
+// virtualTable is a table of a module, held by the go_virtual_table that sqlite knows the table by
+type virtualTable struct {
+	table    VirtualTable
+	name     string         // name of the module; tables are labelled with it
+	db       *C.sqlite3     // connection the table belongs to
+	declared *declaredTable // schema declared by the table, if the module is strict; see Strict()
+	pool     *cursorPool    // idle cursors of the table, if the module pools them; see CursorPool()
+
+	constrained bool // whether the module reports constraint violations; see ConstraintSupport()
+}
+
+// goModule returns the module registered with the given client data
+func goModule(pAux unsafe.Pointer) *virtualModule { return pointer.Restore(pAux).(*virtualModule) }
+
+// goTable returns the table behind the given sqlite3_vtab
+func goTable(tab *C.sqlite3_vtab) *virtualTable {
+	return pointer.Restore(((*C.go_virtual_table)(unsafe.Pointer(tab))).impl).(*virtualTable)
+}
+
 // TRAMPOLINES AHEAD!!
 
 // shared code used by xCreate & xConnect tramps
-func create_connect_shared(db *C.sqlite3, fn func(_ *Conn, args []string, declare func(string) error) (VirtualTable, error), argc C.int, argv **C.char, vtab **C.sqlite3_vtab, pzErr **C.char) C.int {
+func create_connect_shared(db *C.sqlite3, pAux unsafe.Pointer, span string, fn func(_ *Conn, args []string, declare func(string) error) (VirtualTable, error), argc C.int, argv **C.char, vtab **C.sqlite3_vtab, pzErr **C.char) C.int {
 	var err error
 
-	// helper function passed to Create/Connect to invoke sqlite3_declare_vtab
-	var declare = func(sql string) error {
-		var csql = C.CString(sql)
-		defer C.free(unsafe.Pointer(csql))
-		return errorIfNotOk(C._sqlite3_declare_vtab(db, csql))
-	}
-
 	var args = make([]string, argc)
 	{ // convert **C.char into []string
 		var slice = *(*[]*C.char)(unsafe.Pointer(&reflect.SliceHeader{Data: uintptr(unsafe.Pointer(argv)), Len: int(argc), Cap: int(argc)}))
@@ -499,8 +642,35 @@ func create_connect_shared(db *C.sqlite3, fn func(_ *Conn, args []string, declar
 		}
 	}
 
+	var module = goModule(pAux)
+
+	// helper function passed to Create/Connect to invoke sqlite3_declare_vtab
+	var declared *declaredTable
+	var declare = func(sql string) error {
+		if module.opts.Strict {
+			if declared, sql, err = parseDeclaration(ParseCreationArgs(args).Table, sql); err != nil {
+				return err
+			}
+		}
+
+		var csql = C.CString(sql)
+		defer C.free(unsafe.Pointer(csql))
+		if err := errorIfNotOk(C._sqlite3_declare_vtab(db, csql)); err != nil {
+			return err
+		}
+
+		if module.opts.ConstraintSupport {
+			return errorIfNotOk(C._sqlite3_vtab_config(db, C.SQLITE_VTAB_CONSTRAINT_SUPPORT, 1))
+		}
+		return nil
+	}
+
 	var table VirtualTable
-	if table, err = fn(wrap(db), args, declare); err != nil && err != SQLITE_OK {
+	var end = startSpan(span, db, AttributeModule, module.name)
+	table, err = fn(wrap(db), args, declare)
+	end(err)
+	if err != nil && err != SQLITE_OK {
+		logDebug("sqlite: failed to create virtual table", "module", module.name, "error", err)
 		if ec, ok := err.(ErrorCode); ok {
 			return C.int(ec)
 		}
@@ -508,25 +678,36 @@ func create_connect_shared(db *C.sqlite3, fn func(_ *Conn, args []string, declar
 		return C.int(SQLITE_ERROR)
 	}
 
-	return C._allocate_virtual_table(vtab, pointer.Save(table))
+	var t = &virtualTable{table: table, name: module.name, db: db, declared: declared, constrained: module.opts.ConstraintSupport}
+	if module.opts.CursorPool > 0 {
+		t.pool = &cursorPool{size: module.opts.CursorPool}
+	}
+	return C._allocate_virtual_table(vtab, saveHandle(handleTable, t))
 }
 
 //export x_create_tramp
-func x_create_tramp(db *C.sqlite3, pAux unsafe.Pointer, argc C.int, argv **C.char, vtab **C.sqlite3_vtab, pzErr **C.char) C.int {
-	var module = pointer.Restore(pAux).(StatefulModule)
-	return create_connect_shared(db, module.Create, argc, argv, vtab, pzErr)
+func x_create_tramp(db *C.sqlite3, pAux unsafe.Pointer, argc C.int, argv **C.char, vtab **C.sqlite3_vtab, pzErr **C.char) (res C.int) {
+	defer recoverCreate("xCreate", pzErr, &res)
+	var module = goModule(pAux).module.(StatefulModule)
+	return create_connect_shared(db, pAux, "sqlite.vtab.create", module.Create, argc, argv, vtab, pzErr)
 }
 
 //export x_connect_tramp
-func x_connect_tramp(db *C.sqlite3, pAux unsafe.Pointer, argc C.int, argv **C.char, vtab **C.sqlite3_vtab, pzErr **C.char) C.int {
-	var module = pointer.Restore(pAux).(Module)
-	return create_connect_shared(db, module.Connect, argc, argv, vtab, pzErr)
+func x_connect_tramp(db *C.sqlite3, pAux unsafe.Pointer, argc C.int, argv **C.char, vtab **C.sqlite3_vtab, pzErr **C.char) (res C.int) {
+	defer recoverCreate("xConnect", pzErr, &res)
+	var module = goModule(pAux).module
+	return create_connect_shared(db, pAux, "sqlite.vtab.connect", module.Connect, argc, argv, vtab, pzErr)
 }
 
 //export x_best_index_tramp
-func x_best_index_tramp(tab *C.sqlite3_vtab, indexInfo *C.sqlite3_index_info) C.int {
+func x_best_index_tramp(tab *C.sqlite3_vtab, indexInfo *C.sqlite3_index_info) (res C.int) {
+	defer recoverTable(tab, "xBestIndex", &res)
 	var version = int(C._sqlite3_libversion_number())
-	var table = pointer.Restore(((*C.go_virtual_table)(unsafe.Pointer(tab))).impl).(VirtualTable)
+	var t = goTable(tab)
+	var table = t.table
+	if m := currentMetrics(); m != nil {
+		m.Count(MetricBestIndexCalls, t.name, 1)
+	}
 
 	var constraints []*IndexConstraint
 	{
@@ -561,10 +742,7 @@ func x_best_index_tramp(tab *C.sqlite3_vtab, indexInfo *C.sqlite3_index_info) C.
 
 	output, err := table.BestIndex(input)
 	if err != nil && err != SQLITE_OK {
-		if ec, ok := err.(ErrorCode); ok {
-			return C.int(ec)
-		}
-		return set_error_message(tab, err)
+		return vtab_error(tab, err)
 	} else if output == nil {
 		return C.int(SQLITE_ERROR)
 	}
@@ -604,53 +782,65 @@ func x_best_index_tramp(tab *C.sqlite3_vtab, indexInfo *C.sqlite3_index_info) C.
 }
 
 //export x_disconnect_tramp
-func x_disconnect_tramp(tab *C.sqlite3_vtab) C.int {
+func x_disconnect_tramp(tab *C.sqlite3_vtab) (res C.int) {
 	var x = unsafe.Pointer(tab)
-	defer func() { pointer.Unref((*C.go_virtual_table)(x).impl); C._sqlite3_free(x) }()
-
-	var table = pointer.Restore((*C.go_virtual_table)(x).impl).(VirtualTable)
-	if err := table.Disconnect(); err != nil {
-		if ec, ok := err.(ErrorCode); ok {
-			return C.int(ec)
+	defer func() { unrefHandle((*C.go_virtual_table)(x).impl); C._sqlite3_free(x) }()
+	defer func() { // the table is released right after, so there's nowhere to report the message
+		if panicked("xDisconnect", recover()) != nil {
+			res = C.int(SQLITE_ERROR)
 		}
-		return set_error_message(tab, err)
+	}()
+
+	var t = goTable(tab)
+	closePooledCursors(t)
+	if err := t.table.Disconnect(); err != nil {
+		return vtab_error(tab, err)
 	}
 	return C.int(SQLITE_OK)
 }
 
 //export x_destroy_tramp
-func x_destroy_tramp(tab *C.sqlite3_vtab) C.int {
+func x_destroy_tramp(tab *C.sqlite3_vtab) (res C.int) {
 	var x = unsafe.Pointer(tab)
-	defer func() { pointer.Unref((*C.go_virtual_table)(x).impl); C._sqlite3_free(x) }()
-
-	var table = pointer.Restore((*C.go_virtual_table)(x).impl).(VirtualTable)
-	if err := table.Destroy(); err != nil {
-		if ec, ok := err.(ErrorCode); ok {
-			return C.int(ec)
+	defer func() { unrefHandle((*C.go_virtual_table)(x).impl); C._sqlite3_free(x) }()
+	defer func() { // the table is released right after, so there's nowhere to report the message
+		if panicked("xDestroy", recover()) != nil {
+			res = C.int(SQLITE_ERROR)
 		}
-		return set_error_message(tab, err)
+	}()
+
+	var t = goTable(tab)
+	closePooledCursors(t)
+	if err := t.table.Destroy(); err != nil {
+		return vtab_error(tab, err)
 	}
 	return C.int(SQLITE_OK)
 }
 
 //export x_open_tramp
-func x_open_tramp(tab *C.sqlite3_vtab, cur **C.sqlite3_vtab_cursor) C.int {
+func x_open_tramp(tab *C.sqlite3_vtab, cur **C.sqlite3_vtab_cursor) (res C.int) {
+	defer recoverTable(tab, "xOpen", &res)
 	var err error
 
-	var table = pointer.Restore(((*C.go_virtual_table)(unsafe.Pointer(tab))).impl).(VirtualTable)
-	var cursor VirtualCursor
-	if cursor, err = table.Open(); err != nil {
-		if ec, ok := err.(ErrorCode); ok {
-			return C.int(ec)
+	var t = goTable(tab)
+	if t.pool != nil {
+		if x := t.pool.get(); x != nil {
+			*cur = (*C.sqlite3_vtab_cursor)(x)
+			return C.int(SQLITE_OK)
 		}
-		return set_error_message(tab, err)
 	}
 
-	return C._allocate_virtual_cursor(cur, pointer.Save(cursor))
+	var cursor VirtualCursor
+	if cursor, err = t.table.Open(); err != nil {
+		return vtab_error(tab, err)
+	}
+
+	return C._allocate_virtual_cursor(cur, saveHandle(handleCursor, cursor))
 }
 
 //export x_update_tramp
-func x_update_tramp(tab *C.sqlite3_vtab, c C.int, v **C.sqlite3_value, rowid *C.sqlite3_int64) C.int {
+func x_update_tramp(tab *C.sqlite3_vtab, c C.int, v **C.sqlite3_value, rowid *C.sqlite3_int64) (res C.int) {
+	defer recoverTable(tab, "xUpdate", &res)
 	var equivalent = func(typ ColumnType, v0, v1 Value) bool {
 		switch typ {
 		case SQLITE_INTEGER:
@@ -665,7 +855,7 @@ func x_update_tramp(tab *C.sqlite3_vtab, c C.int, v **C.sqlite3_value, rowid *C.
 		return false
 	}
 
-	var table = pointer.Restore(((*C.go_virtual_table)(unsafe.Pointer(tab))).impl).(WriteableVirtualTable)
+	var table = goTable(tab).table.(WriteableVirtualTable)
 	argc, argv := int(c), toValues(c, v)
 	var err error
 
@@ -685,69 +875,145 @@ func x_update_tramp(tab *C.sqlite3_vtab, c C.int, v **C.sqlite3_value, rowid *C.
 	}
 
 	if err != nil && err != SQLITE_OK {
-		if ec, ok := err.(ErrorCode); ok {
-			return C.int(ec)
+		if ignoreConflict(tab, err) {
+			return C.int(SQLITE_OK)
 		}
-		return set_error_message(tab, err)
+		return vtab_error(tab, err)
 	}
 
 	return C.int(SQLITE_OK)
 }
 
+// ignoreConflict reports whether err is a constraint violation that the statement being run wants ignored,
+// ie. it's an INSERT OR IGNORE or the like, on a table with constraint support
+func ignoreConflict(tab *C.sqlite3_vtab, err error) bool {
+	var t = goTable(tab)
+	if !t.constrained {
+		return false
+	}
+	if _, ok := ConstraintCode(err); !ok {
+		return false
+	}
+	return wrap(t.db).OnConflict() == CONFLICT_IGNORE
+}
+
 //export x_close_tramp
-func x_close_tramp(cur *C.sqlite3_vtab_cursor) C.int {
+func x_close_tramp(cur *C.sqlite3_vtab_cursor) (res C.int) {
 	var x = unsafe.Pointer(cur)
-	defer func() { pointer.Unref((*C.go_virtual_cursor)(x).impl); C._sqlite3_free(x) }()
+	var pVtab = cur.pVtab
+	var pooled = false
+	defer func() {
+		if !pooled {
+			unrefHandle((*C.go_virtual_cursor)(x).impl)
+			C._sqlite3_free(x)
+		}
+	}()
+	defer recoverTable(pVtab, "xClose", &res)
+	cursorPanics.Delete((*C.go_virtual_cursor)(x).impl)
 
 	var cursor = pointer.Restore((*C.go_virtual_cursor)(x).impl).(VirtualCursor)
-	if err := cursor.Close(); err != nil {
-		if ec, ok := err.(ErrorCode); ok {
-			return C.int(ec)
+	endScan((*C.go_virtual_cursor)(x).impl, nil)
+	if pool := goTable(pVtab).pool; pool != nil {
+		if resettable, ok := cursor.(ResettableCursor); ok && resettable.Reset() == nil && pool.put(x) {
+			pooled = true
+			return C.int(SQLITE_OK)
 		}
-		return set_error_message(cur.pVtab, err)
+	}
+
+	if err := cursor.Close(); err != nil {
+		return vtab_error(pVtab, err)
 	}
 
 	return C.int(SQLITE_OK)
 }
 
+// closePooledCursors closes and releases the idle cursors pooled by the table
+func closePooledCursors(table *virtualTable) {
+	if table.pool == nil {
+		return
+	}
+
+	for _, x := range table.pool.drain() {
+		var impl = (*C.go_virtual_cursor)(x).impl
+		if err := pointer.Restore(impl).(VirtualCursor).Close(); err != nil {
+			logDebug("sqlite: failed to close pooled cursor", "module", table.name, "error", err)
+		}
+		unrefHandle(impl)
+		C._sqlite3_free(x)
+	}
+}
+
 //export x_filter_tramp
-func x_filter_tramp(cur *C.sqlite3_vtab_cursor, idxNum C.int, idxStr *C.char, argc C.int, valarray **C.sqlite3_value) C.int {
+func x_filter_tramp(cur *C.sqlite3_vtab_cursor, idxNum C.int, idxStr *C.char, argc C.int, valarray **C.sqlite3_value) (res C.int) {
+	defer recoverTable(cur.pVtab, "xFilter", &res)
 	var cursor = pointer.Restore(((*C.go_virtual_cursor)(unsafe.Pointer(cur))).impl).(VirtualCursor)
+	if m := currentMetrics(); m != nil {
+		m.Count(MetricFilterCalls, tableName(cur), 1)
+	}
+
+	var impl = ((*C.go_virtual_cursor)(unsafe.Pointer(cur))).impl
+	startScan(impl, goTable(cur.pVtab))
+
 	var str = C.GoString(idxStr)
 	if err := cursor.Filter(int(idxNum), str, toValues(argc, valarray)...); err != nil {
-		if ec, ok := err.(ErrorCode); ok {
-			return C.int(ec)
-		}
-		return set_error_message(cur.pVtab, err)
+		endScan(impl, err)
+		return vtab_error(cur.pVtab, err)
 	}
 	return C.int(SQLITE_OK)
 }
 
 //export x_next_tramp
-func x_next_tramp(cur *C.sqlite3_vtab_cursor) C.int {
+func x_next_tramp(cur *C.sqlite3_vtab_cursor) (res C.int) {
+	defer recoverTable(cur.pVtab, "xNext", &res)
+	if err := cursorPanic(cur); err != nil {
+		return vtab_error(cur.pVtab, err)
+	}
+
 	var cursor = pointer.Restore(((*C.go_virtual_cursor)(unsafe.Pointer(cur))).impl).(VirtualCursor)
 	if err := cursor.Next(); err != nil {
-		if ec, ok := err.(ErrorCode); ok {
-			return C.int(ec)
-		}
-		return set_error_message(cur.pVtab, err)
+		endScan(((*C.go_virtual_cursor)(unsafe.Pointer(cur))).impl, err)
+		return vtab_error(cur.pVtab, err)
 	}
 	return C.int(SQLITE_OK)
 }
 
 //export x_eof_tramp
-func x_eof_tramp(cur *C.sqlite3_vtab_cursor) C.int {
+func x_eof_tramp(cur *C.sqlite3_vtab_cursor) (res C.int) {
+	defer func() { // xEof cannot fail; report the panic from the call sqlite makes next, instead of ending the scan silently
+		if err := panicked("xEof", recover()); err != nil {
+			cursorPanics.Store(((*C.go_virtual_cursor)(unsafe.Pointer(cur))).impl, err)
+			res = C.int(0)
+		}
+	}()
+
 	var cursor = pointer.Restore(((*C.go_virtual_cursor)(unsafe.Pointer(cur))).impl).(VirtualCursor)
 	if cursor.Eof() {
+		endScan(((*C.go_virtual_cursor)(unsafe.Pointer(cur))).impl, nil)
 		return C.int(1)
 	}
+
+	if m := currentMetrics(); m != nil {
+		m.Count(MetricRowsScanned, tableName(cur), 1)
+	}
 	return C.int(0)
 }
 
 //export x_column_tramp
-func x_column_tramp(cur *C.sqlite3_vtab_cursor, c *C.sqlite3_context, idx C.int) C.int {
+func x_column_tramp(cur *C.sqlite3_vtab_cursor, c *C.sqlite3_context, idx C.int) (res C.int) {
+	defer recoverTable(cur.pVtab, "xColumn", &res)
+	if err := cursorPanic(cur); err != nil {
+		return vtab_error(cur.pVtab, err)
+	}
+
 	var cursor = pointer.Restore(((*C.go_virtual_cursor)(unsafe.Pointer(cur))).impl).(VirtualCursor)
 	var ctx = &VirtualTableContext{Context: &Context{ptr: c}}
+
+	var declared = goTable(cur.pVtab).declared
+	var typ = ColumnType(-1) // no result
+	if declared != nil {
+		ctx.result = &typ
+	}
+
 	if err := cursor.Column(ctx, int(idx)); err != nil {
 		if ec, ok := err.(ErrorCode); ok {
 			ctx.ResultText(ec.String())
@@ -756,17 +1022,28 @@ func x_column_tramp(cur *C.sqlite3_vtab_cursor, c *C.sqlite3_context, idx C.int)
 		ctx.ResultText(err.Error())
 		return C.int(SQLITE_ERROR)
 	}
+
+	if declared != nil && (typ != -1 || !ctx.NoChange()) { // unchanged columns of an UPDATE needn't have a result
+		if typ == -1 {
+			typ = SQLITE_NULL
+		}
+		if err := declared.check(int(idx), typ); err != nil {
+			return vtab_error(cur.pVtab, err)
+		}
+	}
 	return C.int(SQLITE_OK)
 }
 
 //export x_rowid_tramp
-func x_rowid_tramp(cur *C.sqlite3_vtab_cursor, rowid *C.sqlite3_int64) C.int {
+func x_rowid_tramp(cur *C.sqlite3_vtab_cursor, rowid *C.sqlite3_int64) (res C.int) {
+	defer recoverTable(cur.pVtab, "xRowid", &res)
+	if err := cursorPanic(cur); err != nil {
+		return vtab_error(cur.pVtab, err)
+	}
+
 	var cursor = pointer.Restore(((*C.go_virtual_cursor)(unsafe.Pointer(cur))).impl).(VirtualCursor)
 	if id, err := cursor.Rowid(); err != nil {
-		if ec, ok := err.(ErrorCode); ok {
-			return C.int(ec)
-		}
-		return set_error_message(cur.pVtab, err)
+		return vtab_error(cur.pVtab, err)
 	} else {
 		*rowid = C.sqlite3_int64(id)
 	}
@@ -774,75 +1051,166 @@ func x_rowid_tramp(cur *C.sqlite3_vtab_cursor, rowid *C.sqlite3_int64) C.int {
 }
 
 //export x_begin_tramp
-func x_begin_tramp(tab *C.sqlite3_vtab) C.int {
-	var table = pointer.Restore(((*C.go_virtual_table)(unsafe.Pointer(tab))).impl).(Transactional)
-	if err := table.Begin(); err != nil {
-		if ec, ok := err.(ErrorCode); ok {
-			return C.int(ec)
-		}
-		return set_error_message(tab, err)
+func x_begin_tramp(tab *C.sqlite3_vtab) (res C.int) {
+	defer recoverTable(tab, "xBegin", &res)
+	var t = goTable(tab)
+	var table = t.table.(Transactional)
+	var end = startTableSpan("sqlite.vtab.begin", t)
+	var err = table.Begin()
+	end(err)
+	if err != nil {
+		return vtab_error(tab, err)
 	}
 	return C.int(SQLITE_OK)
 }
 
 //export x_sync_tramp
-func x_sync_tramp(tab *C.sqlite3_vtab) C.int {
-	var table = pointer.Restore(((*C.go_virtual_table)(unsafe.Pointer(tab))).impl).(TwoPhaseCommitter)
-	if err := table.Sync(); err != nil {
-		if ec, ok := err.(ErrorCode); ok {
-			return C.int(ec)
-		}
-		return set_error_message(tab, err)
+func x_sync_tramp(tab *C.sqlite3_vtab) (res C.int) {
+	defer recoverTable(tab, "xSync", &res)
+	var t = goTable(tab)
+	var table = t.table.(TwoPhaseCommitter)
+	var end = startTableSpan("sqlite.vtab.sync", t)
+	var err = table.Sync()
+	end(err)
+	if err != nil {
+		return vtab_error(tab, err)
 	}
 	return C.int(SQLITE_OK)
 }
 
 //export x_commit_tramp
-func x_commit_tramp(tab *C.sqlite3_vtab) C.int {
-	var table = pointer.Restore(((*C.go_virtual_table)(unsafe.Pointer(tab))).impl).(Transactional)
-	if err := table.Commit(); err != nil {
-		if ec, ok := err.(ErrorCode); ok {
-			return C.int(ec)
-		}
-		return set_error_message(tab, err)
+func x_commit_tramp(tab *C.sqlite3_vtab) (res C.int) {
+	defer recoverTable(tab, "xCommit", &res)
+	var t = goTable(tab)
+	var table = t.table.(Transactional)
+	var end = startTableSpan("sqlite.vtab.commit", t)
+	var err = table.Commit()
+	end(err)
+	if err != nil {
+		return vtab_error(tab, err)
 	}
 	return C.int(SQLITE_OK)
 }
 
 //export x_rollback_tramp
-func x_rollback_tramp(tab *C.sqlite3_vtab) C.int {
-	var table = pointer.Restore(((*C.go_virtual_table)(unsafe.Pointer(tab))).impl).(Transactional)
-	if err := table.Rollback(); err != nil {
-		if ec, ok := err.(ErrorCode); ok {
-			return C.int(ec)
-		}
-		return set_error_message(tab, err)
+func x_rollback_tramp(tab *C.sqlite3_vtab) (res C.int) {
+	defer recoverTable(tab, "xRollback", &res)
+	var t = goTable(tab)
+	var table = t.table.(Transactional)
+	var end = startTableSpan("sqlite.vtab.rollback", t)
+	var err = table.Rollback()
+	end(err)
+	if err != nil {
+		return vtab_error(tab, err)
+	}
+	return C.int(SQLITE_OK)
+}
+
+//export x_savepoint_tramp
+func x_savepoint_tramp(tab *C.sqlite3_vtab, n C.int) (res C.int) {
+	defer recoverTable(tab, "xSavepoint", &res)
+	var table = goTable(tab).table.(Savepointer)
+	if err := table.Savepoint(int(n)); err != nil {
+		return vtab_error(tab, err)
+	}
+	return C.int(SQLITE_OK)
+}
+
+//export x_release_tramp
+func x_release_tramp(tab *C.sqlite3_vtab, n C.int) (res C.int) {
+	defer recoverTable(tab, "xRelease", &res)
+	var table = goTable(tab).table.(Savepointer)
+	if err := table.Release(int(n)); err != nil {
+		return vtab_error(tab, err)
+	}
+	return C.int(SQLITE_OK)
+}
+
+//export x_rollback_to_tramp
+func x_rollback_to_tramp(tab *C.sqlite3_vtab, n C.int) (res C.int) {
+	defer recoverTable(tab, "xRollbackTo", &res)
+	var table = goTable(tab).table.(Savepointer)
+	if err := table.RollbackTo(int(n)); err != nil {
+		return vtab_error(tab, err)
 	}
 	return C.int(SQLITE_OK)
 }
 
 //export x_find_function_tramp
-func x_find_function_tramp(tab *C.sqlite3_vtab, nArg C.int, zName *C.char, pxFunc *C.overloaded_function, ppArg *unsafe.Pointer) C.int {
-	var table = pointer.Restore(((*C.go_virtual_table)(unsafe.Pointer(tab))).impl).(OverloadableVirtualTable)
+func x_find_function_tramp(tab *C.sqlite3_vtab, nArg C.int, zName *C.char, pxFunc *C.overloaded_function, ppArg *unsafe.Pointer) (res C.int) {
+	defer func() { // fall back to the built-in function
+		if panicked("xFindFunction", recover()) != nil {
+			res = C.int(0)
+		}
+	}()
+
+	var table = goTable(tab).table.(OverloadableVirtualTable)
 	var name, args = C.GoString(zName), int(nArg)
 	n, _func := table.FindFunction(name, args)
 	if _func == nil {
 		return C.int(0)
 	}
 	*pxFunc = (*[0]byte)(C.x_overloaded_function_tramp)
-	*ppArg = pointer.Save(_func)
+	*ppArg = saveHandle(handleOverload, _func)
 	return C.int(n)
 }
 
 //export x_overloaded_function_tramp
 func x_overloaded_function_tramp(ctx *C.sqlite3_context, n C.int, v **C.sqlite3_value) {
+	var c = &Context{ptr: ctx}
+	defer recoverFunction(c, "xFunc")
 	var p = unsafe.Pointer(C._sqlite3_user_data(ctx))
 	var fn = pointer.Restore(p).(func(*Context, ...Value))
-	fn(&Context{ptr: ctx}, toValues(n, v)...)
+	fn(c, toValues(n, v)...)
 }
 
 //export module_destroy
-func module_destroy(pAux unsafe.Pointer) { pointer.Unref(pAux) }
+func module_destroy(pAux unsafe.Pointer) { unrefHandle(pAux) }
+
+// recoverTable fails the call with a *PanicError, reported on vtab, if it panicked; it must be deferred
+func recoverTable(vtab *C.sqlite3_vtab, callback string, res *C.int) {
+	if err := panicked(callback, recover()); err != nil {
+		*res = vtab_error(vtab, err)
+	}
+}
+
+// recoverCreate fails xCreate or xConnect with a *PanicError if it panicked; it must be deferred
+func recoverCreate(callback string, pzErr **C.char, res *C.int) {
+	if err := panicked(callback, recover()); err != nil {
+		*pzErr = _allocate_string(err.Error())
+		*res = C.int(SQLITE_ERROR)
+	}
+}
+
+// cursorPanics holds the panics recovered from xEof, keyed by the cursor's handle, until they're reported
+// by the next call on the cursor that can fail
+var cursorPanics sync.Map
+
+// cursorPanic returns the panic recovered from the cursor's xEof, if any
+func cursorPanic(cur *C.sqlite3_vtab_cursor) error {
+	if err, ok := cursorPanics.Load(((*C.go_virtual_cursor)(unsafe.Pointer(cur))).impl); ok {
+		return err.(error)
+	}
+	return nil
+}
+
+// tableName returns the name of the module of the table the cursor belongs to
+func tableName(cur *C.sqlite3_vtab_cursor) string {
+	return goTable(cur.pVtab).name
+}
+
+// vtab_error reports err to sqlite, setting the table's error message unless err is an ErrorCode
+func vtab_error(vtab *C.sqlite3_vtab, err error) C.int {
+	var code C.int
+	if ec, ok := err.(ErrorCode); ok {
+		code = C.int(ec)
+	} else {
+		code = set_error_message(vtab, err)
+	}
+	countError(ErrorCode(code))
+	logDebug("sqlite: virtual table returned error", "module", goTable(vtab).name, "error", err)
+	return code
+}
 
 // helper to set the error message field for the cursor
 func set_error_message(vtab *C.sqlite3_vtab, err error) C.int {
@@ -853,6 +1221,12 @@ func set_error_message(vtab *C.sqlite3_vtab, err error) C.int {
 	if em, ok := err.(*errorCodeWithMessage); ok {
 		vtab.zErrMsg = _allocate_string(em.msg)
 		return C.int(em.code)
+	} else if ce, ok := err.(*ConstraintError); ok {
+		vtab.zErrMsg = _allocate_string(ce.Error())
+		return C.int(ce.Code)
+	} else if qe, ok := err.(*QueryError); ok {
+		vtab.zErrMsg = _allocate_string(qe.Msg)
+		return C.int(qe.Extended)
 	} else {
 		vtab.zErrMsg = _allocate_string(err.Error())
 		return C.int(SQLITE_ERROR)
@@ -871,3 +1245,54 @@ func _allocate_string(msg string) *C.char {
 
 	return (*C.char)(dst)
 }
+
+// CreateVirtualTable registers module under the given name and then creates a virtual table, with the same name,
+// that uses it. This is what most non-eponymous modules need anyway.
+//
+// The arguments are passed on to the module's Create / Connect method. An argument that would otherwise break the
+// argument list (for example, one that contains a comma or parentheses) is quoted as an SQL string literal.
+// For arguments of the form key=value only the value is quoted.
+func (conn *Conn) CreateVirtualTable(name string, module Module, args []string, ifNotExists bool, opts ...func(*ModuleOptions)) error {
+	if err := conn.CreateModule(name, module, opts...); err != nil {
+		return err
+	}
+
+	var sql strings.Builder
+	sql.WriteString("CREATE VIRTUAL TABLE ")
+	if ifNotExists {
+		sql.WriteString("IF NOT EXISTS ")
+	}
+	sql.WriteString(QuoteIdentifier(name))
+	sql.WriteString(" USING ")
+	sql.WriteString(QuoteIdentifier(name))
+	if len(args) > 0 {
+		var quoted = make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = quoteModuleArgument(arg)
+		}
+		sql.WriteString("(" + strings.Join(quoted, ", ") + ")")
+	}
+
+	return conn.Exec(sql.String(), nil)
+}
+
+// CreateVirtualTable registers module under the given name and then creates a virtual table, with the same name,
+// that uses it. See Conn.CreateVirtualTable for details.
+func (ext *ExtensionApi) CreateVirtualTable(name string, module Module, args []string, ifNotExists bool, opts ...func(*ModuleOptions)) error {
+	return ext.conn().CreateVirtualTable(name, module, args, ifNotExists, opts...)
+}
+
+// quoteModuleArgument quotes arg for use in the argument list of a CREATE VIRTUAL TABLE statement, if required
+func quoteModuleArgument(arg string) string {
+	var quote = func(s string) string {
+		if s == "" || strings.ContainsAny(s, ",()'\"`[];\n\r\t") {
+			return QuoteLiteral(s)
+		}
+		return s
+	}
+
+	if i := strings.IndexByte(arg, '='); i > 0 && !strings.ContainsAny(arg[:i], ",()'\"`[];") {
+		return arg[:i] + "=" + quote(arg[i+1:])
+	}
+	return quote(arg)
+}
@@ -0,0 +1,422 @@
+package sqlite_test
+
+import (
+	. "go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/vtabutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// ArgsModule is a virtual table module that returns the arguments it was created with as rows
+type ArgsModule struct{}
+
+func (m *ArgsModule) Create(c *Conn, args []string, declare func(string) error) (VirtualTable, error) {
+	return m.Connect(c, args, declare)
+}
+
+func (m *ArgsModule) Connect(_ *Conn, args []string, declare func(string) error) (VirtualTable, error) {
+	if err := declare("CREATE TABLE x(arg TEXT)"); err != nil {
+		return nil, err
+	}
+	return &ArgsTable{args: ParseCreationArgs(args).Options}, nil
+}
+
+type ArgsTable struct{ args []string }
+
+func (t *ArgsTable) BestIndex(_ *IndexInfoInput) (*IndexInfoOutput, error) {
+	return &IndexInfoOutput{EstimatedCost: 1}, nil
+}
+func (t *ArgsTable) Open() (VirtualCursor, error) { return &ArgsCursor{args: t.args}, nil }
+func (t *ArgsTable) Disconnect() error            { return nil }
+func (t *ArgsTable) Destroy() error               { return nil }
+
+type ArgsCursor struct {
+	args []string
+	pos  int
+}
+
+func (c *ArgsCursor) Filter(int, string, ...Value) error { c.pos = 0; return nil }
+func (c *ArgsCursor) Next() error                        { c.pos++; return nil }
+func (c *ArgsCursor) Rowid() (int64, error)              { return int64(c.pos), nil }
+func (c *ArgsCursor) Eof() bool                          { return c.pos >= len(c.args) }
+func (c *ArgsCursor) Close() error                       { return nil }
+func (c *ArgsCursor) Column(ctx *VirtualTableContext, _ int) error {
+	ctx.ResultText(c.args[c.pos])
+	return nil
+}
+
+func TestCreateVirtualTable(t *testing.T) {
+	var args = []string{"plain", "with, comma", "key=it's (quoted)"}
+
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		if err := api.CreateVirtualTable("my args", &ArgsModule{}, args, false); err != nil {
+			return SQLITE_ERROR, err
+		}
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT arg FROM "my args"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var arg string
+		if err = rows.Scan(&arg); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, arg)
+	}
+
+	var want = []string{"plain", "'with, comma'", "key='it''s (quoted)'"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected arguments %q, got %q", want, got)
+	}
+}
+
+// JournaledModule is a writeable virtual table module whose tables keep their rows in memory,
+// and revert them with vtabutil.Savepoints
+type JournaledModule struct{ table *JournaledTable }
+
+func (m *JournaledModule) Connect(_ *Conn, _ []string, declare func(string) error) (VirtualTable, error) {
+	m.table = &JournaledTable{rows: make(map[int64]string)}
+	m.table.Journal = m.table
+	return m.table, declare("CREATE TABLE x(value TEXT)")
+}
+
+type JournaledTable struct {
+	vtabutil.Savepoints
+	rows    map[int64]string
+	next    int64
+	applied []interface{}
+}
+
+func (t *JournaledTable) BestIndex(_ *IndexInfoInput) (*IndexInfoOutput, error) {
+	return &IndexInfoOutput{EstimatedCost: 1}, nil
+}
+func (t *JournaledTable) Open() (VirtualCursor, error) {
+	var ids []int64
+	for id := range t.rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return &JournaledCursor{table: t, ids: ids}, nil
+}
+func (t *JournaledTable) Disconnect() error                    { return nil }
+func (t *JournaledTable) Destroy() error                       { return nil }
+func (t *JournaledTable) Update(_ Value, _ ...Value) error     { return SQLITE_READONLY }
+func (t *JournaledTable) Replace(_, _ Value, _ ...Value) error { return SQLITE_READONLY }
+func (t *JournaledTable) Delete(_ Value) error                 { return SQLITE_READONLY }
+func (t *JournaledTable) Insert(values ...Value) (int64, error) {
+	t.next++
+	t.rows[t.next] = values[0].Text()
+	return t.next, t.Record(t.next)
+}
+
+func (t *JournaledTable) Apply(changes []interface{}) error {
+	t.applied = append(t.applied, changes...)
+	return nil
+}
+
+func (t *JournaledTable) Undo(changes []interface{}) error {
+	for _, id := range changes {
+		delete(t.rows, id.(int64))
+	}
+	return nil
+}
+
+type JournaledCursor struct {
+	table *JournaledTable
+	ids   []int64
+	pos   int
+}
+
+func (c *JournaledCursor) Filter(int, string, ...Value) error { c.pos = 0; return nil }
+func (c *JournaledCursor) Next() error                        { c.pos++; return nil }
+func (c *JournaledCursor) Rowid() (int64, error)              { return c.ids[c.pos], nil }
+func (c *JournaledCursor) Eof() bool                          { return c.pos >= len(c.ids) }
+func (c *JournaledCursor) Close() error                       { return nil }
+func (c *JournaledCursor) Column(ctx *VirtualTableContext, _ int) error {
+	ctx.ResultText(c.table.rows[c.ids[c.pos]])
+	return nil
+}
+
+func TestSavepointer(t *testing.T) {
+	var module = &JournaledModule{}
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		if err := api.CreateModule("journaled", module, ReadOnly(false), Savepoints(true)); err != nil {
+			return SQLITE_ERROR, err
+		}
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var script = `
+		CREATE VIRTUAL TABLE logs USING journaled;
+		BEGIN;
+			INSERT INTO logs VALUES ('one');
+			SAVEPOINT a;
+				INSERT INTO logs VALUES ('two');
+				SAVEPOINT b;
+					INSERT INTO logs VALUES ('three');
+				RELEASE b;
+			ROLLBACK TO a;
+			INSERT INTO logs VALUES ('four');
+		COMMIT;`
+	if _, err = db.Exec(script); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("SELECT value FROM logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var value string
+		if err = rows.Scan(&value); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, value)
+	}
+
+	if want := []string{"one", "four"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected rows %q, got %q", want, got)
+	}
+	if want := []interface{}{int64(1), int64(4)}; !reflect.DeepEqual(module.table.applied, want) {
+		t.Fatalf("expected changes %v to be applied, got %v", want, module.table.applied)
+	}
+}
+
+func TestParseCreationArgs(t *testing.T) {
+	var tests = []struct {
+		args []string
+		want CreationArgs
+	}{
+		{[]string{"csv", "main", "data", "file='data.csv'", "header=yes"},
+			CreationArgs{Module: "csv", Schema: "main", Table: "data", Options: []string{"file='data.csv'", "header=yes"}}},
+		{[]string{"series", "temp", "series"}, CreationArgs{Module: "series", Schema: "temp", Table: "series"}},
+		{nil, CreationArgs{}},
+	}
+
+	for _, test := range tests {
+		if got := ParseCreationArgs(test.args); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseCreationArgs(%q) = %+v, want %+v", test.args, got, test.want)
+		}
+	}
+}
+
+// TypedModule is a virtual table module whose tables have a single row, with the schema and values
+// configured for the table's name
+type TypedModule struct {
+	tables map[string]struct {
+		schema string
+		values []interface{}
+	}
+}
+
+func (m *TypedModule) Connect(_ *Conn, args []string, declare func(string) error) (VirtualTable, error) {
+	var table = m.tables[ParseCreationArgs(args).Table]
+	return &TypedTable{values: table.values}, declare(table.schema)
+}
+
+type TypedTable struct{ values []interface{} }
+
+func (t *TypedTable) BestIndex(_ *IndexInfoInput) (*IndexInfoOutput, error) {
+	return &IndexInfoOutput{EstimatedCost: 1}, nil
+}
+func (t *TypedTable) Open() (VirtualCursor, error) { return &TypedCursor{values: t.values}, nil }
+func (t *TypedTable) Disconnect() error            { return nil }
+func (t *TypedTable) Destroy() error               { return nil }
+
+type TypedCursor struct {
+	values []interface{}
+	eof    bool
+}
+
+func (c *TypedCursor) Filter(int, string, ...Value) error { c.eof = false; return nil }
+func (c *TypedCursor) Next() error                        { c.eof = true; return nil }
+func (c *TypedCursor) Rowid() (int64, error)              { return 1, nil }
+func (c *TypedCursor) Eof() bool                          { return c.eof }
+func (c *TypedCursor) Close() error                       { return nil }
+func (c *TypedCursor) Column(ctx *VirtualTableContext, i int) error {
+	return ctx.Result(c.values[i])
+}
+
+func TestStrict(t *testing.T) {
+	type table = struct {
+		schema string
+		values []interface{}
+	}
+
+	var module = &TypedModule{tables: map[string]table{
+		"valid":     {"CREATE TABLE x(a INTEGER, b TEXT, c REAL, d NUMERIC, e)", []interface{}{1, "text", 2, 2.5, []byte("blob")}},
+		"mistyped":  {"CREATE TABLE x(a INTEGER, b VARCHAR(10))", []interface{}{1, 2}},
+		"not_null":  {"CREATE TABLE x(a INTEGER, b TEXT NOT NULL)", []interface{}{1, nil}},
+		"strict":    {"CREATE TABLE x(a INT, b BLOB, c ANY) STRICT", []interface{}{1, []byte("blob"), "any"}},
+		"strict_ko": {"CREATE TABLE x(a INT, b BLOB) STRICT", []interface{}{1, "text"}},
+		"unknown":   {"CREATE TABLE x(a INT, b VARCHAR(10)) STRICT", nil},
+	}}
+
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		if err := api.CreateModule("typed", module); err != nil {
+			return SQLITE_ERROR, err
+		}
+		if err := api.CreateModule("strict_typed", module, Strict(true)); err != nil {
+			return SQLITE_ERROR, err
+		}
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var query = func(table string) error {
+		var rows, err = db.Query("SELECT * FROM " + table)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+		}
+		return rows.Err()
+	}
+
+	for name := range module.tables {
+		if name == "unknown" {
+			continue
+		}
+		if _, err = db.Exec("CREATE VIRTUAL TABLE " + name + " USING strict_typed"); err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+	}
+
+	var tests = []struct{ table, err string }{
+		{"valid", ""},
+		{"strict", ""},
+		{"mistyped", "cannot store INTEGER value in VARCHAR(10) column mistyped.b"},
+		{"not_null", "NOT NULL constraint failed: not_null.b"},
+		{"strict_ko", "cannot store TEXT value in BLOB column strict_ko.b"},
+	}
+	for _, test := range tests {
+		if err = query(test.table); test.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.table, err)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: expected error %q, got %v", test.table, test.err, err)
+		}
+	}
+
+	if _, err = db.Exec("CREATE VIRTUAL TABLE unknown USING strict_typed"); err == nil || !strings.Contains(err.Error(), "unknown datatype") {
+		t.Fatalf("expected an error for an unknown datatype in a strict declaration, got %v", err)
+	}
+
+	// without the option, mistyped values go through
+	module.tables["lax"] = module.tables["mistyped"]
+	if _, err = db.Exec("CREATE VIRTUAL TABLE lax USING typed"); err != nil {
+		t.Fatal(err)
+	}
+	if err = query("lax"); err != nil {
+		t.Fatalf("expected no error without the Strict option, got %v", err)
+	}
+}
+
+// PooledModule is an eponymous virtual table module that counts the cursors its tables open, reset and close
+type PooledModule struct{ opened, reset, closed int }
+
+func (m *PooledModule) Connect(_ *Conn, _ []string, declare func(string) error) (VirtualTable, error) {
+	return &PooledTable{module: m}, declare("CREATE TABLE x(value INTEGER)")
+}
+
+type PooledTable struct{ module *PooledModule }
+
+func (t *PooledTable) BestIndex(_ *IndexInfoInput) (*IndexInfoOutput, error) {
+	return &IndexInfoOutput{EstimatedCost: 1}, nil
+}
+func (t *PooledTable) Open() (VirtualCursor, error) {
+	t.module.opened++
+	return &PooledCursor{module: t.module}, nil
+}
+func (t *PooledTable) Disconnect() error { return nil }
+func (t *PooledTable) Destroy() error    { return nil }
+
+type PooledCursor struct {
+	module *PooledModule
+	pos    int
+}
+
+func (c *PooledCursor) Filter(int, string, ...Value) error { c.pos = 0; return nil }
+func (c *PooledCursor) Next() error                        { c.pos++; return nil }
+func (c *PooledCursor) Rowid() (int64, error)              { return int64(c.pos), nil }
+func (c *PooledCursor) Eof() bool                          { return c.pos >= 3 }
+func (c *PooledCursor) Reset() error                       { c.module.reset++; return nil }
+func (c *PooledCursor) Close() error                       { c.module.closed++; return nil }
+func (c *PooledCursor) Column(ctx *VirtualTableContext, _ int) error {
+	ctx.ResultInt(c.pos)
+	return nil
+}
+
+func TestCursorPool(t *testing.T) {
+	var module = &PooledModule{}
+	Register(func(api *ExtensionApi) (ErrorCode, error) {
+		if err := api.CreateModule("pooled", module, EponymousOnly(true), CursorPool(2)); err != nil {
+			return SQLITE_ERROR, err
+		}
+		return SQLITE_OK, nil
+	})
+
+	db, err := Connect(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+
+	for i := 0; i < 5; i++ {
+		var sum int
+		if err = db.QueryRow("SELECT SUM(value) FROM pooled").Scan(&sum); err != nil {
+			t.Fatal(err)
+		} else if sum != 3 {
+			t.Fatalf("expected sum of 3, got %d", sum)
+		}
+	}
+
+	if module.opened != 1 || module.reset != 5 || module.closed != 0 {
+		t.Fatalf("expected a single cursor to be reused, got opened=%d reset=%d closed=%d", module.opened, module.reset, module.closed)
+	}
+
+	// a self-join needs two cursors at once, and the pool has room for both
+	var count int
+	if err = db.QueryRow("SELECT COUNT(*) FROM pooled a, pooled b").Scan(&count); err != nil || count != 9 {
+		t.Fatalf("expected 9 rows, got %d, %v", count, err)
+	}
+	if module.opened != 2 {
+		t.Fatalf("expected a second cursor to be opened, got opened=%d", module.opened)
+	}
+
+	// pooled cursors are closed along with the connection
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if module.closed != 2 {
+		t.Fatalf("expected pooled cursors to be closed, got closed=%d", module.closed)
+	}
+}
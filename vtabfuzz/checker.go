@@ -0,0 +1,192 @@
+//go:build static
+// +build static
+
+package vtabfuzz
+
+import (
+	"fmt"
+	"go.riyazali.net/sqlite"
+	"math"
+	"runtime/debug"
+	"sync/atomic"
+	"testing"
+)
+
+// checker wraps the module, and the tables and cursors it creates, and checks the invariants of every call
+type checker struct {
+	t       testing.TB
+	current string // query being run; included in reports
+	cursors int64  // number of open cursors
+}
+
+// fail reports a violation of an invariant
+func (c *checker) fail(format string, args ...interface{}) {
+	c.t.Errorf("vtabfuzz: %s (while running %q)", fmt.Sprintf(format, args...), c.current)
+}
+
+// recover reports a panic in the named method and turns it into an error; it must be deferred
+func (c *checker) recover(method string, err *error) {
+	if r := recover(); r != nil {
+		c.fail("%s panicked: %v\n%s", method, r, debug.Stack())
+		if err != nil {
+			*err = fmt.Errorf("vtabfuzz: %s panicked: %v", method, r)
+		}
+	}
+}
+
+func (c *checker) module(module sqlite.Module) sqlite.Module {
+	if stateful, ok := module.(sqlite.StatefulModule); ok {
+		return &checkedStatefulModule{checkedModule{c, module}, stateful}
+	}
+	return &checkedModule{c, module}
+}
+
+type checkedModule struct {
+	*checker
+	module sqlite.Module
+}
+
+func (m *checkedModule) Connect(conn *sqlite.Conn, args []string, declare func(string) error) (_ sqlite.VirtualTable, err error) {
+	defer m.recover("Connect", &err)
+	table, err := m.module.Connect(conn, args, declare)
+	if err != nil {
+		return nil, err
+	}
+	return &checkedTable{m.checker, table}, nil
+}
+
+type checkedStatefulModule struct {
+	checkedModule
+	stateful sqlite.StatefulModule
+}
+
+func (m *checkedStatefulModule) Create(conn *sqlite.Conn, args []string, declare func(string) error) (_ sqlite.VirtualTable, err error) {
+	defer m.recover("Create", &err)
+	table, err := m.stateful.Create(conn, args, declare)
+	if err != nil {
+		return nil, err
+	}
+	return &checkedTable{m.checker, table}, nil
+}
+
+type checkedTable struct {
+	*checker
+	table sqlite.VirtualTable
+}
+
+func (t *checkedTable) BestIndex(input *sqlite.IndexInfoInput) (output *sqlite.IndexInfoOutput, err error) {
+	defer t.recover("BestIndex", &err)
+	if output, err = t.table.BestIndex(input); err != nil || output == nil {
+		return output, err
+	}
+
+	if len(output.ConstraintUsage) > len(input.Constraints) {
+		t.fail("BestIndex returned usage for %d constraints, but only %d were given", len(output.ConstraintUsage), len(input.Constraints))
+		return nil, sqlite.SQLITE_ERROR
+	}
+
+	var seen = make(map[int]bool)
+	var largest = 0
+	for i, usage := range output.ConstraintUsage {
+		if usage == nil || usage.ArgvIndex == 0 {
+			continue
+		}
+		switch {
+		case usage.ArgvIndex < 0:
+			t.fail("BestIndex returned negative ArgvIndex %d for constraint %d", usage.ArgvIndex, i)
+		case !input.Constraints[i].Usable:
+			t.fail("BestIndex returned ArgvIndex %d for unusable constraint %d", usage.ArgvIndex, i)
+		case seen[usage.ArgvIndex]:
+			t.fail("BestIndex returned ArgvIndex %d for more than one constraint", usage.ArgvIndex)
+		}
+		seen[usage.ArgvIndex] = true
+		if usage.ArgvIndex > largest {
+			largest = usage.ArgvIndex
+		}
+	}
+	if len(seen) != largest {
+		t.fail("BestIndex returned ArgvIndex values with gaps: %d values, largest is %d", len(seen), largest)
+	}
+
+	if math.IsNaN(output.EstimatedCost) || output.EstimatedCost < 0 {
+		t.fail("BestIndex returned invalid EstimatedCost %v", output.EstimatedCost)
+	}
+	return output, nil
+}
+
+func (t *checkedTable) Open() (_ sqlite.VirtualCursor, err error) {
+	defer t.recover("Open", &err)
+	cursor, err := t.table.Open()
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&t.cursors, 1)
+	return &checkedCursor{checker: t.checker, cursor: cursor}, nil
+}
+
+func (t *checkedTable) Disconnect() (err error) {
+	defer t.recover("Disconnect", &err)
+	return t.table.Disconnect()
+}
+
+func (t *checkedTable) Destroy() (err error) {
+	defer t.recover("Destroy", &err)
+	return t.table.Destroy()
+}
+
+type checkedCursor struct {
+	*checker
+	cursor sqlite.VirtualCursor
+	closed bool
+}
+
+func (c *checkedCursor) Filter(num int, str string, values ...sqlite.Value) (err error) {
+	defer c.recover("Filter", &err)
+	return c.cursor.Filter(num, str, values...)
+}
+
+func (c *checkedCursor) Next() (err error) {
+	defer c.recover("Next", &err)
+	return c.cursor.Next()
+}
+
+func (c *checkedCursor) Rowid() (rowid int64, err error) {
+	defer c.recover("Rowid", &err)
+	if rowid, err = c.cursor.Rowid(); err != nil {
+		return rowid, err
+	}
+	if again, err := c.cursor.Rowid(); err == nil && again != rowid {
+		c.fail("Rowid returned %d and then %d for the same row", rowid, again)
+	}
+	return rowid, nil
+}
+
+func (c *checkedCursor) Column(ctx *sqlite.VirtualTableContext, i int) (err error) {
+	defer c.recover("Column", &err)
+	return c.cursor.Column(ctx, i)
+}
+
+func (c *checkedCursor) Eof() (eof bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.fail("Eof panicked: %v\n%s", r, debug.Stack())
+			eof = true
+		}
+	}()
+
+	if eof = c.cursor.Eof(); eof != c.cursor.Eof() {
+		c.fail("Eof returned different values when called repeatedly on the same row")
+	}
+	return eof
+}
+
+func (c *checkedCursor) Close() (err error) {
+	defer c.recover("Close", &err)
+	if c.closed {
+		c.fail("Close called more than once on the same cursor")
+		return nil
+	}
+	c.closed = true
+	atomic.AddInt64(&c.cursors, -1)
+	return c.cursor.Close()
+}
@@ -0,0 +1,380 @@
+//go:build static
+// +build static
+
+// Package vtabfuzz provides a harness that exercises virtual table modules built with go.riyazali.net/sqlite
+// with randomly generated queries, to catch crashes and misbehaving modules before they are released.
+//
+// Run registers the module with a test database (see package sqlitetest), takes a snapshot of the table's contents
+// into a regular table and then runs randomly generated queries, with varying constraints, ordering and limits,
+// against both of them. It reports:
+//
+//   - panics in any of the module's methods
+//   - BestIndex outputs that sqlite would reject (eg. ConstraintUsage for unusable constraints or gaps in ArgvIndex)
+//   - Eof or Rowid returning different values when called repeatedly on the same row
+//   - rows with duplicate rowids, or rowids that map to different rows across scans
+//   - results that differ from the snapshot's, eg. when a constraint is omitted but not applied by the module,
+//     or when the output is claimed to be ordered but isn't
+//   - cursors that are not closed
+//
+// Queries that fail with an error aren't reported, as modules may legitimately reject some query plans.
+// Constraints on hidden columns (eg. arguments to table-valued functions) are only checked for the above
+// invariants, as the snapshot doesn't contain them.
+//
+// Like sqlitetest, the package requires the static and sqlite_vtable build tags.
+package vtabfuzz
+
+import (
+	"fmt"
+	"go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/sqlitetest"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// Options represents the various options that affect how a module is fuzzed
+type Options struct {
+	Args          []string                      // arguments passed to CREATE VIRTUAL TABLE; if nil, eponymous modules are queried directly
+	Iterations    int                           // number of queries to generate; defaults to 200
+	Seed          int64                         // seed for the random number generator; defaults to 1 so that runs are reproducible
+	Values        []interface{}                 // values used in constraints; defaults to a mix of NULL, integers, floats, text and blobs
+	ModuleOptions []func(*sqlite.ModuleOptions) // options used when registering the module
+}
+
+// WithArgs creates the table with CREATE VIRTUAL TABLE, passing the given arguments to the module
+func WithArgs(args ...string) func(*Options) {
+	return func(opt *Options) { opt.Args = append([]string{}, args...) }
+}
+
+// WithIterations sets the number of queries to generate
+func WithIterations(n int) func(*Options) {
+	return func(opt *Options) { opt.Iterations = n }
+}
+
+// WithSeed sets the seed for the random number generator
+func WithSeed(seed int64) func(*Options) {
+	return func(opt *Options) { opt.Seed = seed }
+}
+
+// WithValues sets the values used in generated constraints
+func WithValues(values ...interface{}) func(*Options) {
+	return func(opt *Options) { opt.Values = values }
+}
+
+// WithModuleOptions sets the options used when registering the module
+func WithModuleOptions(opts ...func(*sqlite.ModuleOptions)) func(*Options) {
+	return func(opt *Options) { opt.ModuleOptions = append(opt.ModuleOptions, opts...) }
+}
+
+// defaultValues are used in generated constraints when no values are provided
+var defaultValues = []interface{}{
+	nil, int64(0), int64(1), int64(-1), int64(2), int64(10), int64(1) << 62, 0.5, -2.5,
+	"", "a", "abc", "%", "_b*", []byte{}, []byte{0x00, 0xff},
+}
+
+// operators used in generated constraints; unary ones have no placeholder
+var operators = []string{"=", "<", "<=", ">", ">=", "!=", "IS", "IS NOT", "LIKE", "GLOB", "IS NULL", "IS NOT NULL"}
+
+// counter used to register every module under a unique name
+var modules int64
+
+// Run fuzzes the module, reporting any violation as a test error.
+func Run(t testing.TB, module sqlite.Module, opts ...func(*Options)) {
+	t.Helper()
+
+	var options = &Options{Iterations: 200, Seed: 1, Values: defaultValues}
+	for _, f := range opts {
+		f(options)
+	}
+
+	var n = atomic.AddInt64(&modules, 1)
+	var extension, name = fmt.Sprintf("vtabfuzz-%d", n), fmt.Sprintf("vtabfuzz_module_%d", n)
+
+	var c = &checker{t: t}
+	sqlite.RegisterNamed(extension, func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateModule(name, c.module(module), options.ModuleOptions...); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+	defer sqlite.Unregister(extension)
+
+	var db = sqlitetest.Open(t, sqlitetest.WithExtensions(extension))
+
+	var table = name
+	if _, stateful := module.(sqlite.StatefulModule); stateful || options.Args != nil {
+		table = "vtabfuzz"
+		var query = fmt.Sprintf("CREATE VIRTUAL TABLE %s USING %s", table, name)
+		if len(options.Args) > 0 {
+			query += "(" + strings.Join(options.Args, ", ") + ")"
+		}
+		db.MustExec(query)
+	}
+
+	var f = &fuzzer{checker: c, db: db, table: table, options: options, rnd: rand.New(rand.NewSource(options.Seed))}
+	f.columns()
+	f.snapshot()
+
+	for i := 0; i < options.Iterations && !t.Failed(); i++ {
+		f.run()
+	}
+}
+
+// fuzzer generates queries against the virtual table and compares them with the snapshot
+type fuzzer struct {
+	*checker
+	db      *sqlitetest.DB
+	table   string
+	options *Options
+	rnd     *rand.Rand
+
+	visible []string // names of the columns returned by SELECT *
+	hidden  []string // names of the hidden columns
+	rowid   bool     // whether the table has a rowid
+	snapped bool     // whether the snapshot could be taken; if not, results aren't compared
+}
+
+// snapshotTable is the name of the regular table that holds a copy of the virtual table's contents
+const snapshotTable = "temp.vtabfuzz_snapshot"
+
+// columns discovers the names of the visible and hidden columns of the table
+func (f *fuzzer) columns() {
+	f.t.Helper()
+
+	for _, row := range f.db.QueryRows("SELECT name, hidden FROM pragma_table_xinfo(?)", f.table) {
+		if row[1].(int64) == 0 {
+			f.visible = append(f.visible, row[0].(string))
+		} else {
+			f.hidden = append(f.hidden, row[0].(string))
+		}
+	}
+
+	if len(f.visible) == 0 {
+		f.t.Fatalf("vtabfuzz: table %s has no columns", f.table)
+	}
+}
+
+// snapshot copies the contents of the table into snapshotTable and checks rowids are unique and stable.
+// If the table cannot be scanned without constraints (eg. a table-valued function with required arguments)
+// no snapshot is taken.
+func (f *fuzzer) snapshot() {
+	f.t.Helper()
+
+	var columns = quoteAll(f.visible)
+	var query = fmt.Sprintf("CREATE TABLE %s AS SELECT rowid AS vtabfuzz_rowid, %s FROM %s", snapshotTable, columns, f.table)
+	if _, err := f.db.Exec(query); err == nil {
+		f.snapped, f.rowid = true, true
+	} else {
+		query = fmt.Sprintf("CREATE TABLE %s AS SELECT %s FROM %s", snapshotTable, columns, f.table)
+		if _, err = f.db.Exec(query); err != nil {
+			f.t.Logf("vtabfuzz: cannot take snapshot of %s, results won't be compared: %v", f.table, err)
+			return
+		}
+		f.snapped = true
+	}
+
+	if !f.rowid {
+		return
+	}
+
+	var duplicates = f.db.QueryRows(fmt.Sprintf("SELECT vtabfuzz_rowid FROM %s GROUP BY 1 HAVING COUNT(*) > 1", snapshotTable))
+	for _, row := range duplicates {
+		f.fail("rowid %v is returned for more than one row", row[0])
+	}
+
+	// a second scan must return the same rows for the same rowids
+	var got, err = f.query(fmt.Sprintf("SELECT rowid, %s FROM %s", columns, f.table))
+	if err != nil {
+		f.fail("second scan of %s failed: %v", f.table, err)
+		return
+	}
+	var want, _ = f.query(fmt.Sprintf("SELECT vtabfuzz_rowid, %s FROM %s", columns, snapshotTable))
+	if !equal(sorted(got), sorted(want)) {
+		f.fail("rowids are not stable across scans: first scan returned %v, second scan returned %v", want, got)
+	}
+}
+
+// run generates and runs a single query
+func (f *fuzzer) run() {
+	var where []string
+	var args []interface{}
+	var compare = f.snapped
+
+	var candidates = f.visible
+	if f.rowid {
+		candidates = append(append([]string{}, candidates...), "rowid")
+	}
+
+	for i, n := 0, f.rnd.Intn(4); i < n; i++ {
+		var column string
+		if len(f.hidden) > 0 && f.rnd.Intn(2) == 0 {
+			column, compare = f.hidden[f.rnd.Intn(len(f.hidden))], false
+		} else {
+			column = candidates[f.rnd.Intn(len(candidates))]
+		}
+
+		var op = operators[f.rnd.Intn(len(operators))]
+		if strings.HasSuffix(op, "NULL") {
+			where = append(where, fmt.Sprintf("%s %s", quote(column), op))
+		} else {
+			where = append(where, fmt.Sprintf("%s %s ?", quote(column), op))
+			args = append(args, f.options.Values[f.rnd.Intn(len(f.options.Values))])
+		}
+	}
+
+	var clauses string
+	if len(where) > 0 {
+		clauses += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var order = -1
+	if f.rnd.Intn(2) == 0 {
+		order = f.rnd.Intn(len(f.visible))
+		var direction = []string{"ASC", "DESC"}[f.rnd.Intn(2)]
+		clauses += fmt.Sprintf(" ORDER BY %s %s", quote(f.visible[order]), direction)
+	}
+
+	var limit = -1
+	if f.rnd.Intn(4) == 0 {
+		limit = f.rnd.Intn(5)
+		clauses += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	var columns = quoteAll(f.visible)
+	var query = fmt.Sprintf("SELECT %s FROM %s%s", columns, f.table, clauses)
+
+	var got, err = f.query(query, args...)
+	if err != nil || !compare {
+		return
+	}
+
+	var want, _ = f.query(fmt.Sprintf("SELECT %s FROM %s%s", columns, snapshotTable, clauses), args...)
+	switch {
+	case limit >= 0:
+		if len(got) > limit || !contains(sorted(want), sorted(got)) {
+			f.fail("query %q with %v returned %v, expected a subset of %v", query, args, got, want)
+		}
+	case !equal(sorted(got), sorted(want)):
+		f.fail("query %q with %v returned %v, expected %v", query, args, got, want)
+	case order >= 0 && !equal(columnValues(got, order), columnValues(want, order)):
+		f.fail("query %q with %v returned rows out of order: %v", query, args, got)
+	}
+}
+
+// query runs the query and returns its rows, formatted as strings
+func (f *fuzzer) query(query string, args ...interface{}) ([][]string, error) {
+	f.current = query
+
+	var rows, err = f.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var result [][]string
+	var columns, _ = rows.Columns()
+	for rows.Next() {
+		var values = make([]interface{}, len(columns))
+		var dest = make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			break
+		}
+
+		var row = make([]string, len(values))
+		for i, v := range values {
+			row[i] = format(v)
+		}
+		result = append(result, row)
+	}
+
+	if cerr := rows.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+
+	if open := atomic.LoadInt64(&f.cursors); open != 0 {
+		f.fail("%d cursor(s) not closed after the query completed", open)
+		atomic.StoreInt64(&f.cursors, 0)
+	}
+	return result, err
+}
+
+func format(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return fmt.Sprintf("x'%x'", v)
+	case string:
+		return sqlite.QuoteLiteral(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func quote(column string) string {
+	if column == "rowid" {
+		return column
+	}
+	return sqlite.QuoteIdentifier(column)
+}
+
+func quoteAll(columns []string) string {
+	var quoted = make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = quote(c)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// sorted returns the rows, joined into strings, in sorted order
+func sorted(rows [][]string) []string {
+	var result = make([]string, len(rows))
+	for i, row := range rows {
+		result[i] = strings.Join(row, " | ")
+	}
+	sort.Strings(result)
+	return result
+}
+
+// columnValues returns the values of the i-th column of the rows
+func columnValues(rows [][]string, i int) []string {
+	var result = make([]string, len(rows))
+	for j, row := range rows {
+		result[j] = row[i]
+	}
+	return result
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// contains reports whether every element of the sorted sub is present in the sorted set (respecting multiplicity)
+func contains(set, sub []string) bool {
+	var i = 0
+	for _, s := range sub {
+		for i < len(set) && set[i] < s {
+			i++
+		}
+		if i == len(set) || set[i] != s {
+			return false
+		}
+		i++
+	}
+	return true
+}
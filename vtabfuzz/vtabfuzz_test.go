@@ -0,0 +1,118 @@
+//go:build static
+// +build static
+
+package vtabfuzz_test
+
+import (
+	"fmt"
+	"go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/vtabfuzz"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// NumbersModule implements an eponymous virtual table with the numbers 1 to 20 and their labels.
+// If broken is set, equality constraints on value are omitted by BestIndex but ignored by the cursor.
+type NumbersModule struct{ broken bool }
+
+func (m *NumbersModule) Connect(_ *sqlite.Conn, _ []string, declare func(string) error) (sqlite.VirtualTable, error) {
+	return &NumbersTable{broken: m.broken}, declare("CREATE TABLE x(value INTEGER, label TEXT)")
+}
+
+type NumbersTable struct{ broken bool }
+
+func (t *NumbersTable) BestIndex(input *sqlite.IndexInfoInput) (*sqlite.IndexInfoOutput, error) {
+	var output = &sqlite.IndexInfoOutput{EstimatedCost: 20, ConstraintUsage: make([]*sqlite.ConstraintUsage, len(input.Constraints))}
+	for i, c := range input.Constraints {
+		if c.Usable && c.ColumnIndex == 0 && c.Op == sqlite.INDEX_CONSTRAINT_EQ {
+			output.ConstraintUsage[i] = &sqlite.ConstraintUsage{ArgvIndex: 1, Omit: true}
+			output.IndexNumber, output.EstimatedCost = 1, 1
+			break
+		}
+	}
+	return output, nil
+}
+
+func (t *NumbersTable) Open() (sqlite.VirtualCursor, error) {
+	return &NumbersCursor{broken: t.broken}, nil
+}
+func (t *NumbersTable) Disconnect() error { return nil }
+func (t *NumbersTable) Destroy() error    { return nil }
+
+type NumbersCursor struct {
+	broken  bool
+	current int64
+	last    int64
+}
+
+func (c *NumbersCursor) Filter(idx int, _ string, values ...sqlite.Value) error {
+	c.current, c.last = 1, 20
+	if idx == 1 && !c.broken {
+		if values[0].Type() != sqlite.SQLITE_INTEGER {
+			c.current, c.last = 1, 0 // values of other types never match the INTEGER column
+		} else {
+			c.current, c.last = values[0].Int64(), values[0].Int64()
+		}
+	}
+	return nil
+}
+
+func (c *NumbersCursor) Next() error           { c.current++; return nil }
+func (c *NumbersCursor) Rowid() (int64, error) { return c.current, nil }
+func (c *NumbersCursor) Eof() bool             { return c.current < 1 || c.current > c.last || c.current > 20 }
+func (c *NumbersCursor) Close() error          { return nil }
+func (c *NumbersCursor) Column(ctx *sqlite.VirtualTableContext, i int) error {
+	if i == 0 {
+		ctx.ResultInt64(c.current)
+	} else {
+		ctx.ResultText(fmt.Sprintf("n%d", c.current))
+	}
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	vtabfuzz.Run(t, &NumbersModule{}, vtabfuzz.WithIterations(100))
+}
+
+// recorder is a testing.TB that records errors instead of failing the test
+type recorder struct {
+	testing.TB
+	mu     sync.Mutex
+	errors []string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+func (r *recorder) Failed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.errors) > 0
+}
+
+func TestRun_Broken(t *testing.T) {
+	var r = &recorder{TB: t}
+
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+		vtabfuzz.Run(r, &NumbersModule{broken: true}, vtabfuzz.WithIterations(100))
+	}()
+	<-done
+
+	if len(r.errors) == 0 {
+		t.Fatal("expected the broken module to be reported")
+	} else if !strings.Contains(r.errors[0], "expected") {
+		t.Fatalf("unexpected report: %s", r.errors[0])
+	}
+}
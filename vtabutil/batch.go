@@ -0,0 +1,165 @@
+package vtabutil
+
+import (
+	"go.riyazali.net/sqlite"
+)
+
+// Op is the kind of change a Write makes
+type Op int
+
+const (
+	OpInsert Op = iota + 1
+	OpUpdate
+	OpDelete
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpInsert:
+		return "INSERT"
+	case OpUpdate:
+		return "UPDATE"
+	case OpDelete:
+		return "DELETE"
+	}
+	return "UNKNOWN"
+}
+
+// Write is an Insert, Update, Replace or Delete collected by BatchWriter
+type Write struct {
+	Op Op
+
+	// Rowid is the rowid (or primary key) of the row being updated or deleted, or the rowid
+	// returned by NextRowid for inserted rows
+	Rowid interface{}
+
+	// NewRowid is the new rowid of a row whose rowid is changed by an update, and equals Rowid otherwise
+	NewRowid interface{}
+
+	// Values are the values of the row's columns for inserts and updates, as Go values:
+	// int64, float64, string, []byte or nil
+	Values []interface{}
+}
+
+// Flusher receives the writes collected by BatchWriter
+type Flusher interface {
+	// Flush writes the batch to the underlying store. It's invoked once per transaction, with the writes
+	// in the order they were made, and only if there are any. An error fails the commit.
+	Flush(writes []Write) error
+}
+
+// BatchWriter collects the writes made to a virtual table into an in-memory batch that's handed to the Flusher
+// when the transaction commits, and discarded when it's rolled back, which is how most tables backed by a remote
+// API want to operate. It's meant to be embedded in the table, providing the Insert, Update, Replace and Delete
+// methods of sqlite.WriteableVirtualTable along with the methods of sqlite.Savepointer and sqlite.TwoPhaseCommitter.
+// Register the module with sqlite.ReadOnly(false) and sqlite.Savepoints(true):
+//
+//	type IssuesTable struct {
+//		vtabutil.FullScanTable
+//		vtabutil.BatchWriter
+//	}
+//
+// The batch is flushed on Sync when the module is also registered with sqlite.TwoPhaseCommit(true), so that
+// a failing flush rolls back the transaction on every table it spans, and on Commit otherwise.
+// Writes to a savepoint that's rolled back are dropped from the batch.
+//
+// Pending writes are not visible to the table's cursors until they are flushed.
+type BatchWriter struct {
+	Flusher Flusher // receives the batches; must be set before the table is used
+
+	// NextRowid returns the rowid of an inserted row, which becomes sqlite3_last_insert_rowid().
+	// If it's not set, inserted rows are given a rowid of 0, and tables must take their
+	// key from the values instead.
+	NextRowid func(values []interface{}) (int64, error)
+
+	savepoints Savepoints
+}
+
+// Insert collects the insertion of a row
+func (w *BatchWriter) Insert(values ...sqlite.Value) (rowid int64, err error) {
+	var row = goValues(values)
+	if w.NextRowid != nil {
+		if rowid, err = w.NextRowid(row); err != nil {
+			return 0, err
+		}
+	}
+	return rowid, w.record(Write{Op: OpInsert, Rowid: rowid, NewRowid: rowid, Values: row})
+}
+
+// Update collects the update of the row identified by rowid
+func (w *BatchWriter) Update(rowid sqlite.Value, values ...sqlite.Value) error {
+	var id = goValue(rowid)
+	return w.record(Write{Op: OpUpdate, Rowid: id, NewRowid: id, Values: goValues(values)})
+}
+
+// Replace collects the update of the row identified by old, that changes its rowid to new
+func (w *BatchWriter) Replace(old, new sqlite.Value, values ...sqlite.Value) error {
+	return w.record(Write{Op: OpUpdate, Rowid: goValue(old), NewRowid: goValue(new), Values: goValues(values)})
+}
+
+// Delete collects the deletion of the row identified by rowid
+func (w *BatchWriter) Delete(rowid sqlite.Value) error {
+	var id = goValue(rowid)
+	return w.record(Write{Op: OpDelete, Rowid: id, NewRowid: id})
+}
+
+// Begin starts a new batch
+func (w *BatchWriter) Begin() error {
+	w.savepoints.Journal = (*batchJournal)(w)
+	return w.savepoints.Begin()
+}
+
+// Sync flushes the batch, ahead of Commit
+func (w *BatchWriter) Sync() error { return w.savepoints.Commit() }
+
+// Commit flushes the batch, unless Sync did already
+func (w *BatchWriter) Commit() error { return w.savepoints.Commit() }
+
+// Rollback discards the batch. It cannot undo a batch flushed by Sync.
+func (w *BatchWriter) Rollback() error { return w.savepoints.Rollback() }
+
+func (w *BatchWriter) Savepoint(n int) error  { return w.savepoints.Savepoint(n) }
+func (w *BatchWriter) Release(n int) error    { return w.savepoints.Release(n) }
+func (w *BatchWriter) RollbackTo(n int) error { return w.savepoints.RollbackTo(n) }
+
+// Pending returns the number of writes in the current batch
+func (w *BatchWriter) Pending() int { return w.savepoints.Pending() }
+
+func (w *BatchWriter) record(write Write) error { return w.savepoints.Record(write) }
+
+// batchJournal is the Journal of a BatchWriter's savepoints, flushing the batch on Apply.
+// Writes are only ever applied on flush, so there's nothing to Undo.
+type batchJournal BatchWriter
+
+func (j *batchJournal) Apply(changes []interface{}) error {
+	var writes = make([]Write, len(changes))
+	for i, change := range changes {
+		writes[i] = change.(Write)
+	}
+	return j.Flusher.Flush(writes)
+}
+
+func (j *batchJournal) Undo(_ []interface{}) error { return nil }
+
+// goValues copies values to Go values, as sqlite.Value only remains valid for the duration of the call
+func goValues(values []sqlite.Value) []interface{} {
+	var row = make([]interface{}, len(values))
+	for i, value := range values {
+		row[i] = goValue(value)
+	}
+	return row
+}
+
+func goValue(value sqlite.Value) interface{} {
+	switch value.Type() {
+	case sqlite.SQLITE_INTEGER:
+		return value.Int64()
+	case sqlite.SQLITE_FLOAT:
+		return value.Float()
+	case sqlite.SQLITE_TEXT:
+		return value.Text()
+	case sqlite.SQLITE_BLOB:
+		return value.Blob()
+	}
+	return nil
+}
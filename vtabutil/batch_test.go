@@ -0,0 +1,88 @@
+//go:build static
+// +build static
+
+package vtabutil_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/sqlitetest"
+	"go.riyazali.net/sqlite/vtabutil"
+)
+
+// IssuesModule is a writeable virtual table module whose writes are batched and recorded by the module
+type IssuesModule struct {
+	batches [][]vtabutil.Write
+	fail    bool
+	next    int64
+}
+
+func (m *IssuesModule) Flush(writes []vtabutil.Write) error {
+	if m.fail {
+		return errors.New("remote unavailable")
+	}
+	m.batches = append(m.batches, writes)
+	return nil
+}
+
+func (m *IssuesModule) Connect(_ *sqlite.Conn, _ []string, declare func(string) error) (sqlite.VirtualTable, error) {
+	var table = &IssuesTable{}
+	table.Scan = func() (vtabutil.Iterator, error) { return vtabutil.Rows(nil), nil }
+	table.Flusher = m
+	table.NextRowid = func([]interface{}) (int64, error) { m.next++; return m.next, nil }
+	return table, declare("CREATE TABLE x(title TEXT, state TEXT)")
+}
+
+type IssuesTable struct {
+	vtabutil.FullScanTable
+	vtabutil.BatchWriter
+}
+
+func TestBatchWriter(t *testing.T) {
+	var module = &IssuesModule{}
+	sqlite.RegisterNamed("batch", func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		return sqlite.SQLITE_OK, api.CreateModule("issues", module,
+			sqlite.ReadOnly(false), sqlite.Savepoints(true), sqlite.TwoPhaseCommit(true))
+	})
+
+	var db = sqlitetest.Open(t, sqlitetest.WithExtensions("batch"))
+	db.MustExec("CREATE VIRTUAL TABLE issues USING issues")
+
+	// statements outside a transaction are flushed on their own
+	if id, _ := db.MustExec("INSERT INTO issues VALUES ('crash on start', 'open')").LastInsertId(); id != 1 {
+		t.Fatalf("expected rowid returned by NextRowid, got %d", id)
+	}
+
+	db.MustExec("BEGIN")
+	db.MustExec("INSERT INTO issues VALUES ('typo', 'open')")
+	db.MustExec("SAVEPOINT s")
+	db.MustExec("UPDATE issues SET state = 'closed' WHERE rowid = 2") // no rows to read; nothing is written
+	db.MustExec("INSERT INTO issues VALUES ('dropped', 'open')")
+	db.MustExec("ROLLBACK TO s")
+	db.MustExec("INSERT INTO issues VALUES ('kept', 'closed')")
+	db.MustExec("COMMIT")
+
+	db.MustExec("BEGIN")
+	db.MustExec("INSERT INTO issues VALUES ('discarded', 'open')")
+	db.MustExec("ROLLBACK")
+
+	var want = [][]vtabutil.Write{
+		{{Op: vtabutil.OpInsert, Rowid: int64(1), NewRowid: int64(1), Values: []interface{}{"crash on start", "open"}}},
+		{
+			{Op: vtabutil.OpInsert, Rowid: int64(2), NewRowid: int64(2), Values: []interface{}{"typo", "open"}},
+			{Op: vtabutil.OpInsert, Rowid: int64(4), NewRowid: int64(4), Values: []interface{}{"kept", "closed"}},
+		},
+	}
+	if !reflect.DeepEqual(module.batches, want) {
+		t.Fatalf("expected batches %v, got %v", want, module.batches)
+	}
+
+	module.fail = true
+	if _, err := db.Exec("INSERT INTO issues VALUES ('lost', 'open')"); err == nil || !strings.Contains(err.Error(), "remote unavailable") {
+		t.Fatalf("expected a failing flush to fail the statement, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package vtabutil
+
+import (
+	"go.riyazali.net/sqlite"
+)
+
+// Vector is a column of a Batch, such as an arrow.Array
+type Vector interface {
+	// IsNull reports whether the value at row i is NULL
+	IsNull(i int) bool
+
+	// Value returns the value at row i, as accepted by sqlite.Context.Result
+	Value(i int) interface{}
+}
+
+// Batch is a set of rows stored column by column, such as an arrow.Record
+type Batch interface {
+	NumRows() int64
+	NumCols() int64
+
+	// Column returns the column i of the batch
+	Column(i int) Vector
+}
+
+// BatchReader returns a stream of batches, following the protocol of arrow's array.RecordReader: Next advances
+// to the next batch and reports whether there is one, Batch returns it, and Err returns the error that stopped
+// Next early, if any. Release is invoked once the reader is no longer needed.
+type BatchReader interface {
+	Next() bool
+	Batch() Batch
+	Err() error
+	Release()
+}
+
+// ColumnarTable is a read-only virtual table over columnar data, such as Apache Arrow records. Like FullScanTable,
+// it answers every query with a full scan, but its cursor walks the rows of one batch at a time and reads each
+// column straight from its Vector, without assembling rows.
+//
+// The go.riyazali.net/sqlite/interop/arrow module adapts Arrow's records and readers, and provides a module
+// declaring the table from the records' schema.
+type ColumnarTable struct {
+	// Read returns a new BatchReader over the table's data; it's invoked at the start of every scan
+	Read func() (BatchReader, error)
+}
+
+// BestIndex picks a full scan, as ColumnarTable cannot make use of any constraint or ordering
+func (t *ColumnarTable) BestIndex(_ *sqlite.IndexInfoInput) (*sqlite.IndexInfoOutput, error) {
+	return &sqlite.IndexInfoOutput{EstimatedCost: 1000000}, nil
+}
+
+// Open returns a new cursor over the batches returned by Read
+func (t *ColumnarTable) Open() (sqlite.VirtualCursor, error) {
+	return &columnarCursor{read: t.Read}, nil
+}
+
+func (t *ColumnarTable) Disconnect() error { return nil }
+func (t *ColumnarTable) Destroy() error    { return nil }
+
+// columnarCursor walks the rows of the batches returned by a BatchReader, numbering them sequentially from 1
+type columnarCursor struct {
+	read   func() (BatchReader, error)
+	reader BatchReader
+	batch  Batch
+	row    int64 // position in batch
+	rowid  int64
+}
+
+func (c *columnarCursor) Filter(_ int, _ string, _ ...sqlite.Value) (err error) {
+	c.release()
+	if c.reader, err = c.read(); err != nil {
+		return err
+	}
+	c.rowid = 0
+	return c.advance()
+}
+
+func (c *columnarCursor) Next() error {
+	if c.row++; c.row < c.batch.NumRows() {
+		c.rowid++
+		return nil
+	}
+	return c.advance()
+}
+
+// advance moves the cursor to the first row of the next non-empty batch
+func (c *columnarCursor) advance() error {
+	for c.batch, c.row = nil, 0; c.reader.Next(); {
+		if batch := c.reader.Batch(); batch.NumRows() > 0 {
+			c.batch, c.rowid = batch, c.rowid+1
+			return nil
+		}
+	}
+	return c.reader.Err()
+}
+
+func (c *columnarCursor) Column(ctx *sqlite.VirtualTableContext, i int) error {
+	if int64(i) >= c.batch.NumCols() || i < 0 {
+		ctx.ResultNull()
+		return nil
+	}
+
+	var vector = c.batch.Column(i)
+	if vector == nil || vector.IsNull(int(c.row)) {
+		ctx.ResultNull()
+		return nil
+	}
+	return ctx.Result(vector.Value(int(c.row)))
+}
+
+func (c *columnarCursor) Rowid() (int64, error) { return c.rowid, nil }
+func (c *columnarCursor) Eof() bool             { return c.batch == nil }
+func (c *columnarCursor) Close() error          { c.release(); return nil }
+
+// Reset implements sqlite.ResettableCursor, so that modules built on ColumnarTable can be registered with sqlite.CursorPool
+func (c *columnarCursor) Reset() error { return c.Close() }
+
+func (c *columnarCursor) release() {
+	if c.reader != nil {
+		c.reader.Release()
+	}
+	c.reader, c.batch = nil, nil
+}
+
+// Batches returns a BatchReader over the given batches, for tables whose data is already in memory
+func Batches(batches ...Batch) BatchReader { return &batchReader{batches: batches, pos: -1} }
+
+type batchReader struct {
+	batches []Batch
+	pos     int
+}
+
+func (r *batchReader) Next() bool   { r.pos++; return r.pos < len(r.batches) }
+func (r *batchReader) Batch() Batch { return r.batches[r.pos] }
+func (r *batchReader) Err() error   { return nil }
+func (r *batchReader) Release()     {}
@@ -0,0 +1,92 @@
+//go:build static
+// +build static
+
+package vtabutil_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/sqlitetest"
+	"go.riyazali.net/sqlite/vtabutil"
+)
+
+// vector is a Vector over a slice, where nil values are NULL
+type vector []interface{}
+
+func (v vector) IsNull(i int) bool       { return v[i] == nil }
+func (v vector) Value(i int) interface{} { return v[i] }
+
+// batch is a Batch over a set of vectors of the same length
+type batch []vector
+
+func (b batch) NumRows() int64 {
+	if len(b) == 0 {
+		return 0
+	}
+	return int64(len(b[0]))
+}
+func (b batch) NumCols() int64               { return int64(len(b)) }
+func (b batch) Column(i int) vtabutil.Vector { return b[i] }
+
+// failingReader is a BatchReader that fails after its first batch
+type failingReader struct{ vtabutil.BatchReader }
+
+func (r failingReader) Err() error { return errors.New("stream interrupted") }
+
+// SensorsModule is a read-only virtual table module over a few batches of sensor readings
+type SensorsModule struct{}
+
+func (m *SensorsModule) Connect(_ *sqlite.Conn, args []string, declare func(string) error) (sqlite.VirtualTable, error) {
+	var read = func() (vtabutil.BatchReader, error) {
+		var batches = []vtabutil.Batch{
+			batch{{"a", "b"}, {1.5, nil}},
+			batch{{}, {}}, // empty batches are skipped
+			batch{{"c"}, {3.25}},
+		}
+		if sqlite.ParseCreationArgs(args).Table == "sensors_failing" {
+			return failingReader{vtabutil.Batches(batches[0])}, nil
+		}
+		return vtabutil.Batches(batches...), nil
+	}
+	return &vtabutil.ColumnarTable{Read: read}, declare("CREATE TABLE x(sensor TEXT, reading REAL, extra)")
+}
+
+func init() {
+	sqlite.RegisterNamed("columnar", func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateModule("sensors", &SensorsModule{}, sqlite.CursorPool(1)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func TestColumnarTable(t *testing.T) {
+	var db = sqlitetest.Open(t, sqlitetest.WithExtensions("columnar"))
+
+	var want = [][]interface{}{
+		{int64(1), "a", 1.5, nil},
+		{int64(2), "b", nil, nil},
+		{int64(3), "c", 3.25, nil},
+	}
+	for i := 0; i < 2; i++ { // the second scan reuses the pooled cursor
+		if got := db.QueryRows("SELECT rowid, sensor, reading, extra FROM sensors"); !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+
+	db.MustExec("CREATE VIRTUAL TABLE sensors_failing USING sensors")
+	var rows, err = db.Query("SELECT * FROM sensors_failing")
+	if err == nil {
+		for rows.Next() {
+		}
+		err = rows.Err()
+		_ = rows.Close()
+	}
+	if err == nil || !strings.Contains(err.Error(), "stream interrupted") {
+		t.Fatalf("expected the reader's error to fail the query, got %v", err)
+	}
+}
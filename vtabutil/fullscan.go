@@ -0,0 +1,94 @@
+package vtabutil
+
+import (
+	"io"
+
+	"go.riyazali.net/sqlite"
+)
+
+// Iterator returns the rows of a table one at a time. Each call returns the values of the next row's columns,
+// in the order they're declared in, or io.EOF once there are no more rows. The values are set as the result
+// of each column with sqlite.Context.Result; missing values are returned as NULL.
+type Iterator func() ([]interface{}, error)
+
+// FullScanTable is a read-only virtual table that answers every query with a full scan of the rows returned
+// by Scan, leaving it to sqlite to filter and sort them. It implements sqlite.VirtualTable and can be returned
+// as-is from a module's Connect, once the module has declared the table's schema:
+//
+//	func (m *EnvModule) Connect(_ *sqlite.Conn, _ []string, declare func(string) error) (sqlite.VirtualTable, error) {
+//		return &vtabutil.FullScanTable{Scan: environ}, declare("CREATE TABLE x(name TEXT, value TEXT)")
+//	}
+//
+// It can also be embedded in a table that overrides some of its methods, eg. Disconnect to release resources.
+type FullScanTable struct {
+	// Scan returns a new Iterator over the rows of the table; it's invoked at the start of every scan
+	Scan func() (Iterator, error)
+}
+
+// BestIndex picks a full scan, as FullScanTable cannot make use of any constraint or ordering
+func (t *FullScanTable) BestIndex(_ *sqlite.IndexInfoInput) (*sqlite.IndexInfoOutput, error) {
+	return &sqlite.IndexInfoOutput{EstimatedCost: 1000000}, nil
+}
+
+// Open returns a new cursor over the rows returned by Scan
+func (t *FullScanTable) Open() (sqlite.VirtualCursor, error) {
+	return &fullScanCursor{scan: t.Scan}, nil
+}
+
+func (t *FullScanTable) Disconnect() error { return nil }
+func (t *FullScanTable) Destroy() error    { return nil }
+
+// fullScanCursor iterates over the rows returned by an Iterator, numbering them sequentially from 1
+type fullScanCursor struct {
+	scan  func() (Iterator, error)
+	next  Iterator
+	row   []interface{}
+	rowid int64
+	eof   bool
+}
+
+func (c *fullScanCursor) Filter(_ int, _ string, _ ...sqlite.Value) (err error) {
+	if c.next, err = c.scan(); err != nil {
+		return err
+	}
+	c.rowid, c.eof = 0, false
+	return c.Next()
+}
+
+func (c *fullScanCursor) Next() (err error) {
+	if c.row, err = c.next(); err == io.EOF {
+		c.row, c.eof = nil, true
+		return nil
+	} else if err != nil {
+		return err
+	}
+	c.rowid++
+	return nil
+}
+
+func (c *fullScanCursor) Column(ctx *sqlite.VirtualTableContext, i int) error {
+	if i < 0 || i >= len(c.row) {
+		ctx.ResultNull()
+		return nil
+	}
+	return ctx.Result(c.row[i])
+}
+
+func (c *fullScanCursor) Rowid() (int64, error) { return c.rowid, nil }
+func (c *fullScanCursor) Eof() bool             { return c.eof }
+func (c *fullScanCursor) Close() error          { c.next, c.row = nil, nil; return nil }
+
+// Reset implements sqlite.ResettableCursor, so that modules built on FullScanTable can be registered with sqlite.CursorPool
+func (c *fullScanCursor) Reset() error { return c.Close() }
+
+// Rows returns an Iterator over the given rows, for tables whose rows are already in memory
+func Rows(rows [][]interface{}) Iterator {
+	var i = 0
+	return func() ([]interface{}, error) {
+		if i >= len(rows) {
+			return nil, io.EOF
+		}
+		i++
+		return rows[i-1], nil
+	}
+}
@@ -0,0 +1,53 @@
+//go:build static
+// +build static
+
+package vtabutil_test
+
+import (
+	"reflect"
+	"testing"
+
+	"go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/sqlitetest"
+	"go.riyazali.net/sqlite/vtabutil"
+)
+
+// PlanetsModule is a read-only virtual table module listing a few planets
+type PlanetsModule struct{}
+
+func (m *PlanetsModule) Connect(_ *sqlite.Conn, _ []string, declare func(string) error) (sqlite.VirtualTable, error) {
+	var scan = func() (vtabutil.Iterator, error) {
+		return vtabutil.Rows([][]interface{}{
+			{"mercury", 0, 0.38, false},
+			{"earth", 1, 1.0, true},
+			{"jupiter", 95, 11.2, nil},
+		}), nil
+	}
+	return &vtabutil.FullScanTable{Scan: scan}, declare("CREATE TABLE x(name TEXT, moons INT, radius REAL, habitable INT, extra)")
+}
+
+func init() {
+	sqlite.RegisterNamed("vtabutil", func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateModule("planets", &PlanetsModule{}, sqlite.EponymousOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func TestFullScanTable(t *testing.T) {
+	var db = sqlitetest.Open(t, sqlitetest.WithExtensions("vtabutil"))
+
+	var got = db.QueryRows("SELECT rowid, name, moons, radius, habitable, extra FROM planets WHERE moons > 0 ORDER BY name DESC")
+	var want = [][]interface{}{
+		{int64(3), "jupiter", int64(95), 11.2, nil, nil},
+		{int64(2), "earth", int64(1), 1.0, int64(1), nil},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	if row := db.QueryRow("SELECT COUNT(*) FROM planets"); row[0] != int64(3) {
+		t.Fatalf("expected every scan to start over, got %v rows", row[0])
+	}
+}
@@ -0,0 +1,419 @@
+package vtabutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"go.riyazali.net/sqlite"
+)
+
+// JSONModule is an eponymous table-valued function module that pivots a JSON document into rows, with the same
+// columns as sqlite's json_each and json_tree:
+//
+//	CREATE TABLE x(key, value, type, atom, id, parent, fullkey, path, json HIDDEN, root HIDDEN)
+//
+// The document is either JSON text or blob, or a Go value bound with Stmt.BindPointer (or returned by a function with
+// Context.ResultPointer), which is encoded with encoding/json first. The optional second argument is the path to
+// the element to start from, such as $.a[2].b:
+//
+//	api.CreateModule("go_each", &vtabutil.JSONModule{}, sqlite.EponymousOnly(true))
+//
+//	SELECT key, value FROM go_each(?, '$.tags')
+//
+// Ids are assigned to elements sequentially, in document order, with the document itself numbered 0.
+type JSONModule struct {
+	// Tree makes the table walk every element under the root recursively, like json_tree,
+	// instead of only its immediate children, like json_each.
+	Tree bool
+}
+
+// columns of the tables of JSONModule
+const (
+	jsonColumnKey = iota
+	jsonColumnValue
+	jsonColumnType
+	jsonColumnAtom
+	jsonColumnID
+	jsonColumnParent
+	jsonColumnFullKey
+	jsonColumnPath
+	jsonColumnJSON
+	jsonColumnRoot
+)
+
+func (m *JSONModule) Connect(_ *sqlite.Conn, _ []string, declare func(string) error) (sqlite.VirtualTable, error) {
+	const schema = "CREATE TABLE x(key, value, type, atom, id, parent, fullkey, path, json HIDDEN, root HIDDEN)"
+	return &jsonTable{tree: m.Tree}, declare(schema)
+}
+
+type jsonTable struct{ tree bool }
+
+// BestIndex requires an equality constraint on the json column, and uses the one on root if there's any.
+// The index number is a bitmask of the constraints passed on to Filter, in the order of the columns.
+func (t *jsonTable) BestIndex(input *sqlite.IndexInfoInput) (*sqlite.IndexInfoOutput, error) {
+	var output = &sqlite.IndexInfoOutput{ConstraintUsage: make([]*sqlite.ConstraintUsage, len(input.Constraints))}
+	var idx = [2]int{-1, -1}
+	for i, con := range input.Constraints {
+		if con.ColumnIndex < jsonColumnJSON || con.Op != sqlite.INDEX_CONSTRAINT_EQ {
+			continue
+		}
+		if !con.Usable {
+			return nil, sqlite.SQLITE_CONSTRAINT // the document and root are inputs; a plan without them is unusable
+		}
+		idx[con.ColumnIndex-jsonColumnJSON] = i
+	}
+
+	if idx[0] < 0 {
+		output.EstimatedCost = 1e99 // no document; there are no rows to return
+		return output, nil
+	}
+
+	var args = 0
+	for i, j := range idx {
+		if j >= 0 {
+			args++
+			output.IndexNumber |= 1 << i
+			output.ConstraintUsage[j] = &sqlite.ConstraintUsage{ArgvIndex: args, Omit: true}
+		}
+	}
+	output.EstimatedCost = 1
+	return output, nil
+}
+
+func (t *jsonTable) Open() (sqlite.VirtualCursor, error) { return &jsonCursor{tree: t.tree}, nil }
+func (t *jsonTable) Disconnect() error                   { return nil }
+func (t *jsonTable) Destroy() error                      { return nil }
+
+// jsonCursor walks over the rows produced from a document
+type jsonCursor struct {
+	tree bool
+	doc  *jsonNode
+	root string
+	top  *jsonNode // element at root
+	rows []*jsonNode
+	pos  int
+}
+
+func (c *jsonCursor) Filter(idxNum int, _ string, values ...sqlite.Value) (err error) {
+	c.doc, c.root, c.top, c.rows, c.pos = nil, "$", nil, nil, 0
+	if idxNum&1 == 0 {
+		return nil
+	}
+
+	if c.doc, err = decodeDocument(values[0]); err != nil || c.doc == nil {
+		return err
+	}
+	if idxNum&2 != 0 {
+		if values[1].IsNil() {
+			return nil
+		}
+		c.root = values[1].Text()
+	}
+
+	if c.top, err = c.doc.lookup(c.root); err != nil || c.top == nil {
+		return err
+	}
+
+	var id = 0
+	c.doc.number(&id)
+	if c.tree {
+		c.rows = c.top.flatten(nil)
+	} else if c.top.kind == '{' || c.top.kind == '[' {
+		c.rows = c.top.children
+	} else {
+		c.rows = []*jsonNode{c.top}
+	}
+	return nil
+}
+
+func (c *jsonCursor) Next() error           { c.pos++; return nil }
+func (c *jsonCursor) Eof() bool             { return c.pos >= len(c.rows) }
+func (c *jsonCursor) Rowid() (int64, error) { return int64(c.rows[c.pos].id), nil }
+func (c *jsonCursor) Close() error          { c.doc, c.top, c.rows = nil, nil, nil; return nil }
+
+// Reset implements sqlite.ResettableCursor, so that JSONModule can be registered with sqlite.CursorPool
+func (c *jsonCursor) Reset() error { return c.Close() }
+
+func (c *jsonCursor) Column(ctx *sqlite.VirtualTableContext, i int) error {
+	var node = c.rows[c.pos]
+	switch i {
+	case jsonColumnKey:
+		return ctx.Result(node.key)
+	case jsonColumnValue:
+		if node.kind == '{' || node.kind == '[' {
+			ctx.ResultText(node.String())
+			ctx.ResultSubType(sqlite.SUBTYPE_JSON)
+			return nil
+		}
+		return ctx.Result(node.atom())
+	case jsonColumnType:
+		ctx.ResultText(node.typeName())
+	case jsonColumnAtom:
+		return ctx.Result(node.atom())
+	case jsonColumnID:
+		ctx.ResultInt(node.id)
+	case jsonColumnParent:
+		if c.tree && node != c.top { // like json_each, rows have no parent unless walking the tree
+			ctx.ResultInt(node.parent.id)
+		}
+	case jsonColumnFullKey:
+		ctx.ResultText(node.path())
+	case jsonColumnPath:
+		if node.parent != nil {
+			ctx.ResultText(node.parent.path())
+		} else {
+			ctx.ResultText("$")
+		}
+	case jsonColumnJSON:
+		ctx.ResultText(c.doc.String())
+	case jsonColumnRoot:
+		ctx.ResultText(c.root)
+	}
+	return nil
+}
+
+// decodeDocument decodes the document passed as argument, or returns nil if it's NULL
+func decodeDocument(value sqlite.Value) (*jsonNode, error) {
+	var data []byte
+	if v := value.Pointer(); v != nil {
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("vtabutil: failed to encode %T: %v", v, err)
+		}
+	} else if value.IsNil() {
+		return nil, nil
+	} else {
+		data = value.Blob()
+	}
+
+	var dec = json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc, err = decodeNode(dec, nil, nil)
+	if err == nil {
+		if _, err = dec.Token(); err == io.EOF {
+			return doc, nil
+		}
+		err = fmt.Errorf("unexpected data after the document")
+	}
+	return nil, fmt.Errorf("vtabutil: malformed JSON: %v", err)
+}
+
+// jsonNode is an element of a JSON document, keeping the order of object members
+type jsonNode struct {
+	kind     byte        // one of '{', '[', 's' (string), 'n' (number), 'b' (bool) or 0 (null)
+	key      interface{} // member name (string) or array index (int64) in the parent, or nil for the document
+	value    interface{} // string, json.Number or bool for scalars
+	parent   *jsonNode
+	children []*jsonNode
+	id       int
+}
+
+func decodeNode(dec *json.Decoder, parent *jsonNode, key interface{}) (*jsonNode, error) {
+	var tok, err = dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	var node = &jsonNode{key: key, parent: parent}
+	switch v := tok.(type) {
+	case json.Delim:
+		node.kind = byte(v)
+		for i := int64(0); dec.More(); i++ {
+			var key interface{} = i
+			if node.kind == '{' {
+				if tok, err = dec.Token(); err != nil {
+					return nil, err
+				}
+				key = tok.(string)
+			}
+
+			var child *jsonNode
+			if child, err = decodeNode(dec, node, key); err != nil {
+				return nil, err
+			}
+			node.children = append(node.children, child)
+		}
+		if _, err = dec.Token(); err != nil { // closing delimiter
+			return nil, err
+		}
+	case string:
+		node.kind, node.value = 's', v
+	case json.Number:
+		node.kind, node.value = 'n', v
+	case bool:
+		node.kind, node.value = 'b', v
+	}
+	return node, nil
+}
+
+// number assigns ids to the node and its descendants in document order, starting at *id
+func (n *jsonNode) number(id *int) {
+	n.id = *id
+	*id++
+	for _, child := range n.children {
+		child.number(id)
+	}
+}
+
+// flatten appends the node and its descendants to rows, in document order
+func (n *jsonNode) flatten(rows []*jsonNode) []*jsonNode {
+	rows = append(rows, n)
+	for _, child := range n.children {
+		rows = child.flatten(rows)
+	}
+	return rows
+}
+
+// lookup returns the node at the given path, relative to n, or nil if there's no such node
+func (n *jsonNode) lookup(path string) (*jsonNode, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("vtabutil: bad JSON path: %q", path)
+	}
+
+	var node = n
+	for rest := path[1:]; rest != "" && node != nil; {
+		var key interface{}
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			var end = strings.IndexAny(rest, ".[")
+			if strings.HasPrefix(rest, `"`) {
+				end = strings.IndexByte(rest[1:], '"') + 2
+			}
+			if end < 0 {
+				end = len(rest)
+			}
+			key, rest = strings.Trim(rest[:end], `"`), rest[end:]
+		case '[':
+			var end = strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("vtabutil: bad JSON path: %q", path)
+			}
+			var i, err = strconv.ParseInt(rest[1:end], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("vtabutil: bad JSON path: %q", path)
+			}
+			key, rest = i, rest[end+1:]
+		default:
+			return nil, fmt.Errorf("vtabutil: bad JSON path: %q", path)
+		}
+
+		var next *jsonNode
+		for _, child := range node.children {
+			if child.key == key {
+				next = child
+				break
+			}
+		}
+		node = next
+	}
+	return node, nil
+}
+
+// path returns the full path to the node from the root of the document
+func (n *jsonNode) path() string {
+	if n.parent == nil && n.key == nil {
+		return "$"
+	}
+
+	var prefix = "$"
+	if n.parent != nil {
+		prefix = n.parent.path()
+	}
+	switch key := n.key.(type) {
+	case int64:
+		return prefix + "[" + strconv.FormatInt(key, 10) + "]"
+	case string:
+		if isPlainKey(key) {
+			return prefix + "." + key
+		}
+		return prefix + `."` + key + `"`
+	}
+	return prefix
+}
+
+// typeName returns the type of the node, as reported by json_type
+func (n *jsonNode) typeName() string {
+	switch n.kind {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 's':
+		return "text"
+	case 'n':
+		if _, err := n.value.(json.Number).Int64(); err == nil {
+			return "integer"
+		}
+		return "real"
+	case 'b':
+		if n.value.(bool) {
+			return "true"
+		}
+		return "false"
+	}
+	return "null"
+}
+
+// atom returns the value of a scalar node, or nil for containers and null
+func (n *jsonNode) atom() interface{} {
+	switch n.kind {
+	case 's', 'b':
+		return n.value
+	case 'n':
+		if i, err := n.value.(json.Number).Int64(); err == nil {
+			return i
+		}
+		var f, _ = n.value.(json.Number).Float64()
+		return f
+	}
+	return nil
+}
+
+// String returns the compact JSON encoding of the node
+func (n *jsonNode) String() string {
+	var buf strings.Builder
+	n.encode(&buf)
+	return buf.String()
+}
+
+func (n *jsonNode) encode(buf *strings.Builder) {
+	switch n.kind {
+	case '{', '[':
+		buf.WriteByte(n.kind)
+		for i, child := range n.children {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if n.kind == '{' {
+				var key, _ = json.Marshal(child.key)
+				buf.Write(key)
+				buf.WriteByte(':')
+			}
+			child.encode(buf)
+		}
+		buf.WriteByte(n.kind + 2) // '}' and ']' follow their opening delimiters, two code points apart
+	case 0:
+		buf.WriteString("null")
+	default:
+		var b, _ = json.Marshal(n.value)
+		buf.Write(b)
+	}
+}
+
+// isPlainKey reports whether key can appear unquoted in a path
+func isPlainKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
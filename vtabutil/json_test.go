@@ -0,0 +1,114 @@
+//go:build static
+// +build static
+
+package vtabutil_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/sqlitetest"
+	"go.riyazali.net/sqlite/vtabutil"
+)
+
+// Manifest is returned as a pointer by the manifest() sql function
+type Manifest struct {
+	Name string            `json:"name"`
+	Tags []string          `json:"tags"`
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+// ManifestFunc implements manifest(), returning a Go value to pass to go_each
+type ManifestFunc struct{}
+
+func (m *ManifestFunc) Args() int           { return 0 }
+func (m *ManifestFunc) Deterministic() bool { return true }
+func (m *ManifestFunc) Apply(ctx *sqlite.Context, _ ...sqlite.Value) {
+	ctx.ResultPointer(&Manifest{Name: "sqlite", Tags: []string{"db", "embedded"}, Meta: map[string]string{"a b": "c"}})
+}
+
+func init() {
+	sqlite.RegisterNamed("json", func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateModule("go_each", &vtabutil.JSONModule{}, sqlite.EponymousOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		if err := api.CreateModule("go_tree", &vtabutil.JSONModule{Tree: true}, sqlite.EponymousOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		if err := api.CreateFunction("manifest", &ManifestFunc{}); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func TestJSONModule(t *testing.T) {
+	var db = sqlitetest.Open(t, sqlitetest.WithExtensions("json"))
+
+	var tests = []struct {
+		query string
+		want  [][]interface{}
+	}{
+		{
+			query: `SELECT key, value, type, atom, fullkey, path FROM go_each('{"a": 1, "b": [2.5, "x"], "c": null, "d": true}')`,
+			want: [][]interface{}{
+				{"a", int64(1), "integer", int64(1), "$.a", "$"},
+				{"b", `[2.5,"x"]`, "array", nil, "$.b", "$"},
+				{"c", nil, "null", nil, "$.c", "$"},
+				{"d", int64(1), "true", int64(1), "$.d", "$"},
+			},
+		},
+		{
+			query: `SELECT key, value, fullkey FROM go_each('{"a": {"b": [1, 2]}}', '$.a.b')`,
+			want: [][]interface{}{
+				{int64(0), int64(1), "$.a.b[0]"},
+				{int64(1), int64(2), "$.a.b[1]"},
+			},
+		},
+		{
+			query: `SELECT key, type, id, parent, fullkey FROM go_tree('{"a": [1], "b": {}}')`,
+			want: [][]interface{}{
+				{nil, "object", int64(0), nil, "$"},
+				{"a", "array", int64(1), int64(0), "$.a"},
+				{int64(0), "integer", int64(2), int64(1), "$.a[0]"},
+				{"b", "object", int64(3), int64(0), "$.b"},
+			},
+		},
+		{
+			query: `SELECT key, value, fullkey FROM go_tree(manifest()) WHERE type = 'text'`,
+			want: [][]interface{}{
+				{"name", "sqlite", "$.name"},
+				{int64(0), "db", "$.tags[0]"},
+				{int64(1), "embedded", "$.tags[1]"},
+				{"a b", "c", `$.meta."a b"`},
+			},
+		},
+		{
+			query: `SELECT value FROM go_each(manifest()) WHERE key = 'tags'`,
+			want:  [][]interface{}{{`["db","embedded"]`}},
+		},
+		{
+			query: `SELECT COUNT(*) FROM go_each('[1, 2]', '$.missing')`,
+			want:  [][]interface{}{{int64(0)}},
+		},
+	}
+
+	for _, test := range tests {
+		if got := db.QueryRows(test.query); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.query, test.want, got)
+		}
+	}
+
+	var rows, err = db.Query(`SELECT * FROM go_each('{"a":')`)
+	if err == nil {
+		for rows.Next() {
+		}
+		err = rows.Err()
+		_ = rows.Close()
+	}
+	if err == nil || !strings.Contains(err.Error(), "malformed JSON") {
+		t.Errorf("expected malformed JSON to fail the query, got %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package vtabutil
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"go.riyazali.net/sqlite"
+)
+
+// Column sets the result of column i of the current row from row, a struct (or a pointer to one) with a field
+// for every column, so that a cursor's Column method can be written as:
+//
+//	func (c *Cursor) Column(ctx *sqlite.VirtualTableContext, i int) error {
+//		return vtabutil.Column(ctx, c.rows[c.pos], i)
+//	}
+//
+// The columns are the struct's exported fields, in the order they're declared in, including the fields
+// of embedded structs. Fields are mapped to results by their type:
+//
+//   - nil pointers result in NULL; other pointers are dereferenced
+//   - bool results in 1 or 0, integer and float types in an INTEGER and a REAL
+//   - string results in a TEXT and []byte in a BLOB
+//   - time.Time results in a TEXT in RFC 3339 format, which sqlite's date and time functions understand
+//   - driver.Valuer (eg. sql.NullString) results in the value it returns
+//   - maps, slices and other structs result in a TEXT with their JSON encoding
+//
+// The mapping can be adjusted with a `sqlite:"name,options"` tag. The name is used by Schema, and a name
+// of "-" skips the field. The options are:
+//
+//   - json: results in a TEXT with the field's JSON encoding, regardless of its type
+//   - unix, unixmilli: results in an INTEGER with the seconds (or milliseconds) since the unix epoch, for time.Time
+//   - julian: results in a REAL with the julian day number, for time.Time
+func Column(ctx *sqlite.VirtualTableContext, row interface{}, i int) error {
+	var v = reflect.ValueOf(row)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return fmt.Errorf("vtabutil: expected a struct, got %v", row)
+	}
+
+	var fields, err = fieldsOf(v.Type())
+	if err != nil {
+		return err
+	}
+	if i < 0 || i >= len(fields) {
+		return fmt.Errorf("vtabutil: column %d out of range; %s has %d columns", i, v.Type(), len(fields))
+	}
+
+	var field = fields[i]
+	var value, verr = field.value(v.FieldByIndex(field.index))
+	if verr != nil {
+		return fmt.Errorf("vtabutil: failed to convert field %s: %v", field.name, verr)
+	}
+	if t, ok := value.(time.Time); ok { // from a driver.Valuer
+		value = t.Format(time.RFC3339Nano)
+	}
+	return ctx.Result(value)
+}
+
+// Schema returns the CREATE TABLE statement to declare a table whose rows are structs of the same type as v,
+// with the columns Column produces. Columns are named after the field's tag (or else, the field's name),
+// and are declared with the type of the results they hold.
+func Schema(v interface{}) (string, error) {
+	var t = reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var fields, err = fieldsOf(t)
+	if err != nil {
+		return "", err
+	}
+
+	var columns = make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = strings.TrimSpace(quote(field.name) + " " + field.affinity)
+	}
+	return fmt.Sprintf("CREATE TABLE x(%s)", strings.Join(columns, ", ")), nil
+}
+
+// field describes how a struct field maps to a column
+type field struct {
+	name     string
+	index    []int
+	affinity string                                   // declared type of the column
+	value    func(reflect.Value) (interface{}, error) // converts the field to a value accepted by Context.Result
+}
+
+var fieldCache sync.Map // map[reflect.Type][]*field
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// fieldsOf returns the columns of the struct type t, caching them for later calls
+func fieldsOf(t reflect.Type) ([]*field, error) {
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("vtabutil: expected a struct, got %v", t)
+	}
+
+	if fields, ok := fieldCache.Load(t); ok {
+		return fields.([]*field), nil
+	}
+
+	var fields, err = collect(t, nil)
+	if err != nil {
+		return nil, err
+	}
+	fieldCache.Store(t, fields)
+	return fields, nil
+}
+
+func collect(t reflect.Type, index []int) (fields []*field, _ error) {
+	for i := 0; i < t.NumField(); i++ {
+		var sf = t.Field(i)
+		var name, opts = parseTag(sf.Tag.Get("sqlite"))
+		if name == "-" || sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+
+		var idx = append(append([]int(nil), index...), i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && name == "" && len(opts) == 0 && !sf.Type.Implements(valuerType) {
+			var embedded, err = collect(sf.Type, idx)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, embedded...)
+			continue
+		} else if sf.PkgPath != "" {
+			continue // unexported non-struct embedded field
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		var f, err = converter(sf.Type, opts)
+		if err != nil {
+			return nil, fmt.Errorf("vtabutil: field %s: %v", sf.Name, err)
+		}
+		f.name, f.index = name, idx
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// converter returns the field (without name and index) that converts values of type t, as adjusted by opts
+func converter(t reflect.Type, opts map[string]bool) (*field, error) {
+	if opts["json"] {
+		return &field{affinity: "TEXT", value: func(v reflect.Value) (interface{}, error) {
+			var b, err = json.Marshal(v.Interface())
+			return string(b), err
+		}}, nil
+	}
+
+	if t.Implements(valuerType) {
+		return &field{value: func(v reflect.Value) (interface{}, error) {
+			if v.Kind() == reflect.Ptr && v.IsNil() {
+				return nil, nil
+			}
+			return v.Interface().(driver.Valuer).Value()
+		}}, nil
+	}
+
+	if t.Kind() == reflect.Ptr {
+		var elem, err = converter(t.Elem(), opts)
+		if err != nil {
+			return nil, err
+		}
+		return &field{affinity: elem.affinity, value: func(v reflect.Value) (interface{}, error) {
+			if v.IsNil() {
+				return nil, nil
+			}
+			return elem.value(v.Elem())
+		}}, nil
+	}
+
+	if t == timeType {
+		return timeConverter(opts)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &field{affinity: "INTEGER", value: func(v reflect.Value) (interface{}, error) { return v.Bool(), nil }}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &field{affinity: "INTEGER", value: func(v reflect.Value) (interface{}, error) { return v.Int(), nil }}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &field{affinity: "INTEGER", value: func(v reflect.Value) (interface{}, error) { return int64(v.Uint()), nil }}, nil
+	case reflect.Float32, reflect.Float64:
+		return &field{affinity: "REAL", value: func(v reflect.Value) (interface{}, error) { return v.Float(), nil }}, nil
+	case reflect.String:
+		return &field{affinity: "TEXT", value: func(v reflect.Value) (interface{}, error) { return v.String(), nil }}, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &field{affinity: "BLOB", value: func(v reflect.Value) (interface{}, error) {
+				if v.IsNil() {
+					return nil, nil
+				}
+				return v.Bytes(), nil
+			}}, nil
+		}
+		return converter(t, map[string]bool{"json": true})
+	case reflect.Map, reflect.Array, reflect.Struct, reflect.Interface:
+		return converter(t, map[string]bool{"json": true})
+	default:
+		return nil, fmt.Errorf("unsupported type %v", t)
+	}
+}
+
+func timeConverter(opts map[string]bool) (*field, error) {
+	switch {
+	case opts["unix"]:
+		return &field{affinity: "INTEGER", value: func(v reflect.Value) (interface{}, error) {
+			return v.Interface().(time.Time).Unix(), nil
+		}}, nil
+	case opts["unixmilli"]:
+		return &field{affinity: "INTEGER", value: func(v reflect.Value) (interface{}, error) {
+			return v.Interface().(time.Time).UnixNano() / int64(time.Millisecond), nil
+		}}, nil
+	case opts["julian"]:
+		return &field{affinity: "REAL", value: func(v reflect.Value) (interface{}, error) {
+			// julian day number of the unix epoch is 2440587.5
+			return float64(v.Interface().(time.Time).UnixNano())/float64(24*time.Hour) + 2440587.5, nil
+		}}, nil
+	default:
+		return &field{affinity: "TEXT", value: func(v reflect.Value) (interface{}, error) {
+			return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+		}}, nil
+	}
+}
+
+// parseTag splits a `sqlite:"name,options"` tag into the name and the set of options
+func parseTag(tag string) (string, map[string]bool) {
+	var parts = strings.Split(tag, ",")
+	var opts = make(map[string]bool, len(parts)-1)
+	for _, opt := range parts[1:] {
+		opts[strings.TrimSpace(opt)] = true
+	}
+	return strings.TrimSpace(parts[0]), opts
+}
+
+// quote quotes name as an sql identifier
+func quote(name string) string { return `"` + strings.Replace(name, `"`, `""`, -1) + `"` }
@@ -0,0 +1,111 @@
+//go:build static
+// +build static
+
+package vtabutil_test
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.riyazali.net/sqlite"
+	"go.riyazali.net/sqlite/sqlitetest"
+	"go.riyazali.net/sqlite/vtabutil"
+)
+
+type Audit struct {
+	Created time.Time `sqlite:"created_at"`
+	Updated time.Time `sqlite:"updated_at,unix"`
+}
+
+type Release struct {
+	Name     string
+	Major    uint8
+	Stable   bool
+	Score    *float64
+	Notes    sql.NullString
+	Tags     []string
+	Meta     map[string]int `sqlite:"meta"`
+	Checksum []byte
+	Audit
+	internal string
+	Skipped  string `sqlite:"-"`
+}
+
+// ReleasesModule is a read-only virtual table module whose cursors use vtabutil.Column
+type ReleasesModule struct{ releases []Release }
+
+func (m *ReleasesModule) Connect(_ *sqlite.Conn, _ []string, declare func(string) error) (sqlite.VirtualTable, error) {
+	var schema, err = vtabutil.Schema(Release{})
+	if err != nil {
+		return nil, err
+	}
+	return &ReleasesTable{releases: m.releases}, declare(schema)
+}
+
+type ReleasesTable struct {
+	vtabutil.FullScanTable
+	releases []Release
+}
+
+func (t *ReleasesTable) Open() (sqlite.VirtualCursor, error) { return &ReleasesCursor{table: t}, nil }
+
+type ReleasesCursor struct {
+	table *ReleasesTable
+	pos   int
+}
+
+func (c *ReleasesCursor) Filter(int, string, ...sqlite.Value) error { c.pos = 0; return nil }
+func (c *ReleasesCursor) Next() error                               { c.pos++; return nil }
+func (c *ReleasesCursor) Rowid() (int64, error)                     { return int64(c.pos), nil }
+func (c *ReleasesCursor) Eof() bool                                 { return c.pos >= len(c.table.releases) }
+func (c *ReleasesCursor) Close() error                              { return nil }
+func (c *ReleasesCursor) Column(ctx *sqlite.VirtualTableContext, i int) error {
+	return vtabutil.Column(ctx, &c.table.releases[c.pos], i)
+}
+
+func TestSchema(t *testing.T) {
+	var schema, err = vtabutil.Schema(&Release{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want = `CREATE TABLE x("Name" TEXT, "Major" INTEGER, "Stable" INTEGER, "Score" REAL, "Notes", "Tags" TEXT, ` +
+		`"meta" TEXT, "Checksum" BLOB, "created_at" TEXT, "updated_at" INTEGER)`
+	if schema != want {
+		t.Fatalf("expected %s, got %s", want, schema)
+	}
+
+	if _, err = vtabutil.Schema(42); err == nil {
+		t.Fatal("expected an error for a non-struct value")
+	}
+}
+
+func TestColumn(t *testing.T) {
+	var score = 9.5
+	var at = time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	var module = &ReleasesModule{releases: []Release{
+		{Name: "v1.0.0", Major: 1, Stable: true, Score: &score, Notes: sql.NullString{String: "first", Valid: true},
+			Tags: []string{"lts"}, Meta: map[string]int{"downloads": 10}, Checksum: []byte{0xca, 0xfe},
+			Audit: Audit{Created: at, Updated: at}, internal: "ignored", Skipped: "ignored"},
+		{Name: "v2.0.0-rc1", Major: 2},
+	}}
+
+	sqlite.RegisterNamed("vtabutil-marshal", func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateModule("releases", module, sqlite.EponymousOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+
+	var db = sqlitetest.Open(t, sqlitetest.WithExtensions("vtabutil-marshal"))
+	var got = db.QueryRows("SELECT Name, Major, Stable, Score, Notes, Tags, meta, Checksum, date(created_at), updated_at FROM releases")
+	var want = [][]interface{}{
+		{"v1.0.0", int64(1), int64(1), 9.5, "first", `["lts"]`, `{"downloads":10}`, []byte{0xca, 0xfe}, "2021-03-04", at.Unix()},
+		{"v2.0.0-rc1", int64(2), int64(0), nil, nil, "null", "null", nil, "0001-01-01", time.Time{}.Unix()},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
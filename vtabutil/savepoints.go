@@ -0,0 +1,139 @@
+// Package vtabutil provides building blocks for virtual table modules built with go.riyazali.net/sqlite,
+// implementing the parts most modules would otherwise copy from one another.
+package vtabutil
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrNoTransaction is returned by Savepoints when a change is recorded outside a transaction
+var ErrNoTransaction = errors.New("vtabutil: no transaction in progress")
+
+// Journal receives the changes recorded with Savepoints.Record as transactions are committed or rolled back.
+// Tables that write straight through to their store use Undo to revert them, while tables that buffer
+// their writes use Apply to flush them.
+type Journal interface {
+	// Apply is invoked with the changes made by a transaction, in the order they were recorded, when it commits.
+	Apply(changes []interface{}) error
+
+	// Undo is invoked with the changes being discarded, in the reverse order of how they were recorded,
+	// when a transaction is rolled back or reverted to a savepoint.
+	Undo(changes []interface{}) error
+}
+
+// Savepoints keeps track of the transaction and savepoints a writeable virtual table participates in.
+// It's meant to be embedded in the table, providing the Begin, Commit, Rollback, Savepoint, Release and RollbackTo
+// methods of sqlite.Savepointer. Register the module with sqlite.Savepoints(true) for sqlite to invoke them.
+//
+// The table calls Record with every change it makes, and Savepoints hands them to the Journal in batches,
+// following sqlite's nesting rules: rolling back to savepoint n undoes the changes recorded since Savepoint(n),
+// releasing a savepoint merges its changes into the enclosing one, and commit applies everything.
+//
+// Savepoints is not safe for concurrent use; sqlite serializes calls on a table through its connection.
+type Savepoints struct {
+	Journal Journal // receives the changes; must be set before the table is used
+
+	active     bool
+	changes    []interface{}
+	savepoints []savepoint // open savepoints, ordered by their identifier
+}
+
+// savepoint records the number of changes made before a savepoint was opened
+type savepoint struct{ id, mark int }
+
+// Begin starts a new transaction, discarding the bookkeeping of any earlier one
+func (s *Savepoints) Begin() error {
+	s.reset()
+	s.active = true
+	return nil
+}
+
+// Commit hands the changes made in the transaction to the Journal's Apply and ends the transaction
+func (s *Savepoints) Commit() error {
+	var changes = s.changes
+	s.reset()
+	if len(changes) == 0 {
+		return nil
+	}
+	return s.Journal.Apply(changes)
+}
+
+// Rollback hands the changes made in the transaction to the Journal's Undo and ends the transaction
+func (s *Savepoints) Rollback() error {
+	var changes = s.changes
+	s.reset()
+	return s.undo(changes)
+}
+
+// Savepoint opens savepoint n at the current position of the transaction
+func (s *Savepoints) Savepoint(n int) error {
+	s.drop(n) // a savepoint re-opened with the same identifier replaces the earlier one
+	s.savepoints = append(s.savepoints, savepoint{id: n, mark: len(s.changes)})
+	return nil
+}
+
+// Release closes savepoint n and all the ones opened after it; their changes become part of the enclosing savepoint
+func (s *Savepoints) Release(n int) error {
+	s.drop(n)
+	return nil
+}
+
+// RollbackTo hands the changes made since savepoint n was opened to the Journal's Undo, and closes the savepoints
+// opened after it. Savepoint n itself remains open.
+func (s *Savepoints) RollbackTo(n int) error {
+	// sqlite only invokes Savepoint while the table is part of the transaction, so n might predate the table
+	// joining it. Its state then is the one it had at the first savepoint it saw.
+	var mark = len(s.changes)
+	if i := s.search(n); i < len(s.savepoints) {
+		mark = s.savepoints[i].mark
+	}
+	s.drop(n + 1)
+
+	var changes = s.changes[mark:]
+	s.changes = s.changes[:mark:mark] // later changes must not overwrite the ones handed to Undo
+	return s.undo(changes)
+}
+
+// Record records a change made by the table in the current transaction
+func (s *Savepoints) Record(change interface{}) error {
+	if !s.active {
+		return ErrNoTransaction
+	}
+	s.changes = append(s.changes, change)
+	return nil
+}
+
+// InTransaction reports whether a transaction is in progress
+func (s *Savepoints) InTransaction() bool { return s.active }
+
+// Depth returns the number of open savepoints
+func (s *Savepoints) Depth() int { return len(s.savepoints) }
+
+// Pending returns the number of changes recorded in the current transaction
+func (s *Savepoints) Pending() int { return len(s.changes) }
+
+// undo hands changes to the Journal in reverse order
+func (s *Savepoints) undo(changes []interface{}) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	var reversed = make([]interface{}, len(changes))
+	for i, change := range changes {
+		reversed[len(changes)-1-i] = change
+	}
+	return s.Journal.Undo(reversed)
+}
+
+// search returns the index of the first open savepoint with an identifier of n or greater
+func (s *Savepoints) search(n int) int {
+	return sort.Search(len(s.savepoints), func(i int) bool { return s.savepoints[i].id >= n })
+}
+
+// drop closes the savepoints with identifiers of n or greater
+func (s *Savepoints) drop(n int) { s.savepoints = s.savepoints[:s.search(n)] }
+
+func (s *Savepoints) reset() {
+	s.active, s.changes, s.savepoints = false, nil, nil
+}
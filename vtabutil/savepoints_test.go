@@ -0,0 +1,92 @@
+package vtabutil_test
+
+import (
+	"reflect"
+	"testing"
+
+	"go.riyazali.net/sqlite/vtabutil"
+)
+
+// journal records the batches handed to it
+type journal struct{ applied, undone [][]interface{} }
+
+func (j *journal) Apply(changes []interface{}) error {
+	j.applied = append(j.applied, changes)
+	return nil
+}
+func (j *journal) Undo(changes []interface{}) error { j.undone = append(j.undone, changes); return nil }
+
+func TestSavepoints(t *testing.T) {
+	var j = &journal{}
+	var s = &vtabutil.Savepoints{Journal: j}
+
+	if err := s.Record(0); err != vtabutil.ErrNoTransaction {
+		t.Fatalf("expected ErrNoTransaction outside a transaction, got %v", err)
+	}
+
+	_ = s.Begin()
+	_ = s.Record(1)
+	_ = s.Savepoint(0)
+	_ = s.Record(2)
+	_ = s.Savepoint(1)
+	_ = s.Record(3)
+	_ = s.Record(4)
+
+	if s.Depth() != 2 || s.Pending() != 4 {
+		t.Fatalf("expected 2 savepoints and 4 changes, got %d and %d", s.Depth(), s.Pending())
+	}
+
+	// rolling back to 1 undoes 3 and 4, newest first, and keeps savepoint 1 open
+	_ = s.RollbackTo(1)
+	if want := [][]interface{}{{4, 3}}; !reflect.DeepEqual(j.undone, want) {
+		t.Fatalf("expected undone changes %v, got %v", want, j.undone)
+	}
+	if s.Depth() != 2 {
+		t.Fatalf("expected savepoint to remain open after rolling back to it, got depth %d", s.Depth())
+	}
+
+	_ = s.Record(5)
+	_ = s.Release(1) // 5 becomes part of savepoint 0
+	_ = s.Savepoint(1)
+	_ = s.Record(6)
+
+	// rolling back to 0 undoes everything since it was opened, across released and open savepoints
+	_ = s.RollbackTo(0)
+	if want := []interface{}{6, 5, 2}; !reflect.DeepEqual(j.undone[1], want) {
+		t.Fatalf("expected undone changes %v, got %v", want, j.undone[1])
+	}
+	if s.Depth() != 1 {
+		t.Fatalf("expected only savepoint 0 to remain open, got depth %d", s.Depth())
+	}
+
+	_ = s.Record(7)
+	if err := s.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]interface{}{{1, 7}}; !reflect.DeepEqual(j.applied, want) {
+		t.Fatalf("expected applied changes %v, got %v", want, j.applied)
+	}
+	if s.InTransaction() || s.Depth() != 0 || s.Pending() != 0 {
+		t.Fatal("expected commit to end the transaction")
+	}
+}
+
+func TestSavepoints_Rollback(t *testing.T) {
+	var j = &journal{}
+	var s = &vtabutil.Savepoints{Journal: j}
+
+	_ = s.Begin()
+	_ = s.Savepoint(2) // the table joined the transaction with savepoints 0 and 1 already open
+	_ = s.Record(1)
+
+	_ = s.RollbackTo(0) // predates the table, so reverts to when it joined
+	_ = s.Record(2)
+	_ = s.Rollback()
+
+	if want := [][]interface{}{{1}, {2}}; !reflect.DeepEqual(j.undone, want) {
+		t.Fatalf("expected undone changes %v, got %v", want, j.undone)
+	}
+	if len(j.applied) != 0 {
+		t.Fatalf("expected no changes to be applied, got %v", j.applied)
+	}
+}
@@ -0,0 +1,266 @@
+package vtabutil
+
+import (
+	"strconv"
+	"strings"
+
+	"go.riyazali.net/sqlite"
+)
+
+// Query is a piece of SQL along with the arguments bound to its ? placeholders, in order.
+// It can be passed to sqlite.Conn.Exec as-is:
+//
+//	var q = vtabutil.Select(vtabutil.Shadow(schema, table, "data"), "k", "v").Where("k = ?", key).Build()
+//	err = conn.Exec(q.SQL, fn, q.Args...)
+type Query struct {
+	SQL  string
+	Args []interface{}
+}
+
+// Shadow returns the quoted, schema-qualified name of the shadow table of a virtual table,
+// named after the table with the given suffix, eg. "main"."docs_data" for the table docs and the suffix data.
+func Shadow(schema, table, suffix string) string {
+	return Table(schema, table+"_"+suffix)
+}
+
+// Table returns the quoted name of the table, qualified with the schema unless it's empty
+func Table(schema, table string) string {
+	if schema == "" {
+		return sqlite.QuoteIdentifier(table)
+	}
+	return sqlite.QuoteIdentifier(schema) + "." + sqlite.QuoteIdentifier(table)
+}
+
+// quoted returns a comma-separated list of the quoted column names
+func quoted(cols []string) string {
+	var names = make([]string, len(cols))
+	for i, col := range cols {
+		names[i] = sqlite.QuoteIdentifier(col)
+	}
+	return strings.Join(names, ", ")
+}
+
+// placeholders returns a parenthesized list of n placeholders
+func placeholders(n int) string {
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", n), ", ") + ")"
+}
+
+// where is the WHERE clause shared by the builders; its conditions are joined with AND
+type where struct {
+	conds []string
+	args  []interface{}
+}
+
+func (w *where) add(cond string, args []interface{}) {
+	w.conds = append(w.conds, "("+cond+")")
+	w.args = append(w.args, args...)
+}
+
+func (w *where) write(sql *strings.Builder, args *[]interface{}) {
+	if len(w.conds) > 0 {
+		sql.WriteString(" WHERE ")
+		sql.WriteString(strings.Join(w.conds, " AND "))
+		*args = append(*args, w.args...)
+	}
+}
+
+// SelectBuilder builds a SELECT query; see Select
+type SelectBuilder struct {
+	table   string
+	cols    []string
+	where   where
+	orderBy []string
+	limit   int
+}
+
+// Select starts a query selecting the given columns (or all columns, if there are none) from table.
+// The table name is used as-is, so that it can be qualified; use Table or Shadow to quote it.
+func Select(table string, cols ...string) *SelectBuilder {
+	return &SelectBuilder{table: table, cols: cols, limit: -1}
+}
+
+// Where adds a condition to the query, with args bound to its placeholders. Conditions are joined with AND.
+func (b *SelectBuilder) Where(cond string, args ...interface{}) *SelectBuilder {
+	b.where.add(cond, args)
+	return b
+}
+
+// OrderBy sorts the result by the column, in ascending order unless desc is set
+func (b *SelectBuilder) OrderBy(col string, desc bool) *SelectBuilder {
+	var term = sqlite.QuoteIdentifier(col)
+	if desc {
+		term += " DESC"
+	}
+	b.orderBy = append(b.orderBy, term)
+	return b
+}
+
+// Limit limits the number of rows returned by the query
+func (b *SelectBuilder) Limit(n int) *SelectBuilder {
+	b.limit = n
+	return b
+}
+
+// Build returns the query
+func (b *SelectBuilder) Build() Query {
+	var sql strings.Builder
+	var args []interface{}
+
+	sql.WriteString("SELECT ")
+	if len(b.cols) == 0 {
+		sql.WriteString("*")
+	} else {
+		sql.WriteString(quoted(b.cols))
+	}
+	sql.WriteString(" FROM ")
+	sql.WriteString(b.table)
+	b.where.write(&sql, &args)
+
+	if len(b.orderBy) > 0 {
+		sql.WriteString(" ORDER BY ")
+		sql.WriteString(strings.Join(b.orderBy, ", "))
+	}
+	if b.limit >= 0 {
+		sql.WriteString(" LIMIT ")
+		sql.WriteString(strconv.Itoa(b.limit))
+	}
+	return Query{SQL: sql.String(), Args: args}
+}
+
+// InsertBuilder builds an INSERT query; see Insert
+type InsertBuilder struct {
+	table    string
+	cols     []string
+	rows     int
+	args     []interface{}
+	conflict string
+}
+
+// Insert starts a query inserting into the given columns of table.
+// The table name is used as-is, so that it can be qualified; use Table or Shadow to quote it.
+func Insert(table string, cols ...string) *InsertBuilder {
+	return &InsertBuilder{table: table, cols: cols}
+}
+
+// Values adds a row to the query, with one value per column
+func (b *InsertBuilder) Values(values ...interface{}) *InsertBuilder {
+	b.rows++
+	b.args = append(b.args, values...)
+	return b
+}
+
+// OrReplace turns the query into an INSERT OR REPLACE, which replaces the rows it conflicts with
+func (b *InsertBuilder) OrReplace() *InsertBuilder {
+	b.conflict = " OR REPLACE"
+	return b
+}
+
+// Build returns the query. A query with no rows added with Values has a single row of placeholders,
+// so that it can be prepared once and bound with every row.
+func (b *InsertBuilder) Build() Query {
+	var sql strings.Builder
+	sql.WriteString("INSERT")
+	sql.WriteString(b.conflict)
+	sql.WriteString(" INTO ")
+	sql.WriteString(b.table)
+	sql.WriteString(" (")
+	sql.WriteString(quoted(b.cols))
+	sql.WriteString(") VALUES ")
+
+	var rows = b.rows
+	if rows == 0 {
+		rows = 1
+	}
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			sql.WriteString(", ")
+		}
+		sql.WriteString(placeholders(len(b.cols)))
+	}
+	return Query{SQL: sql.String(), Args: b.args}
+}
+
+// UpdateBuilder builds an UPDATE query; see Update
+type UpdateBuilder struct {
+	table string
+	cols  []string
+	args  []interface{}
+	where where
+}
+
+// Update starts a query updating table.
+// The table name is used as-is, so that it can be qualified; use Table or Shadow to quote it.
+func Update(table string) *UpdateBuilder { return &UpdateBuilder{table: table} }
+
+// Set sets the column to the value
+func (b *UpdateBuilder) Set(col string, value interface{}) *UpdateBuilder {
+	b.cols = append(b.cols, col)
+	b.args = append(b.args, value)
+	return b
+}
+
+// Where adds a condition to the query, with args bound to its placeholders. Conditions are joined with AND.
+func (b *UpdateBuilder) Where(cond string, args ...interface{}) *UpdateBuilder {
+	b.where.add(cond, args)
+	return b
+}
+
+// Build returns the query
+func (b *UpdateBuilder) Build() Query {
+	var sql strings.Builder
+	var args = append([]interface{}(nil), b.args...)
+
+	sql.WriteString("UPDATE ")
+	sql.WriteString(b.table)
+	sql.WriteString(" SET ")
+	for i, col := range b.cols {
+		if i > 0 {
+			sql.WriteString(", ")
+		}
+		sql.WriteString(sqlite.QuoteIdentifier(col))
+		sql.WriteString(" = ?")
+	}
+	b.where.write(&sql, &args)
+	return Query{SQL: sql.String(), Args: args}
+}
+
+// DeleteBuilder builds a DELETE query; see Delete
+type DeleteBuilder struct {
+	table string
+	where where
+}
+
+// Delete starts a query deleting from table.
+// The table name is used as-is, so that it can be qualified; use Table or Shadow to quote it.
+func Delete(table string) *DeleteBuilder { return &DeleteBuilder{table: table} }
+
+// Where adds a condition to the query, with args bound to its placeholders. Conditions are joined with AND.
+func (b *DeleteBuilder) Where(cond string, args ...interface{}) *DeleteBuilder {
+	b.where.add(cond, args)
+	return b
+}
+
+// Build returns the query
+func (b *DeleteBuilder) Build() Query {
+	var sql strings.Builder
+	var args []interface{}
+
+	sql.WriteString("DELETE FROM ")
+	sql.WriteString(b.table)
+	b.where.write(&sql, &args)
+	return Query{SQL: sql.String(), Args: args}
+}
+
+// Eq returns a condition comparing the column with a placeholder, to be passed to Where along with the value:
+//
+//	Select(table).Where(vtabutil.Eq("key"), key)
+func Eq(col string) string { return sqlite.QuoteIdentifier(col) + " = ?" }
+
+// In returns a condition matching the column against a list of n placeholders, to be passed to Where
+// along with n values. A list of no values matches no rows.
+func In(col string, n int) string {
+	if n == 0 {
+		return "0"
+	}
+	return sqlite.QuoteIdentifier(col) + " IN " + placeholders(n)
+}
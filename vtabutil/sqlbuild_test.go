@@ -0,0 +1,57 @@
+package vtabutil_test
+
+import (
+	"reflect"
+	"testing"
+
+	"go.riyazali.net/sqlite/vtabutil"
+)
+
+func TestSQLBuilders(t *testing.T) {
+	var data = vtabutil.Shadow("main", `do"cs`, "data")
+
+	var tests = []struct {
+		query vtabutil.Query
+		sql   string
+		args  []interface{}
+	}{
+		{
+			query: vtabutil.Select(data, "k", "v").Where(vtabutil.Eq("k"), 1).
+				Where(vtabutil.In("v", 2), "a", "b").OrderBy("k", true).Limit(10).Build(),
+			sql:  `SELECT "k", "v" FROM "main"."do""cs_data" WHERE ("k" = ?) AND ("v" IN (?, ?)) ORDER BY "k" DESC LIMIT 10`,
+			args: []interface{}{1, "a", "b"},
+		},
+		{
+			query: vtabutil.Select(vtabutil.Table("", "t")).Where(vtabutil.In("k", 0)).Build(),
+			sql:   `SELECT * FROM "t" WHERE (0)`,
+		},
+		{
+			query: vtabutil.Insert(data, "k", "v").Build(),
+			sql:   `INSERT INTO "main"."do""cs_data" ("k", "v") VALUES (?, ?)`,
+		},
+		{
+			query: vtabutil.Insert(data, "k", "v").OrReplace().Values(1, "a").Values(2, "b").Build(),
+			sql:   `INSERT OR REPLACE INTO "main"."do""cs_data" ("k", "v") VALUES (?, ?), (?, ?)`,
+			args:  []interface{}{1, "a", 2, "b"},
+		},
+		{
+			query: vtabutil.Update(data).Set("v", "c").Set("n", nil).Where("k > ?", 3).Build(),
+			sql:   `UPDATE "main"."do""cs_data" SET "v" = ?, "n" = ? WHERE (k > ?)`,
+			args:  []interface{}{"c", nil, 3},
+		},
+		{
+			query: vtabutil.Delete(data).Where(vtabutil.Eq("k"), 4).Build(),
+			sql:   `DELETE FROM "main"."do""cs_data" WHERE ("k" = ?)`,
+			args:  []interface{}{4},
+		},
+	}
+
+	for _, test := range tests {
+		if test.query.SQL != test.sql {
+			t.Errorf("expected %s got %s", test.sql, test.query.SQL)
+		}
+		if !reflect.DeepEqual(test.query.Args, test.args) {
+			t.Errorf("expected args %v got %v for %s", test.args, test.query.Args, test.sql)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+//go:build cgo
+// +build cgo
+
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Watch polls the connection, every interval, for changes made to the main database by other connections
+// (in the same or another process) and delivers a notification on the returned channel for every change it notices,
+// which gives cache-style extensions a simple way of invalidating what they keep around.
+//
+// Changes are detected through PRAGMA data_version, which sqlite bumps whenever another connection commits,
+// and through the modification time of the database file (and its write-ahead log), which catches changes
+// that data_version only reports once the connection reads the database again. The modification times don't
+// tell which connection made the change, and so, changes committed through the connection itself are reported too.
+// Notifications are coalesced: the channel holds at most one pending notification, no matter how many changes
+// happened since it was last received.
+//
+// The channel is closed when ctx is done or when polling fails. The connection is handed over to a separate
+// goroutine until then (see Conn.Disown), and so, it should be one dedicated to watching rather than one that's
+// used for other queries; with ownership checks enabled, using it elsewhere in the meantime panics.
+// The interval must be positive.
+// see: https://www.sqlite.org/pragma.html#pragma_data_version
+func (conn *Conn) Watch(ctx context.Context, interval time.Duration) (<-chan struct{}, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("sqlite: non-positive interval %v for Watch", interval)
+	}
+
+	var w = &watcher{conn: conn}
+	if f, ok := conn.Filename("main"); ok {
+		w.path = f.String()
+	}
+
+	if _, err := w.poll(); err != nil {
+		return nil, err
+	}
+
+	var ch = make(chan struct{}, 1)
+	conn.Disown() // hand the connection over to the watching goroutine
+	go func() {
+		defer close(ch)
+		defer conn.Disown() // and back, once it's done
+
+		var ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if changed, err := w.poll(); err != nil {
+				return
+			} else if changed {
+				select {
+				case ch <- struct{}{}:
+				default: // a notification is already pending
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// watcher keeps the state observed by the last poll of a Conn.Watch
+type watcher struct {
+	conn    *Conn
+	path    string // empty for in-memory and temporary databases
+	version int64
+	mtime   time.Time
+	walTime time.Time
+}
+
+// poll reports whether the database changed since the last poll
+func (w *watcher) poll() (changed bool, err error) {
+	var version int64
+	if version, err = ResultInt64(w.conn, "PRAGMA data_version"); err != nil {
+		return false, err
+	}
+
+	var mtime, walTime time.Time
+	if w.path != "" {
+		mtime, walTime = modTime(w.path), modTime(w.path+"-wal")
+	}
+
+	changed = version != w.version || !mtime.Equal(w.mtime) || !walTime.Equal(w.walTime)
+	w.version, w.mtime, w.walTime = version, mtime, walTime
+	return changed, nil
+}
+
+// modTime returns the modification time of the file at path, or the zero time if there's no such file
+func modTime(path string) time.Time {
+	if info, err := os.Stat(path); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
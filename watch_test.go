@@ -0,0 +1,81 @@
+package sqlite_test
+
+import (
+	"context"
+	. "go.riyazali.net/sqlite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	bootstrap(t)
+
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var path = filepath.Join(dir, "test.db")
+	writer, err := Open(path, DefaultOpenFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	// polls briefly lock the database, which the writer may run into
+	if err = writer.Exec("PRAGMA busy_timeout = 5000", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = writer.Exec("CREATE TABLE t (a)", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	watcher, err := Open(path, DefaultOpenFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	if _, err = watcher.Watch(context.Background(), 0); err == nil {
+		t.Fatal("expected an error with a non-positive interval")
+	}
+
+	// the connection is handed over to the watching goroutine, and back once it's done
+	SetOwnershipChecks(true)
+	defer SetOwnershipChecks(false)
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	changes, err := watcher.Watch(ctx, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-changes:
+		t.Fatal("unexpected notification before any change")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err = writer.Exec("INSERT INTO t VALUES (1)", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a notification after a change by another connection")
+	}
+
+	// the channel is closed once the context is done, after which the connection is free to use again
+	cancel()
+	for range changes {
+	}
+	if err = watcher.Exec("SELECT 1", nil); err != nil {
+		t.Fatal(err)
+	}
+}